@@ -15,31 +15,282 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/client"
 	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/tracing"
+	"opendev.org/airship/armada-go/pkg/transcript"
+	"opendev.org/airship/armada-go/pkg/util"
 )
 
 // NewApplyCommand creates a command to apply armada manifests
 func NewApplyCommand(cfgFactory config.Factory) *cobra.Command {
 	p := &apply.RunCommand{Factory: cfgFactory}
+	var transcriptPath, profile string
+	var targets, chartTimeouts, clusters []string
+	var remote remoteOptions
 
 	runCmd := &cobra.Command{
-		Use:   "apply",
+		Use:   "apply MANIFESTS",
 		Short: "armada-go command to apply manifests",
-		Args:  cobra.ExactArgs(1),
+		Long: `Applies MANIFESTS, a file, a directory of YAML files, a file:// URL of either,
+- for stdin, an http(s) URL or a deckhand+http(s) URL of rendered documents.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			p.Manifests = args[0]
 			p.Out = cmd.OutOrStdout()
+			shutdown, err := tracing.Init(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := shutdown(context.Background()); err != nil {
+					log.Printf("unable to flush traces: %s", err.Error())
+				}
+			}()
+			cfg, err := cfgFactory()
+			if err != nil {
+				return err
+			}
+			p.Config = cfg
+			if remote.URL != "" {
+				if err := checkRemoteFlags(cmd); err != nil {
+					return err
+				}
+			}
+			if len(chartTimeouts) > 0 {
+				if p.ChartTimeouts, err = util.ParseDurations(chartTimeouts); err != nil {
+					return fmt.Errorf("--chart-timeout: %w", err)
+				}
+			}
+			if len(clusters) > 0 {
+				if p.Clusters, err = util.ParsePairs(clusters); err != nil {
+					return fmt.Errorf("--cluster: %w", err)
+				}
+			}
+			// --kubeconfig and --kube-context take precedence over the profile
+			if cmd.Flags().Changed("kubeconfig") {
+				p.Kubeconfig = cfg.Kubernetes.Kubeconfig
+			}
+			if cmd.Flags().Changed("kube-context") {
+				p.Context = cfg.Kubernetes.Context
+			}
+			if profile != "" {
+				prof, err := cfg.Profile(profile)
+				if err != nil {
+					return err
+				}
+				if remote.URL != "" {
+					if err := checkRemoteProfile(prof); err != nil {
+						return err
+					}
+				}
+				applyProfile(cmd, p, prof)
+				if transcriptPath == "" {
+					transcriptPath = prof.Transcript
+				}
+			}
+			if remote.URL != "" {
+				return applyRemote(cmd, &remote, p, targets)
+			}
+			if transcriptPath != "" {
+				t, err := transcript.Create(transcriptPath)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					if err := t.Close(); err != nil {
+						log.Printf("unable to close transcript: %s", err.Error())
+					}
+				}()
+				p.Transcript = t
+			}
+			if stages := apply.ParseStages(targets); len(stages) > 1 || (len(stages) == 1 && len(stages[0]) > 1) {
+				multi := &apply.MultiRunCommand{Template: p, Stages: stages, Out: cmd.OutOrStdout()}
+				return multi.RunE()
+			} else if len(stages) == 1 {
+				p.TargetManifest = stages[0][0]
+			}
 			return p.RunE()
 		},
 	}
 
 	var metricsOutput string
 	flags := runCmd.Flags()
-	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringArrayVar(&targets, "target-manifest", nil,
+		"target manifest, repeat to apply several manifests one after another, "+
+			"comma separated manifests are applied in parallel, e.g. --target-manifest infra --target-manifest tenant-a,tenant-b")
 	flags.StringVar(&metricsOutput, "metrics-output", "", "metrics output")
+	remote.addFlags(flags)
+	flags.StringVar(&transcriptPath, "transcript", "", "write a JSONL transcript of the apply to the file")
+	flags.StringVar(&p.DistributeNamespace, "distribute-namespace", "",
+		"hand chart groups over to armada workers watching this namespace, groups run at once unless "+
+			"charts of one depend on charts of another")
+	flags.StringVar(&profile, "profile", "",
+		"apply defaults from the [profile.<name>] section of the config, flags take precedence")
+	flags.IntVar(&p.MaxParallel, "max-parallel", 0, "maximum charts installed at once in parallel chart groups")
+	flags.Var(util.NewDurationValue(&p.WaitTimeout), "wait-timeout",
+		"wait timeout for charts without data.wait.timeout, seconds or a duration such as 30m")
+	flags.StringArrayVar(&chartTimeouts, "chart-timeout", nil,
+		"wait timeout of a chart by chart or release name, e.g. keystone=30m, replaces data.wait.timeout, can be repeated")
+	flags.Var(util.NewDurationValue(&p.Timeout), "timeout",
+		"limit for the whole apply, charts still installing are cancelled when it expires")
+	flags.StringArrayVar(&clusters, "cluster", nil,
+		"kubeconfig context of the cluster a chart group is applied to, e.g. workload=target-cluster, "+
+			"replaces data.cluster of the group, can be repeated")
+	flags.StringVar(&p.Context, "context", "", "kubeconfig context to use")
+	_ = flags.MarkDeprecated("context", "use --kube-context instead")
+	flags.BoolVar(&p.Prune, "prune", false, "delete ArmadaCharts of previous applies which are not in the manifest")
+	flags.StringVar(&p.ReleasePrefix, "release-prefix", "",
+		"prefix of the ArmadaChart names replacing release_prefix of the manifest")
+	flags.BoolVar(&p.NoReleasePrefix, "no-release-prefix", false,
+		"name ArmadaCharts after the releases of their charts without prefix, e.g. to manage existing releases")
+	runCmd.MarkFlagsMutuallyExclusive("release-prefix", "no-release-prefix")
+	flags.BoolVar(&p.Adopt, "adopt", false,
+		"take over ArmadaCharts and Helm releases of the charts not created by armada-go instead of failing "+
+			"or duplicating them, the adopted objects are reported")
+	flags.BoolVar(&p.DryRun, "dry-run", false,
+		"print the changes the apply would make, with --prune also what would be deleted")
+	flags.StringVar(&p.CRDPath, "crd-path", "", "ArmadaChart CRD to create or upgrade to instead of the embedded one")
+	flags.StringVar(&p.Backend, "backend", "",
+		"how charts are installed: operator creates ArmadaCharts, helm installs releases without armada-operator "+
+			"(default operator)")
+	flags.BoolVar(&p.ForceReconcile, "force-reconcile", false,
+		"overwrite ArmadaCharts edited on the cluster since the last apply, they are only reported otherwise")
+	flags.BoolVar(&p.Preflight, "preflight", false,
+		"check the cluster version, the CRD, permissions and nodes first, failed checks abort the apply")
+	flags.BoolVar(&p.NoCreateNamespaces, "no-create-namespaces", false,
+		"fail if a namespace of a chart doesn't exist instead of creating it")
+	flags.BoolVar(&p.NoLock, "no-lock", false,
+		"apply without taking the lock which keeps other applies of the manifest from running at the same time")
+	flags.Var(util.NewDurationValue(&p.LockWait), "lock-wait",
+		"how long to wait for another apply of the manifest to finish, fails right away by default")
+	flags.BoolVar(&p.SkipTests, "skip-tests", false, "don't run the Helm tests of charts with data.test.enabled")
+	flags.BoolVar(&p.Atomic, "atomic", false,
+		"restore the previous spec of charts whose update doesn't become ready, data.atomic of a chart overrides it")
+	flags.BoolVar(&p.WaitForOperator, "wait-for-operator", false,
+		"wait for the armada-operator deployment to be available before creating ArmadaCharts")
+	flags.StringVar(&p.OperatorNamespace, "operator-namespace", "",
+		"namespace of the armada-operator deployment, all namespaces are searched by default")
+	flags.StringVar(&p.OperatorDeployment, "operator-deployment", "",
+		"name of the armada-operator deployment (default \"armada-operator\")")
+	flags.Var(util.NewDurationValue(&p.OperatorWaitTimeout), "operator-wait-timeout",
+		"how long to wait for armada-operator, seconds or a duration (default 5m)")
+	flags.StringArrayVar(&p.SkipCharts, "skip-chart", nil,
+		"leave the chart, by chart or release name, out of the apply, can be repeated")
+	flags.StringArrayVar(&p.SkipChartGroups, "skip-chart-group", nil,
+		"leave the chart group out of the apply, can be repeated")
+	flags.StringArrayVar(&p.CanaryGroups, "canary-group", nil,
+		"install the first chart of the chart group and continue with the others once it is ready, can be repeated")
+	flags.BoolVar(&p.Resume, "resume", false,
+		"skip charts the interrupted apply of the target manifest finished, unless they changed since")
+	flags.BoolVar(&p.PrintPlan, "print-plan", false,
+		"print the chart groups and the waves their charts would be installed in, without applying")
+	flags.StringVar(&p.ManifestKey, "manifest-key", "",
+		"PEM public key the manifests have to be signed with, the signature is read from <manifests>.sig")
+	flags.StringVar(&p.SiteStatusNamespace, "site-status-namespace", "",
+		"namespace of the armada-site-status ConfigMap, the namespace armada-go runs in by default")
 
 	return runCmd
 }
+
+// remoteApplyFlags are the apply flags the API of the --remote server
+// carries, it would ignore the others
+var remoteApplyFlags = []string{"remote", "remote-token", "profile", "target-manifest", "skip-chart",
+	"skip-chart-group", "canary-group", "resume", "atomic", "force-reconcile"}
+
+// checkRemoteFlags refuses flags --remote can't honor, e.g. a --dry-run
+// would be a real apply on the server
+func checkRemoteFlags(cmd *cobra.Command) error {
+	var ignored []string
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed && !slices.Contains(remoteApplyFlags, f.Name) {
+			ignored = append(ignored, "--"+f.Name)
+		}
+	})
+	if len(ignored) > 0 {
+		return fmt.Errorf("%s can't be sent to the --remote server", strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+// checkRemoteProfile refuses profiles with settings --remote can't honor,
+// only the target manifest is sent to the server
+func checkRemoteProfile(prof *config.Profile) error {
+	var ignored []string
+	for setting, set := range map[string]bool{
+		"transcript":           prof.Transcript != "",
+		"distribute_namespace": prof.DistributeNamespace != "",
+		"max_parallel":         prof.MaxParallel != 0,
+		"wait_timeout":         prof.WaitTimeout != 0,
+		"kubeconfig":           prof.Kubeconfig != "",
+		"context":              prof.Context != "",
+		"release_prefix":       prof.ReleasePrefix != "",
+		"prune":                prof.Prune,
+	} {
+		if set {
+			ignored = append(ignored, setting)
+		}
+	}
+	if len(ignored) > 0 {
+		slices.Sort(ignored)
+		return fmt.Errorf("profile %s sets %s, which can't be sent to the --remote server", prof.Name,
+			strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+// applyProfile fills options not set by flags from the profile, an explicit
+// --prune=false takes precedence too
+func applyProfile(cmd *cobra.Command, p *apply.RunCommand, prof *config.Profile) {
+	prune := p.Prune
+	p.ApplyProfile(prof)
+	if cmd.Flags().Changed("prune") {
+		p.Prune = prune
+	}
+}
+
+// applyRemote lets the --remote server apply the manifests, local files,
+// directories and stdin are sent along, URLs the server has to be able to
+// fetch
+func applyRemote(cmd *cobra.Command, remote *remoteOptions, p *apply.RunCommand, targets []string) error {
+	if len(targets) > 1 || strings.Contains(strings.Join(targets, ""), ",") {
+		return fmt.Errorf("--remote applies a single target manifest")
+	}
+	opts := client.ApplyOptions{SkipCharts: p.SkipCharts, SkipChartGroups: p.SkipChartGroups,
+		CanaryGroups: p.CanaryGroups, Resume: p.Resume, Atomic: p.Atomic,
+		ForceReconcile: p.ForceReconcile}
+	opts.TargetManifest = p.TargetManifest
+	if len(targets) == 1 {
+		opts.TargetManifest = targets[0]
+	}
+	src, err := apply.NewDocumentSource(p.Manifests, p.Config.Keystone)
+	if err != nil {
+		return err
+	}
+	var res *client.ApplyResult
+	switch src.(type) {
+	case *apply.HTTPSource, *apply.DeckhandSource:
+		res, err = remote.client(p.Config).Apply(cmd.Context(), p.Manifests, opts)
+	default:
+		f, openErr := src.Open(cmd.Context())
+		if openErr != nil {
+			return openErr
+		}
+		defer f.Close()
+		res, err = remote.client(p.Config).ApplyManifests(cmd.Context(), f, opts)
+	}
+	if err != nil {
+		return remoteError(cmd.OutOrStdout(), err)
+	}
+	return printApplyResult(cmd.OutOrStdout(), res)
+}
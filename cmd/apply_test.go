@@ -0,0 +1,117 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+func TestApplyRemoteFlags(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "site.yaml")
+	if err := os.WriteFile(manifest, []byte("---\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		posts   bool
+	}{
+		{name: "dry run", args: []string{"--dry-run"}, wantErr: true},
+		{name: "print plan", args: []string{"--print-plan"}, wantErr: true},
+		{name: "prune", args: []string{"--prune"}, wantErr: true},
+		{name: "timeout", args: []string{"--timeout", "10m"}, wantErr: true},
+		{name: "carried", args: []string{"--atomic", "--skip-chart", "mariadb"}, posts: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					posts.Add(1)
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer srv.Close()
+
+			cmd := NewApplyCommand(func() (*config.Config, error) { return &config.Config{}, nil })
+			cmd.SetArgs(append([]string{"--remote", srv.URL, manifest}, tt.args...))
+			cmd.SetOut(&nopWriter{})
+			cmd.SetErr(&nopWriter{})
+			err := cmd.Execute()
+			if tt.wantErr && err == nil {
+				t.Errorf("got no error, want one")
+			}
+			if got := posts.Load() > 0; got != tt.posts {
+				t.Errorf("got POST %t, want %t", got, tt.posts)
+			}
+		})
+	}
+}
+
+func TestApplyProfilePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "armada.conf")
+	if err := os.WriteFile(path, []byte("[profile.prod]\nprune = true\n\n[profile.lab]\nmax_parallel = 2\n"),
+		0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.CreateFactory(&path, nil)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		profile string
+		args    []string
+		want    bool
+	}{
+		{profile: "prod", want: true},
+		{profile: "prod", args: []string{"--prune=false"}, want: false},
+		{profile: "lab", want: false},
+		{profile: "lab", args: []string{"--prune"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile+" "+fmt.Sprint(tt.args), func(t *testing.T) {
+			prof, err := cfg.Profile(tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := &apply.RunCommand{}
+			cmd := &cobra.Command{}
+			cmd.Flags().BoolVar(&p.Prune, "prune", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			applyProfile(cmd, p, prof)
+			if p.Prune != tt.want {
+				t.Errorf("got prune %t, want %t", p.Prune, tt.want)
+			}
+		})
+	}
+}
+
+type nopWriter struct{}
+
+func (*nopWriter) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,184 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	armadaschema "opendev.org/airship/armada-go/pkg/schema"
+)
+
+// completedFlags are flags naming documents of the manifest file
+var completedFlags = map[string]armadaschema.Kind{
+	"target-manifest":    armadaschema.KindManifest,
+	"target-chart-group": armadaschema.KindChartGroup,
+	"target-chart":       armadaschema.KindChart,
+	"skip-chart-group":   armadaschema.KindChartGroup,
+	"skip-chart":         armadaschema.KindChart,
+}
+
+// addCompletions registers completion of manifest files and of the
+// documents they contain for cmd and all its subcommands. The manifest is
+// the first argument of commands taking MANIFESTS or the --manifest flag.
+// Shell completion scripts are generated by the completion command cobra
+// adds to the root command.
+func addCompletions(cmd *cobra.Command) {
+	for _, sub := range cmd.Commands() {
+		addCompletions(sub)
+	}
+	if strings.Contains(cmd.Use, "MANIFESTS") && cmd.ValidArgsFunction == nil {
+		cmd.ValidArgsFunction = func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
+		}
+	}
+	if cmd.Flags().Lookup("manifest") != nil {
+		_ = cmd.RegisterFlagCompletionFunc("manifest",
+			func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+				return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
+			})
+	}
+	for flag, kind := range completedFlags {
+		if cmd.Flags().Lookup(flag) != nil {
+			_ = cmd.RegisterFlagCompletionFunc(flag, completeDocuments(kind))
+		}
+	}
+}
+
+// completeDocuments completes names of documents of the kind, charts and
+// chart groups are limited to the ones of --target-manifest if it is set.
+// Comma separated lists are completed after the last comma.
+func completeDocuments(kind armadaschema.Kind) cobra.CompletionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		path := ""
+		if f := cmd.Flags().Lookup("manifest"); f != nil {
+			path = f.Value.String()
+		} else if len(args) > 0 {
+			path = args[0]
+		}
+		docs, err := readDocuments(path)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		target := ""
+		if kind != armadaschema.KindManifest {
+			if f := cmd.Flags().Lookup("target-manifest"); f != nil && f.Changed {
+				target = strings.Trim(f.Value.String(), "[]")
+			}
+		}
+		prefix := ""
+		if i := strings.LastIndex(toComplete, ","); i >= 0 {
+			prefix = toComplete[:i+1]
+		}
+		var names []string
+		for _, name := range docs.names(kind, target) {
+			names = append(names, prefix+name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// documents are the names of the documents of a manifest file
+type documents struct {
+	manifests map[string][]string
+	groups    map[string][]string
+	charts    []string
+}
+
+// names returns documents of the kind, with target set only the ones
+// reachable from the target manifest
+func (d *documents) names(kind armadaschema.Kind, target string) []string {
+	var names []string
+	switch kind {
+	case armadaschema.KindManifest:
+		for name := range d.manifests {
+			names = append(names, name)
+		}
+	case armadaschema.KindChartGroup:
+		if groups, ok := d.manifests[target]; ok {
+			names = append(names, groups...)
+		} else {
+			for name := range d.groups {
+				names = append(names, name)
+			}
+		}
+	case armadaschema.KindChart:
+		if groups, ok := d.manifests[target]; ok {
+			for _, group := range groups {
+				names = append(names, d.groups[group]...)
+			}
+		} else {
+			names = append(names, d.charts...)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readDocuments reads the names of the documents of a local manifest file,
+// remote manifests are not fetched for completion
+func readDocuments(path string) (*documents, error) {
+	if u, err := url.Parse(path); err != nil || u.Scheme != "" || path == "" {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	docs := &documents{manifests: map[string][]string{}, groups: map[string][]string{}}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		buf, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		sch, name, ok, err := armadaschema.Detect(buf)
+		if err != nil || !ok {
+			continue
+		}
+		var doc struct {
+			Data struct {
+				ChartGroups []string `json:"chart_groups"`
+				ChartGroup  []string `json:"chart_group"`
+			} `json:"data"`
+		}
+		if err := yaml.Unmarshal(buf, &doc); err != nil {
+			continue
+		}
+		switch sch.Kind {
+		case armadaschema.KindManifest:
+			docs.manifests[name] = doc.Data.ChartGroups
+		case armadaschema.KindChartGroup:
+			docs.groups[name] = doc.Data.ChartGroup
+		case armadaschema.KindChart:
+			docs.charts = append(docs.charts, name)
+		}
+	}
+}
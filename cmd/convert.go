@@ -0,0 +1,53 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/convert"
+)
+
+// NewConvertCommand creates a command to migrate legacy Armada manifests
+func NewConvertCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &convert.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:   "convert MANIFESTS",
+		Short: "armada-go command to convert manifests written for the Python Armada",
+		Long: `Rewrites the armada/Chart/v1 documents of MANIFESTS, a file or - for stdin, to
+the fields armada-go and armada-operator support: test: true becomes
+test.enabled, the top level timeout moves to wait.timeout, numeric min_ready
+becomes a string and unsupported fields like install.no_hooks or upgrade.post
+are dropped with a warning. Other documents are kept as they
+are. With --output armadachart the converted charts are printed as
+ArmadaChart resources, like the render command does.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.In = cmd.InOrStdin()
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVarP(&p.Format, "output", "o", convert.FormatManifest, "output format, manifest or armadachart")
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest rendered with --output armadachart")
+	flags.BoolVar(&p.Strict, "strict", false, "fail instead of dropping fields which can't be converted")
+
+	return runCmd
+}
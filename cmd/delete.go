@@ -0,0 +1,55 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/teardown"
+	"opendev.org/airship/armada-go/pkg/util"
+)
+
+// NewDeleteCommand creates a command to delete releases of armada manifests
+func NewDeleteCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &teardown.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:   "delete MANIFESTS",
+		Short: "armada-go command to delete the ArmadaCharts of manifests",
+		Long: `Deletes the ArmadaCharts of manifests in reverse chart group order and waits
+for armada-operator to uninstall every chart group before the next one.
+Namespaces and the ArmadaChart CRD are kept unless purging is requested.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.BoolVar(&p.DryRun, "dry-run", false, "only print what would be deleted")
+	flags.BoolVar(&p.PurgeNamespaces, "purge-namespaces", false, "delete namespaces left without ArmadaCharts")
+	flags.BoolVar(&p.PurgeCRD, "purge-crd", false, "delete the ArmadaChart CRD if no ArmadaCharts are left")
+	flags.Var(util.NewDurationValue(&p.Timeout), "timeout",
+		"how long the ArmadaCharts of a chart group may take to be removed by armada-operator (default 10m)")
+	flags.StringVar(&p.Backend, "backend", "",
+		"how the charts were installed: operator deletes the ArmadaCharts, helm uninstalls the releases "+
+			"of apply --backend=helm (default operator)")
+
+	return runCmd
+}
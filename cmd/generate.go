@@ -0,0 +1,61 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/generate"
+)
+
+// NewGenerateCommand creates a command to generate kubernetes manifests
+func NewGenerateCommand() *cobra.Command {
+	generateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "armada-go command to generate kubernetes manifests",
+	}
+	generateCmd.AddCommand(newGenerateJobCommand())
+	return generateCmd
+}
+
+func newGenerateJobCommand() *cobra.Command {
+	p := &generate.JobCommand{}
+
+	runCmd := &cobra.Command{
+		Use:   "job",
+		Short: "armada-go command to generate a Job or CronJob running apply in the cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.Manifests, "manifest", "", "manifests href passed to apply")
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringVar(&p.Profile, "profile", "", "apply profile from the config")
+	flags.StringVar(&p.Schedule, "schedule", "", "cron schedule, generates a CronJob instead of a Job")
+	flags.StringVar(&p.Name, "name", generate.DefaultName, "name of the Job or CronJob")
+	flags.StringVarP(&p.Namespace, "namespace", "n", "", "namespace of the Job or CronJob")
+	flags.StringVar(&p.Image, "image", generate.DefaultImage, "armada-go image")
+	flags.StringVar(&p.PullPolicy, "image-pull-policy", "", "image pull policy")
+	flags.StringVar(&p.ServiceAccount, "service-account", "", "service account the apply runs as")
+	flags.StringVar(&p.ConfigMap, "config-map", "", "config map with armada.conf mounted at /etc/armada")
+	flags.Int32Var(&p.BackoffLimit, "backoff-limit", 0, "number of retries of a failed apply")
+	_ = runCmd.MarkFlagRequired("manifest")
+
+	return runCmd
+}
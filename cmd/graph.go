@@ -0,0 +1,49 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/graph"
+)
+
+// NewGraphCommand creates a command to render armada manifests as a graph
+func NewGraphCommand(_ config.Factory) *cobra.Command {
+	p := &graph.RunCommand{}
+
+	runCmd := &cobra.Command{
+		Use:   "graph MANIFESTS",
+		Short: "armada-go command to render chart groups and charts of manifests as a graph",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringVar(&p.Format, "format", graph.FormatDot, "output format, dot or mermaid")
+	flags.StringVar(&p.ReleasePrefix, "release-prefix", "",
+		"prefix of the ArmadaChart names replacing release_prefix of the manifest")
+	flags.BoolVar(&p.NoReleasePrefix, "no-release-prefix", false,
+		"name ArmadaCharts after the releases of their charts without prefix")
+	runCmd.MarkFlagsMutuallyExclusive("release-prefix", "no-release-prefix")
+
+	return runCmd
+}
@@ -0,0 +1,49 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/history"
+)
+
+// NewHistoryCommand creates a command to show the revisions of a release
+func NewHistoryCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &history.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:   "history RELEASE",
+		Short: "armada-go command to show the Helm revisions of the release of an ArmadaChart",
+		Long: `Lists the revisions of the Helm release managed by the ArmadaChart RELEASE with
+their chart version, status, deploy time and a hash of the values, revisions
+with equal hashes were deployed with the same values. Pass a revision to
+rollback --version to return to it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Release = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVarP(&p.Namespace, "namespace", "n", "", "namespace of the ArmadaChart, searched in all namespaces if empty")
+	flags.IntVar(&p.Max, "max", 0, "show only the newest revisions, all if 0")
+	flags.StringVarP(&p.Format, "output", "o", history.FormatTable, "output format, table or json")
+
+	return runCmd
+}
@@ -0,0 +1,49 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/lint"
+)
+
+// NewLintCommand creates a command to check manifests for common mistakes
+func NewLintCommand() *cobra.Command {
+	p := &lint.RunCommand{}
+
+	runCmd := &cobra.Command{
+		Use:   "lint MANIFESTS",
+		Short: "armada-go command to check manifests for mistakes schema validation doesn't catch",
+		Long: `Checks all documents of MANIFESTS, a file or - for stdin, for duplicate
+documents and releases, references to missing documents, charts and chart
+groups nothing uses, ArmadaChart names colliding or invalid once the release
+prefix is applied, charts without wait timeout and deprecated fields.
+Exits non-zero if errors, or with --strict warnings, were found.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.In = cmd.InOrStdin()
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVarP(&p.Format, "output", "o", lint.FormatText, "output format, text or json")
+	flags.BoolVar(&p.Strict, "strict", false, "fail on warnings too")
+
+	return runCmd
+}
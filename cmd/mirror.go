@@ -0,0 +1,83 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/mirror"
+	"opendev.org/airship/armada-go/pkg/source"
+)
+
+// NewMirrorCommand creates a command to mirror manifest dependencies
+func NewMirrorCommand() *cobra.Command {
+	mirrorCmd := &cobra.Command{
+		Use:   "mirror",
+		Short: "armada-go commands to mirror manifest dependencies for air-gapped sites",
+	}
+	mirrorCmd.AddCommand(newMirrorChartsCommand())
+	return mirrorCmd
+}
+
+func newMirrorChartsCommand() *cobra.Command {
+	p := &mirror.RunCommand{}
+	var output string
+	// git sources are fetched like apply fetches them
+	sources := &source.Resolver{}
+	p.Fetch = func(ctx context.Context, src mirror.Source) (*mirror.Chart, error) {
+		fetched, err := sources.Fetch(ctx, source.Source{Type: src.Type, Location: src.Location,
+			Subpath: src.Subpath, Reference: src.Reference})
+		if err != nil {
+			return nil, err
+		}
+		return fetched.Chart, nil
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "charts MANIFESTS",
+		Short: "push charts of manifests to an OCI registry and print the manifests pointing at it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Output = cmd.OutOrStdout()
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				p.Output = f
+			}
+			if p.Password == "" {
+				p.Password = os.Getenv("ARMADA_MIRROR_PASSWORD")
+			}
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.To, "to", "", "registry to push charts to, oci://registry/path")
+	flags.StringVarP(&output, "output", "o", "", "write the rewritten manifests to the file instead of stdout")
+	flags.StringVar(&p.Username, "username", "", "registry username")
+	flags.StringVar(&p.Password, "password", "", "registry password, defaults to $ARMADA_MIRROR_PASSWORD")
+	flags.BoolVar(&p.PlainHTTP, "plain-http", false, "use plain HTTP to talk to the registry")
+	flags.BoolVar(&p.Insecure, "insecure-skip-tls-verify", false, "skip verification of the registry certificate")
+	_ = runCmd.MarkFlagRequired("to")
+
+	return runCmd
+}
@@ -0,0 +1,75 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/plugin"
+)
+
+// NewPluginCommand creates a command to inspect CLI plugins
+func NewPluginCommand() *cobra.Command {
+	pluginCmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "armada-go command to work with CLI plugins",
+		Long: `Plugins are executables named armada-<name> found on PATH, they are invoked as
+"armada <name>" with the remaining arguments. Dashes in the executable name
+separate subcommands, underscores stand for dashes, e.g. armada-site-check_drift
+is invoked as "armada site check-drift". Built-in commands take precedence.`,
+	}
+
+	pluginCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "armada-go command to list plugins found on PATH",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plugins := plugin.List()
+			if len(plugins) == 0 {
+				return fmt.Errorf("no plugins found on PATH")
+			}
+			root := cmd.Root()
+			for _, p := range plugins {
+				if found, _, err := root.Find([]string{p.Name}); err == nil && found != root {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s (shadowed by built-in command)\n", p.Name, p.Path)
+					continue
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", p.Name, p.Path)
+			}
+			return nil
+		},
+	})
+
+	return pluginCmd
+}
+
+// HandlePluginCommand runs a plugin when args don't name a built-in command,
+// it only returns if no plugin was found or it could not be executed
+func HandlePluginCommand(root *cobra.Command, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == cobra.ShellCompRequestCmd ||
+		args[0] == cobra.ShellCompNoDescRequestCmd {
+		return nil
+	}
+	if found, _, err := root.Find(args); err == nil && found != root {
+		return nil
+	}
+	p, rest, ok := plugin.Lookup(args)
+	if !ok {
+		return nil
+	}
+	return p.Exec(rest)
+}
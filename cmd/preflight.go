@@ -0,0 +1,50 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+// NewPreflightCommand creates a command to check a cluster before applying
+// manifests to it
+func NewPreflightCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &apply.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:   "preflight MANIFESTS",
+		Short: "armada-go command to check that a cluster can take the manifests without changing it",
+		Long: "Checks the Kubernetes version, the armadacharts CRD, the permissions of the current identity, " +
+			"the namespaces of the charts and the nodes, and prints a pass, warn or fail report. " +
+			"It exits non-zero if a check failed.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunPreflight(cmd.Context())
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringVar(&p.Backend, "backend", "", "backend the manifests are applied with, operator or helm")
+	flags.BoolVar(&p.NoCreateNamespaces, "no-create-namespaces", false, "missing namespaces fail the check")
+	flags.StringVar(&p.SiteStatusNamespace, "site-status-namespace", "", "namespace of the armada-site-status ConfigMap")
+
+	return runCmd
+}
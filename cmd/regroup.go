@@ -0,0 +1,49 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/regroup"
+)
+
+// NewRegroupCommand creates a command to suggest a faster chart grouping
+func NewRegroupCommand(_ config.Factory) *cobra.Command {
+	p := &regroup.RunCommand{}
+
+	runCmd := &cobra.Command{
+		Use:   "regroup MANIFESTS",
+		Short: "armada-go command to suggest chart groups which could install in parallel",
+		Long: `Suggests chart group layouts from the chart dependencies declared in the
+manifests and the chart timings recorded in apply transcripts. Charts of a
+sequenced group which don't depend on each other could be installed in
+parallel, the estimated saving is based on the averaged timings.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringArrayVar(&p.Transcripts, "transcript", nil,
+		"apply transcript to take chart timings from, can be repeated to average several applies")
+
+	return runCmd
+}
@@ -0,0 +1,68 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/releases"
+)
+
+// NewReleasesCommand creates a command to inspect deployed releases
+func NewReleasesCommand(cfgFactory config.Factory) *cobra.Command {
+	releasesCmd := &cobra.Command{
+		Use:   "releases",
+		Short: "armada-go command to inspect the releases deployed by ArmadaCharts",
+	}
+	releasesCmd.AddCommand(newReleasesListCommand(cfgFactory))
+	return releasesCmd
+}
+
+func newReleasesListCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &releases.RunCommand{Factory: cfgFactory}
+	var remote remoteOptions
+
+	runCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "list ArmadaCharts with the chart, version, status and last deployment of their Helm release",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Out = cmd.OutOrStdout()
+			if remote.URL != "" {
+				cfg, err := cfgFactory()
+				if err != nil {
+					return err
+				}
+				byNamespace, err := remote.client(cfg).Releases(cmd.Context(), p.Namespace)
+				if err != nil {
+					return err
+				}
+				return printRemoteReleases(p.Out, byNamespace, p.Format)
+			}
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVarP(&p.Namespace, "namespace", "n", "", "namespace, all namespaces if empty")
+	flags.StringVarP(&p.LabelSelector, "selector", "l", "", "label selector of the ArmadaCharts")
+	flags.StringVarP(&p.Format, "output", "o", releases.FormatTable, "output format, table or json")
+	flags.BoolVar(&p.ShowLabels, "show-labels", false, "add the labels of the ArmadaCharts to the table")
+	remote.addFlags(flags)
+
+	return runCmd
+}
@@ -0,0 +1,113 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	"opendev.org/airship/armada-go/pkg/auth"
+	"opendev.org/airship/armada-go/pkg/client"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/releases"
+)
+
+// remoteOptions send a command to an armada-go server instead of running
+// it against the cluster
+type remoteOptions struct {
+	URL   string
+	Token string
+}
+
+func (o *remoteOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.URL, "remote", "",
+		"URL of an armada-go server to send the command to instead of using the cluster, e.g. https://armada.ucp:8000")
+	flags.StringVar(&o.Token, "remote-token", "", "token sent to the --remote server, $OS_AUTH_TOKEN if empty, "+
+		"a token of the [keystone_authtoken] user is requested if neither is set")
+}
+
+// client returns the client of the server, tokens are requested from
+// Keystone if no token was given and auth_url is configured. OS_AUTH_TOKEN
+// is read here rather than as flag default, which --help would print.
+func (o *remoteOptions) client(cfg *config.Config) *client.Client {
+	c := &client.Client{URL: o.URL, Token: o.Token}
+	if c.Token == "" {
+		c.Token = os.Getenv("OS_AUTH_TOKEN")
+	}
+	if c.Token == "" && cfg.Keystone.AuthURL != "" {
+		c.Tokens = auth.ServiceToken(cfg.Keystone)
+	}
+	return c
+}
+
+// remoteError adds the apply log the server answered with to err
+func remoteError(out io.Writer, err error) error {
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Log != "" {
+		_, _ = io.WriteString(out, apiErr.Log)
+	}
+	return err
+}
+
+// printApplyResult writes the log of the remote apply and what it changed
+func printApplyResult(out io.Writer, res *client.ApplyResult) error {
+	if _, err := io.WriteString(out, res.Log); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHART\tNAMESPACE\tSTATE\tDURATION\tREASON")
+	for _, r := range res.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Chart, r.Namespace, r.State, r.Duration, r.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "installed: %s\nupgraded: %s\n", joinOrNone(res.Message.Install),
+		joinOrNone(res.Message.Upgrade))
+	return err
+}
+
+// printRemoteReleases writes the releases by namespace as table or json
+func printRemoteReleases(out io.Writer, byNamespace map[string][]string, format string) error {
+	if format == releases.FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(byNamespace)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tRELEASE")
+	for _, ns := range slices.Sorted(maps.Keys(byNamespace)) {
+		for _, rel := range byNamespace[ns] {
+			fmt.Fprintf(w, "%s\t%s\n", ns, rel)
+		}
+	}
+	return w.Flush()
+}
+
+func joinOrNone(s []string) string {
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,51 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/render"
+)
+
+// NewRenderCommand creates a command to render armada manifests as ArmadaCharts
+func NewRenderCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &render.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:     "render MANIFESTS",
+		Aliases: []string{"template"},
+		Short:   "armada-go command to print the ArmadaCharts of manifests without applying them",
+		Long: `Converts the charts of the manifest into the ArmadaChart resources apply would
+write, with the release prefix, labels and overrides applied, so they can be
+committed and applied by a GitOps tool instead of armada-go.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringVar(&p.OutputDir, "output-dir", "",
+		"write every ArmadaChart to <output-dir>/<namespace>/<name>.yaml instead of stdout")
+	flags.BoolVar(&p.IncludeCRD, "include-crd", false, "also render the ArmadaChart CRD")
+	flags.StringVar(&p.CRDPath, "crd-path", "", "ArmadaChart CRD to render instead of the embedded one")
+
+	return runCmd
+}
@@ -0,0 +1,49 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/rollback"
+	"opendev.org/airship/armada-go/pkg/util"
+)
+
+// NewRollbackCommand creates a command to roll back a release to a previous revision
+func NewRollbackCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &rollback.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:   "rollback RELEASE",
+		Short: "armada-go command to roll back a release to a previous revision",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Release = args[0]
+			p.Out = cmd.OutOrStdout()
+			util.WarnSuspiciousTimeout("rollback wait", p.Timeout)
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.IntVar(&p.Version, "version", 0, "revision to roll back to, defaults to the previous one")
+	flags.StringVar(&p.Namespace, "namespace", "", "namespace of the release")
+	flags.BoolVar(&p.Wait, "wait", true, "wait until the release is ready")
+	flags.Var(util.NewDurationValue(&p.Timeout), "timeout",
+		"wait timeout, in seconds or as a duration like 15m, defaults to the chart wait timeout")
+
+	return runCmd
+}
@@ -16,7 +16,6 @@ package cmd
 
 import (
 	"io"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 
@@ -30,14 +29,17 @@ all configurations in a single Armada YAML and providing life-cycle hooks for al
 // RootOptions stores global flags values
 type RootOptions struct {
 	Debug            bool
+	LogFormat        string
+	Verbosity        int
 	ArmadaConfigPath string
+	Kubernetes       cfg.KubernetesConfig
 }
 
 // NewArmadaCommand creates a root `armada` command with the default commands attached
 func NewArmadaCommand(out io.Writer) *cobra.Command {
 	rootCmd, settings := NewRootCommand(out)
 	return AddDefaultArmadaCommands(rootCmd,
-		cfg.CreateFactory(&settings.ArmadaConfigPath))
+		cfg.CreateFactory(&settings.ArmadaConfigPath, &settings.Kubernetes))
 }
 
 // NewRootCommand creates the root `armada` command. All other commands are
@@ -50,8 +52,15 @@ func NewRootCommand(out io.Writer) (*cobra.Command, *RootOptions) {
 		Long:          longRoot,
 		SilenceErrors: true,
 		SilenceUsage:  true,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("verbosity") {
+				log.SetVerbosity(options.Verbosity)
+			}
 			log.Init(options.Debug, cmd.ErrOrStderr())
+			if cmd.Flags().Changed("log-format") {
+				return log.SetFormat(options.LogFormat)
+			}
+			return nil
 		},
 	}
 	rootCmd.SetOut(out)
@@ -66,17 +75,40 @@ func AddDefaultArmadaCommands(cmd *cobra.Command, factory cfg.Factory) *cobra.Co
 	cmd.AddCommand(NewServerCommand(factory))
 	cmd.AddCommand(NewApplyCommand(factory))
 	cmd.AddCommand(NewWaitCommand(factory))
+	cmd.AddCommand(NewRollbackCommand(factory))
+	cmd.AddCommand(NewHistoryCommand(factory))
+	cmd.AddCommand(NewDeleteCommand(factory))
+	cmd.AddCommand(NewGraphCommand(factory))
+	cmd.AddCommand(NewRenderCommand(factory))
+	cmd.AddCommand(NewRegroupCommand(factory))
+	cmd.AddCommand(NewConvertCommand(factory))
+	cmd.AddCommand(NewLintCommand())
+	cmd.AddCommand(NewValidateCommand(factory))
+	cmd.AddCommand(NewVerifyCommand(factory))
+	cmd.AddCommand(NewPreflightCommand(factory))
+	cmd.AddCommand(NewStatusCommand(factory))
+	cmd.AddCommand(NewReleasesCommand(factory))
+	cmd.AddCommand(NewTranscriptCommand())
+	cmd.AddCommand(NewWorkerCommand(factory))
+	cmd.AddCommand(NewPluginCommand())
+	cmd.AddCommand(NewGenerateCommand())
+	cmd.AddCommand(NewMirrorCommand())
+	cmd.AddCommand(NewVersionCommand())
+	addCompletions(cmd)
 
 	return cmd
 }
 
 func initFlags(options *RootOptions, cmd *cobra.Command) {
 	flags := cmd.PersistentFlags()
-	flags.BoolVar(&options.Debug, "debug", false, "enable verbose output")
-
-	defaultArmadaConfigDir := filepath.Join("$HOME", ".armada")
-
-	defaultArmadaConfigPath := filepath.Join(defaultArmadaConfigDir, "config")
+	flags.BoolVar(&options.Debug, "debug", false, "enable verbose output, same as --verbosity 4 with source locations")
+	flags.IntVarP(&options.Verbosity, "verbosity", "v", 0,
+		"log verbosity, 0 logs informational messages, higher levels add debug messages")
+	flags.StringVar(&options.LogFormat, "log-format", log.FormatText, "log format, text or json")
 	flags.StringVar(&options.ArmadaConfigPath, "armadaconf", "",
-		`path to the armada-go configuration file. Defaults to "`+defaultArmadaConfigPath+`"`)
+		`path to the armada-go configuration file, INI, YAML or JSON. Defaults to $`+cfg.EnvConfigPath+
+			` or "`+cfg.DefaultPath+`", settings can be overridden by `+cfg.EnvPrefix+`_<SECTION>_<KEY> environment variables`)
+	flags.StringVar(&options.Kubernetes.Kubeconfig, "kubeconfig", "",
+		"path to the kubeconfig file, the in-cluster configuration is used by default")
+	flags.StringVar(&options.Kubernetes.Context, "kube-context", "", "kubeconfig context to use")
 }
@@ -19,6 +19,7 @@ import (
 
 	"opendev.org/airship/armada-go/pkg/config"
 	"opendev.org/airship/armada-go/pkg/server"
+	"opendev.org/airship/armada-go/pkg/util"
 )
 
 const (
@@ -46,5 +47,16 @@ func NewServerCommand(cfgFactory config.Factory) *cobra.Command {
 		},
 	}
 
+	flags := runCmd.Flags()
+	flags.StringVar(&p.ListenAddress, "listen-address", "",
+		"address to listen on, defaults to api.listen_address from config or all interfaces")
+	flags.IntVar(&p.Port, "port", 0, "port to listen on, defaults to api.port from config or 8000")
+	flags.StringVar(&p.TLSCertFile, "tls-cert-file", "", "TLS certificate file, defaults to api.tls_cert_file from config")
+	flags.StringVar(&p.TLSKeyFile, "tls-key-file", "", "TLS key file, defaults to api.tls_key_file from config")
+	flags.StringVar(&p.TLSClientCAFile, "tls-client-ca-file", "",
+		"CA used to verify client certificates, defaults to api.tls_client_ca_file from config")
+	flags.Var(util.NewDurationValue(&p.ShutdownTimeout), "shutdown-timeout",
+		"how long to wait for in-flight applies on shutdown, defaults to api.shutdown_timeout from config or no limit")
+
 	return runCmd
 }
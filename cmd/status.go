@@ -0,0 +1,51 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/status"
+)
+
+// NewStatusCommand creates a command to compare a manifest with the cluster
+func NewStatusCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &status.RunCommand{Factory: cfgFactory}
+
+	runCmd := &cobra.Command{
+		Use:   "status MANIFESTS",
+		Short: "armada-go command to show whether the ArmadaCharts of the cluster match a manifest",
+		Long: `Compares every chart of the manifest with its ArmadaChart in the cluster and
+prints whether it is present and ready, how many spec changes the operator
+hasn't observed yet and whether the live spec drifted from the manifest.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.StringVarP(&p.Format, "output", "o", status.FormatText, "output format, text or json")
+	flags.BoolVar(&p.Diff, "diff", false, "show the spec difference of drifted charts")
+	flags.BoolVar(&p.ExitCode, "exit-code", false, "exit non-zero if the site isn't converged")
+	flags.StringVar(&p.SiteStatusNamespace, "site-status-namespace", "",
+		"namespace of the ConfigMap recording the last apply")
+
+	return runCmd
+}
@@ -0,0 +1,47 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/transcript"
+)
+
+// NewTranscriptCommand creates a command to work with apply transcripts
+func NewTranscriptCommand() *cobra.Command {
+	transcriptCmd := &cobra.Command{
+		Use:   "transcript",
+		Short: "armada-go command to work with apply transcripts",
+	}
+
+	transcriptCmd.AddCommand(&cobra.Command{
+		Use:   "view FILE",
+		Short: "armada-go command to pretty-print an apply transcript",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return transcript.View(f, cmd.OutOrStdout())
+		},
+	})
+
+	return transcriptCmd
+}
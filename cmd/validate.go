@@ -0,0 +1,69 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+// NewValidateCommand creates a command to validate manifests locally or
+// by an armada-go server
+func NewValidateCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &apply.RunCommand{Factory: cfgFactory}
+	var remote remoteOptions
+
+	runCmd := &cobra.Command{
+		Use:   "validate MANIFESTS",
+		Short: "armada-go command to validate manifests against the document schemas",
+		Long: "Parses and validates the documents of MANIFESTS without contacting the cluster. " +
+			"With --remote the armada-go server validates them, MANIFESTS has to be a URL it can fetch.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Manifests = args[0]
+			p.Out = cmd.OutOrStdout()
+			if remote.URL != "" {
+				cfg, err := cfgFactory()
+				if err != nil {
+					return err
+				}
+				res, err := remote.client(cfg).Validate(cmd.Context(), p.Manifests)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintln(p.Out, res.Message)
+				return err
+			}
+			if err := p.LoadConfig(); err != nil {
+				return err
+			}
+			if err := p.ParseManifests(); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintf(p.Out, "Successfully validated: %s\n", p.Manifests)
+			return err
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	remote.addFlags(flags)
+
+	return runCmd
+}
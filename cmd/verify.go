@@ -0,0 +1,49 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/util"
+	"opendev.org/airship/armada-go/pkg/verify"
+)
+
+// NewVerifyCommand creates a command to continuously verify a deployed site
+func NewVerifyCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &verify.RunCommand{Factory: cfgFactory, Interval: verify.DefaultInterval}
+
+	runCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "armada-go command to periodically check readiness and drift of the ArmadaCharts of a manifest",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p.Out = cmd.OutOrStdout()
+			return p.RunE()
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&p.Manifests, "manifest", "", "manifest href to verify the site against")
+	flags.StringVar(&p.TargetManifest, "target-manifest", "", "target manifest")
+	flags.Var(util.NewDurationValue(&p.Interval), "interval", "time between checks, in seconds or as a duration like 10m")
+	flags.StringVar(&p.MetricsAddress, "metrics-address", "", "serve Prometheus metrics on this address, e.g. :9090")
+	flags.StringVar(&p.Webhook, "webhook", "", "URL alerts are posted to when the site regresses or recovers")
+	flags.BoolVar(&p.Once, "once", false, "check once and exit non-zero if the site is unhealthy")
+	_ = runCmd.MarkFlagRequired("manifest")
+
+	return runCmd
+}
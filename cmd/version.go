@@ -0,0 +1,59 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"opendev.org/airship/armada-go/pkg/version"
+)
+
+// NewVersionCommand creates a command to print the build of armada-go
+func NewVersionCommand() *cobra.Command {
+	var output string
+	var short bool
+
+	runCmd := &cobra.Command{
+		Use:   "version",
+		Short: "armada-go command to print the version, commit and build date",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := version.Get()
+			switch {
+			case short:
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), info.Version)
+				return err
+			case output == "json":
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			case output == "text":
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), info)
+				return err
+			default:
+				return fmt.Errorf("unknown output format %q, expected text or json", output)
+			}
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVarP(&output, "output", "o", "text", "output format, text or json")
+	flags.BoolVar(&short, "short", false, "print the version only")
+
+	return runCmd
+}
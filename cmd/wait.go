@@ -16,50 +16,84 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"opendev.org/airship/armada-go/pkg/config"
-	"opendev.org/airship/armada-operator/pkg/waitutil"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/util"
+	"opendev.org/airship/armada-go/pkg/wait"
 )
 
 // NewWaitCommand creates a command to wait for armada manifests
-func NewWaitCommand(_ config.Factory) *cobra.Command {
-	getConfig := func() *rest.Config {
-		k8sConfig, err := rest.InClusterConfig()
-		if err != nil {
-			k8sConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-				clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
-			if err != nil {
-				panic(err)
-			}
-		}
-		return k8sConfig
-	}
-
-	p := &waitutil.WaitOptions{
-		RestConfig: getConfig(),
-	}
+func NewWaitCommand(cfgFactory config.Factory) *cobra.Command {
+	p := &wait.WaitOptions{}
+	var output string
 
 	runCmd := &cobra.Command{
 		Use:   "wait",
 		Short: "armada-go command to wait for armada manifests",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			p.Logger = zap.New(zap.WriteTo(cmd.OutOrStdout()), zap.ConsoleEncoder())
-			return p.Wait(context.Background())
+			cfg, err := cfgFactory()
+			if err != nil {
+				return err
+			}
+			if p.RestConfig, err = cfg.Kubernetes.RestConfig(); err != nil {
+				return err
+			}
+			if p.Timeout == 0 {
+				p.Timeout = cfg.Wait.Timeout
+			}
+			if p.OperatorTimeout == 0 {
+				p.OperatorTimeout = cfg.Wait.OperatorTimeout
+			}
+			if p.ProgressInterval == 0 {
+				p.ProgressInterval = cfg.Wait.ProgressInterval
+			}
+			util.WarnSuspiciousTimeout("wait", p.Timeout)
+			switch output {
+			case "text":
+				p.Logger = log.New(cmd.OutOrStdout()).Logr()
+				res, err := p.Wait(context.Background())
+				if res != nil && err != nil {
+					_ = wait.PrintResult(cmd.OutOrStdout(), res)
+				}
+				return err
+			case "json":
+				// keep stdout parseable
+				p.Logger = log.New(cmd.ErrOrStderr()).Logr()
+				res, err := p.Wait(context.Background())
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if encErr := enc.Encode(res); encErr != nil {
+					return encErr
+				}
+				return err
+			default:
+				return fmt.Errorf("unknown output format %q, expected text or json", output)
+			}
 		},
 	}
 
 	flags := runCmd.Flags()
-	flags.StringVar(&p.ResourceType, "resource-type", "", "resource type")
+	flags.StringVar(&p.ResourceType, "resource-type", wait.ArmadaCharts,
+		"resource type, one of "+strings.Join(wait.ResourceTypes(), ", ")+" or any type together with --for")
+	flags.StringVar(&p.For, "for", "",
+		"readiness criterion condition=TYPE[=STATUS] or jsonpath={EXPR}[=VALUE], required for other resource types")
 	flags.StringVar(&p.Namespace, "namespace", "", "namespace")
 	flags.StringVar(&p.LabelSelector, "label-selector", "", "label selector")
-	flags.DurationVar(&p.Timeout, "timeout", 0, "timeout")
-	flags.StringVar(&p.MinReady, "min-ready", "", "min ready")
+	flags.Var(util.NewDurationValue(&p.Timeout), "timeout", "timeout, in seconds or as a duration like 15m")
+	flags.StringVar(&p.MinReady, "min-ready", "",
+		"number, like 2, or percentage, like 75%, of matched resources which have to be ready, all if empty")
+	flags.Var(util.NewDurationValue(&p.OperatorTimeout), "operator-timeout",
+		"fail if charts aren't observed by armada-operator for this long, negative disables the check")
+	flags.Var(util.NewDurationValue(&p.ProgressInterval), "progress-interval",
+		"how often to log which resources aren't ready and why, negative disables the summaries")
+	flags.StringVarP(&output, "output", "o", "text", "output format, text or json describing every matched resource")
 
 	return runCmd
 }
@@ -0,0 +1,85 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/partition"
+)
+
+// NewWorkerCommand creates a command installing chart groups handed over by `armada apply --distribute-namespace`
+func NewWorkerCommand(cfgFactory config.Factory) *cobra.Command {
+	w := &partition.Worker{}
+	runOpts := &apply.RunCommand{}
+
+	runCmd := &cobra.Command{
+		Use:   "worker MANIFESTS",
+		Short: "armada-go command to install chart groups distributed by a coordinating apply",
+		Long: `Installs the chart groups published by an apply with --distribute-namespace.
+MANIFESTS are the manifests of the coordinating apply, they provide the charts,
+hooks and waits of the groups.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := cfgFactory()
+			if err != nil {
+				return err
+			}
+			k8sConfig, err := cfg.Kubernetes.RestConfig()
+			if err != nil {
+				return err
+			}
+			if w.Identity == "" {
+				if w.Identity, err = os.Hostname(); err != nil {
+					return err
+				}
+			}
+
+			runOpts.Manifests = args[0]
+			runOpts.Out = cmd.OutOrStdout()
+			runOpts.Config = cfg
+			if err = runOpts.LoadConfig(); err != nil {
+				return err
+			}
+			if err = runOpts.ParseManifests(); err != nil {
+				return err
+			}
+			w.Client = kubernetes.NewForConfigOrDie(k8sConfig)
+			w.Install = func(ctx context.Context, group partition.Group) error {
+				return runOpts.InstallGroup(ctx, group.Name, group.Charts, group.Canary, k8sConfig)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+			return w.Run(ctx)
+		},
+	}
+
+	flags := runCmd.Flags()
+	flags.StringVar(&w.Namespace, "namespace", "", "namespace the coordinating apply publishes work to")
+	flags.StringVar(&w.Identity, "identity", "", "worker identity recorded in leases, defaults to the hostname")
+	flags.StringVar(&runOpts.TargetManifest, "target-manifest", "", "target manifest of the coordinating apply")
+	_ = runCmd.MarkFlagRequired("namespace")
+
+	return runCmd
+}
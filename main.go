@@ -22,7 +22,12 @@ import (
 )
 
 func main() {
-	if err := cmd.NewArmadaCommand(os.Stdout).Execute(); err != nil {
+	rootCmd := cmd.NewArmadaCommand(os.Stdout)
+	if err := cmd.HandlePluginCommand(rootCmd, os.Args[1:]); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := rootCmd.Execute(); err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -0,0 +1,158 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"text/tabwriter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/helm"
+	"opendev.org/airship/armada-go/pkg/prune"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Adoption is an existing object an apply with Adopt took over
+type Adoption struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// Adoptions returns the objects the last run adopted, or would have adopted
+// with DryRun
+func (c *RunCommand) Adoptions() []Adoption {
+	return c.adoptions
+}
+
+// adopt takes over the ArmadaCharts and Helm releases of the charts applied
+// to the cluster, see Adopt
+func (c *RunCommand) adopt(ctx context.Context, t *targetCluster) error {
+	client := dynamic.NewForConfigOrDie(t.restConfig).Resource(schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	})
+	return c.adoptCharts(ctx, client, kubernetes.NewForConfigOrDie(t.restConfig), t.name)
+}
+
+// adoptCharts relabels ArmadaCharts of the releases of the cluster lacking
+// the release labels, keeps ArmadaCharts managing a release under another
+// name as the ArmadaChart of the chart and reports Helm releases without
+// ArmadaChart, which are upgraded by the created one
+func (c *RunCommand) adoptCharts(ctx context.Context, client dynamic.NamespaceableResourceInterface,
+	cs kubernetes.Interface, cluster string) error {
+	if c.adopted == nil {
+		c.adopted = map[string]string{}
+	}
+	for _, ns := range c.targetNamespaces(cluster) {
+		list, err := client.Namespace(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to list charts in namespace %s: %w", ns, err)
+		}
+		releases, err := helm.LatestReleases(ctx, cs, ns)
+		if err != nil {
+			return fmt.Errorf("unable to list helm releases in namespace %s: %w", ns, err)
+		}
+		for _, chart := range c.clusterCharts(cluster) {
+			if chart.Namespace != ns {
+				continue
+			}
+			var live *unstructured.Unstructured
+			for i, item := range list.Items {
+				release, _, _ := unstructured.NestedString(item.Object, "data", "release")
+				if item.GetName() == chart.Name || (live == nil && release == chart.Spec.Release) {
+					live = &list.Items[i]
+				}
+			}
+			switch {
+			case live == nil && releases[ns+"/"+chart.Spec.Release] != nil:
+				c.adoptions = append(c.adoptions, Adoption{Kind: prune.KindHelmRelease, Namespace: ns,
+					Name: chart.Spec.Release, Reason: "not managed by an ArmadaChart, upgraded by ArmadaChart " + chart.Name})
+			case live == nil:
+			case live.GetName() != chart.Name:
+				c.adopted[ns+"/"+chart.Spec.Release] = live.GetName()
+				c.adoptions = append(c.adoptions, Adoption{Kind: prune.KindArmadaChart, Namespace: ns,
+					Name: live.GetName(), Reason: fmt.Sprintf("manages release %s, kept instead of creating %s",
+						chart.Spec.Release, chart.Name)})
+				if err := c.relabel(ctx, client, live, chart.Labels); err != nil {
+					return err
+				}
+			case !labels.SelectorFromSet(chart.Labels).Matches(labels.Set(live.GetLabels())):
+				c.adoptions = append(c.adoptions, Adoption{Kind: prune.KindArmadaChart, Namespace: ns,
+					Name: live.GetName(), Reason: "relabeled with " + labels.Set(chart.Labels).String()})
+				if err := c.relabel(ctx, client, live, chart.Labels); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// relabel adds the release and ownership labels to the adopted ArmadaChart
+// unless DryRun is set
+func (c *RunCommand) relabel(ctx context.Context, client dynamic.NamespaceableResourceInterface,
+	live *unstructured.Unstructured, lbls map[string]string) error {
+	if c.DryRun {
+		return nil
+	}
+	lbls = maps.Clone(lbls)
+	maps.Copy(lbls, c.ownerLabels())
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": lbls}})
+	if err != nil {
+		return err
+	}
+	_, err = client.Namespace(live.GetNamespace()).Patch(ctx, live.GetName(), types.MergePatchType, patch,
+		metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return fmt.Errorf("unable to adopt chart %s: %w", live.GetName(), err)
+	}
+	return nil
+}
+
+// printAdoptions writes the adopted objects as a table
+func (c *RunCommand) printAdoptions(w io.Writer) error {
+	verb := "adopted"
+	if c.DryRun {
+		verb = "would be adopted"
+	}
+	if len(c.adoptions) == 0 {
+		_, err := fmt.Fprintf(w, "nothing %s\n", verb)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tREASON")
+	for _, a := range c.adoptions {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Kind, a.Namespace, a.Name, a.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d objects %s\n", len(c.adoptions), verb)
+	return err
+}
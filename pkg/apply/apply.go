@@ -17,56 +17,235 @@ package apply
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
-	"opendev.org/airship/armada-go/pkg/auth"
 	"opendev.org/airship/armada-go/pkg/log"
 	"os"
-	"regexp"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
-	v1 "k8s.io/api/core/v1"
 	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextension "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiextv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
 	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
-	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/yaml"
 
 	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/crd"
+	"opendev.org/airship/armada-go/pkg/hooks"
+	"opendev.org/airship/armada-go/pkg/lock"
+	"opendev.org/airship/armada-go/pkg/partition"
+	armadaschema "opendev.org/airship/armada-go/pkg/schema"
+	"opendev.org/airship/armada-go/pkg/source"
+	"opendev.org/airship/armada-go/pkg/tracing"
+	"opendev.org/airship/armada-go/pkg/transcript"
+	"opendev.org/airship/armada-go/pkg/util"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
 	armadav1 "opendev.org/airship/armada-operator/api/v1"
-	armadawait "opendev.org/airship/armada-operator/pkg/waitutil"
 )
 
 // RunCommand phase run command
 type RunCommand struct {
-	Factory        config.Factory
+	Factory config.Factory
+	// Backend installs the charts, BackendOperator if empty
+	Backend string
+	// ChartBackend executes the charts instead of the backend named by
+	// Backend, if set
+	ChartBackend Backend
+	// Config provides defaults for options not set explicitly, it is taken
+	// from Factory if nil
+	Config         *config.Config
 	Manifests      string
 	TargetManifest string
 	Out            io.Writer
+	// Source provides the manifest documents instead of Manifests, which
+	// then only names them, e.g. in logs
+	Source DocumentSource
+	// ManifestReader is read like a Source if set
+	ManifestReader io.Reader
 	Installed      *[]string
 	Updated        *[]string
+	// ReleaseLabelKey overrides the label key used to mark and select ArmadaCharts
+	ReleaseLabelKey string
+	// ExtraLabels are added to every ArmadaChart and its wait selector
+	ExtraLabels map[string]string
+	// ReleaseLabelTemplate composes the release label value, it defaults to
+	// {{.Prefix}}-{{.Release}}
+	ReleaseLabelTemplate string
+	// Progress is called on every chart state change with the namespace and
+	// name of the ArmadaChart, if set
+	Progress func(chart string, state ChartState)
+	// Log receives apply messages instead of the global logger, if set
+	Log *log.Logger
+	// Transcript records every apply action, if set
+	Transcript *transcript.Writer
+	// GroupRunner installs the chart groups instead of this process, if set
+	GroupRunner GroupRunner
+	// DistributeNamespace hands chart groups over to `armada worker`
+	// processes watching this namespace. Groups run at once unless charts of
+	// one depend on charts of another, see distributeGroups.
+	DistributeNamespace string
+	// MaxParallel limits charts installed at once in parallel chart groups,
+	// zero means no limit
+	MaxParallel int
+	// WaitTimeout is used for charts without data.wait.timeout,
+	// DefaultWaitTimeout if zero
+	WaitTimeout time.Duration
+	// ChartTimeouts replace the wait timeout of charts by chart document or
+	// release name, including data.wait.timeout
+	ChartTimeouts map[string]time.Duration
+	// Timeout limits the whole apply, installs still running when it expires
+	// are cancelled. Zero means no limit.
+	Timeout time.Duration
+	// Kubeconfig and Context select the target cluster when running outside
+	// of a cluster
+	Kubeconfig string
+	Context    string
+	// Clusters maps chart groups to the kubeconfig context of the cluster
+	// their charts are applied to, replacing data.cluster of the groups
+	Clusters map[string]string
+	// ReleasePrefix replaces release_prefix of the manifest in the names of
+	// the ArmadaCharts, NoReleasePrefix names them after their releases
+	ReleasePrefix   string
+	NoReleasePrefix bool
+	// Adopt takes over existing ArmadaCharts and Helm releases of the charts
+	// armada-go didn't create: ArmadaCharts get the release labels, one
+	// managing the release under another name is kept, see Adoptions
+	Adopt bool
+	// Prune deletes ArmadaCharts of previous applies missing in the manifest
+	Prune bool
+	// DryRun prints the changes the backend would make, and with Prune what
+	// would be deleted, instead of making them. Hooks and tests aren't run.
+	DryRun bool
+	// CRDPath overrides the ArmadaChart CRD embedded in armada-go
+	CRDPath string
+	// ForceReconcile overwrites ArmadaCharts edited on the cluster since the
+	// last apply, they are left untouched with a warning otherwise
+	ForceReconcile bool
+	// SkipTests doesn't run the Helm tests of charts with data.test.enabled
+	// after they became ready
+	SkipTests bool
+	// NoCreateNamespaces fails the apply if a namespace of a chart is
+	// missing instead of creating it
+	NoCreateNamespaces bool
+	// Preflight checks the cluster version, the CRD, permissions and nodes
+	// before anything is changed, the apply fails if a check fails
+	Preflight bool
+	// NoLock applies without taking the lock of the manifest, which
+	// serializes applies of the same manifest
+	NoLock bool
+	// LockWait is how long to wait for another apply of the manifest to
+	// finish, zero fails right away
+	LockWait time.Duration
+	// LockHolder identifies the apply to concurrent ones,
+	// lock.DefaultHolder if empty
+	LockHolder string
+	// Atomic restores the previous spec of ArmadaCharts whose update didn't
+	// become ready, so armada-operator rolls their release back, before
+	// the failure is reported
+	Atomic bool
+	// WaitForOperator checks that the armada-operator deployment is available
+	// before any ArmadaChart is created
+	WaitForOperator bool
+	// OperatorNamespace and OperatorDeployment locate the operator, all
+	// namespaces are searched for DefaultOperatorDeployment by default
+	OperatorNamespace  string
+	OperatorDeployment string
+	// OperatorWaitTimeout limits the operator check, DefaultOperatorWaitTimeout
+	// if zero
+	OperatorWaitTimeout time.Duration
+	// SiteStatusNamespace holds the SiteStatusName ConfigMap,
+	// DefaultSiteStatusNamespace if empty
+	SiteStatusNamespace string
+	// SkipCharts and SkipChartGroups leave charts, by chart document or
+	// release name, and chart groups out of the apply, like SkipAnnotation
+	SkipCharts      []string
+	SkipChartGroups []string
+	// CanaryGroups install the first chart of the chart groups as canary,
+	// unless the group document configures its canary
+	CanaryGroups []string
+	// PrintPlan writes the order charts would be installed in to Out
+	// instead of applying the manifest
+	PrintPlan bool
+	// Resume skips charts which became ready in the interrupted apply of
+	// the target manifest with the spec they have now, see CheckpointName
+	Resume bool
+	// Sources fetches the charts armada-operator can't fetch itself, it is
+	// created from the [sources] config if nil
+	Sources *source.Resolver
+	// SourceURL is where armada-operator downloads the charts fetched by
+	// Sources from
+	SourceURL string
+	// ManifestKey is the PEM public key file the manifests have to be
+	// signed with, the signature is read from <manifests>.sig
+	ManifestKey string
 
 	airManifest *AirshipManifest
 	airGroups   map[string]*AirshipChartGroup
 	airCharts   map[string]*AirshipChart
+	labelTmpl   *template.Template
+	// manifestHash is the digest of the parsed manifest documents
+	manifestHash string
+	// appliedAt is when the run started, see AppliedAtAnnotation
+	appliedAt time.Time
+
+	// outcome of the charts, recorded for the site status
+	outcome *outcome
+	// checkpoint records ready charts, nil when charts are installed
+	// outside of RunE
+	checkpoint *checkpoint
+	// noSiteStatus leaves the site status to the caller
+	noSiteStatus bool
+	// clusters are the clusters of the run, the cluster of the apply first
+	clusters []*targetCluster
+	// namespaces are the namespaces verified during the apply
+	namespaces *namespaceCache
+	// sources replace the source of ArmadaCharts of charts fetched by Sources
+	sources map[*AirshipChart]armadav1.ArmadaChartSource
+	// adopted are the names of ArmadaCharts adopted under another name by
+	// namespace/release
+	adopted map[string]string
+	// adoptions are the objects adopted during the run
+	adoptions []Adoption
+}
+
+// GroupRunner installs independent chart groups
+type GroupRunner interface {
+	RunGroups(ctx context.Context, groups []partition.Group) error
 }
 
+// DefaultWaitTimeout is the wait timeout of charts without data.wait.timeout,
+// the default of classic Armada
+const DefaultWaitTimeout = 900 * time.Second
+
+// ErrApplyTimeout is returned if the apply didn't finish within its Timeout
+var ErrApplyTimeout = errors.New("apply timed out")
+
+// ChartState is the progress of a single chart within an apply
+type ChartState string
+
+const (
+	ChartInstalling ChartState = "installing"
+	ChartReady      ChartState = "ready"
+	ChartFailed     ChartState = "failed"
+	ChartSkipped    ChartState = "skipped"
+)
+
 type AirshipDocument struct {
 	Schema   string          `json:"schema,omitempty"`
 	Metadata AirshipMetadata `json:"metadata,omitempty"`
@@ -74,6 +253,8 @@ type AirshipDocument struct {
 
 type AirshipMetadata struct {
 	Name string `json:"name,omitempty"`
+	// Annotations control how armada-go handles the document, e.g. SkipAnnotation
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type AirshipManifest struct {
@@ -84,6 +265,14 @@ type AirshipManifest struct {
 type AirshipManifestSpec struct {
 	ChartGroups   []string `json:"chart_groups,omitempty"`
 	ReleasePrefix string   `json:"release_prefix,omitempty"`
+	// ChartGroupDefaults are inherited by all chart groups unless overridden by the group
+	ChartGroupDefaults AirshipChartGroupDefaults `json:"chart_group_defaults,omitempty"`
+	// Namespaces controls how the namespaces of the charts are created
+	Namespaces AirshipNamespaces `json:"namespaces,omitempty"`
+}
+
+type AirshipChartGroupDefaults struct {
+	Sequenced bool `json:"sequenced,omitempty"`
 }
 
 type AirshipChartGroup struct {
@@ -94,143 +283,780 @@ type AirshipChartGroup struct {
 type AirshipChartGroupSpec struct {
 	ChartGroup  []string `json:"chart_group,omitempty"`
 	Description string   `json:"description,omitempty"`
-	Sequenced   bool     `json:"sequenced,omitempty"`
+	Sequenced   *bool    `json:"sequenced,omitempty"`
+	// Canary charts are installed and have to become ready before the
+	// other charts of the group are started
+	Canary *AirshipCanary `json:"canary,omitempty"`
+	// Hooks run before the first chart of the group is installed and after
+	// all of them are ready
+	Hooks hooks.Hooks `json:"hooks,omitempty"`
+	// Cluster is the kubeconfig context of the cluster the charts are
+	// applied to, the cluster of the apply if empty
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// IsSequenced returns whether charts of the group are installed one by one,
+// falling back to the manifest defaults if the group doesn't say
+func (cg *AirshipChartGroup) IsSequenced(defaults AirshipChartGroupDefaults) bool {
+	if cg.Sequenced != nil {
+		return *cg.Sequenced
+	}
+	return defaults.Sequenced
 }
 
 type AirshipChart struct {
 	AirshipDocument
 	armadav1.ArmadaChartSpec `json:"data,omitempty"`
+	// Extensions are chart document fields handled by armada-go itself
+	Extensions AirshipChartExtensions `json:"-"`
+}
+
+// AirshipChartExtensions holds the chart document fields which are not part
+// of ArmadaChartSpec
+type AirshipChartExtensions struct {
+	// Namespaces fans the chart out, one ArmadaChart is created per namespace
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Dependencies are names of charts this chart depends on
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Wait holds wait settings ArmadaChart doesn't know about
+	Wait AirshipWaitExtensions `json:"wait,omitempty"`
+	// Atomic overrides RunCommand.Atomic for the chart
+	Atomic *bool `json:"atomic,omitempty"`
+	// Hooks run before the ArmadaCharts are created or updated and after
+	// they became ready
+	Hooks hooks.Hooks `json:"hooks,omitempty"`
+	// Test holds the data.test fields ArmadaChart doesn't know about
+	Test AirshipTestExtensions `json:"test,omitempty"`
+	// Source is data.source including the fields ArmadaChart doesn't know
+	// about
+	Source source.Source `json:"source,omitempty"`
+}
+
+// AirshipTestExtensions are the armada-go specific data.test fields
+type AirshipTestExtensions struct {
+	// Timeout in seconds limits the Helm tests, helm.DefaultTestTimeout if zero
+	Timeout int64 `json:"timeout,omitempty"`
+	// Options.Cleanup deletes the test pods after the tests
+	Options struct {
+		Cleanup bool `json:"cleanup,omitempty"`
+	} `json:"options,omitempty"`
+}
+
+// AirshipWaitExtensions are the armada-go specific data.wait fields
+type AirshipWaitExtensions struct {
+	// Timeout is data.wait.timeout as given, ArmadaChart only holds whole
+	// seconds
+	Timeout util.Duration `json:"timeout,omitempty"`
+	// Resources are matched to data.wait.resources by position
+	Resources []AirshipWaitResourceExtensions `json:"resources,omitempty"`
+}
+
+// AirshipWaitResourceExtensions are the armada-go specific fields of a
+// data.wait.resources entry
+type AirshipWaitResourceExtensions struct {
+	// Timeout replaces the chart wait timeout for the resource
+	Timeout util.Duration `json:"timeout,omitempty"`
+}
+
+// TargetNamespaces returns namespaces the chart is deployed into
+func (ch *AirshipChart) TargetNamespaces() []string {
+	if len(ch.Extensions.Namespaces) > 0 {
+		return ch.Extensions.Namespaces
+	}
+	return []string{ch.Namespace}
 }
 
 // RunE runs the phase
 func (c *RunCommand) RunE() error {
-	log.Printf("armada-go apply, manifests path %s", c.Manifests)
+	return c.RunContext(context.Background())
+}
 
-	if err := c.ParseManifests(); err != nil {
-		return err
+// RunContext runs the phase with the config and logger carried by ctx unless
+// Config or Log are set, so concurrent applies don't share them
+func (c *RunCommand) RunContext(ctx context.Context) error {
+	if c.Config == nil {
+		c.Config = config.FromContext(ctx)
 	}
-
-	k8sConfig, err := rest.InClusterConfig()
+	if c.Log == nil {
+		c.Log = log.FromContext(ctx, nil)
+	}
+	c.outcome = newOutcome()
+	c.record(transcript.Entry{Action: transcript.ApplyStart, Message: c.Manifests})
+	ctx, span := tracing.Start(ctx, "apply", attribute.String("manifests", c.Manifests),
+		attribute.String("target_manifest", c.TargetManifest))
+	err := c.run(ctx)
+	tracing.End(span, err)
+	finish := transcript.Entry{Action: transcript.ApplyFinish}
 	if err != nil {
-		log.Printf("Unable to load in-cluster kubeconfig, reason: %v", err)
-		k8sConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+		finish.Error = err.Error()
+	}
+	c.record(finish)
+	return err
+}
+
+// ApplyProfile fills options not set explicitly from the profile
+func (c *RunCommand) ApplyProfile(p *config.Profile) {
+	if c.TargetManifest == "" {
+		c.TargetManifest = p.TargetManifest
+	}
+	if c.DistributeNamespace == "" {
+		c.DistributeNamespace = p.DistributeNamespace
+	}
+	if c.MaxParallel == 0 {
+		c.MaxParallel = p.MaxParallel
+	}
+	if c.WaitTimeout == 0 {
+		c.WaitTimeout = p.WaitTimeout
+	}
+	if c.Kubeconfig == "" {
+		c.Kubeconfig = p.Kubeconfig
+	}
+	if c.Context == "" {
+		c.Context = p.Context
+	}
+	if c.ReleasePrefix == "" && !c.NoReleasePrefix {
+		c.ReleasePrefix = p.ReleasePrefix
+	}
+	if !c.Prune {
+		c.Prune = p.Prune
+	}
+}
+
+// LoadConfig fills options not set explicitly from the [apply] and
+// [kubernetes] sections of the config
+func (c *RunCommand) LoadConfig() error {
+	if c.Config == nil {
+		cfg, err := config.Resolve(c.Factory)
+		if err != nil {
+			return err
+		}
+		c.Config = cfg
+	}
+	if c.ReleaseLabelKey == "" {
+		c.ReleaseLabelKey = c.Config.Apply.ReleaseLabelKey
+	}
+	if c.ReleaseLabelTemplate == "" {
+		c.ReleaseLabelTemplate = c.Config.Apply.ReleaseLabelTemplate
+	}
+	if c.ExtraLabels == nil {
+		c.ExtraLabels = c.Config.Apply.ExtraLabels
+	}
+	if c.MaxParallel == 0 {
+		c.MaxParallel = c.Config.Apply.MaxParallel
+	}
+	if c.WaitTimeout == 0 {
+		c.WaitTimeout = c.Config.Apply.WaitTimeout
+	}
+	if c.WaitTimeout == 0 {
+		c.WaitTimeout = DefaultWaitTimeout
+	}
+	if c.ChartTimeouts == nil {
+		c.ChartTimeouts = c.Config.Apply.ChartTimeouts
+	}
+	if c.Clusters == nil {
+		c.Clusters = c.Config.Apply.Clusters
+	}
+	if c.Timeout == 0 {
+		c.Timeout = c.Config.Apply.Timeout
+	}
+	if c.Kubeconfig == "" {
+		c.Kubeconfig = c.Config.Kubernetes.Kubeconfig
+	}
+	if c.Context == "" {
+		c.Context = c.Config.Kubernetes.Context
+	}
+	if c.CRDPath == "" {
+		c.CRDPath = c.Config.Apply.CRDPath
+	}
+	if !c.WaitForOperator {
+		c.WaitForOperator = c.Config.Apply.WaitForOperator
+	}
+	if c.OperatorNamespace == "" {
+		c.OperatorNamespace = c.Config.Apply.OperatorNamespace
+	}
+	if c.OperatorDeployment == "" {
+		c.OperatorDeployment = c.Config.Apply.OperatorDeployment
+	}
+	if c.OperatorWaitTimeout == 0 {
+		c.OperatorWaitTimeout = c.Config.Apply.OperatorWaitTimeout
+	}
+	if c.SiteStatusNamespace == "" {
+		c.SiteStatusNamespace = c.Config.Apply.SiteStatusNamespace
+	}
+	if c.Backend == "" {
+		c.Backend = c.Config.Apply.Backend
+	}
+	if c.Config.Apply.NoCreateNamespaces {
+		c.NoCreateNamespaces = true
+	}
+	if c.Config.Apply.Preflight {
+		c.Preflight = true
+	}
+	if c.Config.Apply.NoLock {
+		c.NoLock = true
+	}
+	if c.LockWait == 0 {
+		c.LockWait = c.Config.Apply.LockWait
+	}
+	if c.SourceURL == "" {
+		c.SourceURL = c.Config.Sources.PublicURL
+	}
+	if c.Sources == nil {
+		creds, err := sourceCredentials(c.Config.Sources)
 		if err != nil {
 			return err
 		}
+		c.Sources = &source.Resolver{CacheDir: c.Config.Sources.CacheDir, PlainHTTP: c.Config.Sources.PlainHTTP,
+			Env: c.Config.Proxy.Env(), Credentials: creds, Verify: c.Config.Sources.Verify,
+			Keyring: c.Config.Sources.Keyring}
+		if file := c.Config.Sources.PublicKeyFile; file != "" {
+			if c.Sources.PublicKey, err = os.ReadFile(file); err != nil {
+				return err
+			}
+		}
 	}
+	if c.ManifestKey == "" {
+		c.ManifestKey = c.Config.Apply.ManifestKeyFile
+	}
+	return c.compileLabelTemplate()
+}
+
+// RestConfig returns the client configuration of the target cluster
+func (c *RunCommand) RestConfig() (*rest.Config, error) {
+	kube := c.Config.Kubernetes
+	kube.Kubeconfig, kube.Context = c.Kubeconfig, c.Context
+	return kube.RestConfig()
+}
+
+func (c *RunCommand) run(ctx context.Context) (err error) {
+	c.logf("armada-go apply, manifests path %s", c.Manifests)
+	c.appliedAt = time.Now().UTC()
 
-	if err := c.VerifyNamespaces(k8sConfig); err != nil {
+	if err := c.LoadConfig(); err != nil {
 		return err
 	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, c.Timeout, fmt.Errorf("%w after %s", ErrApplyTimeout, c.Timeout))
+		defer cancel()
+		defer func() {
+			if cause := context.Cause(ctx); err != nil && errors.Is(cause, ErrApplyTimeout) {
+				err = fmt.Errorf("%w: %w", cause, err)
+			}
+		}()
+	}
 
-	dc := dynamic.NewForConfigOrDie(k8sConfig)
-	resClient := dc.Resource(schema.GroupVersionResource{
-		Group:    armadav1.ArmadaChartGroup,
-		Version:  armadav1.ArmadaChartVersion,
-		Resource: armadav1.ArmadaChartPlural,
-	})
+	parseCtx, span := tracing.Start(ctx, "parse manifests")
+	err = c.parseManifests(parseCtx)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	if err = c.validateSkips(); err != nil {
+		return err
+	}
+	if err = c.validateReleasePrefix(); err != nil {
+		return err
+	}
+	if err = c.validateBackend(); err != nil {
+		return err
+	}
+	if err = c.validateClusters(); err != nil {
+		return err
+	}
+	if c.PrintPlan {
+		return c.printPlan(c.Out)
+	}
 
-	if err := c.CheckCRD(k8sConfig); err != nil {
+	k8sConfig, err := c.RestConfig()
+	if err != nil {
+		return err
+	}
+	if err = c.setupClusters(k8sConfig); err != nil {
 		return err
 	}
 
-	for _, cgName := range c.airManifest.ChartGroups {
-		cg := c.airGroups[cgName]
-		log.Printf("processing chart group %s, sequenced %v", cgName, cg.Sequenced)
-		if !cg.Sequenced {
-			eg := errgroup.Group{}
-			for _, cName := range cg.ChartGroup {
-				log.Printf("adding 1 chart to wg %s", cName)
-				chp := c.airCharts[cName]
-				chpc := c.ConvertChart(chp)
-				eg.Go(func() error {
-					return c.InstallChart(chpc, resClient, k8sConfig)
-				})
+	if c.Preflight {
+		for _, t := range c.clusters {
+			ctx, span := tracing.Start(ctx, "preflight", attribute.String("cluster", t.name))
+			err = c.runPreflight(ctx, t)
+			tracing.End(span, err)
+			if err != nil {
+				return err
 			}
-			if err := eg.Wait(); err != nil {
+		}
+	}
+	if c.DryRun {
+		c.logf("dry run, printing the changes of the %s backend instead of making them", c.Backend)
+		for _, t := range c.clusters {
+			if err = c.VerifyNamespaces(t.restConfig); err != nil {
 				return err
 			}
-		} else {
-			for _, cName := range cg.ChartGroup {
-				log.Printf("sequential chart install %s", cName)
-				if err = c.InstallChart(c.ConvertChart(c.airCharts[cName]), resClient, k8sConfig); err != nil {
-					return err
+		}
+	} else {
+		if !c.NoLock {
+			held, release, err := c.acquireLock(ctx, k8sConfig)
+			if err != nil {
+				return err
+			}
+			defer release()
+			ctx = held
+		}
+		if !c.noSiteStatus {
+			// the status is written also if the apply timed out
+			defer func() { c.writeSiteStatus(context.WithoutCancel(ctx), k8sConfig, c.SiteStatus(err)) }()
+		}
+		if !c.NoLock {
+			// registered last so the site status reports the lost lock
+			defer func() {
+				var lost *lock.LostError
+				if err != nil && errors.As(context.Cause(ctx), &lost) {
+					err = fmt.Errorf("%w: %w", lost, err)
 				}
+			}()
+		}
+		if err = c.loadCheckpoint(ctx, k8sConfig); err != nil {
+			return err
+		}
+		for _, t := range c.clusters {
+			if c.statusOnly(t) {
+				continue
+			}
+			if err = c.prepareCluster(ctx, t); err != nil {
+				return fmt.Errorf("%s: %w", t, err)
+			}
+		}
+	}
+	for _, t := range c.clusters {
+		if t.backend, err = c.backend(t.restConfig); err != nil {
+			return err
+		}
+	}
+	if c.Adopt {
+		for _, t := range c.clusters {
+			if err = c.adopt(ctx, t); err != nil {
+				return fmt.Errorf("%s: %w", t, err)
+			}
+		}
+		if err = c.printAdoptions(c.Out); err != nil {
+			return err
+		}
+	}
+	defer c.logClusterResults()
+	if err = c.resolveSources(ctx, k8sConfig); err != nil {
+		return err
+	}
+
+	if c.GroupRunner == nil && c.DistributeNamespace != "" {
+		c.GroupRunner = &partition.Coordinator{
+			Client:    kubernetes.NewForConfigOrDie(k8sConfig),
+			Namespace: c.DistributeNamespace,
+		}
+	}
+
+	if c.GroupRunner != nil && !c.DryRun {
+		if err := c.distributeGroups(ctx); err != nil {
+			return err
+		}
+	} else {
+		for _, cgName := range c.airManifest.ChartGroups {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("chart group %s not started: %w", cgName, err)
+			}
+			if c.skippedGroup(cgName) {
+				continue
+			}
+			if err := c.runGroup(ctx, cgName, c.cluster(c.groupCluster(cgName)).restConfig); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.Prune {
+		for _, t := range c.clusters {
+			if c.statusOnly(t) {
+				// nothing is kept there, everything would be pruned
+				continue
+			}
+			if err := c.prune(t.restConfig, c.DryRun); err != nil {
+				return err
 			}
 		}
 	}
+	c.clearCheckpoint(ctx)
+	return nil
+}
+
+// prepareCluster creates the namespaces and, for the operator backend, the
+// ArmadaChart CRD on the cluster
+func (c *RunCommand) prepareCluster(ctx context.Context, t *targetCluster) (err error) {
+	k8sConfig := t.restConfig
+	_, span := tracing.Start(ctx, "verify namespaces", attribute.String("cluster", t.name))
+	err = c.VerifyNamespaces(k8sConfig)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+
+	if !c.helmBackend() {
+		_, span = tracing.Start(ctx, "check crd")
+		err = c.CheckCRD(k8sConfig)
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.WaitForOperator && !c.helmBackend() {
+		operatorCtx, span := tracing.Start(ctx, "wait for operator")
+		err = c.WaitOperator(operatorCtx, k8sConfig)
+		tracing.End(span, err)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (c *RunCommand) InstallChart(
-	chart *armadav1.ArmadaChart,
-	resClient dynamic.NamespaceableResourceInterface,
+// runGroup installs the charts of a chart group
+func (c *RunCommand) runGroup(ctx context.Context, cgName string, k8sConfig *rest.Config) (err error) {
+	cg := c.airGroups[cgName]
+	sequenced := cg.IsSequenced(c.airManifest.ChartGroupDefaults)
+	ctx, span := tracing.Start(ctx, "chart group", attribute.String("chart_group", cgName),
+		attribute.Bool("sequenced", sequenced))
+	defer func() { tracing.End(span, err) }()
+	ctx = log.IntoContext(ctx, c.logger().With("chart_group", cgName))
+
+	c.logCtx(ctx, "processing chart group %s, sequenced %v", cgName, sequenced)
+	return c.installGroup(ctx, cgName, c.groupCharts(ctx, cgName), c.canary(cgName), k8sConfig)
+}
+
+// skippedGroup returns whether the chart group is skipped, its charts are
+// reported as skipped
+func (c *RunCommand) skippedGroup(cgName string) bool {
+	reason := c.skipGroup(cgName)
+	if reason == "" {
+		return false
+	}
+	c.logf("WARNING: skipping chart group %s, %s", cgName, reason)
+	for _, cName := range c.airGroups[cgName].ChartGroup {
+		c.skip(c.airCharts[cName])
+	}
+	return true
+}
+
+// groupCharts returns the charts of the chart group to install, leaving out
+// skipped charts and charts applied by the interrupted apply
+func (c *RunCommand) groupCharts(ctx context.Context, cgName string) []string {
+	cg := c.airGroups[cgName]
+	chartNames := make([]string, 0, len(cg.ChartGroup))
+	for _, cName := range cg.ChartGroup {
+		if reason := c.skipChart(cName); reason != "" {
+			c.logCtx(ctx, "WARNING: skipping chart %s, %s", cName, reason)
+			c.skip(c.airCharts[cName])
+			continue
+		}
+		if c.resumed(c.airCharts[cName]) {
+			c.logCtx(ctx, "chart %s was applied by the interrupted apply, resuming after it", cName)
+			for _, chpc := range c.ConvertCharts(c.airCharts[cName]) {
+				c.reportProgress(chpc, ChartReady)
+			}
+			continue
+		}
+		chartNames = append(chartNames, cName)
+	}
+	return chartNames
+}
+
+// InstallGroup installs the charts of the chart group with its hooks, like
+// an apply does, canary charts first. Ready charts aren't checkpointed.
+func (c *RunCommand) InstallGroup(ctx context.Context, cgName string, charts, canary []string,
 	restConfig *rest.Config) error {
+	ctx = log.IntoContext(ctx, c.logger().With("chart_group", cgName))
+	return c.installGroup(ctx, cgName, charts, canary, restConfig)
+}
 
-	log.Printf("installing chart %s %s %s", chart.GetName(), chart.Name, chart.Namespace)
-	updated := false
-	var prevGen int64
-	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(chart)
-	if err != nil {
+func (c *RunCommand) installGroup(ctx context.Context, cgName string, chartNames, canary []string,
+	k8sConfig *rest.Config) error {
+	cg := c.airGroups[cgName]
+	sequenced := cg.IsSequenced(c.airManifest.ChartGroupDefaults)
+	if err := c.runHooks(ctx, k8sConfig, &cg.Hooks, hooks.Event{Phase: hooks.Pre, ChartGroup: cgName}); err != nil {
+		return err
+	}
+	if len(canary) > 0 {
+		var first, rest []string
+		for _, cName := range chartNames {
+			if slices.Contains(canary, cName) {
+				first = append(first, cName)
+			} else {
+				rest = append(rest, cName)
+			}
+		}
+		if len(first) > 0 && len(rest) > 0 {
+			c.logCtx(ctx, "installing canary charts of group %s first: %s", cgName, strings.Join(first, ", "))
+			if err := c.runCharts(ctx, cgName, sequenced, first, k8sConfig); err != nil {
+				return fmt.Errorf("%w, halting chart group %s before its other %d charts: %w",
+					ErrCanaryFailed, cgName, len(rest), err)
+			}
+			c.logCtx(ctx, "canary charts of group %s are ready, installing the other %d charts", cgName, len(rest))
+			chartNames = rest
+		}
+	}
+	if err := c.runCharts(ctx, cgName, sequenced, chartNames, k8sConfig); err != nil {
 		return err
 	}
+	return c.runHooks(ctx, k8sConfig, &cg.Hooks, hooks.Event{Phase: hooks.Post, ChartGroup: cgName})
+}
 
-	if oldObj, err := resClient.Namespace(chart.Namespace).Get(
-		context.Background(), chart.GetName(), metav1.GetOptions{}); err != nil {
-		log.Printf("unable to get chart %s: %s, creating", chart.Name, err.Error())
-		if _, err = resClient.Namespace(chart.Namespace).Create(
-			context.Background(), &unstructured.Unstructured{Object: obj}, metav1.CreateOptions{}); err != nil {
+// runCharts installs the charts of a chart group
+func (c *RunCommand) runCharts(ctx context.Context, cgName string, sequenced bool, chartNames []string,
+	k8sConfig *rest.Config) error {
+	if !sequenced && c.hasDependencies(chartNames) {
+		c.logCtx(ctx, "installing charts of group %s as their dependencies become ready", cgName)
+		return c.runDependencies(ctx, chartNames, k8sConfig)
+	} else if !sequenced {
+		eg := errgroup.Group{}
+		if c.MaxParallel > 0 {
+			eg.SetLimit(c.MaxParallel)
+		}
+		for _, cName := range chartNames {
+			for _, chpc := range c.ConvertCharts(c.airCharts[cName]) {
+				c.logCtx(ctx, "adding 1 chart to wg %s, namespace %s", cName, chpc.Namespace)
+				eg.Go(func() error {
+					return c.installChart(ctx, chpc, k8sConfig)
+				})
+			}
+		}
+		if err := eg.Wait(); err != nil {
 			return err
 		}
-		log.Printf("chart has been successfully created %s", chart.Name)
 	} else {
-		prevGen = oldObj.GetGeneration()
-		uObj := &unstructured.Unstructured{Object: obj}
-		uObj.SetResourceVersion(oldObj.GetResourceVersion())
-		log.Printf("chart %s was found, updating", chart.Name)
-		if _, err = resClient.Namespace(chart.Namespace).Update(
-			context.Background(), uObj, metav1.UpdateOptions{}); err != nil {
-			log.Printf("resource update error: %s", err.Error())
-			if strings.Contains(err.Error(), "the object has been modified") {
-				log.Printf("resource expired, retrying %s", err.Error())
-				return c.InstallChart(chart, resClient, restConfig)
+		for _, cName := range chartNames {
+			for _, chpc := range c.ConvertCharts(c.airCharts[cName]) {
+				c.logCtx(ctx, "sequential chart install %s, namespace %s", cName, chpc.Namespace)
+				if err := c.installChart(ctx, chpc, k8sConfig); err != nil {
+					return err
+				}
 			}
-			return err
 		}
-		log.Printf("chart has been successfully updated %s", chart.Name)
-		updated = true
 	}
+	return nil
+}
+
+// applyChange applies the change, if the ArmadaChart was modified meanwhile
+// the change is prepared again and retried without rerunning the hooks
+func (c *RunCommand) applyChange(ctx context.Context, b Backend, chart *armadav1.ArmadaChart,
+	change *Change) (changed bool, err error) {
+	modified := func(err error) bool { return strings.Contains(err.Error(), "the object has been modified") }
+	err = retry.OnError(retry.DefaultRetry, modified, func() error {
+		if changed, err = b.Apply(ctx, change); err == nil || !modified(err) {
+			return err
+		}
+		c.logCtx(ctx, "resource expired, retrying %s", err.Error())
+		prepared, prepareErr := b.Prepare(ctx, chart)
+		if prepareErr != nil {
+			return prepareErr
+		}
+		prepared.Timeout, prepared.Atomic, prepared.Observers = change.Timeout, change.Atomic, change.Observers
+		*change = *prepared
+		return err
+	})
+	return changed, err
+}
+
+// InstallChart installs the chart with the backend of the command, like
+// an apply does, the ready chart isn't checkpointed
+func (c *RunCommand) InstallChart(ctx context.Context, chart *armadav1.ArmadaChart, restConfig *rest.Config) error {
+	return c.installChart(ctx, chart, restConfig)
+}
+
+func (c *RunCommand) installChart(ctx context.Context, chart *armadav1.ArmadaChart,
+	restConfig *rest.Config) (err error) {
+	ctx, span := tracing.Start(ctx, "install chart", attribute.String("chart", chart.Name),
+		attribute.String("namespace", chart.Namespace), attribute.String("release", chart.Spec.Release))
+	defer func() { tracing.End(span, err) }()
+	ctx = log.IntoContext(ctx, log.FromContext(ctx, c.logger()).With(
+		"chart", chart.Name, "namespace", chart.Namespace, "release", chart.Spec.Release))
 
-	wOpts := armadawait.WaitOptions{
-		RestConfig: restConfig,
-		Namespace:  chart.Namespace,
-		LabelSelector: fmt.Sprintf("%s=%s", armadav1.ArmadaChartLabel,
-			fmt.Sprintf("%s-%s", c.airManifest.ReleasePrefix, chart.Spec.Release)),
-		ResourceType: "armadacharts",
-		Timeout:      time.Second * time.Duration(chart.Spec.Wait.Timeout),
-		Logger:       zap.New(zap.WriteTo(c.Out), zap.ConsoleEncoder()),
+	b, err := c.backend(restConfig)
+	if err != nil {
+		return err
 	}
+	c.logCtx(ctx, "installing chart %s %s %s", chart.GetName(), chart.Name, chart.Namespace)
+	c.reportProgress(chart, ChartInstalling)
+	c.outcome.start(chart, c.clusterName(restConfig))
+	defer func() {
+		c.outcome.finish(chart, err)
+		if err != nil {
+			c.reportProgress(chart, ChartFailed)
+		}
+	}()
 
-	err = wOpts.Wait(context.Background())
-	log.Printf("finished with chart %s", chart.GetName())
-	if !updated && c.Installed != nil {
-		*c.Installed = append(*c.Installed, chart.Name)
-	} else if updated && c.Updated != nil {
-		if updObj, err := resClient.Namespace(chart.Namespace).Get(
-			context.Background(), chart.GetName(), metav1.GetOptions{}); err != nil {
-			log.Printf("unable to get current generation of chart %s: %s", chart.Name, err.Error())
+	change, err := b.Prepare(ctx, chart)
+	if err != nil {
+		return err
+	}
+	change.Timeout = c.waitTimeout(chart)
+	change.Atomic = c.atomic(chart)
+	change.Observers = []armadawait.Observer{c.outcome.observer(chart)}
+	// edited charts are left untouched, only waited for
+	edited := change.Action == ActionUpgrade && change.Diff != "" && !c.ForceReconcile
+	changed := false
+	switch {
+	case change.Action == ActionNone:
+		c.logCtx(ctx, "chart %s is unchanged and ready, skipping update and wait", chart.Name)
+		if change.Relabel {
+			c.logCtx(ctx, "labeling chart %s as managed by %s", chart.Name, ManagedByValue)
+			if _, err = c.applyChange(ctx, b, chart, change); err != nil {
+				return err
+			}
+		}
+		c.reportProgress(chart, ChartReady)
+		c.applied(ctx, chart)
+		return nil
+	case edited:
+		c.logCtx(ctx, "WARNING: chart %s was edited on the cluster since the last apply, leaving it untouched, "+
+			"manifest changes are not applied, use --force-reconcile to overwrite (-last applied +live):\n%s",
+			chart.Name, change.Diff)
+	default:
+		if change.Diff != "" {
+			c.logCtx(ctx, "chart %s was edited on the cluster since the last apply, overwriting (-last applied +live):\n%s",
+				chart.Name, change.Diff)
+		}
+		if change.Action == ActionInstall {
+			c.logCtx(ctx, "chart %s not found, creating", chart.Name)
 		} else {
-			newGen := updObj.GetGeneration()
-			// Chart actually has been updated
-			if newGen > prevGen {
-				*c.Updated = append(*c.Updated, chart.Name)
+			c.logCtx(ctx, "chart %s was found, updating", chart.Name)
+		}
+		if err = c.runChartHooks(ctx, restConfig, chart, hooks.Pre); err != nil {
+			return err
+		}
+		if changed, err = c.applyChange(ctx, b, chart, change); err != nil {
+			if change.Action == ActionUpgrade && change.Atomic {
+				err = c.rollback(ctx, b, change, err)
 			}
+			return err
+		}
+		if change.Action == ActionInstall {
+			c.logCtx(ctx, "chart has been successfully created %s", chart.Name)
+		} else {
+			c.logCtx(ctx, "chart has been successfully updated %s", chart.Name)
+		}
+	}
+
+	waitCtx, waitSpan := tracing.Start(ctx, "wait", attribute.String("chart", chart.Name),
+		attribute.String("timeout", change.Timeout.String()))
+	err = b.Wait(waitCtx, change)
+	if err == nil && !c.DryRun {
+		err = c.waitResources(waitCtx, chart, restConfig, change.Timeout)
+	}
+	tracing.End(waitSpan, err)
+	if err == nil && !edited {
+		err = c.runTests(ctx, chart, restConfig)
+	}
+	if err != nil && change.Action == ActionUpgrade && !edited && change.Atomic {
+		err = c.rollback(ctx, b, change, err)
+	}
+	if err == nil && !edited {
+		err = c.runChartHooks(ctx, restConfig, chart, hooks.Post)
+	}
+	c.logCtx(ctx, "finished with chart %s", chart.GetName())
+	if err == nil {
+		c.reportProgress(chart, ChartReady)
+		if !edited {
+			c.applied(ctx, chart)
+		}
+	}
+	if changed && change.Action == ActionInstall {
+		c.outcome.installed()
+		if c.Installed != nil {
+			*c.Installed = append(*c.Installed, chart.Name)
+		}
+	} else if changed {
+		c.outcome.updated()
+		if c.Updated != nil {
+			*c.Updated = append(*c.Updated, chart.Name)
 		}
 	}
 	return err
 }
 
+// waitTimeout returns the wait timeout of the chart: an override of
+// ChartTimeouts, data.wait.timeout, WaitTimeout or DefaultWaitTimeout
+func (c *RunCommand) waitTimeout(chart *armadav1.ArmadaChart) time.Duration {
+	if d, ok := c.ChartTimeouts[chart.Spec.Release]; ok {
+		return d
+	}
+	if name, _ := c.sourceChart(chart); name != "" {
+		if d, ok := c.ChartTimeouts[name]; ok {
+			return d
+		}
+	}
+	if _, source := c.sourceChart(chart); source != nil && source.Extensions.Wait.Timeout > 0 {
+		return time.Duration(source.Extensions.Wait.Timeout)
+	}
+	if chart.Spec.Wait.Timeout > 0 {
+		return time.Second * time.Duration(chart.Spec.Wait.Timeout)
+	}
+	if c.WaitTimeout > 0 {
+		return c.WaitTimeout
+	}
+	return DefaultWaitTimeout
+}
+
+func (c *RunCommand) logf(format string, v ...interface{}) {
+	c.logCtx(context.Background(), format, v...)
+}
+
+// logCtx logs with the fields of the logger carried by ctx, e.g. the chart
+func (c *RunCommand) logCtx(ctx context.Context, format string, v ...interface{}) {
+	c.record(transcript.Entry{Action: transcript.Log, Message: fmt.Sprintf(format, v...)})
+	log.FromContext(ctx, c.logger()).Printf(format, v...)
+}
+
+// logger returns the logger of the command, the global one if not set
+func (c *RunCommand) logger() *log.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return log.Default()
+}
+
+func (c *RunCommand) record(e transcript.Entry) {
+	if c.Transcript == nil {
+		return
+	}
+	if err := c.Transcript.Record(e); err != nil {
+		log.Printf("unable to write transcript: %s", err.Error())
+	}
+}
+
+// reportProgress records the state of the chart by its namespace and name,
+// charts deployed into several namespaces share the name
+func (c *RunCommand) reportProgress(chart *armadav1.ArmadaChart, state ChartState) {
+	key := resultKey(chart)
+	c.outcome.set(key, state)
+	c.record(transcript.Entry{Action: transcript.ChartState, Chart: key, State: string(state)})
+	if c.Progress != nil {
+		c.Progress(key, state)
+	}
+}
+
+// ConvertCharts returns ArmadaCharts for every target namespace of the chart
+func (c *RunCommand) ConvertCharts(chart *AirshipChart) []*armadav1.ArmadaChart {
+	charts := make([]*armadav1.ArmadaChart, 0, len(chart.TargetNamespaces()))
+	for _, ns := range chart.TargetNamespaces() {
+		ac := c.ConvertChart(chart)
+		if name, ok := c.adopted[ns+"/"+chart.Release]; ok {
+			ac.Name = name
+		}
+		ac.Namespace = ns
+		ac.Spec.Namespace = ns
+		charts = append(charts, ac)
+	}
+	return charts
+}
+
 func (c *RunCommand) ConvertChart(chart *AirshipChart) *armadav1.ArmadaChart {
 	return &armadav1.ArmadaChart{
 		TypeMeta: metav1.TypeMeta{
@@ -238,151 +1064,244 @@ func (c *RunCommand) ConvertChart(chart *AirshipChart) *armadav1.ArmadaChart {
 			APIVersion: armadav1.ArmadaChartAPIVersion,
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-%s", c.airManifest.ReleasePrefix, chart.Release),
+			Name:      c.chartName(chart.Release),
 			Namespace: chart.Namespace,
-			Labels: map[string]string{
-				armadav1.ArmadaChartLabel: fmt.Sprintf("%s-%s", c.airManifest.ReleasePrefix, chart.Release),
-			},
+			Labels:    c.ReleaseLabels(c.releaseLabelValue(chart)),
 		},
-		Spec: chart.ArmadaChartSpec,
+		Spec: c.spec(chart),
 	}
 }
 
-func (c *RunCommand) CheckCRD(restConfig *rest.Config) error {
-	crdClient := apiextension.NewForConfigOrDie(restConfig)
-	if _, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(), "armadacharts.armada.airshipit.org", metav1.GetOptions{}); err != nil {
-		if apierrors.IsNotFound(err) {
-			log.Printf("armadacharts CRD not found, creating: %s", err.Error())
-			objToapp, err := c.ReadCRD()
-			if err != nil {
-				return err
-			}
-			_, err = crdClient.ApiextensionsV1().CustomResourceDefinitions().Create(context.Background(), objToapp, metav1.CreateOptions{})
-			if err != nil {
-				log.Printf("error while creating crd %t", err)
-				return err
-			}
-		} else {
-			return err
-		}
+// spec returns the ArmadaChart spec of the chart, pointing at the chart
+// fetched by Sources if there is one
+func (c *RunCommand) spec(chart *AirshipChart) armadav1.ArmadaChartSpec {
+	spec := chart.ArmadaChartSpec
+	if src, ok := c.sources[chart]; ok {
+		spec.Source = src
 	}
-	return nil
+	return spec
 }
 
-func (c *RunCommand) ReadCRD() (*apiextv1.CustomResourceDefinition, error) {
-	sch := runtime.NewScheme()
-	_ = scheme.AddToScheme(sch)
-	_ = apiextv1.AddToScheme(sch)
+// crdEstablishTimeout limits how long CheckCRD waits for the API server to
+// serve a created or upgraded CRD
+const crdEstablishTimeout = time.Minute
 
-	decode := serializer.NewCodecFactory(sch).UniversalDeserializer().Decode
-	data, err := os.ReadFile("crd.yaml")
+// CheckCRD creates the ArmadaChart CRD if it is missing and upgrades it if
+// the cluster has an older revision than CRDPath or the embedded one. A CRD
+// without revision, e.g. installed by armada-operator, only gets the served
+// versions it lacks. It waits until the CRD is established and fails if it
+// doesn't serve the ArmadaChart version of armada-go.
+func (c *RunCommand) CheckCRD(restConfig *rest.Config) error {
+	want, err := c.ReadCRD()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	obj, _, err := decode(data, nil, nil)
-	if err != nil {
-		return nil, err
+	crds := apiextension.NewForConfigOrDie(restConfig).ApiextensionsV1().CustomResourceDefinitions()
+	stampOwner(want, c.ownerLabels(), c.ownerAnnotations())
+	live, err := crds.Get(context.Background(), crd.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		c.logf("armadacharts CRD not found, creating: %s", err.Error())
+		if live, err = crds.Create(context.Background(), want, metav1.CreateOptions{FieldManager: FieldManager}); err != nil {
+			c.logf("error while creating crd %s", err.Error())
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if reason := crd.NeedsUpgrade(live, want); reason != "" {
+		c.logf("armadacharts CRD is outdated, %s, upgrading", reason)
+		up := crd.Upgrade(live, want)
+		if live, err = crds.Update(context.Background(), up, metav1.UpdateOptions{FieldManager: FieldManager}); err != nil {
+			c.logf("error while upgrading crd %s", err.Error())
+			return err
+		}
 	}
 
-	crdTo := obj.(*apiextv1.CustomResourceDefinition)
-	return crdTo, nil
+	if err := crd.CheckVersion(live, armadav1.ArmadaChartVersion); err != nil {
+		return err
+	}
+	return c.waitCRDEstablished(crds, live)
 }
 
-func (c *RunCommand) VerifyNamespaces(rsc *rest.Config) error {
-	cs := kubernetes.NewForConfigOrDie(rsc)
-
-	namespaces := make(map[string]bool)
-	for _, cgname := range c.airManifest.ChartGroups {
-		cg := c.airGroups[cgname]
-		for _, chrt := range cg.ChartGroup {
-			ns := c.airCharts[chrt].Namespace
-			if _, ok := namespaces[ns]; !ok {
-				namespaces[ns] = true
-			}
-		}
+// waitCRDEstablished polls the CRD until the API server serves it, so the
+// first ArmadaChart isn't rejected with "no matches for kind"
+func (c *RunCommand) waitCRDEstablished(crds apiextv1client.CustomResourceDefinitionInterface,
+	live *apiextv1.CustomResourceDefinition) error {
+	ok, reason := crd.Established(live)
+	if ok {
+		return nil
 	}
-	for k, _ := range namespaces {
-		log.Printf("processing namespace %s", k)
-		if _, err := cs.CoreV1().Namespaces().Get(context.Background(), k, metav1.GetOptions{}); err != nil {
-			if apierrors.IsNotFound(err) {
-				log.Printf("namespace %s not found, creating", k)
-				if _, err = cs.CoreV1().Namespaces().Create(context.Background(), &v1.Namespace{
-					ObjectMeta: metav1.ObjectMeta{Name: k}}, metav1.CreateOptions{}); err != nil {
-					return err
-				}
-			} else {
-				return err
+	c.logf("waiting for armadacharts CRD to be established")
+	err := k8swait.PollUntilContextTimeout(context.Background(), time.Second, crdEstablishTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			got, err := crds.Get(ctx, crd.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
 			}
-		}
+			ok, reason = crd.Established(got)
+			return ok, nil
+		})
+	if err != nil {
+		return fmt.Errorf("armadacharts CRD is not established after %s: %s: %w", crdEstablishTimeout, reason, err)
 	}
-	log.Printf("all namespaces validated successfully")
+	c.logf("armadacharts CRD is established")
 	return nil
 }
 
+// ReadCRD returns the CRD from CRDPath, or the one embedded in armada-go
+func (c *RunCommand) ReadCRD() (*apiextv1.CustomResourceDefinition, error) {
+	return crd.Load(c.CRDPath)
+}
+
 func (c *RunCommand) ValidateManifests() error {
 	if c.airManifest == nil {
 		return errors.New("no or multiple armada manifest found")
 	}
 
+	if err := c.airManifest.Namespaces.Validate(); err != nil {
+		return err
+	}
+
 	for _, cgname := range c.airManifest.ChartGroups {
 		if cg, ok := c.airGroups[cgname]; ok {
 			for _, cName := range cg.ChartGroup {
 				if chrt, ok := c.airCharts[cName]; ok {
-					if chrt.Release == "" || chrt.Namespace == "" {
+					if chrt.Release == "" || (chrt.Namespace == "" && len(chrt.Extensions.Namespaces) == 0) {
 						return errors.New(fmt.Sprintf("chart document with name %s found does not have release or ns", cName))
 					}
+					if err := c.validateReleaseLabel(chrt); err != nil {
+						return fmt.Errorf("chart %s: %w", cName, err)
+					}
+					if err := chrt.Extensions.Hooks.Validate(); err != nil {
+						return fmt.Errorf("chart %s: %w", cName, err)
+					}
+					if src := chrt.Extensions.Source; src != (source.Source{}) {
+						if err := src.Validate(); err != nil {
+							return fmt.Errorf("chart %s: %w", cName, err)
+						}
+					}
+					util.WarnSuspiciousTimeout(fmt.Sprintf("chart %s wait", cName),
+						time.Duration(chrt.Extensions.Wait.Timeout))
 				} else {
 					return errors.New(fmt.Sprintf("no chart document with name %s found", cName))
 				}
 			}
+			if err := cg.Hooks.Validate(); err != nil {
+				return fmt.Errorf("chart group %s: %w", cgname, err)
+			}
 		} else {
 			return errors.New(fmt.Sprintf("no group document with name %s found", cgname))
 		}
 	}
-	log.Printf("all airship manifests validated successfully")
+	if err := c.validateDependencies(); err != nil {
+		return err
+	}
+	if err := c.validateCanaries(); err != nil {
+		return err
+	}
+	c.logf("all airship manifests validated successfully")
 	return nil
 }
 
-func (c *RunCommand) ParseManifests() error {
-	log.Printf("parsing manifests started, path: %s", c.Manifests)
-
-	var f io.ReadCloser
-	u, err := url.Parse(c.Manifests)
+// normalizeChart converts humane wait timeouts of the chart document, like
+// "15m" or "1h30m", into the number of seconds expected by ArmadaChart. The
+// durations themselves are kept by AirshipWaitExtensions.
+func normalizeChart(buf []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, err
+	}
+	wait, found, _ := unstructured.NestedMap(doc, "data", "wait")
+	if !found {
+		return buf, nil
+	}
+	changed, err := normalizeTimeout(wait)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("wait timeout: %w", err)
 	}
-	if u.Scheme == "" {
-		f, err = os.Open(c.Manifests)
-		if err != nil {
-			return err
-		}
-	} else if u.Scheme == "deckhand+http" {
-		reg, err := regexp.Compile("^[^+]+\\+")
-		if err != nil {
-			return err
-		}
-		deckhandUrl := reg.ReplaceAllString(c.Manifests, "")
-		req, err := http.NewRequest("GET", deckhandUrl, nil)
-		if err != nil {
-			return err
+	resources, _ := wait["resources"].([]interface{})
+	for i, res := range resources {
+		rm, ok := res.(map[string]interface{})
+		if !ok {
+			continue
 		}
-		token, err := auth.Authenticate()
+		resChanged, err := normalizeTimeout(rm)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("wait resource %d timeout: %w", i, err)
 		}
-		req.Header.Set("X-Auth-Token", token)
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
+		changed = changed || resChanged
+	}
+	if !changed {
+		return buf, nil
+	}
+	if err = unstructured.SetNestedField(doc, wait, "data", "wait"); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// normalizeTimeout replaces a timeout given as string by seconds, rounded
+// up as zero would mean no timeout
+func normalizeTimeout(m map[string]interface{}) (bool, error) {
+	s, ok := m["timeout"].(string)
+	if !ok {
+		return false, nil
+	}
+	d, err := util.ParseDuration(s)
+	if err != nil {
+		return false, err
+	}
+	m["timeout"] = int64((d + time.Second - 1) / time.Second)
+	return true, nil
+}
+
+// ParseManifests reads the manifests from their source, see documentSource
+func (c *RunCommand) ParseManifests() error {
+	return c.parseManifests(context.Background())
+}
+
+func (c *RunCommand) parseManifests(ctx context.Context) error {
+	src, err := c.documentSource()
+	if err != nil {
+		return err
+	}
+	c.logf("parsing manifests started, path: %s", src)
+	f, err := src.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if c.ManifestKey != "" {
+		if r, err = c.verifyManifests(src, f); err != nil {
 			return err
 		}
-		f = resp.Body
 	}
-	defer f.Close()
+	return c.ParseDocuments(r)
+}
+
+// documentSource returns Source, a source reading ManifestReader or the
+// source of Manifests
+func (c *RunCommand) documentSource() (DocumentSource, error) {
+	if c.Source != nil {
+		return c.Source, nil
+	}
+	if c.ManifestReader != nil {
+		return &ReaderSource{R: c.ManifestReader, Name: c.Manifests}, nil
+	}
+	var keystone config.KeystoneConfig
+	if c.Config != nil {
+		keystone = c.Config.Keystone
+	}
+	return NewDocumentSource(c.Manifests, keystone)
+}
 
+// ParseDocuments reads the manifest, chart group and chart documents from
+// a multi-document YAML stream and validates them
+func (c *RunCommand) ParseDocuments(r io.Reader) error {
 	c.airCharts = map[string]*AirshipChart{}
 	c.airGroups = map[string]*AirshipChartGroup{}
-	multidocReader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	digest := sha256.New()
+	multidocReader := utilyaml.NewYAMLReader(bufio.NewReader(io.TeeReader(r, digest)))
 	for {
 		buf, err := multidocReader.Read()
 		if err != nil {
@@ -391,39 +1310,72 @@ func (c *RunCommand) ParseManifests() error {
 			}
 			return err
 		}
-		var typeMeta AirshipDocument
-		if err := yaml.Unmarshal(buf, &typeMeta); err != nil {
-			log.Printf("unmarshalling error %s, continuing...", err.Error())
+		sch, name, ok, err := armadaschema.Detect(buf)
+		if err != nil {
+			c.logf("skipping document %s: %s, continuing...", name, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if _, err := armadaschema.Negotiate(sch, armadaschema.V1); err != nil {
+			c.logf("skipping document %s: %s", name, err.Error())
 			continue
 		}
 
-		if typeMeta.Schema == "armada/Manifest/v1" {
-			if (c.TargetManifest != "" && typeMeta.Metadata.Name == c.TargetManifest) ||
+		if sch.Kind == armadaschema.KindManifest {
+			if (c.TargetManifest != "" && name == c.TargetManifest) ||
 				(c.TargetManifest == "" && c.airManifest == nil) {
 				var airManifest AirshipManifest
 				if err := yaml.Unmarshal(buf, &airManifest); err != nil {
 					return err
 				}
-				log.Printf("found airship manifest %s", airManifest.Metadata.Name)
+				c.logf("found airship manifest %s", airManifest.Metadata.Name)
 				c.airManifest = &airManifest
 			}
 		}
-		if typeMeta.Schema == "armada/ChartGroup/v1" {
+		if sch.Kind == armadaschema.KindChartGroup {
 			var cg AirshipChartGroup
 			if err := yaml.Unmarshal(buf, &cg); err != nil {
 				return err
 			}
-			c.airGroups[typeMeta.Metadata.Name] = &cg
+			c.airGroups[name] = &cg
 		}
 
-		if typeMeta.Schema == "armada/Chart/v1" {
+		if sch.Kind == armadaschema.KindChart {
+			var ext struct {
+				Data AirshipChartExtensions `json:"data,omitempty"`
+			}
+			if err := yaml.Unmarshal(buf, &ext); err != nil {
+				return fmt.Errorf("chart %s: %w", name, err)
+			}
+			if buf, err = normalizeChart(buf); err != nil {
+				return fmt.Errorf("chart %s: %w", name, err)
+			}
 			var chrt AirshipChart
 			if err := yaml.Unmarshal(buf, &chrt); err != nil {
 				return err
 			}
-			c.airCharts[typeMeta.Metadata.Name] = &chrt
+			chrt.Extensions = ext.Data
+			c.airCharts[name] = &chrt
 		}
 	}
+	c.manifestHash = "sha256:" + hex.EncodeToString(digest.Sum(nil))
 
 	return c.ValidateManifests()
 }
+
+// Manifest returns the parsed manifest
+func (c *RunCommand) Manifest() *AirshipManifest {
+	return c.airManifest
+}
+
+// ChartGroup returns the parsed chart group by name
+func (c *RunCommand) ChartGroup(name string) *AirshipChartGroup {
+	return c.airGroups[name]
+}
+
+// Chart returns the parsed chart by name
+func (c *RunCommand) Chart(name string) *AirshipChart {
+	return c.airCharts[name]
+}
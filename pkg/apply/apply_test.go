@@ -0,0 +1,267 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/util"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// newTestCommand parses the manifest fixture of testdata with the fake
+// backend recorded by the returned command
+func newTestCommand(t *testing.T, fixture string) (*RunCommand, *RecordingBackend) {
+	t.Helper()
+	rec := &RecordingBackend{Backend: &FakeBackend{}}
+	c := &RunCommand{
+		Config:       &config.Config{},
+		Manifests:    filepath.Join("testdata", fixture),
+		Out:          io.Discard,
+		Log:          log.New(io.Discard),
+		ChartBackend: rec,
+		MaxParallel:  1,
+	}
+	if err := c.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ParseManifests(); err != nil {
+		t.Fatal(err)
+	}
+	c.outcome = newOutcome()
+	return c, rec
+}
+
+// applyGroups installs the chart groups of the parsed manifest like run
+// does once the cluster is prepared
+func applyGroups(c *RunCommand) error {
+	for _, cgName := range c.airManifest.ChartGroups {
+		if err := c.runGroup(context.Background(), cgName, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// golden compares got with the golden file of testdata, -update rewrites it
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from %s, run go test -update to accept:\n--- got\n%s\n--- want\n%s",
+			name, path, got, want)
+	}
+}
+
+func callLines(calls []BackendCall) string {
+	var b strings.Builder
+	for _, call := range calls {
+		b.WriteString(call.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestPlan(t *testing.T) {
+	c, _ := newTestCommand(t, "site.yaml")
+	var b strings.Builder
+	if err := c.printPlan(&b); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "site.plan", []byte(b.String()))
+}
+
+func TestConvertCharts(t *testing.T) {
+	c, _ := newTestCommand(t, "site.yaml")
+	type converted struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Release     string            `json:"release"`
+		Labels      map[string]string `json:"labels"`
+		WaitTimeout int               `json:"wait_timeout"`
+		WaitLabels  map[string]string `json:"wait_labels,omitempty"`
+		Values      json.RawMessage   `json:"values,omitempty"`
+	}
+	var got []converted
+	for _, chart := range c.Charts() {
+		cv := converted{
+			Name:        chart.Name,
+			Namespace:   chart.Namespace,
+			Release:     chart.Spec.Release,
+			Labels:      chart.Labels,
+			WaitTimeout: int(chart.Spec.Wait.Timeout),
+			WaitLabels:  chart.Spec.Wait.Labels,
+		}
+		if chart.Spec.Values != nil {
+			cv.Values = chart.Spec.Values.Raw
+		}
+		got = append(got, cv)
+	}
+	buf, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "site.charts", append(buf, '\n'))
+}
+
+func TestParseManifestsErrors(t *testing.T) {
+	for fixture, want := range map[string]string{
+		"no-manifest.yaml":        "no or multiple armada manifest found",
+		"missing-group.yaml":      "no group document with name tools found",
+		"missing-chart.yaml":      "no chart document with name b found",
+		"missing-namespace.yaml":  "chart document with name a found does not have release or ns",
+		"self-dependency.yaml":    "chart a depends on itself",
+		"dependency-cycle.yaml":   "dependency cycle",
+		"unknown-dependency.yaml": "chart a depends on chart mariadb which is not part of manifest broken",
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			c := &RunCommand{
+				Config:    &config.Config{},
+				Manifests: filepath.Join("testdata", "errors", fixture),
+				Log:       log.New(io.Discard),
+			}
+			if err := c.LoadConfig(); err != nil {
+				t.Fatal(err)
+			}
+			err := c.ParseManifests()
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("got error %v, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestApplyOrder(t *testing.T) {
+	c, rec := newTestCommand(t, "sequenced.yaml")
+	if err := applyGroups(c); err != nil {
+		t.Fatal(err)
+	}
+	first := len(rec.Calls())
+	// applying the manifest again leaves the unchanged charts alone
+	if err := applyGroups(c); err != nil {
+		t.Fatal(err)
+	}
+	calls := rec.Calls()
+	golden(t, "sequenced.calls", []byte(callLines(calls[:first])+"---\n"+callLines(calls[first:])))
+}
+
+func TestApplyFailureHaltsSequence(t *testing.T) {
+	c, rec := newTestCommand(t, "sequenced.yaml")
+	rec.Backend.(*FakeBackend).WaitErrors = map[string]error{"airship-rabbitmq": errors.New("not ready")}
+	err := applyGroups(c)
+	if err == nil || err.Error() != "not ready" {
+		t.Fatalf("got error %v, want not ready", err)
+	}
+	for _, call := range rec.Calls() {
+		if strings.Contains(call.Chart, "keystone") {
+			t.Errorf("chart of the later group was processed after the failure: %s", call)
+		}
+	}
+	for _, r := range c.Results() {
+		if r.Chart == "airship-rabbitmq" && (r.State != ChartFailed || r.Reason != "not ready") {
+			t.Errorf("got result %+v, want failed", r)
+		}
+	}
+}
+
+func TestAtomicRollback(t *testing.T) {
+	c, rec := newTestCommand(t, "sequenced.yaml")
+	fake := rec.Backend.(*FakeBackend)
+	chart := c.ConvertCharts(c.Chart("mariadb"))[0]
+	if err := c.InstallChart(context.Background(), chart, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Atomic = true
+	chart.Spec.Wait.Timeout = 42
+	fake.WaitErrors = map[string]error{chart.Name: errors.New("not ready")}
+	err := c.InstallChart(context.Background(), chart, nil)
+	if err == nil || err.Error() != "not ready, the previous release was restored" {
+		t.Fatalf("got error %v, want the previous release restored", err)
+	}
+	if fake.Applied(chart) {
+		t.Error("the failed spec is still applied")
+	}
+	calls := rec.Calls()
+	if last := calls[len(calls)-1]; last.Method != "rollback" {
+		t.Errorf("got last call %s, want rollback", last)
+	}
+}
+
+func TestSiteStatusCountsNamespaces(t *testing.T) {
+	c, _ := newTestCommand(t, "sequenced.yaml")
+	progress := map[string]ChartState{}
+	c.Progress = func(chart string, state ChartState) { progress[chart] = state }
+	if err := applyGroups(c); err != nil {
+		t.Fatal(err)
+	}
+	keystone := c.ConvertCharts(c.Chart("keystone"))
+	for _, ns := range []string{"region-a", "region-b"} {
+		if state := progress[ns+"/"+keystone[0].Name]; state != ChartReady {
+			t.Errorf("got state %q of keystone in %s, want ready", state, ns)
+		}
+	}
+	s := c.SiteStatus(nil)
+	if want := len(c.Charts()); s.Charts != want || s.Ready != want || len(progress) != want {
+		t.Errorf("got %d charts, %d ready and %d reported, want %d", s.Charts, s.Ready, len(progress), want)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	c, _ := newTestCommand(t, "site.yaml")
+	if got := c.waitTimeout(c.ConvertCharts(c.Chart("mariadb"))[0]); got != 10*time.Minute {
+		t.Errorf("got wait timeout %s of mariadb, want 10m", got)
+	}
+
+	// ArmadaChart gets whole seconds rounded up, zero would mean no timeout
+	buf, err := normalizeChart([]byte(`{"data":{"wait":{"timeout":"1500ms","resources":[{"timeout":"200ms"}]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":{"wait":{"resources":[{"timeout":1}],"timeout":2}}}`; string(buf) != want {
+		t.Errorf("got %s, want %s", buf, want)
+	}
+
+	var ext AirshipChartExtensions
+	if err := json.Unmarshal([]byte(`{"wait":{"timeout":"1500ms","resources":[{"timeout":0.2}]}}`), &ext); err != nil {
+		t.Fatal(err)
+	}
+	if ext.Wait.Timeout != util.Duration(1500*time.Millisecond) ||
+		ext.Wait.Resources[0].Timeout != util.Duration(200*time.Millisecond) {
+		t.Errorf("got timeouts %s and %s, want 1.5s and 200ms",
+			time.Duration(ext.Wait.Timeout), time.Duration(ext.Wait.Resources[0].Timeout))
+	}
+}
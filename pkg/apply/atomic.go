@@ -0,0 +1,51 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// atomic returns whether a failed update of the chart is undone, data.atomic
+// of the chart document overrides Atomic
+func (c *RunCommand) atomic(chart *armadav1.ArmadaChart) bool {
+	if _, ch := c.sourceChart(chart); ch != nil && ch.Extensions.Atomic != nil {
+		return *ch.Extensions.Atomic
+	}
+	return c.Atomic
+}
+
+// rollback has the backend restore the release the chart had before the
+// failed update and wait for it. The returned error wraps the failure of
+// the update.
+func (c *RunCommand) rollback(ctx context.Context, b Backend, change *Change, failure error) error {
+	chart := change.Chart
+	restored, err := b.Rollback(context.WithoutCancel(ctx), change)
+	if !restored && err == nil {
+		c.logCtx(ctx, "chart %s failed without a change, nothing to restore", chart.Name)
+		return failure
+	} else if !restored {
+		return fmt.Errorf("%w, restoring its previous release failed: %w", failure, err)
+	}
+	c.logCtx(ctx, "chart %s failed, restored its previous release", chart.Name)
+	c.outcome.update(chart, func(r *ChartResult) { r.RolledBack = true })
+	if err != nil {
+		return fmt.Errorf("%w, the restored previous release didn't become ready either: %w", failure, err)
+	}
+	return fmt.Errorf("%w, the previous release was restored", failure)
+}
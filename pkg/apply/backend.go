@@ -0,0 +1,190 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Backends install the charts of a manifest
+const (
+	// BackendOperator creates ArmadaCharts which armada-operator installs
+	BackendOperator = "operator"
+	// BackendHelm installs the Helm releases with the Helm SDK, for clusters
+	// without armada-operator
+	BackendHelm = "helm"
+)
+
+// Backend executes the charts of an apply. The apply drives every chart
+// through Prepare, Apply and Wait, and Rollback if an atomic update failed;
+// hooks, tests and the waits of data.wait.resources are run by the apply.
+type Backend interface {
+	// Prepare compares the chart with what is deployed and returns the
+	// change Apply would make
+	Prepare(ctx context.Context, chart *armadav1.ArmadaChart) (*Change, error)
+	// Apply installs or upgrades the release, it returns whether the
+	// release was actually changed
+	Apply(ctx context.Context, change *Change) (bool, error)
+	// Wait blocks until the applied release is ready or change.Timeout expires
+	Wait(ctx context.Context, change *Change) error
+	// Rollback undoes a failed upgrade and waits for the previous release,
+	// it returns false if there was nothing to undo
+	Rollback(ctx context.Context, change *Change) (bool, error)
+	// Delete removes the release of the chart, deleting a missing release
+	// isn't an error
+	Delete(ctx context.Context, chart *armadav1.ArmadaChart) error
+}
+
+// ChangeAction is what a Backend does with a chart
+type ChangeAction string
+
+const (
+	// ActionInstall installs a release which isn't deployed yet
+	ActionInstall ChangeAction = "install"
+	// ActionUpgrade upgrades the deployed release
+	ActionUpgrade ChangeAction = "upgrade"
+	// ActionNone leaves the unchanged and ready release alone
+	ActionNone ChangeAction = "none"
+)
+
+// Change is a chart prepared by a Backend
+type Change struct {
+	Chart  *armadav1.ArmadaChart
+	Action ChangeAction
+	// Diff lists edits made on the cluster since the last apply, the
+	// upgrade is only applied with RunCommand.ForceReconcile then
+	Diff string
+	// Timeout limits Apply, Wait and Rollback
+	Timeout time.Duration
+	// Atomic undoes a failed install of the Helm backend
+	Atomic bool
+	// Observers are notified of the progress of Wait
+	Observers []armadawait.Observer
+	// Relabel applies an ActionNone change anyway as the release is
+	// unchanged, but lacks the ownership labels of the manifest
+	Relabel bool
+
+	// state is kept by the backend between the calls
+	state interface{}
+}
+
+// validateBackend checks the backend and the options it doesn't support
+func (c *RunCommand) validateBackend() error {
+	switch c.Backend {
+	case "":
+		c.Backend = BackendOperator
+	case BackendOperator:
+	case BackendHelm:
+		if c.Prune {
+			return fmt.Errorf("prune is not supported by the %s backend", BackendHelm)
+		}
+		if c.Adopt {
+			return fmt.Errorf("adopt is not supported by the %s backend", BackendHelm)
+		}
+		if c.GroupRunner != nil || c.DistributeNamespace != "" {
+			return fmt.Errorf("armada workers are not supported by the %s backend", BackendHelm)
+		}
+	default:
+		return fmt.Errorf("unknown backend %q, expected %s or %s", c.Backend, BackendOperator, BackendHelm)
+	}
+	return nil
+}
+
+// helmBackend returns whether releases are installed without ArmadaCharts
+func (c *RunCommand) helmBackend() bool {
+	return c.Backend == BackendHelm
+}
+
+// backend returns ChartBackend, or the backend named by Backend if it isn't
+// set, wrapped by DryRunBackend for a dry run. The backends created by run
+// are reused for their cluster.
+func (c *RunCommand) backend(restConfig *rest.Config) (Backend, error) {
+	if c.ChartBackend != nil {
+		return c.ChartBackend, nil
+	}
+	if t := c.clusterOf(restConfig); t != nil && t.backend != nil {
+		return t.backend, nil
+	}
+	if err := c.validateBackend(); err != nil {
+		return nil, err
+	}
+	var b Backend
+	if c.helmBackend() {
+		b = &HelmBackend{RestConfig: restConfig, Fetch: c.fetchChart, Sources: c.Sources}
+	} else {
+		b = &OperatorBackend{
+			Client: dynamic.NewForConfigOrDie(restConfig).Resource(schema.GroupVersionResource{
+				Group:    armadav1.ArmadaChartGroup,
+				Version:  armadav1.ArmadaChartVersion,
+				Resource: armadav1.ArmadaChartPlural,
+			}),
+			RestConfig:       restConfig,
+			OperatorTimeout:  c.Config.Wait.OperatorTimeout,
+			ProgressInterval: c.Config.Wait.ProgressInterval,
+			Labels:           c.ownerLabels(),
+			Annotations:      c.ownerAnnotations(),
+		}
+	}
+	if c.DryRun {
+		b = &DryRunBackend{Backend: b, Out: c.Out}
+	}
+	return b, nil
+}
+
+// DryRunBackend prints the changes of Backend instead of making them, only
+// its Prepare is called
+type DryRunBackend struct {
+	Backend Backend
+	Out     io.Writer
+}
+
+func (b *DryRunBackend) Prepare(ctx context.Context, chart *armadav1.ArmadaChart) (*Change, error) {
+	return b.Backend.Prepare(ctx, chart)
+}
+
+func (b *DryRunBackend) Apply(_ context.Context, change *Change) (bool, error) {
+	if change.Action == ActionNone {
+		_, err := fmt.Fprintf(b.Out, "would label chart %s in namespace %s as managed by %s\n",
+			change.Chart.Name, change.Chart.Namespace, ManagedByValue)
+		return false, err
+	}
+	_, err := fmt.Fprintf(b.Out, "would %s chart %s in namespace %s, release %s\n", change.Action,
+		change.Chart.Name, change.Chart.Namespace, change.Chart.Spec.Release)
+	return false, err
+}
+
+func (b *DryRunBackend) Wait(context.Context, *Change) error {
+	return nil
+}
+
+func (b *DryRunBackend) Rollback(context.Context, *Change) (bool, error) {
+	return false, nil
+}
+
+func (b *DryRunBackend) Delete(_ context.Context, chart *armadav1.ArmadaChart) error {
+	_, err := fmt.Fprintf(b.Out, "would delete chart %s in namespace %s, release %s\n",
+		chart.Name, chart.Namespace, chart.Spec.Release)
+	return err
+}
@@ -0,0 +1,98 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrCanaryFailed is returned if the canary charts of a chart group didn't
+// become ready, the other charts of the group are left alone
+var ErrCanaryFailed = errors.New("canary failed")
+
+// AirshipCanary selects the canary charts of a chart group, either by name
+// or as the first Count charts, one by default:
+//
+//	data:
+//	  chart_group: [ingress-a, ingress-b, ingress-c]
+//	  canary:
+//	    charts: [ingress-a]
+type AirshipCanary struct {
+	Charts []string `json:"charts,omitempty"`
+	Count  int      `json:"count,omitempty"`
+}
+
+// canary returns the canary charts of the chart group, nil if it has none
+func (c *RunCommand) canary(cgName string) []string {
+	cg := c.airGroups[cgName]
+	if cg.Canary == nil && !slices.Contains(c.CanaryGroups, cgName) {
+		return nil
+	}
+	count := 1
+	if cg.Canary != nil {
+		if len(cg.Canary.Charts) > 0 {
+			return cg.Canary.Charts
+		}
+		if cg.Canary.Count > 0 {
+			count = cg.Canary.Count
+		}
+	}
+	return cg.ChartGroup[:min(count, len(cg.ChartGroup))]
+}
+
+// validateCanaries checks that canaries leave charts to protect and don't
+// depend on charts installed after them
+func (c *RunCommand) validateCanaries() error {
+	for _, name := range c.CanaryGroups {
+		if !slices.Contains(c.airManifest.ChartGroups, name) {
+			return fmt.Errorf("canary chart group %s not found in manifest %s", name, c.airManifest.Metadata.Name)
+		}
+	}
+	for _, cgName := range c.airManifest.ChartGroups {
+		canary := c.canary(cgName)
+		if canary == nil {
+			continue
+		}
+		cg := c.airGroups[cgName]
+		if cg.Canary != nil && cg.Canary.Count < 0 {
+			return fmt.Errorf("canary count of chart group %s is negative", cgName)
+		}
+		for _, cName := range canary {
+			if !slices.Contains(cg.ChartGroup, cName) {
+				return fmt.Errorf("canary chart %s is not part of chart group %s", cName, cgName)
+			}
+			for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+				if slices.Contains(cg.ChartGroup, dep) && !slices.Contains(canary, dep) {
+					return fmt.Errorf("canary chart %s of group %s depends on chart %s which is not a canary",
+						cName, cgName, dep)
+				}
+			}
+		}
+		if len(canary) >= len(cg.ChartGroup) {
+			return fmt.Errorf("canary of chart group %s covers all its charts", cgName)
+		}
+		if cg.IsSequenced(c.airManifest.ChartGroupDefaults) {
+			for _, cName := range cg.ChartGroup[:len(canary)] {
+				if !slices.Contains(canary, cName) {
+					return fmt.Errorf("canary charts of sequenced group %s have to come first, found %s",
+						cgName, cName)
+				}
+			}
+		}
+	}
+	return nil
+}
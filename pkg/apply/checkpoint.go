@@ -0,0 +1,176 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// CheckpointName is the ConfigMap recording the charts an apply finished,
+// keyed by the name of the target manifest. It is removed once the apply
+// succeeds, so it only survives interrupted or failed applies.
+const CheckpointName = "armada-apply-checkpoint"
+
+// checkpoint holds the spec hashes of the ArmadaCharts, by namespace and
+// name, which became ready in the current or, when resuming, interrupted apply
+type checkpoint struct {
+	mu       sync.Mutex
+	cms      corev1.ConfigMapInterface
+	manifest string
+	charts   map[string]string
+}
+
+// loadCheckpoint reads the checkpoint of the target manifest when resuming,
+// otherwise it drops the one left by a previous apply
+func (c *RunCommand) loadCheckpoint(ctx context.Context, restConfig *rest.Config) error {
+	namespace := c.SiteStatusNamespace
+	if namespace == "" {
+		namespace = DefaultSiteStatusNamespace()
+	}
+	c.checkpoint = &checkpoint{
+		cms:      kubernetes.NewForConfigOrDie(restConfig).CoreV1().ConfigMaps(namespace),
+		manifest: c.airManifest.Metadata.Name,
+		charts:   map[string]string{},
+	}
+	if !c.Resume {
+		return c.checkpoint.save(ctx)
+	}
+	cm, err := c.checkpoint.cms.Get(ctx, CheckpointName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		c.logf("no checkpoint %s/%s to resume from, applying all charts", namespace, CheckpointName)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read checkpoint %s/%s: %w", namespace, CheckpointName, err)
+	}
+	if data, ok := cm.Data[c.checkpoint.manifest]; ok {
+		if err := json.Unmarshal([]byte(data), &c.checkpoint.charts); err != nil {
+			return fmt.Errorf("checkpoint %s/%s is corrupt: %w", namespace, CheckpointName, err)
+		}
+	}
+	c.logf("resuming from checkpoint %s/%s, %d charts were applied", namespace, CheckpointName,
+		len(c.checkpoint.charts))
+	return nil
+}
+
+// resumed returns whether every ArmadaChart of the chart became ready in the
+// interrupted apply with the spec it has now
+func (c *RunCommand) resumed(chart *AirshipChart) bool {
+	if c.checkpoint == nil || !c.Resume {
+		return false
+	}
+	c.checkpoint.mu.Lock()
+	defer c.checkpoint.mu.Unlock()
+	for _, ac := range c.ConvertCharts(chart) {
+		hash, _, err := SpecHashes(ac, nil)
+		if err != nil || c.checkpoint.charts[ac.Namespace+"/"+ac.Name] != hash {
+			return false
+		}
+	}
+	return true
+}
+
+// applied records the ready chart, failing to do so doesn't fail the apply
+func (c *RunCommand) applied(ctx context.Context, chart *armadav1.ArmadaChart) {
+	if c.checkpoint == nil {
+		return
+	}
+	hash, _, err := SpecHashes(chart, nil)
+	if err == nil {
+		c.checkpoint.mu.Lock()
+		c.checkpoint.charts[chart.Namespace+"/"+chart.Name] = hash
+		c.checkpoint.mu.Unlock()
+		err = c.checkpoint.save(context.WithoutCancel(ctx))
+	}
+	if err != nil {
+		c.logCtx(ctx, "WARNING: unable to checkpoint chart %s: %s", chart.Name, err.Error())
+	}
+}
+
+// clearCheckpoint removes the checkpoint of the target manifest after a
+// successful apply
+func (c *RunCommand) clearCheckpoint(ctx context.Context) {
+	if c.checkpoint == nil {
+		return
+	}
+	c.checkpoint.mu.Lock()
+	c.checkpoint.charts = nil
+	c.checkpoint.mu.Unlock()
+	if err := c.checkpoint.save(ctx); err != nil {
+		c.logf("WARNING: unable to clear checkpoint %s: %s", CheckpointName, err.Error())
+	}
+}
+
+// save writes the charts of the target manifest, other target manifests
+// may share the ConfigMap, so conflicting writes are retried
+func (cp *checkpoint) save(ctx context.Context) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	var data string
+	if len(cp.charts) > 0 {
+		buf, err := json.Marshal(cp.charts)
+		if err != nil {
+			return err
+		}
+		data = string(buf)
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := cp.cms.Get(ctx, CheckpointName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if data == "" {
+				return nil
+			}
+			_, err = cp.cms.Create(ctx, &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   CheckpointName,
+					Labels: map[string]string{ManagedByLabel: ManagedByValue},
+				},
+				Data: map[string]string{cp.manifest: data},
+			}, metav1.CreateOptions{FieldManager: FieldManager})
+			return err
+		} else if err != nil {
+			return err
+		}
+		if data == "" {
+			if _, ok := cm.Data[cp.manifest]; !ok {
+				return nil
+			}
+			delete(cm.Data, cp.manifest)
+			if len(cm.Data) == 0 {
+				return cp.cms.Delete(ctx, CheckpointName, metav1.DeleteOptions{
+					Preconditions: &metav1.Preconditions{ResourceVersion: &cm.ResourceVersion}})
+			}
+		} else {
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[cp.manifest] = data
+		}
+		_, err = cp.cms.Update(ctx, cm, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+}
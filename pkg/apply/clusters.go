@@ -0,0 +1,171 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/client-go/rest"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// targetCluster is a cluster charts of the manifest are applied to
+type targetCluster struct {
+	// name is the kubeconfig context, empty for the cluster of the apply
+	name       string
+	restConfig *rest.Config
+	backend    Backend
+}
+
+func (t *targetCluster) String() string {
+	if t.name == "" {
+		return "default cluster"
+	}
+	return "cluster " + t.name
+}
+
+// groupCluster returns the kubeconfig context the charts of the chart group
+// are applied to, empty for the cluster of the apply
+func (c *RunCommand) groupCluster(cgName string) string {
+	name, ok := c.Clusters[cgName]
+	if !ok {
+		name = c.airGroups[cgName].Cluster
+	}
+	if name == c.Context {
+		return ""
+	}
+	return name
+}
+
+// validateClusters checks that Clusters names chart groups of the manifest
+// and that workers aren't asked to reach other clusters
+func (c *RunCommand) validateClusters() error {
+	for cgName := range c.Clusters {
+		if _, ok := c.airGroups[cgName]; !ok {
+			return fmt.Errorf("cluster of unknown chart group %s requested", cgName)
+		}
+	}
+	if len(c.clusterNames()) > 1 && (c.GroupRunner != nil || c.DistributeNamespace != "") {
+		return fmt.Errorf("armada workers can't apply chart groups to other clusters")
+	}
+	return nil
+}
+
+// clusterNames returns the clusters of the chart groups which aren't
+// skipped in manifest order, the cluster of the apply first
+func (c *RunCommand) clusterNames() []string {
+	names := []string{""}
+	for _, cgName := range c.airManifest.ChartGroups {
+		if name := c.groupCluster(cgName); c.skipGroup(cgName) == "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// setupClusters creates the rest configs of the clusters, restConfig is
+// the one of the cluster of the apply
+func (c *RunCommand) setupClusters(restConfig *rest.Config) error {
+	c.clusters = []*targetCluster{{restConfig: restConfig}}
+	for _, name := range c.clusterNames()[1:] {
+		kube := c.Config.Kubernetes
+		kube.Kubeconfig, kube.Context = c.Kubeconfig, name
+		rc, err := kube.RestConfig()
+		if err != nil {
+			return fmt.Errorf("cluster %s: %w", name, err)
+		}
+		c.clusters = append(c.clusters, &targetCluster{name: name, restConfig: rc})
+	}
+	return nil
+}
+
+// cluster returns the cluster with the kubeconfig context name
+func (c *RunCommand) cluster(name string) *targetCluster {
+	for _, t := range c.clusters {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// clusterOf returns the cluster using restConfig, nil if restConfig isn't
+// one of the clusters
+func (c *RunCommand) clusterOf(restConfig *rest.Config) *targetCluster {
+	for _, t := range c.clusters {
+		if t.restConfig == restConfig {
+			return t
+		}
+	}
+	return nil
+}
+
+// clusterName returns the kubeconfig context of the cluster using
+// restConfig, empty for the cluster of the apply
+func (c *RunCommand) clusterName(restConfig *rest.Config) string {
+	if t := c.clusterOf(restConfig); t != nil {
+		return t.name
+	}
+	return ""
+}
+
+// clusterGroups returns the chart groups applied to the cluster
+func (c *RunCommand) clusterGroups(name string) []string {
+	var groups []string
+	for _, cgName := range c.airManifest.ChartGroups {
+		if c.groupCluster(cgName) == name {
+			groups = append(groups, cgName)
+		}
+	}
+	return groups
+}
+
+// statusOnly returns whether the cluster of the apply only keeps the status
+// of a multi-cluster apply, no chart group is applied to it
+func (c *RunCommand) statusOnly(t *targetCluster) bool {
+	return t.name == "" && len(c.clusters) > 1 && len(c.clusterGroups("")) == 0
+}
+
+// clusterCharts returns the ArmadaCharts applied to the cluster in chart
+// group order
+func (c *RunCommand) clusterCharts(name string) []*armadav1.ArmadaChart {
+	var charts []*armadav1.ArmadaChart
+	for _, cgName := range c.clusterGroups(name) {
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			charts = append(charts, c.ConvertCharts(c.airCharts[cName])...)
+		}
+	}
+	return charts
+}
+
+// logClusterResults logs how many charts became ready and failed on every
+// cluster of a multi-cluster apply
+func (c *RunCommand) logClusterResults() {
+	if len(c.clusters) < 2 {
+		return
+	}
+	results := c.Results()
+	for _, t := range c.clusters {
+		counts := map[ChartState]int{}
+		for _, r := range results {
+			if r.Cluster == t.name {
+				counts[r.State]++
+			}
+		}
+		c.logf("%s: %d charts ready, %d failed", t, counts[ChartReady], counts[ChartFailed])
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestClusters(t *testing.T) {
+	c, _ := newTestCommand(t, "site.yaml")
+	c.Clusters = map[string]string{"openstack": "workload"}
+	if err := c.validateClusters(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.clusterNames(); !slices.Equal(got, []string{"", "workload"}) {
+		t.Fatalf("got clusters %q, want the default cluster and workload", got)
+	}
+	if got := c.targetNamespaces(""); !slices.Equal(got, []string{"openstack"}) {
+		t.Errorf("got namespaces %q of the default cluster, want openstack", got)
+	}
+	if got := c.targetNamespaces("workload"); !slices.Equal(got, []string{"openstack", "region-a", "region-b"}) {
+		t.Errorf("got namespaces %q of workload, want openstack, region-a and region-b", got)
+	}
+
+	c.clusters = []*targetCluster{{restConfig: &rest.Config{}}, {name: "workload", restConfig: &rest.Config{}}}
+	for _, cgName := range c.airManifest.ChartGroups {
+		if err := c.runGroup(context.Background(), cgName, c.cluster(c.groupCluster(cgName)).restConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{"airship-mariadb": "", "airship-rabbitmq": "", "airship-keystone": "workload",
+		"airship-horizon": "workload", "airship-glance": "workload"}
+	results := c.Results()
+	if len(results) == 0 {
+		t.Fatal("no chart was applied")
+	}
+	for _, r := range results {
+		if cluster := want[r.Chart]; r.Cluster != cluster {
+			t.Errorf("chart %s/%s was applied to cluster %q, want %q", r.Namespace, r.Chart, r.Cluster, cluster)
+		}
+	}
+
+	// the default cluster is left alone, also by prune, once no group is
+	// applied to it
+	if c.statusOnly(c.clusters[0]) {
+		t.Error("default cluster with chart groups only keeps the status")
+	}
+	for _, cgName := range c.airManifest.ChartGroups {
+		c.Clusters[cgName] = "workload"
+	}
+	if !c.statusOnly(c.clusters[0]) || c.statusOnly(c.clusters[1]) {
+		t.Error("default cluster without chart groups doesn't only keep the status")
+	}
+
+	c.Clusters = map[string]string{"tenant": "workload"}
+	if err := c.validateClusters(); err == nil {
+		t.Error("cluster of an unknown chart group was accepted")
+	}
+}
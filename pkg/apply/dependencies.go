@@ -0,0 +1,240 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/rest"
+)
+
+// DependencyWaves orders charts by their data.dependencies among the given
+// charts, a chart is placed in the wave after the last of its dependencies.
+// Dependencies outside of charts are ignored, they were installed before.
+func (c *RunCommand) DependencyWaves(charts []string) ([][]string, error) {
+	included := map[string]bool{}
+	for _, cName := range charts {
+		included[cName] = true
+	}
+	wave := map[string]int{}
+	var waves [][]string
+	for len(wave) < len(charts) {
+		placed := false
+		for _, cName := range charts {
+			if _, ok := wave[cName]; ok {
+				continue
+			}
+			level, ready := 0, true
+			for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+				if !included[dep] {
+					continue
+				}
+				depLevel, ok := wave[dep]
+				if !ok {
+					ready = false
+					break
+				}
+				level = max(level, depLevel+1)
+			}
+			if !ready {
+				continue
+			}
+			wave[cName] = level
+			if level == len(waves) {
+				waves = append(waves, nil)
+			}
+			waves[level] = append(waves[level], cName)
+			placed = true
+		}
+		if !placed {
+			return nil, fmt.Errorf("dependency cycle %s", strings.Join(c.dependencyCycle(charts), " -> "))
+		}
+	}
+	return waves, nil
+}
+
+// dependencyCycle returns a cycle of dependencies among charts, starting
+// and ending with the same chart, nil if there is none
+func (c *RunCommand) dependencyCycle(charts []string) []string {
+	included := map[string]bool{}
+	for _, cName := range charts {
+		included[cName] = true
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(cName string) []string
+	visit = func(cName string) []string {
+		state[cName] = visiting
+		path = append(path, cName)
+		for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+			if !included[dep] {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				start := slices.Index(path, dep)
+				return append(slices.Clone(path[start:]), dep)
+			case 0:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[cName] = visited
+		return nil
+	}
+	for _, cName := range charts {
+		if state[cName] == 0 {
+			if cycle := visit(cName); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// validateDependencies checks that every dependency is a chart of the
+// manifest installed before the chart: in an earlier chart group, earlier in
+// a sequenced group or anywhere in a parallel group without cycles
+func (c *RunCommand) validateDependencies() error {
+	group := map[string]int{}
+	for i, cgName := range c.airManifest.ChartGroups {
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			group[cName] = i
+		}
+	}
+	for i, cgName := range c.airManifest.ChartGroups {
+		cg := c.airGroups[cgName]
+		sequenced := cg.IsSequenced(c.airManifest.ChartGroupDefaults)
+		for pos, cName := range cg.ChartGroup {
+			for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+				depGroup, ok := group[dep]
+				switch {
+				case dep == cName:
+					return fmt.Errorf("chart %s depends on itself", cName)
+				case !ok:
+					return fmt.Errorf("chart %s depends on chart %s which is not part of manifest %s",
+						cName, dep, c.airManifest.Metadata.Name)
+				case depGroup > i:
+					return fmt.Errorf("chart %s of group %s depends on chart %s of the later group %s",
+						cName, cgName, dep, c.airManifest.ChartGroups[depGroup])
+				case depGroup == i && sequenced && slices.Index(cg.ChartGroup, dep) > pos:
+					return fmt.Errorf("chart %s depends on chart %s which comes later in the sequenced group %s",
+						cName, dep, cgName)
+				}
+			}
+		}
+		if !sequenced {
+			if cycle := c.dependencyCycle(cg.ChartGroup); cycle != nil {
+				return fmt.Errorf("chart group %s: dependency cycle %s", cgName, strings.Join(cycle, " -> "))
+			}
+		}
+	}
+	return nil
+}
+
+// hasDependencies returns whether any of the charts depends on another one
+func (c *RunCommand) hasDependencies(charts []string) bool {
+	included := map[string]bool{}
+	for _, cName := range charts {
+		included[cName] = true
+	}
+	for _, cName := range charts {
+		for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+			if included[dep] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runDependencies installs the charts of a parallel chart group, every chart
+// starts as soon as its dependencies of the group are ready. A chart whose
+// dependency failed is not installed. MaxParallel limits the charts being
+// installed, charts waiting for dependencies don't count.
+func (c *RunCommand) runDependencies(ctx context.Context, charts []string, k8sConfig *rest.Config) error {
+	if _, err := c.DependencyWaves(charts); err != nil {
+		return err
+	}
+	type result struct {
+		done chan struct{}
+		err  error
+	}
+	results := map[string]*result{}
+	for _, cName := range charts {
+		results[cName] = &result{done: make(chan struct{})}
+	}
+	var slots chan struct{}
+	if c.MaxParallel > 0 {
+		slots = make(chan struct{}, c.MaxParallel)
+	}
+
+	eg := errgroup.Group{}
+	for _, cName := range charts {
+		res := results[cName]
+		eg.Go(func() (err error) {
+			defer func() {
+				res.err = err
+				close(res.done)
+			}()
+			for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+				depRes, ok := results[dep]
+				if !ok {
+					continue
+				}
+				select {
+				case <-depRes.done:
+				case <-ctx.Done():
+					return fmt.Errorf("chart %s not started: %w", cName, ctx.Err())
+				}
+				if depRes.err != nil {
+					c.logCtx(ctx, "not installing chart %s, its dependency %s failed", cName, dep)
+					for _, chpc := range c.ConvertCharts(c.airCharts[cName]) {
+						c.reportProgress(chpc, ChartFailed)
+					}
+					return fmt.Errorf("chart %s not installed, dependency %s failed", cName, dep)
+				}
+			}
+
+			installs := errgroup.Group{}
+			for _, chpc := range c.ConvertCharts(c.airCharts[cName]) {
+				installs.Go(func() error {
+					if slots != nil {
+						select {
+						case slots <- struct{}{}:
+							defer func() { <-slots }()
+						case <-ctx.Done():
+							return fmt.Errorf("chart %s not started: %w", cName, ctx.Err())
+						}
+					}
+					c.logCtx(ctx, "installing chart %s, namespace %s, dependencies ready", cName, chpc.Namespace)
+					return c.installChart(ctx, chpc, k8sConfig)
+				})
+			}
+			return installs.Wait()
+		})
+	}
+	return eg.Wait()
+}
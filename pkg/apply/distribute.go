@@ -0,0 +1,94 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"opendev.org/airship/armada-go/pkg/partition"
+)
+
+// groupWaves orders the chart groups of the manifest for distribution, a
+// group is placed in the wave after the last group its charts depend on.
+// Dependencies only point at earlier groups, see validateDependencies.
+func (c *RunCommand) groupWaves() [][]string {
+	groupOf := map[string]string{}
+	wave := map[string]int{}
+	var waves [][]string
+	for _, cgName := range c.airManifest.ChartGroups {
+		level := 0
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+				if depGroup, ok := groupOf[dep]; ok {
+					level = max(level, wave[depGroup]+1)
+				}
+			}
+		}
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			if _, ok := groupOf[cName]; !ok {
+				groupOf[cName] = cgName
+			}
+		}
+		wave[cgName] = level
+		if level == len(waves) {
+			waves = append(waves, nil)
+		}
+		waves[level] = append(waves[level], cgName)
+	}
+	return waves
+}
+
+// distributeGroups hands the chart groups over to the GroupRunner one wave
+// at a time, the groups of a wave are installed at once by the workers
+func (c *RunCommand) distributeGroups(ctx context.Context) error {
+	waves := c.groupWaves()
+	for i, wave := range waves {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("chart groups %s not started: %w", strings.Join(wave, ", "), err)
+		}
+		var groups []partition.Group
+		for _, cgName := range wave {
+			if c.skippedGroup(cgName) {
+				continue
+			}
+			groups = append(groups, partition.Group{
+				Name:   cgName,
+				Charts: c.groupCharts(ctx, cgName),
+				Canary: c.canary(cgName),
+			})
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(groups))
+		for _, g := range groups {
+			names = append(names, g.Name)
+		}
+		c.logf("handing chart groups %s, wave %d of %d, over to workers", strings.Join(names, ", "), i+1, len(waves))
+		if err := c.GroupRunner.RunGroups(ctx, groups); err != nil {
+			return err
+		}
+		for _, g := range groups {
+			for _, cName := range g.Charts {
+				for _, chpc := range c.ConvertCharts(c.airCharts[cName]) {
+					c.applied(ctx, chpc)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"opendev.org/airship/armada-go/pkg/partition"
+)
+
+type recordingRunner struct {
+	waves []string
+}
+
+func (r *recordingRunner) RunGroups(_ context.Context, groups []partition.Group) error {
+	r.waves = append(r.waves, fmt.Sprint(groups))
+	return nil
+}
+
+func TestDistributeGroups(t *testing.T) {
+	tests := []struct {
+		name        string
+		independent bool
+		want        []string
+	}{
+		{
+			name: "dependent",
+			want: []string{"[{infra [mariadb rabbitmq] []}]", "[{openstack [keystone horizon] []}]"},
+		},
+		{
+			name:        "independent",
+			independent: true,
+			want:        []string{"[{infra [mariadb rabbitmq] []} {openstack [keystone horizon] []}]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestCommand(t, "site.yaml")
+			if tt.independent {
+				c.Chart("keystone").Extensions.Dependencies = nil
+			}
+			c.SkipCharts = []string{"glance"}
+			runner := &recordingRunner{}
+			c.GroupRunner = runner
+			if err := c.distributeGroups(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(runner.waves) != fmt.Sprint(tt.want) {
+				t.Errorf("got waves %v, want %v", runner.waves, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"opendev.org/airship/armada-go/pkg/auth"
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+// DocumentSource provides the manifest documents ParseManifests reads
+type DocumentSource interface {
+	// Open returns the documents as a multi-document YAML stream
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// String names the source in logs
+	String() string
+}
+
+// supportedSources lists the manifests NewDocumentSource accepts, for errors
+const supportedSources = "a file or directory path, a file:// URL, - for stdin, an http(s):// URL or " +
+	"a deckhand+http(s):// URL of rendered documents"
+
+// NewDocumentSource returns the source of manifests given as a file or
+// directory path or file:// URL, - for stdin, an http(s) URL or a
+// deckhand+http(s) URL of rendered documents
+func NewDocumentSource(manifests string, keystone config.KeystoneConfig) (DocumentSource, error) {
+	if manifests == "" {
+		return nil, fmt.Errorf("no manifests given, expected %s", supportedSources)
+	}
+	if manifests == "-" {
+		return &ReaderSource{R: os.Stdin, Name: "stdin"}, nil
+	}
+	u, err := url.Parse(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifests %s: %w, expected %s", manifests, err, supportedSources)
+	}
+	switch u.Scheme {
+	case "":
+		return pathSource(manifests), nil
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("manifests %s: file URLs of host %s are not supported, expected file:///path",
+				manifests, u.Host)
+		}
+		if u.Path == "" {
+			return nil, fmt.Errorf("manifests %s: file URL without a path", manifests)
+		}
+		return pathSource(u.Path), nil
+	case "http", "https":
+		return &HTTPSource{URL: manifests}, nil
+	case "deckhand+http", "deckhand+https":
+		return &DeckhandSource{URL: strings.TrimPrefix(manifests, "deckhand+"), Keystone: keystone}, nil
+	}
+	return nil, fmt.Errorf("unsupported scheme %q of manifests %s, expected %s", u.Scheme, manifests, supportedSources)
+}
+
+// pathSource reads a directory or file
+func pathSource(path string) DocumentSource {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return &DirectorySource{Path: path}
+	}
+	return &FileSource{Path: path}
+}
+
+// FileSource reads the documents from a file
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Open(context.Context) (io.ReadCloser, error) {
+	return os.Open(s.Path)
+}
+
+func (s *FileSource) String() string {
+	return s.Path
+}
+
+// DirectorySource reads the .yaml and .yml files below Path in lexical
+// order, like the site definitions of a repository
+type DirectorySource struct {
+	Path string
+}
+
+func (s *DirectorySource) Open(context.Context) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	err := filepath.WalkDir(s.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); d.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("---\n")
+		buf.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (s *DirectorySource) String() string {
+	return s.Path
+}
+
+// HTTPSource fetches the documents from URL
+type HTTPSource struct {
+	URL string
+	// Client sends the request, http.DefaultClient if nil
+	Client *http.Client
+}
+
+func (s *HTTPSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(s.Client).Do(req)
+	return responseBody(s, resp, err)
+}
+
+func (s *HTTPSource) String() string {
+	return s.URL
+}
+
+// DeckhandSource fetches rendered documents from Deckhand, authenticated
+// with a token of the [keystone_authtoken] user. URL is given without the
+// deckhand+ prefix.
+type DeckhandSource struct {
+	URL      string
+	Keystone config.KeystoneConfig
+	// Client sends the request, http.DefaultClient if nil
+	Client *http.Client
+}
+
+func (s *DeckhandSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := auth.ServiceToken(s.Keystone).Do(httpClient(s.Client), req)
+	return responseBody(s, resp, err)
+}
+
+func (s *DeckhandSource) String() string {
+	return "deckhand+" + s.URL
+}
+
+// ReaderSource reads the documents from R, e.g. stdin or a request body, it
+// can only be opened once
+type ReaderSource struct {
+	R io.Reader
+	// Name names the source in logs
+	Name string
+}
+
+func (s *ReaderSource) Open(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(s.R), nil
+}
+
+func (s *ReaderSource) String() string {
+	if s.Name == "" {
+		return "inline"
+	}
+	return s.Name
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
+
+// responseBody returns the body of a successful response
+func responseBody(s DocumentSource, resp *http.Response, err error) (io.ReadCloser, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unable to fetch manifests from %s: %s", s, resp.Status)
+	}
+	return resp.Body, nil
+}
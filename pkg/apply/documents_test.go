@@ -0,0 +1,118 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+func TestNewDocumentSource(t *testing.T) {
+	dir := t.TempDir()
+	for manifests, want := range map[string]DocumentSource{
+		"-":                     &ReaderSource{R: os.Stdin, Name: "stdin"},
+		dir:                     &DirectorySource{Path: dir},
+		"site.yaml":             &FileSource{Path: "site.yaml"},
+		"file:///site/a.yaml":   &FileSource{Path: "/site/a.yaml"},
+		"file://" + dir:         &DirectorySource{Path: dir},
+		"https://site/docs":     &HTTPSource{URL: "https://site/docs"},
+		"deckhand+http://dh/r1": &DeckhandSource{URL: "http://dh/r1"},
+	} {
+		src, err := NewDocumentSource(manifests, config.KeystoneConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprintf("%T %s", src, src), fmt.Sprintf("%T %s", want, want); got != want {
+			t.Errorf("%s: got %s, want %s", manifests, got, want)
+		}
+	}
+	for manifests, want := range map[string]string{
+		"s3://bucket/site.yaml":   `unsupported scheme "s3"`,
+		"htps://deckhand/docs":    "expected a file or directory path",
+		"file://remote/site.yaml": "file URLs of host remote are not supported",
+		"":                        "no manifests given",
+	} {
+		_, err := NewDocumentSource(manifests, config.KeystoneConfig{})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", manifests, err, want)
+		}
+	}
+}
+
+func TestDirectorySource(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"b.yaml":        "b: 1",
+		"a/charts.yml":  "a: 1\n",
+		"README.md":     "not a document",
+		"c/empty.yaml":  "",
+		"c/z/last.yaml": "---\nz: 1\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := (&DirectorySource{Path: dir}).Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	want := "---\na: 1\n---\nb: 1\n---\n---\n---\nz: 1\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "site.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/site.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(fixture)
+	}))
+	defer srv.Close()
+
+	c := &RunCommand{Config: &config.Config{}, Manifests: srv.URL + "/site.yaml", Log: log.New(io.Discard)}
+	if err := c.ParseManifests(); err != nil {
+		t.Fatal(err)
+	}
+	if c.airManifest == nil || len(c.airCharts) == 0 {
+		t.Errorf("expected the manifest and charts to be parsed")
+	}
+
+	c = &RunCommand{Config: &config.Config{}, Manifests: srv.URL + "/missing.yaml", Log: log.New(io.Discard)}
+	if err := c.ParseManifests(); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected a 404 error, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"sync"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// FakeBackend keeps the applied charts in memory instead of installing
+// their releases, for tests of the apply logic
+type FakeBackend struct {
+	// ApplyErrors and WaitErrors fail Apply and Wait of charts by name
+	ApplyErrors map[string]error
+	WaitErrors  map[string]error
+
+	mu sync.Mutex
+	// hashes are the spec hashes of the applied charts by namespace/name
+	hashes map[string]string
+}
+
+// fakeChange is the state of a change of FakeBackend
+type fakeChange struct {
+	hash, previous string
+}
+
+func (b *FakeBackend) Prepare(_ context.Context, chart *armadav1.ArmadaChart) (*Change, error) {
+	hash, _, err := SpecHashes(chart, nil)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	previous, ok := b.hashes[resultKey(chart)]
+	change := &Change{Chart: chart, Action: ActionInstall, state: &fakeChange{hash: hash, previous: previous}}
+	if ok && previous == hash {
+		change.Action = ActionNone
+	} else if ok {
+		change.Action = ActionUpgrade
+	}
+	return change, nil
+}
+
+func (b *FakeBackend) Apply(_ context.Context, change *Change) (bool, error) {
+	if err := b.ApplyErrors[change.Chart.Name]; err != nil {
+		return false, err
+	}
+	b.set(change.Chart, change.state.(*fakeChange).hash)
+	return true, nil
+}
+
+func (b *FakeBackend) Wait(_ context.Context, change *Change) error {
+	return b.WaitErrors[change.Chart.Name]
+}
+
+func (b *FakeBackend) Rollback(_ context.Context, change *Change) (bool, error) {
+	st := change.state.(*fakeChange)
+	if st.previous == "" || !b.Applied(change.Chart) {
+		return false, nil
+	}
+	b.set(change.Chart, st.previous)
+	return true, nil
+}
+
+func (b *FakeBackend) Delete(_ context.Context, chart *armadav1.ArmadaChart) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.hashes, resultKey(chart))
+	return nil
+}
+
+// Applied returns whether the chart is applied with its current spec
+func (b *FakeBackend) Applied(chart *armadav1.ArmadaChart) bool {
+	hash, _, err := SpecHashes(chart, nil)
+	if err != nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hashes[resultKey(chart)] == hash
+}
+
+func (b *FakeBackend) set(chart *armadav1.ArmadaChart, hash string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.hashes == nil {
+		b.hashes = map[string]string{}
+	}
+	b.hashes[resultKey(chart)] = hash
+}
@@ -0,0 +1,212 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/helm"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/source"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// HelmBackend installs the Helm releases of the charts with the Helm SDK,
+// the way armada-operator would
+type HelmBackend struct {
+	RestConfig *rest.Config
+	// Fetch returns the chart of the ArmadaChart, its source is fetched by
+	// Sources if nil
+	Fetch func(ctx context.Context, chart *armadav1.ArmadaChart) (*source.Chart, error)
+	// Sources fetches the sources of ArmadaCharts with its credentials
+	Sources *source.Resolver
+}
+
+// chartDigestLabel records the digest of the chart archive on the release,
+// the hex digest is cut to the 63 characters a label value may have
+const chartDigestLabel = "armada.airshipit.org/chart-digest"
+
+// helmChange is the state of a change of HelmBackend
+type helmChange struct {
+	cfg    *action.Configuration
+	chart  *chart.Chart
+	values map[string]interface{}
+	labels map[string]string
+	// last is the newest revision of the release before the change
+	last *release.Release
+}
+
+func (b *HelmBackend) Prepare(ctx context.Context, ac *armadav1.ArmadaChart) (*Change, error) {
+	logger := log.FromContext(ctx, log.Default())
+	fetch := b.Fetch
+	if fetch == nil {
+		fetch = func(ctx context.Context, ac *armadav1.ArmadaChart) (*source.Chart, error) {
+			sources := b.Sources
+			if sources == nil {
+				sources = &source.Resolver{}
+			}
+			return sources.Fetch(ctx, specSource(ac))
+		}
+	}
+	src, err := fetch(ctx, ac)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch chart %s: %w", ac.Name, err)
+	}
+	chrt, err := loader.LoadArchive(bytes.NewReader(src.Archive))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load chart %s: %w", ac.Name, err)
+	}
+	values := map[string]interface{}{}
+	if ac.Spec.Values != nil && len(ac.Spec.Values.Raw) > 0 {
+		if err := json.Unmarshal(ac.Spec.Values.Raw, &values); err != nil {
+			return nil, fmt.Errorf("invalid values of chart %s: %w", ac.Name, err)
+		}
+	}
+	if ac.Spec.Upgrade.PreUpgrade != nil {
+		logger.Printf("WARNING: upgrade.pre of chart %s is not supported by the %s backend, use data.hooks.pre",
+			ac.Name, BackendHelm)
+	}
+
+	cfg, err := b.configuration(ctx, ac.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	last, err := lastRelease(cfg, ac.Spec.Release)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(src.Archive)
+	digest := hex.EncodeToString(sum[:])[:63]
+	change := &Change{Chart: ac, Action: ActionUpgrade, state: &helmChange{cfg: cfg, chart: chrt, values: values,
+		labels: map[string]string{chartDigestLabel: digest}, last: last}}
+	switch {
+	case last == nil:
+		change.Action = ActionInstall
+	case last.Info.Status == release.StatusDeployed &&
+		last.Labels[chartDigestLabel] == digest && sameValues(last.Config, values):
+		change.Action = ActionNone
+	}
+	return change, nil
+}
+
+// Apply installs or upgrades the release and waits for its resources
+func (b *HelmBackend) Apply(ctx context.Context, change *Change) (bool, error) {
+	st := change.state.(*helmChange)
+	ac := change.Chart
+	if change.Action == ActionInstall {
+		install := action.NewInstall(st.cfg)
+		install.ReleaseName, install.Namespace = ac.Spec.Release, ac.Namespace
+		install.Wait, install.Timeout, install.Atomic = true, change.Timeout, change.Atomic
+		install.Labels = st.labels
+		if _, err := install.RunWithContext(ctx, st.chart, st.values); err != nil {
+			return false, fmt.Errorf("unable to install release %s: %w", ac.Spec.Release, err)
+		}
+		return true, nil
+	}
+	upgrade := action.NewUpgrade(st.cfg)
+	upgrade.Namespace = ac.Namespace
+	upgrade.Wait, upgrade.Timeout = true, change.Timeout
+	upgrade.Labels = st.labels
+	if _, err := upgrade.RunWithContext(ctx, ac.Spec.Release, st.chart, st.values); err != nil {
+		return false, fmt.Errorf("unable to upgrade release %s: %w", ac.Spec.Release, err)
+	}
+	return true, nil
+}
+
+// Wait returns at once, Apply already waited for the release
+func (b *HelmBackend) Wait(context.Context, *Change) error {
+	return nil
+}
+
+// Rollback rolls the release back to the revision it had before the change
+func (b *HelmBackend) Rollback(ctx context.Context, change *Change) (bool, error) {
+	st := change.state.(*helmChange)
+	if st.last == nil {
+		return false, nil
+	}
+	last, err := lastRelease(st.cfg, change.Chart.Spec.Release)
+	if err != nil {
+		return false, err
+	}
+	if last == nil || last.Version == st.last.Version {
+		return false, nil
+	}
+	rollback := action.NewRollback(st.cfg)
+	rollback.Version = st.last.Version
+	rollback.Wait, rollback.Timeout = true, change.Timeout
+	if err := rollback.Run(change.Chart.Spec.Release); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete uninstalls the release
+func (b *HelmBackend) Delete(ctx context.Context, ac *armadav1.ArmadaChart) error {
+	cfg, err := b.configuration(ctx, ac.Namespace)
+	if err != nil {
+		return err
+	}
+	uninstall := action.NewUninstall(cfg)
+	uninstall.IgnoreNotFound = true
+	_, err = uninstall.Run(ac.Spec.Release)
+	return err
+}
+
+// configuration returns the Helm configuration for releases of the namespace
+func (b *HelmBackend) configuration(ctx context.Context, namespace string) (*action.Configuration, error) {
+	return helm.Configuration(b.RestConfig, namespace, log.FromContext(ctx, log.Default()).Debugf)
+}
+
+// lastRelease returns the newest revision of the release, nil if it was
+// never installed
+func lastRelease(cfg *action.Configuration, name string) (*release.Release, error) {
+	history, err := cfg.Releases.History(name)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var last *release.Release
+	for _, rel := range history {
+		if last == nil || rel.Version > last.Version {
+			last = rel
+		}
+	}
+	return last, nil
+}
+
+// sameValues compares release values, numbers of both are decoded the same way
+func sameValues(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	ra, errA := roundTrip(a)
+	rb, errB := roundTrip(b)
+	return errA == nil && errB == nil && reflect.DeepEqual(ra, rb)
+}
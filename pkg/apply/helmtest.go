@@ -0,0 +1,52 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/helm"
+	"opendev.org/airship/armada-go/pkg/log"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// runTests runs the Helm tests of the release of a ready chart with
+// data.test.enabled, a failing test fails the chart
+func (c *RunCommand) runTests(ctx context.Context, chart *armadav1.ArmadaChart, restConfig *rest.Config) error {
+	if !chart.Spec.Test.Enabled || c.SkipTests || c.DryRun {
+		return nil
+	}
+	revisions, err := helm.ListReleases(ctx, kubernetes.NewForConfigOrDie(restConfig), chart.Namespace,
+		chart.Spec.Release)
+	if err != nil {
+		return fmt.Errorf("unable to find release %s for tests: %w", chart.Spec.Release, err)
+	}
+	if len(revisions) == 0 {
+		return fmt.Errorf("release %s of chart %s not found for tests", chart.Spec.Release, chart.Name)
+	}
+	opts := helm.TestOptions{Log: log.FromContext(ctx, c.logger())}
+	if _, ch := c.sourceChart(chart); ch != nil {
+		opts.Timeout = time.Duration(ch.Extensions.Test.Timeout) * time.Second
+		opts.Cleanup = ch.Extensions.Test.Options.Cleanup
+	}
+	results, err := helm.RunTests(ctx, restConfig, chart.Namespace, chart.Spec.Release, opts)
+	c.outcome.update(chart, func(r *ChartResult) { r.Tests = results })
+	return err
+}
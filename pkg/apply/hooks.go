@@ -0,0 +1,47 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/hooks"
+	"opendev.org/airship/armada-go/pkg/log"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// runHooks runs the hooks of the event phase with the logger of ctx
+func (c *RunCommand) runHooks(ctx context.Context, restConfig *rest.Config, h *hooks.Hooks, ev hooks.Event) error {
+	if len(h.Pre) == 0 && len(h.Post) == 0 || c.DryRun {
+		return nil
+	}
+	ev.Manifest = c.airManifest.Metadata.Name
+	r := &hooks.Runner{RestConfig: restConfig, Log: log.FromContext(ctx, c.logger())}
+	return r.Run(ctx, h, ev)
+}
+
+// runChartHooks runs the hooks of the chart document the ArmadaChart was
+// converted from, in the namespace of the ArmadaChart
+func (c *RunCommand) runChartHooks(ctx context.Context, restConfig *rest.Config,
+	chart *armadav1.ArmadaChart, phase string) error {
+	name, ch := c.sourceChart(chart)
+	if ch == nil {
+		return nil
+	}
+	return c.runHooks(ctx, restConfig, &ch.Extensions.Hooks, hooks.Event{Phase: phase,
+		ChartGroup: c.groupOf(name), Chart: name, Namespace: chart.Namespace})
+}
@@ -0,0 +1,119 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// compileLabelTemplate parses ReleaseLabelTemplate, set from the [apply]
+// section of armada.conf:
+//
+//	release_label_key = example.com/release
+//	release_label_template = {{.Namespace}}.{{.Release}}
+//	extra_labels = team=infra,tier=platform
+func (c *RunCommand) compileLabelTemplate() error {
+	c.labelTmpl = nil
+	if c.ReleaseLabelTemplate == "" {
+		return nil
+	}
+	tmpl, err := template.New("release_label").Option("missingkey=error").Parse(c.ReleaseLabelTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid apply.release_label_template %q: %w", c.ReleaseLabelTemplate, err)
+	}
+	c.labelTmpl = tmpl
+	return nil
+}
+
+// ReleaseLabels returns the labels put on the ArmadaChart of the release and
+// used to select it while waiting
+func (c *RunCommand) ReleaseLabels(release string) map[string]string {
+	key := c.ReleaseLabelKey
+	if key == "" {
+		key = armadav1.ArmadaChartLabel
+	}
+	lbls := map[string]string{}
+	for k, v := range c.ExtraLabels {
+		lbls[k] = v
+	}
+	lbls[key] = release
+	return lbls
+}
+
+// ReleaseLabelData is available to the release label template
+type ReleaseLabelData struct {
+	// Prefix is the release prefix of the manifest
+	Prefix string
+	// Release is the release of the chart document
+	Release string
+	// Chart is the name of the chart document
+	Chart string
+	// Namespace is the namespace of the chart
+	Namespace string
+}
+
+// renderReleaseLabel returns the release label value of the chart
+func (c *RunCommand) renderReleaseLabel(chart *AirshipChart) (string, error) {
+	if c.labelTmpl == nil {
+		return c.chartName(chart.Release), nil
+	}
+	var b strings.Builder
+	err := c.labelTmpl.Execute(&b, ReleaseLabelData{
+		Prefix:    c.releasePrefix(),
+		Release:   chart.Release,
+		Chart:     chart.Metadata.Name,
+		Namespace: chart.Namespace,
+	})
+	return b.String(), err
+}
+
+// validateReleaseLabel checks the template renders a valid label value for the chart
+func (c *RunCommand) validateReleaseLabel(chart *AirshipChart) error {
+	value, err := c.renderReleaseLabel(chart)
+	if err != nil {
+		return fmt.Errorf("release label template: %w", err)
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return fmt.Errorf("release label %q is invalid: %s", value, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// releaseLabelValue returns the release label value of the chart, the
+// manifest must have passed ValidateManifests
+func (c *RunCommand) releaseLabelValue(chart *AirshipChart) string {
+	value, _ := c.renderReleaseLabel(chart)
+	return value
+}
+
+// ManagedSelector selects ArmadaCharts created by applies with the same label
+// settings, regardless of the release
+func (c *RunCommand) ManagedSelector() string {
+	key := c.ReleaseLabelKey
+	if key == "" {
+		key = armadav1.ArmadaChartLabel
+	}
+	selector := labels.SelectorFromSet(c.ExtraLabels)
+	req, _ := labels.NewRequirement(key, selection.Exists, nil)
+	return selector.Add(*req).String()
+}
@@ -0,0 +1,50 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/lock"
+)
+
+// acquireLock takes the lock of the manifest in the site status namespace,
+// the returned function releases it. The returned context is cancelled once
+// the lock is lost so the apply stops.
+func (c *RunCommand) acquireLock(ctx context.Context, restConfig *rest.Config) (context.Context, func(), error) {
+	locker := &lock.Locker{
+		Client:    kubernetes.NewForConfigOrDie(restConfig),
+		Namespace: c.lockNamespace(),
+		Holder:    c.LockHolder,
+		Wait:      c.LockWait,
+	}
+	name := c.airManifest.Metadata.Name
+	held, release, err := locker.Acquire(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.logf("holding the apply lock of %s as %s", name, locker.Holder)
+	return held, release, nil
+}
+
+func (c *RunCommand) lockNamespace() string {
+	if c.SiteStatusNamespace != "" {
+		return c.SiteStatusNamespace
+	}
+	return DefaultSiteStatusNamespace()
+}
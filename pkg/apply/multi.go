@@ -0,0 +1,194 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Manifest results of a multi-manifest apply
+const (
+	ManifestSucceeded = "succeeded"
+	ManifestFailed    = "failed"
+	ManifestSkipped   = "skipped"
+)
+
+// ParseStages splits target manifest arguments into stages: stages run one
+// after another in the given order, comma separated manifests of a stage
+// run in parallel. "infra" and "tenant-a,tenant-b" apply infra first and
+// both tenants afterwards.
+func ParseStages(args []string) [][]string {
+	var stages [][]string
+	for _, arg := range args {
+		var stage []string
+		for _, name := range strings.Split(arg, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				stage = append(stage, name)
+			}
+		}
+		if len(stage) > 0 {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// ManifestResult is the outcome of one target manifest
+type ManifestResult struct {
+	TargetManifest string
+	Stage          int
+	Result         string
+	Installed      []string
+	Updated        []string
+	Duration       time.Duration
+	Err            error
+}
+
+// MultiRunCommand applies several target manifests of the same documents
+// with one consolidated report
+type MultiRunCommand struct {
+	// Template provides the options of every apply, its TargetManifest is
+	// replaced
+	Template *RunCommand
+	Stages   [][]string
+	Out      io.Writer
+}
+
+// RunE runs the stages, a failing stage stops the following ones
+func (m *MultiRunCommand) RunE() error {
+	ctx := context.Background()
+	var (
+		mu      sync.Mutex
+		results []*ManifestResult
+		runs    []*RunCommand
+		failed  error
+	)
+	if m.Template.namespaces == nil {
+		// the targets share the namespaces they verified
+		m.Template.namespaces = &namespaceCache{}
+	}
+	for i, stage := range m.Stages {
+		if failed != nil {
+			for _, name := range stage {
+				results = append(results, &ManifestResult{TargetManifest: name, Stage: i + 1, Result: ManifestSkipped})
+			}
+			continue
+		}
+		m.Template.logf("applying stage %d of %d: %s", i+1, len(m.Stages), strings.Join(stage, ", "))
+		eg := errgroup.Group{}
+		for _, name := range stage {
+			run := m.forTarget(name)
+			res := &ManifestResult{TargetManifest: name, Stage: i + 1, Result: ManifestSucceeded}
+			mu.Lock()
+			results = append(results, res)
+			runs = append(runs, run)
+			mu.Unlock()
+			eg.Go(func() error {
+				start := time.Now()
+				err := run.RunContext(ctx)
+				res.Duration = time.Since(start)
+				res.Installed, res.Updated = *run.Installed, *run.Updated
+				if err != nil {
+					res.Result, res.Err = ManifestFailed, err
+					return fmt.Errorf("target manifest %s: %w", name, err)
+				}
+				return nil
+			})
+		}
+		failed = eg.Wait()
+	}
+
+	m.writeSiteStatus(ctx, runs, failed)
+	if err := PrintManifestResults(m.Out, results); err != nil {
+		return err
+	}
+	return failed
+}
+
+// forTarget returns a copy of the template applying the target manifest
+func (m *MultiRunCommand) forTarget(name string) *RunCommand {
+	run := *m.Template
+	run.TargetManifest = name
+	run.Installed, run.Updated = &[]string{}, &[]string{}
+	run.noSiteStatus = true
+	if run.Log == nil {
+		run.Log = run.logger()
+	}
+	run.Log = run.Log.With("target_manifest", name)
+	return &run
+}
+
+// writeSiteStatus records one status for all target manifests, unless none
+// of them got as far as the cluster
+func (m *MultiRunCommand) writeSiteStatus(ctx context.Context, runs []*RunCommand, applyErr error) {
+	reached := false
+	for _, run := range runs {
+		reached = reached || run.outcome != nil && run.airManifest != nil
+	}
+	if !reached || runs[0].Config == nil {
+		return
+	}
+	restConfig, err := runs[0].RestConfig()
+	if err != nil {
+		runs[0].logf("WARNING: unable to write site status: %s", err.Error())
+		return
+	}
+	// target manifests may share charts, they are counted once by namespace
+	// and name with the state of the last apply of the chart
+	var targets []string
+	var total *SiteStatus
+	charts, states := map[string]bool{}, map[string]ChartState{}
+	for _, run := range runs {
+		s := run.SiteStatus(applyErr)
+		run.chartStates(charts, states)
+		targets = append(targets, run.TargetManifest)
+		if total == nil {
+			total = s
+			continue
+		}
+		if total.ManifestHash == "" {
+			total.ManifestHash = s.ManifestHash
+		}
+		total.Installed += s.Installed
+		total.Updated += s.Updated
+	}
+	total.count(charts, states)
+	total.TargetManifest = strings.Join(targets, ",")
+	total.Time = time.Now()
+	runs[0].writeSiteStatus(ctx, restConfig, total)
+}
+
+// PrintManifestResults writes a table of the target manifest results
+func PrintManifestResults(out io.Writer, results []*ManifestResult) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "STAGE\tTARGET MANIFEST\tRESULT\tINSTALLED\tUPDATED\tDURATION\tERROR")
+	for _, r := range results {
+		errMsg := ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%s\t%s\n", r.Stage, r.TargetManifest, r.Result,
+			len(r.Installed), len(r.Updated), r.Duration.Round(time.Second), errMsg)
+	}
+	return tw.Flush()
+}
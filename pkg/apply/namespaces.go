@@ -0,0 +1,306 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// AirshipNamespaces is data.namespaces of the manifest, it controls the
+// namespaces of the charts:
+//
+//	namespaces:
+//	  labels:
+//	    pod-security.kubernetes.io/enforce: baseline
+//	  overrides:
+//	    openstack:
+//	      labels:
+//	        istio-injection: enabled
+//	  adopt: true
+type AirshipNamespaces struct {
+	// Create creates missing namespaces, true if unset
+	Create *bool `json:"create,omitempty"`
+	// Adopt patches the labels and annotations onto existing namespaces,
+	// namespaces lacking them are only reported otherwise
+	Adopt bool `json:"adopt,omitempty"`
+	// AirshipNamespaceMetadata is set on all namespaces
+	AirshipNamespaceMetadata
+	// Overrides add to or replace the labels and annotations of single
+	// namespaces
+	Overrides map[string]AirshipNamespaceMetadata `json:"overrides,omitempty"`
+}
+
+// AirshipNamespaceMetadata are labels and annotations of namespaces
+type AirshipNamespaceMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Validate checks the label and annotation keys and the label values
+func (n *AirshipNamespaces) Validate() error {
+	metas := map[string]AirshipNamespaceMetadata{"": n.AirshipNamespaceMetadata}
+	maps.Copy(metas, n.Overrides)
+	for name, meta := range metas {
+		where := "namespaces"
+		if name != "" {
+			where = "namespaces.overrides." + name
+		}
+		for k, v := range meta.Labels {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				return fmt.Errorf("%s: invalid label %s: %s", where, k, strings.Join(errs, ", "))
+			}
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				return fmt.Errorf("%s: invalid value of label %s: %s", where, k, strings.Join(errs, ", "))
+			}
+		}
+		for k := range meta.Annotations {
+			if errs := validation.IsQualifiedName(strings.ToLower(k)); len(errs) > 0 {
+				return fmt.Errorf("%s: invalid annotation %s: %s", where, k, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// metadata returns the labels and annotations of the namespace
+func (n *AirshipNamespaces) metadata(name string) AirshipNamespaceMetadata {
+	meta := AirshipNamespaceMetadata{Labels: maps.Clone(n.Labels), Annotations: maps.Clone(n.Annotations)}
+	if o, ok := n.Overrides[name]; ok {
+		if meta.Labels == nil {
+			meta.Labels = map[string]string{}
+		}
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		maps.Copy(meta.Labels, o.Labels)
+		maps.Copy(meta.Annotations, o.Annotations)
+	}
+	return meta
+}
+
+// missing returns the labels and annotations the namespace lacks or has
+// other values of
+func (m AirshipNamespaceMetadata) missing(ns *v1.Namespace) AirshipNamespaceMetadata {
+	var res AirshipNamespaceMetadata
+	for k, v := range m.Labels {
+		if cur, ok := ns.Labels[k]; !ok || cur != v {
+			if res.Labels == nil {
+				res.Labels = map[string]string{}
+			}
+			res.Labels[k] = v
+		}
+	}
+	for k, v := range m.Annotations {
+		if cur, ok := ns.Annotations[k]; !ok || cur != v {
+			if res.Annotations == nil {
+				res.Annotations = map[string]string{}
+			}
+			res.Annotations[k] = v
+		}
+	}
+	return res
+}
+
+func (m AirshipNamespaceMetadata) empty() bool {
+	return len(m.Labels) == 0 && len(m.Annotations) == 0
+}
+
+// String lists the labels and annotations sorted by key
+func (m AirshipNamespaceMetadata) String() string {
+	var parts []string
+	for _, k := range slices.Sorted(maps.Keys(m.Labels)) {
+		parts = append(parts, fmt.Sprintf("label %s=%s", k, m.Labels[k]))
+	}
+	for _, k := range slices.Sorted(maps.Keys(m.Annotations)) {
+		parts = append(parts, fmt.Sprintf("annotation %s=%s", k, m.Annotations[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// namespaceWorkers limits the namespaces created or patched at once
+const namespaceWorkers = 8
+
+// namespaceCache remembers the namespaces verified during the apply, the
+// applies of a multi-manifest apply share it
+type namespaceCache struct {
+	mu       sync.Mutex
+	verified map[string]bool
+}
+
+func (nc *namespaceCache) has(key string) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.verified[key]
+}
+
+func (nc *namespaceCache) add(key string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.verified == nil {
+		nc.verified = map[string]bool{}
+	}
+	nc.verified[key] = true
+}
+
+// VerifyNamespaces creates the missing namespaces of the charts with the
+// labels and annotations of data.namespaces. Existing namespaces lacking
+// them are patched if data.namespaces.adopt is set. With DryRun the changes
+// are only reported. The namespaces are listed once and changed
+// concurrently, verified namespaces aren't checked again during the apply.
+// Only the namespaces of the chart groups applied to the cluster of rsc
+// are verified.
+func (c *RunCommand) VerifyNamespaces(rsc *rest.Config) error {
+	return c.verifyNamespaces(context.Background(), kubernetes.NewForConfigOrDie(rsc), c.clusterName(rsc))
+}
+
+func (c *RunCommand) verifyNamespaces(ctx context.Context, cs kubernetes.Interface, cluster string) error {
+	spec := &c.airManifest.Namespaces
+	create := !c.NoCreateNamespaces && (spec.Create == nil || *spec.Create)
+	if c.namespaces == nil {
+		c.namespaces = &namespaceCache{}
+	}
+
+	wanted := map[string]AirshipNamespaceMetadata{}
+	for _, ns := range c.targetNamespaces(cluster) {
+		if want := spec.metadata(ns); !c.namespaces.has(namespaceKey(cluster, ns, spec.Adopt, want)) {
+			wanted[ns] = want
+		}
+	}
+	if len(wanted) == 0 {
+		c.logf("all namespaces validated successfully")
+		return nil
+	}
+	existing, err := c.listNamespaces(ctx, cs, wanted)
+	if err != nil {
+		return err
+	}
+	for _, k := range slices.Sorted(maps.Keys(wanted)) {
+		if _, found := existing[k]; !found && !create {
+			return fmt.Errorf("namespace %s doesn't exist and creating namespaces is disabled", k)
+		}
+	}
+
+	ownerLabels, ownerAnnotations := c.ownerLabels(), c.ownerAnnotations()
+	eg := errgroup.Group{}
+	eg.SetLimit(namespaceWorkers)
+	for _, k := range slices.Sorted(maps.Keys(wanted)) {
+		want := wanted[k]
+		ns, found := existing[k]
+		var patch AirshipNamespaceMetadata
+		if found {
+			patch = want.missing(ns)
+		}
+		switch {
+		case !found && c.DryRun:
+			c.logf("namespace %s would be created %s", k, withMetadata(want))
+		case !found:
+			eg.Go(func() error {
+				c.logf("namespace %s not found, creating", k)
+				created := &v1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: k, Labels: want.Labels, Annotations: want.Annotations}}
+				stampOwner(created, ownerLabels, ownerAnnotations)
+				_, err := cs.CoreV1().Namespaces().Create(ctx, created, metav1.CreateOptions{FieldManager: FieldManager})
+				if err != nil && !apierrors.IsAlreadyExists(err) {
+					return fmt.Errorf("creating namespace %s: %w", k, err)
+				}
+				c.namespaces.add(namespaceKey(cluster, k, spec.Adopt, want))
+				return nil
+			})
+		case patch.empty():
+			c.namespaces.add(namespaceKey(cluster, k, spec.Adopt, want))
+		case !spec.Adopt:
+			c.logf("WARNING: namespace %s lacks %s, set data.namespaces.adopt to patch it", k, patch)
+		case c.DryRun:
+			c.logf("namespace %s would be patched with %s", k, patch)
+		default:
+			eg.Go(func() error {
+				c.logf("patching namespace %s with %s", k, patch)
+				buf, err := json.Marshal(map[string]any{"metadata": patch})
+				if err != nil {
+					return err
+				}
+				if _, err := cs.CoreV1().Namespaces().Patch(ctx, k, types.MergePatchType, buf,
+					metav1.PatchOptions{FieldManager: FieldManager}); err != nil {
+					return fmt.Errorf("patching namespace %s: %w", k, err)
+				}
+				c.namespaces.add(namespaceKey(cluster, k, spec.Adopt, want))
+				return nil
+			})
+		}
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	c.logf("all namespaces validated successfully")
+	return nil
+}
+
+// listNamespaces returns the existing namespaces of wanted by name, they
+// are read one by one if armada-go may not list namespaces
+func (c *RunCommand) listNamespaces(ctx context.Context, cs kubernetes.Interface,
+	wanted map[string]AirshipNamespaceMetadata) (map[string]*v1.Namespace, error) {
+	existing := map[string]*v1.Namespace{}
+	list, err := cs.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err == nil {
+		for i := range list.Items {
+			if _, ok := wanted[list.Items[i].Name]; ok {
+				existing[list.Items[i].Name] = &list.Items[i]
+			}
+		}
+		return existing, nil
+	}
+	if !apierrors.IsForbidden(err) {
+		return nil, err
+	}
+	for k := range wanted {
+		ns, err := cs.CoreV1().Namespaces().Get(ctx, k, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing[k] = ns
+	}
+	return existing, nil
+}
+
+// namespaceKey identifies a verified namespace of a cluster together with
+// the metadata it was verified with
+func namespaceKey(cluster, name string, adopt bool, want AirshipNamespaceMetadata) string {
+	return fmt.Sprintf("%s/%s %t %s", cluster, name, adopt, want)
+}
+
+func withMetadata(m AirshipNamespaceMetadata) string {
+	if m.empty() {
+		return "without labels"
+	}
+	return "with " + m.String()
+}
@@ -0,0 +1,83 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestVerifyNamespaces(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCommand(t, "site.yaml")
+	c.airManifest.Namespaces = AirshipNamespaces{
+		Adopt:                    true,
+		AirshipNamespaceMetadata: AirshipNamespaceMetadata{Labels: map[string]string{"security": "baseline"}},
+		Overrides: map[string]AirshipNamespaceMetadata{
+			"region-a": {Annotations: map[string]string{"owner": "a"}},
+		},
+	}
+	cs := fake.NewClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openstack"}})
+
+	if err := c.verifyNamespaces(ctx, cs, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"openstack", "region-a", "region-b"} {
+		ns, err := cs.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ns.Labels["security"] != "baseline" {
+			t.Errorf("namespace %s has labels %v, want security=baseline", name, ns.Labels)
+		}
+	}
+	ns, _ := cs.CoreV1().Namespaces().Get(ctx, "region-a", metav1.GetOptions{})
+	if ns.Annotations["owner"] != "a" {
+		t.Errorf("namespace region-a has annotations %v, want owner=a", ns.Annotations)
+	}
+	if ns.Labels[ManagedByLabel] != ManagedByValue || ns.Annotations[AppliedAtAnnotation] == "" {
+		t.Errorf("created namespace region-a lacks the ownership metadata: labels %v, annotations %v",
+			ns.Labels, ns.Annotations)
+	}
+
+	// verified namespaces aren't looked at again
+	cs.ClearActions()
+	if err := c.verifyNamespaces(ctx, cs, ""); err != nil {
+		t.Fatal(err)
+	}
+	if actions := cs.Actions(); len(actions) != 0 {
+		t.Errorf("second verification made %d requests, want none", len(actions))
+	}
+}
+
+func TestVerifyNamespacesNoCreate(t *testing.T) {
+	c, _ := newTestCommand(t, "site.yaml")
+	c.NoCreateNamespaces = true
+	cs := fake.NewClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openstack"}})
+	err := c.verifyNamespaces(context.Background(), cs, "")
+	if err == nil || !strings.Contains(err.Error(), "namespace region-a doesn't exist") {
+		t.Fatalf("got error %v, want region-a missing", err)
+	}
+	for _, a := range cs.Actions() {
+		if a.GetVerb() == "create" {
+			t.Fatalf("namespace created although creation is disabled")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// DefaultOperatorDeployment is the name of the armada-operator deployment
+	DefaultOperatorDeployment = "armada-operator"
+	// DefaultOperatorWaitTimeout limits the operator pre-flight check
+	DefaultOperatorWaitTimeout = 5 * time.Minute
+)
+
+// WaitOperator blocks until the armada-operator deployment is available, so
+// charts aren't created while nothing reconciles them. The deployment is
+// looked up in all namespaces unless OperatorNamespace is set.
+func (c *RunCommand) WaitOperator(ctx context.Context, restConfig *rest.Config) error {
+	name := c.OperatorDeployment
+	if name == "" {
+		name = DefaultOperatorDeployment
+	}
+	timeout := c.OperatorWaitTimeout
+	if timeout == 0 {
+		timeout = DefaultOperatorWaitTimeout
+	}
+	deployments := kubernetes.NewForConfigOrDie(restConfig).AppsV1().Deployments(c.OperatorNamespace)
+
+	c.logCtx(ctx, "waiting for deployment %s to be available, timeout %s", name, timeout)
+	reason := ""
+	err := k8swait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		list, err := deployments.List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+		})
+		if err != nil {
+			return false, err
+		}
+		var next string
+		switch len(list.Items) {
+		case 0:
+			next = "deployment not found"
+		case 1:
+			var ok bool
+			if ok, next = deploymentAvailable(&list.Items[0]); ok {
+				c.logCtx(ctx, "deployment %s/%s is available", list.Items[0].Namespace, name)
+				return true, nil
+			}
+		default:
+			return false, fmt.Errorf("found %d deployments named %s, set the operator namespace", len(list.Items), name)
+		}
+		if next != reason {
+			reason = next
+			c.logCtx(ctx, "waiting for deployment %s: %s", name, reason)
+		}
+		return false, nil
+	})
+	if k8swait.Interrupted(err) && reason != "" {
+		return fmt.Errorf("armada-operator deployment %s is not available after %s: %s", name, timeout, reason)
+	}
+	return err
+}
+
+// deploymentAvailable returns whether the deployment rolled out and has a
+// ready replica, and the reason if it hasn't
+func deploymentAvailable(d *appsv1.Deployment) (bool, string) {
+	if d.Status.ObservedGeneration < d.Generation {
+		return false, "rollout not observed yet"
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentAvailable && cond.Status != v1.ConditionTrue {
+			return false, fmt.Sprintf("not available: %s", cond.Message)
+		}
+	}
+	if d.Status.ReadyReplicas == 0 {
+		return false, "no ready replicas"
+	}
+	return true, ""
+}
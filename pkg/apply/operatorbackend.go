@@ -0,0 +1,180 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+
+	"opendev.org/airship/armada-go/pkg/log"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// errNotUpdated stops a rollback when the failed update didn't change the spec
+var errNotUpdated = errors.New("spec not updated")
+
+// OperatorBackend creates and updates ArmadaCharts and waits for
+// armada-operator to install their releases
+type OperatorBackend struct {
+	Client     dynamic.NamespaceableResourceInterface
+	RestConfig *rest.Config
+	// OperatorTimeout and ProgressInterval are passed to the ArmadaChart
+	// waits, see armadawait.WaitOptions
+	OperatorTimeout  time.Duration
+	ProgressInterval time.Duration
+	// Labels and Annotations are added to the written ArmadaCharts, e.g. the
+	// ownership metadata of the apply. They aren't part of the spec hash.
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// operatorChange is the state of a change of OperatorBackend
+type operatorChange struct {
+	rendered *unstructured.Unstructured
+	// previous is the ArmadaChart before the update
+	previous *unstructured.Unstructured
+}
+
+func (b *OperatorBackend) Prepare(ctx context.Context, chart *armadav1.ArmadaChart) (*Change, error) {
+	rendered, err := Render(chart)
+	if err != nil {
+		return nil, err
+	}
+	change := &Change{Chart: chart, Action: ActionInstall}
+	live, err := b.Client.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		owner, err := b.releaseOwner(ctx, chart)
+		if err != nil {
+			return nil, err
+		}
+		if owner != "" {
+			return nil, &ReleaseConflictError{Namespace: chart.Namespace, Release: chart.Spec.Release,
+				Chart: chart.Name, Existing: owner}
+		}
+		change.state = &operatorChange{rendered: rendered}
+		return change, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get chart %s: %w", chart.Name, err)
+	}
+	diff, err := manualEdits(live)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare chart %s with the last applied spec: %w", chart.Name, err)
+	}
+	change.Diff = diff
+	change.Action = ActionUpgrade
+	if diff == "" && unchanged(rendered, live) {
+		change.Action = ActionNone
+		// charts applied before the ownership labels existed get them
+		change.Relabel = len(b.Labels) > 0 && missingOwner(live.GetLabels(), b.Labels) != ""
+	}
+	change.state = &operatorChange{rendered: rendered, previous: live}
+	return change, nil
+}
+
+func (b *OperatorBackend) Apply(ctx context.Context, change *Change) (bool, error) {
+	st := change.state.(*operatorChange)
+	obj := st.rendered.DeepCopy()
+	stampOwner(obj, b.Labels, b.Annotations)
+	res := b.Client.Namespace(change.Chart.Namespace)
+	if st.previous == nil {
+		_, err := res.Create(ctx, obj, metav1.CreateOptions{FieldManager: FieldManager})
+		return err == nil, err
+	}
+	obj.SetResourceVersion(st.previous.GetResourceVersion())
+	updated, err := res.Update(ctx, obj, metav1.UpdateOptions{FieldManager: FieldManager})
+	if err != nil {
+		return false, err
+	}
+	// the generation only grows if the spec actually changed
+	return updated.GetGeneration() > st.previous.GetGeneration(), nil
+}
+
+func (b *OperatorBackend) Wait(ctx context.Context, change *Change) error {
+	wOpts := armadawait.WaitOptions{
+		RestConfig:       b.RestConfig,
+		Namespace:        change.Chart.Namespace,
+		LabelSelector:    labels.SelectorFromSet(change.Chart.Labels).String(),
+		ResourceType:     armadawait.ArmadaCharts,
+		Timeout:          change.Timeout,
+		OperatorTimeout:  b.OperatorTimeout,
+		ProgressInterval: b.ProgressInterval,
+		Observers:        change.Observers,
+		Logger:           log.FromContext(ctx, log.Default()).Logr(),
+	}
+	_, err := wOpts.Wait(ctx)
+	return err
+}
+
+// Rollback writes the spec the ArmadaChart had before the failed update
+// back, so armada-operator rolls the release back, and waits for it
+func (b *OperatorBackend) Rollback(ctx context.Context, change *Change) (bool, error) {
+	st := change.state.(*operatorChange)
+	if st.previous == nil {
+		return false, nil
+	}
+	res := b.Client.Namespace(change.Chart.Namespace)
+	var restored *unstructured.Unstructured
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		live, err := res.Get(ctx, change.Chart.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if live.GetGeneration() == st.previous.GetGeneration() {
+			return errNotUpdated
+		}
+		live.Object["data"] = st.previous.Object["data"]
+		live.SetLabels(st.previous.GetLabels())
+		live.SetAnnotations(st.previous.GetAnnotations())
+		restored, err = res.Update(ctx, live, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+	if errors.Is(err, errNotUpdated) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	wOpts := armadawait.WaitOptions{
+		RestConfig:      b.RestConfig,
+		Namespace:       change.Chart.Namespace,
+		LabelSelector:   labels.SelectorFromSet(restored.GetLabels()).String(),
+		ResourceType:    armadawait.ArmadaCharts,
+		Timeout:         change.Timeout,
+		OperatorTimeout: b.OperatorTimeout,
+		Logger:          log.FromContext(ctx, log.Default()).Logr(),
+	}
+	_, err = wOpts.Wait(ctx)
+	return true, err
+}
+
+// Delete deletes the ArmadaChart, armada-operator uninstalls its release
+func (b *OperatorBackend) Delete(ctx context.Context, chart *armadav1.ArmadaChart) error {
+	err := b.Client.Namespace(chart.Namespace).Delete(ctx, chart.Name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// newFakeOperatorBackend returns an OperatorBackend on a fake dynamic client
+func newFakeOperatorBackend() *OperatorBackend {
+	gvr := schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	}
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ArmadaChartList"})
+	return &OperatorBackend{Client: dc.Resource(gvr)}
+}
+
+func TestOperatorBackend(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCommand(t, "sequenced.yaml")
+	chart := c.ConvertCharts(c.Chart("mariadb"))[0]
+	b := newFakeOperatorBackend()
+	b.Labels, b.Annotations = c.ownerLabels(), c.ownerAnnotations()
+
+	change, err := b.Prepare(ctx, chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Action != ActionInstall {
+		t.Fatalf("got action %s for a missing ArmadaChart, want %s", change.Action, ActionInstall)
+	}
+	if changed, err := b.Apply(ctx, change); err != nil || !changed {
+		t.Fatalf("install: changed %v, error %v", changed, err)
+	}
+
+	created, err := b.Client.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.GetLabels()[ManagedByLabel] != ManagedByValue || created.GetLabels()[ManifestLabel] != "sequenced" ||
+		created.GetAnnotations()[ManifestRevisionAnnotation] != c.manifestHash {
+		t.Errorf("created ArmadaChart lacks the ownership metadata: labels %v, annotations %v",
+			created.GetLabels(), created.GetAnnotations())
+	}
+
+	// the created ArmadaChart isn't ready, so it is upgraded
+	if change, err = b.Prepare(ctx, chart); err != nil {
+		t.Fatal(err)
+	}
+	if change.Action != ActionUpgrade || change.Diff != "" {
+		t.Fatalf("got action %s, diff %q, want an upgrade without edits", change.Action, change.Diff)
+	}
+
+	// edits made on the cluster are reported
+	live, err := b.Client.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.Object["data"].(map[string]interface{})["release"] = "edited"
+	live.SetGeneration(2)
+	if _, err = b.Client.Namespace(chart.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if change, err = b.Prepare(ctx, chart); err != nil {
+		t.Fatal(err)
+	}
+	if change.Diff == "" {
+		t.Error("the edit made on the cluster isn't reported")
+	}
+
+	if err = b.Delete(ctx, chart); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Delete(ctx, chart); err != nil {
+		t.Errorf("deleting a missing ArmadaChart failed: %v", err)
+	}
+	if change, err = b.Prepare(ctx, chart); err != nil || change.Action != ActionInstall {
+		t.Errorf("got action %v, error %v after delete, want %s", change, err, ActionInstall)
+	}
+}
+
+func TestReleaseConflict(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCommand(t, "sequenced.yaml")
+	b := newFakeOperatorBackend()
+	change, err := b.Prepare(ctx, c.ConvertCharts(c.Chart("mariadb"))[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Apply(ctx, change); err != nil {
+		t.Fatal(err)
+	}
+
+	c.NoReleasePrefix = true
+	chart := c.ConvertCharts(c.Chart("mariadb"))[0]
+	if chart.Name != chart.Spec.Release {
+		t.Fatalf("got ArmadaChart %s without release prefix, want %s", chart.Name, chart.Spec.Release)
+	}
+	var conflict *ReleaseConflictError
+	if _, err := b.Prepare(ctx, chart); !errors.As(err, &conflict) || conflict.Existing != change.Chart.Name {
+		t.Fatalf("got error %v, want a conflict with %s", err, change.Chart.Name)
+	}
+
+	// the existing ArmadaChart is managed again once the prefix matches
+	c.NoReleasePrefix = false
+	c.ReleasePrefix = c.airManifest.ReleasePrefix
+	if _, err := b.Prepare(ctx, c.ConvertCharts(c.Chart("mariadb"))[0]); err != nil {
+		t.Fatal(err)
+	}
+	c.ReleasePrefix = "brownfield"
+	if err := c.validateReleasePrefix(); err != nil {
+		t.Fatal(err)
+	}
+	if name := c.ConvertCharts(c.Chart("mariadb"))[0].Name; name != "brownfield-"+chart.Spec.Release {
+		t.Errorf("got ArmadaChart %s with release prefix brownfield", name)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCommand(t, "sequenced.yaml")
+	c.Adopt = true
+	b := newFakeOperatorBackend()
+	// ArmadaCharts created without armada-go, one named after its release
+	for _, name := range []string{"mariadb", "airship-rabbitmq"} {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": armadav1.ArmadaChartAPIVersion,
+			"kind":       armadav1.ArmadaChartKind,
+			"metadata":   map[string]interface{}{"name": name, "namespace": "openstack"},
+			"data":       map[string]interface{}{"release": strings.TrimPrefix(name, "airship-")},
+		}}
+		if _, err := b.Client.Namespace("openstack").Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.adoptCharts(ctx, b.Client, fake.NewClientset(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.Adoptions()); got != 2 {
+		t.Fatalf("got %d adoptions, want 2: %v", got, c.Adoptions())
+	}
+	mariadb := c.ConvertCharts(c.Chart("mariadb"))[0]
+	if mariadb.Name != "mariadb" {
+		t.Errorf("got ArmadaChart %s for the adopted release mariadb, want mariadb", mariadb.Name)
+	}
+	if name, ch := c.sourceChart(mariadb); name != "mariadb" || ch != c.Chart("mariadb") {
+		t.Errorf("got source chart %s of the adopted ArmadaChart mariadb", name)
+	}
+	if _, err := b.Prepare(ctx, mariadb); err != nil {
+		t.Fatal(err)
+	}
+	for _, chart := range []*armadav1.ArmadaChart{mariadb, c.ConvertCharts(c.Chart("rabbitmq"))[0]} {
+		live, err := b.Client.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !labels.SelectorFromSet(chart.Labels).Matches(labels.Set(live.GetLabels())) {
+			t.Errorf("adopted ArmadaChart %s has labels %v, want %v", chart.Name, live.GetLabels(), chart.Labels)
+		}
+	}
+
+	// relabeled ArmadaCharts are left alone by the next apply
+	c.adopted, c.adoptions = nil, nil
+	if err := c.adoptCharts(ctx, b.Client, fake.NewClientset(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if adoptions := c.Adoptions(); len(adoptions) != 1 || adoptions[0].Name != "mariadb" {
+		t.Errorf("got adoptions %v, want only the release of mariadb kept under its name", adoptions)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCommand(t, "sequenced.yaml")
+	chart := c.ConvertCharts(c.Chart("mariadb"))[0]
+	b := newFakeOperatorBackend()
+	b.Labels, b.Annotations = c.ownerLabels(), c.ownerAnnotations()
+
+	// a ready ArmadaChart applied before the ownership labels existed
+	live, err := Render(chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+	}
+	if _, err = b.Client.Namespace(chart.Namespace).Create(ctx, live, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if reason := c.NotOwned(live); reason != "not managed by armada-go" {
+		t.Errorf("got reason %q, want not managed by armada-go", reason)
+	}
+
+	change, err := b.Prepare(ctx, chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Action != ActionNone || !change.Relabel {
+		t.Fatalf("got action %s, relabel %v, want the unchanged chart relabeled", change.Action, change.Relabel)
+	}
+	if changed, err := b.Apply(ctx, change); err != nil || changed {
+		t.Fatalf("relabel: changed %v, error %v, want an unchanged spec", changed, err)
+	}
+	relabeled, err := b.Client.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason := c.NotOwned(relabeled); reason != "" {
+		t.Errorf("relabeled ArmadaChart is %s", reason)
+	}
+	relabeled.Object["status"] = live.Object["status"]
+	if _, err = b.Client.Namespace(chart.Namespace).Update(ctx, relabeled, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if change, err = b.Prepare(ctx, chart); err != nil || change.Action != ActionNone || change.Relabel {
+		t.Errorf("got change %+v, error %v, want the labeled chart left alone", change, err)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+)
+
+// FieldManager is the field manager of the writes of armada-go
+const FieldManager = "armada-go"
+
+// Ownership metadata put on the ArmadaCharts, namespaces and CRD armada-go
+// creates or updates
+const (
+	// ManagedByLabel is set to ManagedByValue
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "armada-go"
+	// ManifestLabel is the name of the manifest, it is left out if the name
+	// isn't a valid label value
+	ManifestLabel = "armada.airshipit.org/manifest"
+	// ManifestRevisionAnnotation is the digest of the manifest documents
+	ManifestRevisionAnnotation = "armada.airshipit.org/manifest-revision"
+	// AppliedAtAnnotation is the start of the apply, or the time of the write
+	// outside of an apply, in RFC 3339
+	AppliedAtAnnotation = "armada.airshipit.org/applied-at"
+)
+
+// ownerLabels returns the ownership labels of the objects written by the apply
+func (c *RunCommand) ownerLabels() map[string]string {
+	lbls := map[string]string{ManagedByLabel: ManagedByValue}
+	if c.airManifest != nil && len(validation.IsValidLabelValue(c.airManifest.Metadata.Name)) == 0 {
+		lbls[ManifestLabel] = c.airManifest.Metadata.Name
+	}
+	return lbls
+}
+
+// OwnerSelector selects the objects written by applies of the manifest
+func (c *RunCommand) OwnerSelector() string {
+	return labels.SelectorFromSet(c.ownerLabels()).String()
+}
+
+// NotOwned returns why obj lacks the ownership labels of the manifest, empty
+// if it has them
+func (c *RunCommand) NotOwned(obj metav1.Object) string {
+	return missingOwner(obj.GetLabels(), c.ownerLabels())
+}
+
+func missingOwner(have, want map[string]string) string {
+	if have[ManagedByLabel] != ManagedByValue {
+		return "not managed by " + ManagedByValue
+	}
+	manifest, ok := want[ManifestLabel]
+	switch {
+	case !ok || have[ManifestLabel] == manifest:
+		return ""
+	case have[ManifestLabel] == "":
+		return "not labeled with manifest " + manifest
+	default:
+		return "owned by manifest " + have[ManifestLabel]
+	}
+}
+
+// Orphans returns the ArmadaCharts of client carrying the ownership labels
+// of the manifest which it no longer has, those prune would delete. None are
+// returned if the manifest name isn't a valid label value.
+func (c *RunCommand) Orphans(ctx context.Context, client dynamic.NamespaceableResourceInterface) (
+	[]unstructured.Unstructured, error) {
+	if _, ok := c.ownerLabels()[ManifestLabel]; !ok {
+		return nil, nil
+	}
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: c.OwnerSelector()})
+	if err != nil {
+		return nil, err
+	}
+	keep := map[string]bool{}
+	for _, chart := range c.Charts() {
+		keep[resultKey(chart)] = true
+	}
+	var orphans []unstructured.Unstructured
+	for _, item := range list.Items {
+		if !keep[item.GetNamespace()+"/"+item.GetName()] {
+			orphans = append(orphans, item)
+		}
+	}
+	return orphans, nil
+}
+
+// ownerAnnotations returns the ownership annotations of the objects written
+// by the apply
+func (c *RunCommand) ownerAnnotations() map[string]string {
+	appliedAt := c.appliedAt
+	if appliedAt.IsZero() {
+		appliedAt = time.Now().UTC()
+	}
+	annotations := map[string]string{AppliedAtAnnotation: appliedAt.Format(time.RFC3339)}
+	if c.manifestHash != "" {
+		annotations[ManifestRevisionAnnotation] = c.manifestHash
+	}
+	return annotations
+}
+
+// stampOwner adds the ownership labels and annotations to obj
+func stampOwner(obj metav1.Object, lbls, annotations map[string]string) {
+	if len(lbls) > 0 {
+		merged := maps.Clone(obj.GetLabels())
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		maps.Copy(merged, lbls)
+		obj.SetLabels(merged)
+	}
+	if len(annotations) > 0 {
+		merged := maps.Clone(obj.GetAnnotations())
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		maps.Copy(merged, annotations)
+		obj.SetAnnotations(merged)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// PlanGroup is how apply installs a chart group
+type PlanGroup struct {
+	Name      string
+	Sequenced bool
+	Skipped   string
+	// Waves are installed one after another, charts of a wave in parallel.
+	// Every chart of a sequenced group is a wave of its own.
+	Waves [][]PlanChart
+}
+
+// PlanChart is a chart of the plan
+type PlanChart struct {
+	Name       string
+	Release    string
+	Namespaces []string
+	Canary     bool
+	Skipped    string
+}
+
+// Plan returns the order apply installs the charts of the parsed manifest in
+func (c *RunCommand) Plan() ([]PlanGroup, error) {
+	var plan []PlanGroup
+	for _, cgName := range c.airManifest.ChartGroups {
+		cg := c.airGroups[cgName]
+		g := PlanGroup{Name: cgName, Sequenced: cg.IsSequenced(c.airManifest.ChartGroupDefaults),
+			Skipped: c.skipGroup(cgName)}
+		var waves [][]string
+		if g.Sequenced {
+			for _, cName := range cg.ChartGroup {
+				waves = append(waves, []string{cName})
+			}
+		} else {
+			// canary charts form waves of their own
+			canary := c.canary(cgName)
+			var rest []string
+			for _, cName := range cg.ChartGroup {
+				if !slices.Contains(canary, cName) {
+					rest = append(rest, cName)
+				}
+			}
+			for _, charts := range [][]string{canary, rest} {
+				stage, err := c.DependencyWaves(charts)
+				if err != nil {
+					return nil, fmt.Errorf("chart group %s: %w", cgName, err)
+				}
+				waves = append(waves, stage...)
+			}
+		}
+		for _, wave := range waves {
+			var charts []PlanChart
+			for _, cName := range wave {
+				chart := c.airCharts[cName]
+				charts = append(charts, PlanChart{Name: cName, Release: c.chartName(chart.Release),
+					Namespaces: chart.TargetNamespaces(), Canary: slices.Contains(c.canary(cgName), cName),
+					Skipped: c.skipChart(cName)})
+			}
+			g.Waves = append(g.Waves, charts)
+		}
+		plan = append(plan, g)
+	}
+	return plan, nil
+}
+
+// printPlan writes the plan of the parsed manifest
+func (c *RunCommand) printPlan(w io.Writer) error {
+	plan, err := c.Plan()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "manifest %s\n", c.airManifest.Metadata.Name)
+	for i, g := range plan {
+		mode := "parallel"
+		if g.Sequenced {
+			mode = "sequenced"
+		}
+		fmt.Fprintf(&b, "%d. chart group %s (%s)", i+1, g.Name, mode)
+		if g.Skipped != "" {
+			fmt.Fprintf(&b, " skipped, %s", g.Skipped)
+		}
+		b.WriteString("\n")
+		for j, wave := range g.Waves {
+			fmt.Fprintf(&b, "   wave %d:\n", j+1)
+			for _, ch := range wave {
+				fmt.Fprintf(&b, "     - %s (%s in %s)", ch.Name, ch.Release, strings.Join(ch.Namespaces, ", "))
+				if ch.Canary {
+					b.WriteString(" canary")
+				}
+				if ch.Skipped != "" && g.Skipped == "" {
+					fmt.Fprintf(&b, " skipped, %s", ch.Skipped)
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// ReleaseConflictError is returned when the release of a chart is already
+// managed by an ArmadaChart of another name, e.g. one created with another
+// release prefix
+type ReleaseConflictError struct {
+	Namespace string
+	Release   string
+	// Chart is the ArmadaChart the apply would create
+	Chart string
+	// Existing is the ArmadaChart managing the release
+	Existing string
+}
+
+func (e *ReleaseConflictError) Error() string {
+	return fmt.Sprintf("release %s in namespace %s is already managed by ArmadaChart %s, not %s, "+
+		"set the release prefix to match it or adopt it", e.Release, e.Namespace, e.Existing, e.Chart)
+}
+
+// releasePrefix returns the prefix of the ArmadaChart names, ReleasePrefix
+// replaces release_prefix of the manifest and NoReleasePrefix drops it
+func (c *RunCommand) releasePrefix() string {
+	switch {
+	case c.NoReleasePrefix:
+		return ""
+	case c.ReleasePrefix != "":
+		return c.ReleasePrefix
+	}
+	return c.airManifest.ReleasePrefix
+}
+
+// chartName returns the name of the ArmadaChart of a release
+func (c *RunCommand) chartName(release string) string {
+	if prefix := c.releasePrefix(); prefix != "" {
+		return prefix + "-" + release
+	}
+	return release
+}
+
+// namePrefix returns the prefix shared by the names of the ArmadaCharts
+func (c *RunCommand) namePrefix() string {
+	if prefix := c.releasePrefix(); prefix != "" {
+		return prefix + "-"
+	}
+	return ""
+}
+
+// validateReleasePrefix checks the prefix options and that the ArmadaChart
+// names are valid
+func (c *RunCommand) validateReleasePrefix() error {
+	if c.NoReleasePrefix && c.ReleasePrefix != "" {
+		return fmt.Errorf("release prefix %q conflicts with disabling the release prefix", c.ReleasePrefix)
+	}
+	for name, chart := range c.airCharts {
+		if errs := validation.IsDNS1123Subdomain(c.chartName(chart.Release)); len(errs) > 0 {
+			return fmt.Errorf("chart %s: ArmadaChart name %s is invalid: %s", name, c.chartName(chart.Release),
+				strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// releaseOwner returns the ArmadaChart other than chart managing its release
+// in its namespace, empty if there is none
+func (b *OperatorBackend) releaseOwner(ctx context.Context, chart *armadav1.ArmadaChart) (string, error) {
+	list, err := b.Client.Namespace(chart.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to list charts in namespace %s: %w", chart.Namespace, err)
+	}
+	for _, item := range list.Items {
+		release, _, _ := unstructured.NestedString(item.Object, "data", "release")
+		if item.GetName() != chart.Name && release == chart.Spec.Release {
+			return item.GetName(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,175 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	apiextension "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/preflight"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// CheckPreflight checks that the cluster can take the charts of the parsed
+// manifests applied to it, nothing is changed
+func (c *RunCommand) CheckPreflight(ctx context.Context, restConfig *rest.Config) (*preflight.Report, error) {
+	spec := c.airManifest.Namespaces
+	cluster := c.clusterName(restConfig)
+	checker := &preflight.Checker{
+		Client:           kubernetes.NewForConfigOrDie(restConfig),
+		Namespaces:       c.targetNamespaces(cluster),
+		CreateNamespaces: !c.NoCreateNamespaces && (spec.Create == nil || *spec.Create),
+		Permissions:      c.permissions(cluster),
+	}
+	if !c.helmBackend() {
+		want, err := c.ReadCRD()
+		if err != nil {
+			return nil, err
+		}
+		checker.CRDs = apiextension.NewForConfigOrDie(restConfig).ApiextensionsV1().CustomResourceDefinitions()
+		checker.CRD, checker.Version = want, armadav1.ArmadaChartVersion
+	}
+	return checker.Run(ctx), nil
+}
+
+// RunPreflight parses the manifests and writes the preflight report to Out,
+// it fails if a check failed
+func (c *RunCommand) RunPreflight(ctx context.Context) error {
+	if err := c.LoadConfig(); err != nil {
+		return err
+	}
+	if err := c.parseManifests(ctx); err != nil {
+		return err
+	}
+	if err := c.validateClusters(); err != nil {
+		return err
+	}
+	restConfig, err := c.RestConfig()
+	if err != nil {
+		return err
+	}
+	if err := c.setupClusters(restConfig); err != nil {
+		return err
+	}
+	failed := 0
+	for _, t := range c.clusters {
+		report, err := c.CheckPreflight(ctx, t.restConfig)
+		if err != nil {
+			return err
+		}
+		if len(c.clusters) > 1 {
+			if _, err := fmt.Fprintf(c.Out, "%s:\n", t); err != nil {
+				return err
+			}
+		}
+		if err := report.Print(c.Out); err != nil {
+			return err
+		}
+		failed += len(report.Failed())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d preflight checks failed", failed)
+	}
+	return nil
+}
+
+// permissions returns what the backend needs to apply the charts of the
+// cluster
+func (c *RunCommand) permissions(cluster string) []preflight.Permission {
+	perms := []preflight.Permission{{Verb: "get", Resource: "namespaces"}}
+	if !c.NoCreateNamespaces {
+		perms = append(perms, preflight.Permission{Verb: "create", Resource: "namespaces", Optional: true,
+			Why: "missing namespaces can't be created"})
+	}
+	if !c.helmBackend() {
+		perms = append(perms,
+			preflight.Permission{Verb: "get", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+			preflight.Permission{Verb: "create", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions",
+				Optional: true, Why: "the armadacharts CRD can't be installed"},
+			preflight.Permission{Verb: "update", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions",
+				Optional: true, Why: "the armadacharts CRD can't be upgraded"})
+	}
+	for _, ns := range c.targetNamespaces(cluster) {
+		group, resource := armadav1.ArmadaChartGroup, armadav1.ArmadaChartPlural
+		if c.helmBackend() {
+			// Helm keeps its releases in secrets
+			group, resource = "", "secrets"
+		}
+		for _, verb := range []string{"get", "list", "create", "update", "delete"} {
+			perms = append(perms, preflight.Permission{Verb: verb, Group: group, Resource: resource, Namespace: ns})
+		}
+	}
+	if !c.NoLock && !c.DryRun && cluster == "" {
+		for _, verb := range []string{"get", "create", "update"} {
+			perms = append(perms, preflight.Permission{Verb: verb, Group: "coordination.k8s.io", Resource: "leases",
+				Namespace: c.lockNamespace()})
+		}
+	}
+	if !c.noSiteStatus && cluster == "" {
+		ns := c.SiteStatusNamespace
+		if ns == "" {
+			ns = DefaultSiteStatusNamespace()
+		}
+		for _, verb := range []string{"get", "create", "update"} {
+			perms = append(perms, preflight.Permission{Verb: verb, Resource: "configmaps", Namespace: ns,
+				Optional: true, Why: "the site status can't be written"})
+		}
+	}
+	return perms
+}
+
+// targetNamespaces returns the namespaces of the charts applied to the
+// cluster
+func (c *RunCommand) targetNamespaces(cluster string) []string {
+	namespaces := map[string]bool{}
+	for _, cgname := range c.clusterGroups(cluster) {
+		for _, chrt := range c.airGroups[cgname].ChartGroup {
+			for _, ns := range c.airCharts[chrt].TargetNamespaces() {
+				namespaces[ns] = true
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(namespaces))
+}
+
+// runPreflight logs the checks of the cluster which didn't pass and fails
+// if one failed
+func (c *RunCommand) runPreflight(ctx context.Context, t *targetCluster) error {
+	report, err := c.CheckPreflight(ctx, t.restConfig)
+	if err != nil {
+		return err
+	}
+	for _, check := range report.Checks {
+		if check.Status != preflight.Pass {
+			c.logf("preflight %s: %s: %s: %s", check.Status, t, check.Name, check.Message)
+		}
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		var msgs []string
+		for _, check := range failed {
+			msgs = append(msgs, check.Name+": "+check.Message)
+		}
+		return fmt.Errorf("preflight checks of the %s failed: %s", t, strings.Join(msgs, "; "))
+	}
+	c.logf("preflight checks of the %s passed", t)
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/prune"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Charts returns ArmadaCharts of the parsed manifest in chart group order
+func (c *RunCommand) Charts() []*armadav1.ArmadaChart {
+	var charts []*armadav1.ArmadaChart
+	for _, cgName := range c.airManifest.ChartGroups {
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			charts = append(charts, c.ConvertCharts(c.airCharts[cName])...)
+		}
+	}
+	return charts
+}
+
+// prune removes ArmadaCharts written by applies of the manifest, with the
+// release labels of this apply and the release prefix, which the manifest no
+// longer applies to the cluster of restConfig
+func (c *RunCommand) prune(restConfig *rest.Config, dryRun bool) error {
+	selector, err := c.pruneSelector()
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, chart := range c.clusterCharts(c.clusterName(restConfig)) {
+		keep[chart.Namespace+"/"+chart.Name] = true
+	}
+
+	planner := &prune.Planner{
+		Dynamic:   dynamic.NewForConfigOrDie(restConfig),
+		Clientset: kubernetes.NewForConfigOrDie(restConfig),
+	}
+	ctx := context.Background()
+	actions, err := planner.Prune(ctx, selector, c.namePrefix(), keep,
+		fmt.Sprintf("not in manifest %s", c.airManifest.Metadata.Name))
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		for _, a := range actions {
+			if a.Kind == prune.KindArmadaChart {
+				c.logf("pruning chart %s/%s: %s", a.Namespace, a.Name, a.Reason)
+			}
+		}
+		if err := planner.Execute(ctx, actions); err != nil {
+			return err
+		}
+	}
+	return prune.Print(c.Out, actions, dryRun)
+}
+
+// pruneSelector selects the ArmadaCharts prune may delete: those carrying
+// the ownership labels of the manifest. Without a manifest label only the
+// release prefix tells the ArmadaCharts of the manifest apart, so prune is
+// refused if there is none.
+func (c *RunCommand) pruneSelector() (string, error) {
+	selector, err := labels.Parse(c.ManagedSelector())
+	if err != nil {
+		return "", err
+	}
+	owner := c.ownerLabels()
+	if _, ok := owner[ManifestLabel]; !ok && c.namePrefix() == "" {
+		return "", fmt.Errorf("refusing to prune: manifest name %q isn't a valid label value and there is "+
+			"no release prefix to tell its ArmadaCharts apart", c.airManifest.Metadata.Name)
+	}
+	reqs, _ := labels.SelectorFromSet(owner).Requirements()
+	return selector.Add(reqs...).String(), nil
+}
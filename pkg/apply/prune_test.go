@@ -0,0 +1,57 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestPruneSelector(t *testing.T) {
+	c, _ := newTestCommand(t, "sequenced.yaml")
+	got, err := c.pruneSelector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, err := labels.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart := c.ConvertCharts(c.Chart("mariadb"))[0]
+	owned := labels.Merge(chart.Labels, c.ownerLabels())
+	if !selector.Matches(labels.Set(owned)) {
+		t.Errorf("selector %s doesn't match the labels %v of an applied chart", got, owned)
+	}
+	other := labels.Merge(owned, labels.Set{ManifestLabel: "other"})
+	if selector.Matches(other) {
+		t.Errorf("selector %s matches the charts of another manifest", got)
+	}
+	if selector.Matches(labels.Set(chart.Labels)) {
+		t.Errorf("selector %s matches charts without the ownership labels", got)
+	}
+
+	// without manifest label only the release prefix tells the charts of the
+	// manifest apart
+	c.airManifest.Metadata.Name = "not a label value!"
+	if got, err = c.pruneSelector(); err != nil || strings.Contains(got, ManifestLabel) {
+		t.Errorf("got selector %q, error %v, want the managed charts of the release prefix", got, err)
+	}
+	c.NoReleasePrefix = true
+	if _, err = c.pruneSelector(); err == nil || !strings.Contains(err.Error(), "refusing to prune") {
+		t.Errorf("got error %v, want prune refused without manifest label and release prefix", err)
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// LastAppliedAnnotation records the ArmadaChart spec written by the last
+// apply, so edits made on the cluster since can be told apart from it
+const LastAppliedAnnotation = "armada.airshipit.org/last-applied-spec"
+
+// SpecHashAnnotation records the digest of the labels and spec written by
+// the last apply, apply leaves ready ArmadaCharts alone when it still matches
+const SpecHashAnnotation = "armada.airshipit.org/spec-hash"
+
+// setLastApplied stores the spec of obj in its LastAppliedAnnotation, the
+// ArmadaChart spec is kept in the data field
+func setLastApplied(obj *unstructured.Unstructured) error {
+	spec, err := json.Marshal(obj.Object["data"])
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedAnnotation] = string(spec)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// Render returns the ArmadaChart object apply writes to the cluster,
+// including the last applied spec and its hash
+func Render(chart *armadav1.ArmadaChart) (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(chart)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: obj}
+	if err := RecordApplied(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// RecordApplied stores the spec of the ArmadaChart and its hash in the
+// annotations apply compares with, so a spec written by other commands, like
+// a rollback, isn't taken for a manual edit
+func RecordApplied(obj *unstructured.Unstructured) error {
+	if err := setLastApplied(obj); err != nil {
+		return err
+	}
+	hash, err := hashJSON(map[string]any{"labels": obj.GetLabels(), "data": obj.Object["data"]})
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	annotations[SpecHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// unchanged returns whether the live ArmadaChart was written by an apply of
+// the rendered object and is ready, so updating and waiting for it is a no-op
+func unchanged(rendered, live *unstructured.Unstructured) bool {
+	hash := live.GetAnnotations()[SpecHashAnnotation]
+	if hash == "" || hash != rendered.GetAnnotations()[SpecHashAnnotation] {
+		return false
+	}
+	ready, _ := armadawait.IsReady(live)
+	return ready
+}
+
+// manualEdits returns the difference between the last applied spec and the
+// spec of the live object, it is empty if the object wasn't edited or was
+// written by an apply which didn't record the spec. Like kubectl apply, fields
+// missing in the last applied spec are not managed by armada-go, so fields
+// added by defaulting or by hand are ignored.
+func manualEdits(live *unstructured.Unstructured) (string, error) {
+	lastApplied, ok := live.GetAnnotations()[LastAppliedAnnotation]
+	if !ok {
+		return "", nil
+	}
+	var last any
+	if err := json.Unmarshal([]byte(lastApplied), &last); err != nil {
+		return "", err
+	}
+	return specDiff(last, live.Object["data"])
+}
+
+// Drift returns the difference between the spec the manifest asks for and
+// the spec of the live ArmadaChart, it is empty if they match
+func Drift(want *armadav1.ArmadaChart, live *unstructured.Unstructured) (string, error) {
+	spec, err := decodeSpec(want)
+	if err != nil {
+		return "", err
+	}
+	return specDiff(spec, live.Object["data"])
+}
+
+// SpecHashes returns digests of the spec the manifest asks for and of the
+// part of the live spec armada-go manages, they differ if the chart drifted.
+// The live hash is empty if live is nil.
+func SpecHashes(want *armadav1.ArmadaChart, live *unstructured.Unstructured) (string, string, error) {
+	spec, err := decodeSpec(want)
+	if err != nil {
+		return "", "", err
+	}
+	wantHash, err := hashJSON(spec)
+	if err != nil || live == nil {
+		return wantHash, "", err
+	}
+	current, err := roundTrip(live.Object["data"])
+	if err != nil {
+		return "", "", err
+	}
+	liveHash, err := hashJSON(managed(spec, current))
+	return wantHash, liveHash, err
+}
+
+// decodeSpec returns the spec of the chart as decoded JSON
+func decodeSpec(chart *armadav1.ArmadaChart) (any, error) {
+	buf, err := json.Marshal(chart.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var spec any
+	err = json.Unmarshal(buf, &spec)
+	return spec, err
+}
+
+// roundTrip encodes and decodes v, so numbers compare equal to decoded ones
+func roundTrip(v any) (any, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	err = json.Unmarshal(buf, &res)
+	return res, err
+}
+
+// hashJSON is the sha256 of the JSON encoding of v, map keys are sorted by
+// the encoder so equal values hash equally
+func hashJSON(v any) (string, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(buf)), nil
+}
+
+// specDiff compares the fields of want in the live spec, like kubectl apply,
+// fields missing in want are not managed by armada-go
+func specDiff(want, live any) (string, error) {
+	current, err := roundTrip(live)
+	if err != nil {
+		return "", err
+	}
+	current = managed(want, current)
+	if reflect.DeepEqual(want, current) {
+		return "", nil
+	}
+	return cmp.Diff(want, current), nil
+}
+
+// managed drops map keys of live which are missing in last
+func managed(last, live any) any {
+	lastMap, ok := last.(map[string]any)
+	liveMap, ok2 := live.(map[string]any)
+	if !ok || !ok2 {
+		return live
+	}
+	out := map[string]any{}
+	for k, v := range liveMap {
+		if lv, ok := lastMap[k]; ok {
+			out[k] = managed(lv, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// BackendCall is a call RecordingBackend passed on
+type BackendCall struct {
+	Method    string
+	Chart     string
+	Namespace string
+	// Action is the action of the change, empty for Delete
+	Action ChangeAction
+	Err    string
+}
+
+func (bc BackendCall) String() string {
+	s := fmt.Sprintf("%s %s/%s", bc.Method, bc.Namespace, bc.Chart)
+	if bc.Action != "" {
+		s += " " + string(bc.Action)
+	}
+	if bc.Err != "" {
+		s += ": " + bc.Err
+	}
+	return s
+}
+
+// RecordingBackend records the calls of the apply before passing them on
+// to Backend, FakeBackend if nil
+type RecordingBackend struct {
+	Backend Backend
+
+	mu    sync.Mutex
+	calls []BackendCall
+}
+
+// Calls returns the calls recorded so far in the order they were made
+func (b *RecordingBackend) Calls() []BackendCall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]BackendCall{}, b.calls...)
+}
+
+func (b *RecordingBackend) record(method string, chart *armadav1.ArmadaChart, action ChangeAction, err error) {
+	bc := BackendCall{Method: method, Chart: chart.Name, Namespace: chart.Namespace, Action: action}
+	if err != nil {
+		bc.Err = err.Error()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, bc)
+}
+
+func (b *RecordingBackend) backend() Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Backend == nil {
+		b.Backend = &FakeBackend{}
+	}
+	return b.Backend
+}
+
+func (b *RecordingBackend) Prepare(ctx context.Context, chart *armadav1.ArmadaChart) (*Change, error) {
+	change, err := b.backend().Prepare(ctx, chart)
+	var action ChangeAction
+	if change != nil {
+		action = change.Action
+	}
+	b.record("prepare", chart, action, err)
+	return change, err
+}
+
+func (b *RecordingBackend) Apply(ctx context.Context, change *Change) (bool, error) {
+	changed, err := b.backend().Apply(ctx, change)
+	b.record("apply", change.Chart, change.Action, err)
+	return changed, err
+}
+
+func (b *RecordingBackend) Wait(ctx context.Context, change *Change) error {
+	err := b.backend().Wait(ctx, change)
+	b.record("wait", change.Chart, change.Action, err)
+	return err
+}
+
+func (b *RecordingBackend) Rollback(ctx context.Context, change *Change) (bool, error) {
+	restored, err := b.backend().Rollback(ctx, change)
+	method := "rollback"
+	if !restored {
+		method = "rollback-skipped"
+	}
+	b.record(method, change.Chart, change.Action, err)
+	return restored, err
+}
+
+func (b *RecordingBackend) Delete(ctx context.Context, chart *armadav1.ArmadaChart) error {
+	err := b.backend().Delete(ctx, chart)
+	b.record("delete", chart, "", err)
+	return err
+}
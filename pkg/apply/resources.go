@@ -0,0 +1,110 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/log"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// waitResources runs the waits of data.wait.resources once the ArmadaChart
+// is ready, one after another. A resource waits for the chart timeout
+// unless it sets its own, its labels are added to data.wait.labels.
+func (c *RunCommand) waitResources(ctx context.Context, chart *armadav1.ArmadaChart,
+	restConfig *rest.Config, timeout time.Duration) error {
+	_, source := c.sourceChart(chart)
+	var ext AirshipWaitExtensions
+	if source != nil {
+		ext = source.Extensions.Wait
+	}
+	for i, res := range chart.Spec.Wait.Resources {
+		if res == nil {
+			continue
+		}
+		if res.Delay > 0 {
+			c.logCtx(ctx, "delaying wait for %s by %ds", res.Type, res.Delay)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(res.Delay) * time.Second):
+			}
+		}
+
+		sel := maps.Clone(chart.Spec.Wait.Labels)
+		if sel == nil {
+			sel = map[string]string{}
+		}
+		maps.Copy(sel, res.Labels)
+		namespace := res.Namespace
+		if namespace == "" {
+			namespace = chart.Namespace
+		}
+		resTimeout := timeout
+		if i < len(ext.Resources) && ext.Resources[i].Timeout > 0 {
+			resTimeout = time.Duration(ext.Resources[i].Timeout)
+		}
+
+		wOpts := armadawait.WaitOptions{
+			RestConfig:       restConfig,
+			Namespace:        namespace,
+			LabelSelector:    labels.SelectorFromSet(sel).String(),
+			ResourceType:     res.Type,
+			Timeout:          resTimeout,
+			MinReady:         res.MinReady,
+			For:              forCondition(res.Condition),
+			ProgressInterval: c.Config.Wait.ProgressInterval,
+			Logger:           log.FromContext(ctx, c.logger()).Logr(),
+		}
+		if _, err := wOpts.Wait(ctx); err != nil {
+			return fmt.Errorf("chart %s: waiting for %s: %w", chart.Name, res.Type, err)
+		}
+	}
+	return nil
+}
+
+// forCondition turns data.wait.resources[].condition into a readiness
+// criterion, a bare condition type like Available has to become True
+func forCondition(condition string) string {
+	if condition == "" || strings.HasPrefix(condition, "condition=") || strings.HasPrefix(condition, "jsonpath=") {
+		return condition
+	}
+	return "condition=" + condition
+}
+
+// sourceChart returns the name and chart document the ArmadaChart was
+// converted from, nil if it isn't part of the parsed manifests. Charts are
+// matched by release and namespace as adopted ArmadaCharts keep their name.
+func (c *RunCommand) sourceChart(chart *armadav1.ArmadaChart) (string, *AirshipChart) {
+	if c.airManifest == nil {
+		return "", nil
+	}
+	for name, ch := range c.airCharts {
+		if ch.Release == chart.Spec.Release && slices.Contains(ch.TargetNamespaces(), chart.Namespace) {
+			return name, ch
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,126 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"sort"
+	"time"
+
+	"opendev.org/airship/armada-go/pkg/helm"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// ChartResult describes how the install of an ArmadaChart went
+type ChartResult struct {
+	Chart     string     `json:"chart"`
+	Namespace string     `json:"namespace"`
+	State     ChartState `json:"state"`
+	Started   time.Time  `json:"started"`
+	// Cluster is the kubeconfig context of the cluster the chart was
+	// applied to, empty for the cluster of the apply
+	Cluster string `json:"cluster,omitempty"`
+	// ReadyAfter is the time from the start of the install until the
+	// ArmadaChart was seen ready
+	ReadyAfter time.Duration `json:"ready_after,omitempty"`
+	// Duration is the time the install took, including the waits of
+	// data.wait.resources
+	Duration time.Duration `json:"duration"`
+	// Reason is why the chart was last seen not ready or failed
+	Reason string `json:"reason,omitempty"`
+	// RolledBack is set if the previous spec was restored after the update
+	// failed, see RunCommand.Atomic
+	RolledBack bool `json:"rolled_back,omitempty"`
+	// Tests are the Helm tests run after the chart became ready
+	Tests []helm.TestResult `json:"tests,omitempty"`
+}
+
+// Results returns the result of every chart the last run installed, in the
+// order the installs started
+func (c *RunCommand) Results() []ChartResult {
+	o := c.outcome
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	res := make([]ChartResult, 0, len(o.results))
+	for _, r := range o.results {
+		res = append(res, *r)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Started.Before(res[j].Started) })
+	return res
+}
+
+func resultKey(chart *armadav1.ArmadaChart) string {
+	return chart.Namespace + "/" + chart.Name
+}
+
+// update changes the result of the chart under the lock of the outcome
+func (o *outcome) update(chart *armadav1.ArmadaChart, fn func(r *ChartResult)) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	r, ok := o.results[resultKey(chart)]
+	if !ok {
+		r = &ChartResult{Chart: chart.Name, Namespace: chart.Namespace, State: ChartInstalling, Started: time.Now()}
+		o.results[resultKey(chart)] = r
+	}
+	fn(r)
+}
+
+func (o *outcome) start(chart *armadav1.ArmadaChart, cluster string) {
+	o.update(chart, func(r *ChartResult) {
+		*r = ChartResult{Chart: chart.Name, Namespace: chart.Namespace, State: ChartInstalling, Started: time.Now(),
+			Cluster: cluster}
+	})
+}
+
+func (o *outcome) finish(chart *armadav1.ArmadaChart, err error) {
+	o.update(chart, func(r *ChartResult) {
+		r.Duration = time.Since(r.Started)
+		r.State = ChartReady
+		if err != nil {
+			r.State = ChartFailed
+			r.Reason = err.Error()
+		}
+	})
+}
+
+// observer fills the result of the chart from the progress of its wait
+func (o *outcome) observer(chart *armadav1.ArmadaChart) armadawait.Observer {
+	return armadawait.ObserverFuncs{
+		Ready: func(rr armadawait.ResourceResult) {
+			if rr.Name != chart.Name || chart.Namespace != "" && rr.Namespace != chart.Namespace {
+				return
+			}
+			o.update(chart, func(r *ChartResult) {
+				r.ReadyAfter = time.Since(r.Started)
+				r.Reason = ""
+			})
+		},
+		Unready: func(rr armadawait.ResourceResult) {
+			if rr.Name != chart.Name || chart.Namespace != "" && rr.Namespace != chart.Namespace {
+				return
+			}
+			o.update(chart, func(r *ChartResult) { r.Reason = rr.Reason })
+		},
+		Timeout: func(res *armadawait.WaitResult) {
+			o.update(chart, func(r *ChartResult) { r.Reason = res.Error })
+		},
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"opendev.org/airship/armada-go/pkg/source"
+)
+
+// verifyManifests reads the manifests and checks them against the detached
+// signature next to them, as written by `cosign sign-blob --key`
+func (c *RunCommand) verifyManifests(src DocumentSource, f io.Reader) (io.Reader, error) {
+	file, ok := src.(*FileSource)
+	if !ok {
+		return nil, fmt.Errorf("signed manifests have to be files, %s isn't", src)
+	}
+	key, err := os.ReadFile(c.ManifestKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.ReadFile(file.Path + ".sig")
+	if err != nil {
+		return nil, fmt.Errorf("manifests have to be signed: %w", err)
+	}
+	if err := source.VerifySignature(key, data, sig); err != nil {
+		return nil, fmt.Errorf("signature of %s: %w", file.Path, err)
+	}
+	c.logf("signature of %s verified", file.Path)
+	return bytes.NewReader(data), nil
+}
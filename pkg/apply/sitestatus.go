@@ -0,0 +1,251 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// SiteStatusName is the ConfigMap summarizing the last apply of the site
+const SiteStatusName = "armada-site-status"
+
+// Site states
+const (
+	SiteConverged = "converged"
+	SiteFailed    = "failed"
+)
+
+// SiteStatus answers whether the site converged with a single object read,
+// it is written to the SiteStatusName ConfigMap after every apply
+type SiteStatus struct {
+	Status         string    `json:"status"`
+	Manifest       string    `json:"manifest"`
+	TargetManifest string    `json:"target_manifest,omitempty"`
+	ManifestHash   string    `json:"manifest_hash"`
+	Time           time.Time `json:"timestamp"`
+	Error          string    `json:"error,omitempty"`
+	Charts         int       `json:"charts"`
+	Ready          int       `json:"ready"`
+	Failed         int       `json:"failed"`
+	Installed      int       `json:"installed"`
+	Updated        int       `json:"updated"`
+	Skipped        int       `json:"skipped,omitempty"`
+}
+
+// Converged returns whether the last apply succeeded
+func (s *SiteStatus) Converged() bool {
+	return s.Status == SiteConverged
+}
+
+func (s *SiteStatus) data() map[string]string {
+	return map[string]string{
+		"status":          s.Status,
+		"manifest":        s.Manifest,
+		"target_manifest": s.TargetManifest,
+		"manifest_hash":   s.ManifestHash,
+		"timestamp":       s.Time.UTC().Format(time.RFC3339),
+		"error":           s.Error,
+		"charts":          strconv.Itoa(s.Charts),
+		"ready":           strconv.Itoa(s.Ready),
+		"failed":          strconv.Itoa(s.Failed),
+		"installed":       strconv.Itoa(s.Installed),
+		"updated":         strconv.Itoa(s.Updated),
+		"skipped":         strconv.Itoa(s.Skipped),
+	}
+}
+
+func siteStatusFromData(data map[string]string) *SiteStatus {
+	s := &SiteStatus{
+		Status:         data["status"],
+		Manifest:       data["manifest"],
+		TargetManifest: data["target_manifest"],
+		ManifestHash:   data["manifest_hash"],
+		Error:          data["error"],
+	}
+	s.Time, _ = time.Parse(time.RFC3339, data["timestamp"])
+	s.Charts, _ = strconv.Atoi(data["charts"])
+	s.Ready, _ = strconv.Atoi(data["ready"])
+	s.Failed, _ = strconv.Atoi(data["failed"])
+	s.Installed, _ = strconv.Atoi(data["installed"])
+	s.Updated, _ = strconv.Atoi(data["updated"])
+	s.Skipped, _ = strconv.Atoi(data["skipped"])
+	return s
+}
+
+// DefaultSiteStatusNamespace returns the namespace armada-go runs in, or
+// default when running outside of a cluster
+func DefaultSiteStatusNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if buf, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		if ns := strings.TrimSpace(string(buf)); ns != "" {
+			return ns
+		}
+	}
+	return v1.NamespaceDefault
+}
+
+// ReadSiteStatus returns the status written by the last apply, nil if no
+// apply recorded one yet
+func ReadSiteStatus(ctx context.Context, restConfig *rest.Config, namespace string) (*SiteStatus, error) {
+	if namespace == "" {
+		namespace = DefaultSiteStatusNamespace()
+	}
+	cm, err := kubernetes.NewForConfigOrDie(restConfig).CoreV1().ConfigMaps(namespace).Get(
+		ctx, SiteStatusName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return siteStatusFromData(cm.Data), nil
+}
+
+// outcome counts chart results of an apply, it may be nil when charts are
+// installed outside of RunE, e.g. by armada workers
+type outcome struct {
+	mu sync.Mutex
+	// states by namespace and name of the ArmadaChart
+	states   map[string]ChartState
+	install  int
+	upgrades int
+	// results by namespace and name of the ArmadaChart
+	results map[string]*ChartResult
+}
+
+func newOutcome() *outcome {
+	return &outcome{states: map[string]ChartState{}, results: map[string]*ChartResult{}}
+}
+
+func (o *outcome) set(chart string, state ChartState) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.states[chart] = state
+}
+
+func (o *outcome) installed() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.install++
+}
+
+func (o *outcome) updated() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.upgrades++
+}
+
+// SiteStatus summarizes the apply which ended with applyErr
+func (c *RunCommand) SiteStatus(applyErr error) *SiteStatus {
+	s := &SiteStatus{
+		Status:         SiteConverged,
+		Manifest:       c.Manifests,
+		TargetManifest: c.TargetManifest,
+		ManifestHash:   c.manifestHash,
+		Time:           time.Now(),
+	}
+	if applyErr != nil {
+		s.Status = SiteFailed
+		s.Error = applyErr.Error()
+	}
+	charts, states := map[string]bool{}, map[string]ChartState{}
+	c.chartStates(charts, states)
+	s.count(charts, states)
+	if o := c.outcome; o != nil {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		s.Installed, s.Updated = o.install, o.upgrades
+	}
+	return s
+}
+
+// chartStates adds the ArmadaCharts of the apply and their states to charts
+// and states, both by namespace and name
+func (c *RunCommand) chartStates(charts map[string]bool, states map[string]ChartState) {
+	if c.airManifest != nil {
+		for _, chart := range c.Charts() {
+			charts[resultKey(chart)] = true
+		}
+	}
+	if o := c.outcome; o != nil {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		maps.Copy(states, o.states)
+	}
+}
+
+// count sets the chart counters of s from charts and states
+func (s *SiteStatus) count(charts map[string]bool, states map[string]ChartState) {
+	s.Charts, s.Ready, s.Failed, s.Skipped = len(charts), 0, 0, 0
+	for _, state := range states {
+		switch state {
+		case ChartReady:
+			s.Ready++
+		case ChartFailed:
+			s.Failed++
+		case ChartSkipped:
+			s.Skipped++
+		}
+	}
+}
+
+// writeSiteStatus records the outcome of the apply, failing to do so doesn't
+// fail the apply
+func (c *RunCommand) writeSiteStatus(ctx context.Context, restConfig *rest.Config, s *SiteStatus) {
+	namespace := c.SiteStatusNamespace
+	if namespace == "" {
+		namespace = DefaultSiteStatusNamespace()
+	}
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SiteStatusName,
+			Namespace: namespace,
+			Labels:    map[string]string{ManagedByLabel: ManagedByValue},
+		},
+		Data: s.data(),
+	}
+	cms := kubernetes.NewForConfigOrDie(restConfig).CoreV1().ConfigMaps(namespace)
+	_, err := cms.Update(ctx, cm, metav1.UpdateOptions{FieldManager: FieldManager})
+	if apierrors.IsNotFound(err) {
+		_, err = cms.Create(ctx, cm, metav1.CreateOptions{FieldManager: FieldManager})
+	}
+	if err != nil {
+		c.logf("WARNING: unable to write site status %s/%s: %s", namespace, SiteStatusName, err.Error())
+		return
+	}
+	c.logf("site status %s/%s: %s, %d of %d charts ready", namespace, SiteStatusName, s.Status, s.Ready, s.Charts)
+}
@@ -0,0 +1,117 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SkipAnnotation set to "true" on a chart or chart group document leaves it
+// out of applies:
+//
+//	metadata:
+//	  name: keystone
+//	  annotations:
+//	    armada.airshipit.org/skip: "true"
+const SkipAnnotation = "armada.airshipit.org/skip"
+
+// validateSkips fails for skipped charts and chart groups the manifest
+// doesn't contain, so a typo doesn't apply the chart meant to be skipped,
+// and warns about charts depending on skipped ones
+func (c *RunCommand) validateSkips() error {
+	groups := map[string]bool{}
+	charts := map[string]bool{}
+	for _, cgName := range c.airManifest.ChartGroups {
+		groups[cgName] = true
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			charts[cName] = true
+			charts[c.airCharts[cName].Release] = true
+		}
+	}
+	var unknown []string
+	for _, name := range c.SkipChartGroups {
+		if !groups[name] {
+			unknown = append(unknown, "chart group "+name)
+		}
+	}
+	for _, name := range c.SkipCharts {
+		if !charts[name] {
+			unknown = append(unknown, "chart "+name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("skipped %s not found in manifest %s", strings.Join(unknown, ", "),
+			c.airManifest.Metadata.Name)
+	}
+
+	for _, cgName := range c.airManifest.ChartGroups {
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			if c.skipGroup(cgName) != "" || c.skipChart(cName) != "" {
+				continue
+			}
+			for _, dep := range c.airCharts[cName].Extensions.Dependencies {
+				if c.skipChart(dep) != "" || c.skipGroup(c.groupOf(dep)) != "" {
+					c.logf("WARNING: chart %s depends on skipped chart %s", cName, dep)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// skipGroup returns why the chart group is skipped, empty if it isn't
+func (c *RunCommand) skipGroup(name string) string {
+	if slices.Contains(c.SkipChartGroups, name) {
+		return "requested by --skip-chart-group"
+	}
+	if cg, ok := c.airGroups[name]; ok && cg.Metadata.Annotations[SkipAnnotation] == "true" {
+		return "annotated with " + SkipAnnotation
+	}
+	return ""
+}
+
+// skipChart returns why the chart is skipped, empty if it isn't
+func (c *RunCommand) skipChart(name string) string {
+	chart, ok := c.airCharts[name]
+	if !ok {
+		return ""
+	}
+	if slices.Contains(c.SkipCharts, name) || slices.Contains(c.SkipCharts, chart.Release) {
+		return "requested by --skip-chart"
+	}
+	if chart.Metadata.Annotations[SkipAnnotation] == "true" {
+		return "annotated with " + SkipAnnotation
+	}
+	return ""
+}
+
+// groupOf returns the chart group of the manifest containing the chart
+func (c *RunCommand) groupOf(chart string) string {
+	for _, cgName := range c.airManifest.ChartGroups {
+		if slices.Contains(c.airGroups[cgName].ChartGroup, chart) {
+			return cgName
+		}
+	}
+	return ""
+}
+
+// skip reports the ArmadaCharts of a skipped chart
+func (c *RunCommand) skip(chart *AirshipChart) {
+	for _, ac := range c.ConvertCharts(chart) {
+		c.reportProgress(ac, ChartSkipped)
+	}
+}
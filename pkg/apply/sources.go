@@ -0,0 +1,146 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/source"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// resolveSources fetches the charts armada-operator can't fetch itself,
+// git, local and OCI sources and tarballs with a checksum, and points
+// their ArmadaCharts at SourceURL, where `armada server` serves them from
+// the cache directory
+func (c *RunCommand) resolveSources(ctx context.Context, restConfig *rest.Config) error {
+	if c.Sources != nil && c.Sources.Secrets == nil {
+		c.Sources.Secrets = func(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+			cs, err := kubernetes.NewForConfig(restConfig)
+			if err != nil {
+				return nil, err
+			}
+			secret, err := cs.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			return secret.Data, nil
+		}
+	}
+	if c.helmBackend() {
+		// the Helm backend fetches every chart itself
+		return nil
+	}
+	c.sources = map[*AirshipChart]armadav1.ArmadaChartSource{}
+	for _, cgName := range c.airManifest.ChartGroups {
+		if c.skipGroup(cgName) != "" {
+			continue
+		}
+		for _, cName := range c.airGroups[cgName].ChartGroup {
+			chart := c.airCharts[cName]
+			src := chartSource(chart)
+			if c.skipChart(cName) != "" || src.Location == "" || !src.Fetched() && !c.Sources.Verify {
+				continue
+			}
+			if c.SourceURL == "" || c.Sources.CacheDir == "" {
+				return fmt.Errorf("chart %s: %s sources are fetched by armada-go, "+
+					"sources.cache_dir and sources.public_url have to be configured", cName, src.Type)
+			}
+			fetched, err := c.Sources.Fetch(ctx, src)
+			if err != nil {
+				return fmt.Errorf("chart %s: %w", cName, err)
+			}
+			how := "fetched"
+			if fetched.Cached {
+				how = "found in cache"
+			}
+			c.logCtx(ctx, "chart %s %s from %s %s, %s %s", cName, how, src.Type, src.Location,
+				fetched.Name, fetched.Version)
+			c.sources[chart] = armadav1.ArmadaChartSource{
+				Type:     source.TypeTar,
+				Location: strings.TrimSuffix(c.SourceURL, "/") + "/" + fetched.FileName(),
+				Subpath:  fetched.Name,
+			}
+		}
+	}
+	return nil
+}
+
+// fetchChart returns the chart of the ArmadaChart for the Helm backend
+func (c *RunCommand) fetchChart(ctx context.Context, chart *armadav1.ArmadaChart) (*source.Chart, error) {
+	sources := c.Sources
+	if sources == nil {
+		sources = &source.Resolver{}
+	}
+	if _, ch := c.sourceChart(chart); ch != nil && ch.Extensions.Source.Location != "" {
+		return sources.Fetch(ctx, chartSource(ch))
+	}
+	return sources.Fetch(ctx, specSource(chart))
+}
+
+// specSource returns the source of the ArmadaChart spec
+func specSource(chart *armadav1.ArmadaChart) source.Source {
+	return source.Source{Type: chart.Spec.Source.Type, Location: chart.Spec.Source.Location,
+		Subpath: chart.Spec.Source.Subpath}
+}
+
+// chartSource returns the source of the chart, its secret is looked up in
+// the namespace of the chart unless the reference has one
+func chartSource(chart *AirshipChart) source.Source {
+	src := chart.Extensions.Source
+	if src.SecretRef != nil && src.SecretRef.Namespace == "" {
+		ref := *src.SecretRef
+		ref.Namespace = chart.Namespace
+		src.SecretRef = &ref
+	}
+	return src
+}
+
+// sourceCredentials reads the credentials of sources without a secret_ref
+// from the files of the [sources] section
+func sourceCredentials(cfg config.SourcesConfig) (*source.Credentials, error) {
+	creds := &source.Credentials{Username: cfg.Username, Password: cfg.Password}
+	for _, f := range []struct {
+		name string
+		data *[]byte
+	}{
+		{cfg.TokenFile, nil},
+		{cfg.SSHKeyFile, &creds.SSHKey},
+		{cfg.KnownHostsFile, &creds.KnownHosts},
+		{cfg.DockerConfigFile, &creds.DockerConfig},
+	} {
+		if f.name == "" {
+			continue
+		}
+		buf, err := os.ReadFile(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("sources credentials: %w", err)
+		}
+		if f.data == nil {
+			creds.Token = strings.TrimSpace(string(buf))
+		} else {
+			*f.data = buf
+		}
+	}
+	return creds, nil
+}
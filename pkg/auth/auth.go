@@ -5,13 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/spf13/viper"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"opendev.org/airship/armada-go/pkg/config"
 	"opendev.org/airship/armada-go/pkg/log"
 )
 
@@ -290,55 +291,181 @@ func filterIncomingHeaders(req *http.Request) {
 	req.Header.Del("X-Role")
 }
 
-func Authenticate() (string, error) {
-	authUrl := viper.Sub("keystone_authtoken").GetString("auth_url")
-	username := viper.Sub("keystone_authtoken").GetString("username")
-	password := viper.Sub("keystone_authtoken").GetString("password")
-	projectDomainName := viper.Sub("keystone_authtoken").GetString("project_domain_name")
-	projectName := viper.Sub("keystone_authtoken").GetString("project_name")
-	userDomainName := viper.Sub("keystone_authtoken").GetString("user_domain_name")
-
-	jsonData := []byte(fmt.Sprintf(`{
-		"auth": {
-			"identity": {
-			  "methods": ["password"],
-			  "password": {
-				"user": {
-				  "name": "%s",
-				  "domain": { "id": "%s" },
-				  "password": "%s"
-				}
-			  }
+// tokenRefreshMargin is how long before expiry a cached token is replaced
+const tokenRefreshMargin = 5 * time.Minute
+
+// TokenSource issues Keystone tokens for the armada-go service user. The
+// token is cached and requested again shortly before it expires.
+type TokenSource struct {
+	settings config.KeystoneConfig
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+var sources = struct {
+	mu sync.Mutex
+	m  map[config.KeystoneConfig]*TokenSource
+}{m: map[config.KeystoneConfig]*TokenSource{}}
+
+// ServiceToken returns the token source of the Keystone settings, configs
+// with equal settings share it and so the cached token
+func ServiceToken(k config.KeystoneConfig) *TokenSource {
+	sources.mu.Lock()
+	defer sources.mu.Unlock()
+	s, ok := sources.m[k]
+	if !ok {
+		s = &TokenSource{settings: k}
+		sources.m[k] = s
+	}
+	return s
+}
+
+// Token returns a valid token, requesting a new one if needed
+func (s *TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expiresAt) > tokenRefreshMargin {
+		return s.token, nil
+	}
+
+	token, expiresAt, err := requestToken(s.settings)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.expiresAt = expiresAt
+	return token, nil
+}
+
+// Invalidate drops the cached token, e.g. after it was rejected by a service
+func (s *TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
+
+// Do sends a request without a body using the service token and retries it
+// once with a new token if the cached one is rejected
+func (s *TokenSource) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := s.Token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Auth-Token", token)
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, err
+		}
+		Log("token rejected by %s, authenticating again", req.URL.Host)
+		_ = resp.Body.Close()
+		s.Invalidate()
+	}
+}
+
+// requestBody builds the Keystone v3 authentication request from the
+// keystone_authtoken section. auth_type selects the method, password or
+// v3applicationcredential, and trust_id scopes a password token to a trust:
+//
+//	[keystone_authtoken]
+//	auth_type = v3applicationcredential
+//	application_credential_id = 0b9d...
+//	application_credential_secret = secret
+func requestBody(k config.KeystoneConfig) ([]byte, error) {
+	var identity, scope map[string]any
+	switch authType := k.AuthType; authType {
+	case "", "password", "v3password":
+		identity = map[string]any{
+			"methods": []string{"password"},
+			"password": map[string]any{
+				"user": map[string]any{
+					"name":     k.Username,
+					"domain":   map[string]any{"id": k.UserDomainName},
+					"password": k.Password,
+				},
 			},
-			"scope": {
-			  "project": {
-				"name": "%s",
-				"domain": { "id": "%s" }
-			  }
+		}
+		if trustID := k.TrustID; trustID != "" {
+			scope = map[string]any{"OS-TRUST:trust": map[string]any{"id": trustID}}
+		} else {
+			scope = map[string]any{
+				"project": map[string]any{
+					"name":   k.ProjectName,
+					"domain": map[string]any{"id": k.ProjectDomainName},
+				},
+			}
+		}
+	case "v3applicationcredential", "application_credential":
+		secret := k.ApplicationCredentialSecret
+		if secret == "" {
+			return nil, errors.New("keystone_authtoken.application_credential_secret is not set")
+		}
+		// Application credentials are scoped on creation, a scope must not be given
+		credential := map[string]any{"secret": secret}
+		if id := k.ApplicationCredentialID; id != "" {
+			credential["id"] = id
+		} else if name := k.ApplicationCredentialName; name != "" {
+			credential["name"] = name
+			user := map[string]any{}
+			if userID := k.UserID; userID != "" {
+				user["id"] = userID
+			} else {
+				user["name"] = k.Username
+				user["domain"] = map[string]any{"name": k.UserDomainName}
 			}
-		  }
-	}`, username, userDomainName, password, projectName, projectDomainName))
+			credential["user"] = user
+		} else {
+			return nil, errors.New("keystone_authtoken.application_credential_id or application_credential_name must be set")
+		}
+		identity = map[string]any{
+			"methods":                []string{"application_credential"},
+			"application_credential": credential,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported keystone_authtoken.auth_type %q", authType)
+	}
+
+	body := map[string]any{"identity": identity}
+	if scope != nil {
+		body["scope"] = scope
+	}
+	return json.Marshal(map[string]any{"auth": body})
+}
+
+func requestToken(k config.KeystoneConfig) (string, time.Time, error) {
+	authUrl := k.AuthURL
+	jsonData, err := requestBody(k)
+	if err != nil {
+		return "", time.Time{}, err
+	}
 
 	req, err := http.NewRequest("POST", authUrl+"/auth/tokens", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 201 {
-		return "", errors.New("http: not authorized")
+		return "", time.Time{}, errors.New("http: not authorized")
 	}
 
 	token := resp.Header.Get("X-Subject-Token")
 	if token == "" {
-		return "", errors.New("http: keystone token is empty")
+		return "", time.Time{}, errors.New("http: keystone token is empty")
 	}
 
-	return token, nil
+	// A token without known expiry is not cached
+	var body authResponse
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Token == nil {
+		return token, time.Time{}, nil
+	}
+	return token, body.Token.ExpiresAt, nil
 }
@@ -0,0 +1,72 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package auth
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process Cache used to avoid validating the same token
+// against Keystone on every request
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewMemoryCache returns an empty MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]cacheEntry{}}
+}
+
+// Set implements Cache
+func (c *MemoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// Drop expired entries so tokens of finished sessions don't pile up
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expiresAt: now.Add(ttl)}
+}
+
+// Get implements Cache, value must be a pointer to the type given to Set
+func (c *MemoryCache) Get(key string, value interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return false
+	}
+	dst := reflect.ValueOf(value)
+	src := reflect.ValueOf(e.value)
+	if dst.Kind() != reflect.Pointer || !src.Type().AssignableTo(dst.Elem().Type()) {
+		return false
+	}
+	dst.Elem().Set(src)
+	return true
+}
@@ -0,0 +1,133 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/databus23/keystone"
+
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+// Provider authenticates API requests. Handlers returned by a provider set
+// the X-Identity-Status header to Confirmed for authenticated requests along
+// with X-User-Name, X-Roles and other identity headers consumed by policy
+// enforcement, and always call the wrapped handler.
+type Provider interface {
+	Handler(h http.Handler) http.Handler
+}
+
+// Supported values of the [auth] strategy option
+const (
+	StrategyKeystone = "keystone"
+	StrategyToken    = "token"
+	StrategyNoAuth   = "noauth"
+)
+
+// NewProvider creates the provider selected in the [auth] section of armada.conf:
+//
+//	[auth]
+//	strategy = keystone | token | noauth
+//	token_file = /etc/armada/token   (or token = ...)
+//	roles = admin
+//
+// keystone is used by default and is configured by [keystone_authtoken],
+// validated tokens are cached for token_cache_time seconds (300 by default).
+func NewProvider(cfg *config.Config) (Provider, error) {
+	strategy := cfg.Auth.Strategy
+	switch strategy {
+	case "", StrategyKeystone:
+		if cfg.Keystone.AuthURL == "" {
+			return nil, fmt.Errorf("keystone_authtoken.auth_url is required by the keystone auth strategy")
+		}
+		ks := keystone.New(cfg.Keystone.AuthURL)
+		ks.TokenCache = NewMemoryCache()
+		if cfg.Keystone.TokenCacheTime > 0 {
+			ks.CacheTime = cfg.Keystone.TokenCacheTime
+		}
+		return ks, nil
+	case StrategyToken:
+		token := cfg.Auth.Token
+		if file := cfg.Auth.TokenFile; file != "" {
+			buf, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			token = strings.TrimSpace(string(buf))
+		}
+		if token == "" {
+			return nil, fmt.Errorf("auth.token or auth.token_file is required by the token auth strategy")
+		}
+		return &TokenProvider{Token: token, Roles: cfg.Auth.Roles}, nil
+	case StrategyNoAuth:
+		Log("WARNING: authentication is disabled, all API requests are trusted")
+		return &NoAuthProvider{Roles: cfg.Auth.Roles}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth.strategy %q, use %s, %s or %s",
+			strategy, StrategyKeystone, StrategyToken, StrategyNoAuth)
+	}
+}
+
+// TokenProvider accepts requests carrying a static token either as a bearer
+// token in the Authorization header or in X-Auth-Token
+type TokenProvider struct {
+	Token string
+	// Roles granted to requests with a valid token
+	Roles []string
+}
+
+// Handler implements Provider
+func (p *TokenProvider) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		filterIncomingHeaders(req)
+		req.Header.Set("X-Identity-Status", "Invalid")
+
+		token := req.Header.Get("X-Auth-Token")
+		if bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.Token)) == 1 {
+			setIdentity(req, "token", p.Roles)
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// NoAuthProvider treats every request as authenticated, for development only
+type NoAuthProvider struct {
+	// Roles granted to every request
+	Roles []string
+}
+
+// Handler implements Provider
+func (p *NoAuthProvider) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		filterIncomingHeaders(req)
+		setIdentity(req, "noauth", p.Roles)
+		h.ServeHTTP(w, req)
+	})
+}
+
+func setIdentity(req *http.Request, user string, roles []string) {
+	req.Header.Set("X-Identity-Status", "Confirmed")
+	req.Header.Set("X-User-Name", user)
+	req.Header.Set("X-User-Id", user)
+	req.Header.Set("X-Roles", strings.Join(roles, ","))
+}
@@ -0,0 +1,324 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package client talks to the REST API of `armada server`, so applies can
+// be submitted without credentials of the cluster:
+//
+//	c := &client.Client{URL: "https://armada.ucp:8000", Tokens: auth.ServiceToken(cfg.Keystone)}
+//	job, err := c.ApplyAsync(ctx, "deckhand+https://deckhand/revisions/1/rendered-documents", client.ApplyOptions{})
+//	...
+//	job, err = c.WaitJob(ctx, job.ID, 10*time.Second)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPath is the path of the API below URL
+const APIPath = "/api/v1.0"
+
+// TokenSource issues the tokens sent as X-Auth-Token, auth.TokenSource
+// requests them from Keystone
+type TokenSource interface {
+	Token() (string, error)
+	// Invalidate drops a cached token the server rejected
+	Invalidate()
+}
+
+// Client sends requests to the API at URL
+type Client struct {
+	// URL of the server, e.g. https://armada.ucp.svc:8000
+	URL string
+	// Token is sent as X-Auth-Token, Tokens issues them if it is empty
+	Token  string
+	Tokens TokenSource
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// UserAgent identifies the client, armada-go-client if empty
+	UserAgent string
+}
+
+// Error is an error answered by the API
+type Error struct {
+	Status  int
+	Message string
+	// Retry tells the request may succeed when sent again
+	Retry bool
+	// Log is the apply log of failed applies
+	Log       string
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", http.StatusText(e.Status), e.Message)
+}
+
+// Apply applies the manifests at href, which the server fetches, and
+// returns once the apply finished
+func (c *Client) Apply(ctx context.Context, href string, opts ApplyOptions) (*ApplyResult, error) {
+	var res ApplyResult
+	if err := c.do(ctx, http.MethodPost, "/apply", opts.query(), map[string]any{"hrefs": href}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ApplyManifests applies the manifest documents read from r, which are sent
+// in the request body, and returns once the apply finished
+func (c *Client) ApplyManifests(ctx context.Context, r io.Reader, opts ApplyOptions) (*ApplyResult, error) {
+	var res ApplyResult
+	if err := c.do(ctx, http.MethodPost, "/apply", opts.query(), r, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ApplyAsync starts an apply of the manifests at href as a job of the
+// server, see Job and WaitJob
+func (c *Client) ApplyAsync(ctx context.Context, href string, opts ApplyOptions) (*Job, error) {
+	q := opts.query()
+	q.Set("async", "true")
+	var res struct {
+		Message struct {
+			JobID string `json:"job_id"`
+		} `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/apply", q, map[string]any{"hrefs": href}, &res); err != nil {
+		return nil, err
+	}
+	return &Job{ID: res.Message.JobID, Status: JobRunning, Href: href, TargetManifest: opts.TargetManifest}, nil
+}
+
+// Job returns the state of the apply job
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// JobLogs returns the log of the apply job so far
+func (c *Client) JobLogs(ctx context.Context, id string) (string, error) {
+	var buf bytes.Buffer
+	if err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id)+"/logs", nil, nil, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// WaitJob polls the apply job every interval until it finished, the job
+// is returned with an error if it failed
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch job.Status {
+		case JobSucceeded:
+			return job, nil
+		case JobFailed:
+			return job, fmt.Errorf("apply job %s failed: %s", id, job.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Validate validates the manifests at href
+func (c *Client) Validate(ctx context.Context, href string) (*ValidateResult, error) {
+	var res ValidateResult
+	if err := c.do(ctx, http.MethodPost, "/validatedesign", nil, map[string]any{"href": href}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Releases returns the Helm releases by namespace, of all namespaces if
+// namespace is empty
+func (c *Client) Releases(ctx context.Context, namespace string) (map[string][]string, error) {
+	q := url.Values{}
+	if namespace != "" {
+		q.Set("namespace", namespace)
+	}
+	var res struct {
+		Releases map[string][]string `json:"releases"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/releases", q, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Releases, nil
+}
+
+// Rollback rolls the release back, to the previous revision if
+// opts.Version is zero, and returns the message of the server
+func (c *Client) Rollback(ctx context.Context, release string, opts RollbackOptions) (string, error) {
+	q := url.Values{}
+	if opts.Namespace != "" {
+		q.Set("namespace", opts.Namespace)
+	}
+	if opts.Version != 0 {
+		q.Set("version", strconv.Itoa(opts.Version))
+	}
+	if opts.NoWait {
+		q.Set("wait", "false")
+	}
+	if opts.Timeout != 0 {
+		q.Set("timeout", opts.Timeout.String())
+	}
+	var res struct {
+		Message string `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/rollback/"+url.PathEscape(release), q, nil, &res); err != nil {
+		return "", err
+	}
+	return res.Message, nil
+}
+
+// Delete removes the charts of the manifests at href
+func (c *Client) Delete(ctx context.Context, href string, opts DeleteOptions) (*DeleteResult, error) {
+	var res DeleteResult
+	if err := c.do(ctx, http.MethodPost, "/delete", opts.query(), map[string]any{"hrefs": href}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Health returns nil if the server is up
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health", nil, nil, nil)
+}
+
+// Versions returns the API versions and the build of the server
+func (c *Client) Versions(ctx context.Context) (*Versions, error) {
+	var res Versions
+	if err := c.do(ctx, http.MethodGet, "/versions", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// do sends the request with body encoded as JSON, or YAML read from an
+// io.Reader body, and decodes the response into out, a rejected token of
+// Tokens is replaced once
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := strings.TrimSuffix(c.URL, "/") + APIPath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var buf []byte
+	contentType := "application/json"
+	if r, ok := body.(io.Reader); ok {
+		var err error
+		if buf, err = io.ReadAll(r); err != nil {
+			return err
+		}
+		contentType = "application/x-yaml"
+	} else if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", c.userAgent())
+		token := c.Token
+		if token == "" && c.Tokens != nil {
+			if token, err = c.Tokens.Token(); err != nil {
+				return fmt.Errorf("unable to get a token: %w", err)
+			}
+		}
+		if token != "" {
+			req.Header.Set("X-Auth-Token", token)
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && c.Token == "" && c.Tokens != nil && attempt == 0 {
+			_ = resp.Body.Close()
+			c.Tokens.Invalidate()
+			continue
+		}
+		return decode(resp, out)
+	}
+}
+
+func (c *Client) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return "armada-go-client"
+}
+
+// decode reads the response into out, or into a bytes.Buffer as is, and
+// the error envelope into Error
+func decode(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var env struct {
+			Message   string `json:"message"`
+			Retry     bool   `json:"retry"`
+			Log       string `json:"log"`
+			RequestID string `json:"request_id"`
+		}
+		if json.Unmarshal(data, &env) != nil || env.Message == "" {
+			env.Message = strings.TrimSpace(string(data))
+		}
+		return &Error{Status: resp.StatusCode, Message: env.Message, Retry: env.Retry, Log: env.Log,
+			RequestID: env.RequestID}
+	}
+	if buf, ok := out.(*bytes.Buffer); ok {
+		_, err := buf.Write(data)
+		return err
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response of %s: %w", resp.Request.URL.Path, err)
+	}
+	return nil
+}
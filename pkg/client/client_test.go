@@ -0,0 +1,173 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticTokens struct {
+	tokens      []string
+	invalidated int
+}
+
+func (s *staticTokens) Token() (string, error) {
+	return s.tokens[s.invalidated], nil
+}
+
+func (s *staticTokens) Invalidate() {
+	s.invalidated++
+}
+
+func TestApply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1.0/apply" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query()["skip_chart"]; len(got) != 2 || got[1] != "mariadb" {
+			t.Errorf("unexpected skip_chart %v", got)
+		}
+		if r.URL.Query().Get("target_manifest") != "full-site" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["hrefs"] != "http://site/manifest.yaml" {
+			t.Errorf("unexpected body %v: %v", body, err)
+		}
+		_, _ = w.Write([]byte(`{"message":{"install":["keystone"],"upgrade":[]},"request_id":"req-1",
+			"results":[{"chart":"keystone","namespace":"openstack","state":"ready","duration":2000000000}]}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL + "/", Token: "t"}
+	res, err := c.Apply(context.Background(), "http://site/manifest.yaml",
+		ApplyOptions{TargetManifest: "full-site", SkipCharts: []string{"ceph", "mariadb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Message.Install) != 1 || res.RequestID != "req-1" || len(res.Results) != 1 ||
+		res.Results[0].Duration != 2*time.Second {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestApplyManifests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-yaml" {
+			t.Errorf("unexpected content type %s", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "schema: armada/Manifest/v1\n" {
+			t.Errorf("unexpected body %q", body)
+		}
+		_, _ = w.Write([]byte(`{"message":{"install":[],"upgrade":["keystone"]}}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL}
+	res, err := c.ApplyManifests(context.Background(), strings.NewReader("schema: armada/Manifest/v1\n"), ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Message.Upgrade) != 1 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"kind":"Status","status":"Failure","message":"not the leader","retry":true,
+			"request_id":"req-2"}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL}
+	_, err := c.Job(context.Background(), "1")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	if apiErr.Status != http.StatusConflict || !apiErr.Retry || apiErr.Message != "not the leader" ||
+		apiErr.RequestID != "req-2" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestTokenRenewal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tokens := &staticTokens{tokens: []string{"expired", "fresh"}}
+	c := &Client{URL: srv.URL, Tokens: tokens}
+	if err := c.Health(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.invalidated != 1 {
+		t.Errorf("expected the token to be invalidated once, got %d", tokens.invalidated)
+	}
+}
+
+func TestWaitJob(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := JobRunning
+		if polls == 3 {
+			status = JobFailed
+		}
+		_ = json.NewEncoder(w).Encode(Job{ID: "1", Status: status, Error: "keystone failed"})
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL}
+	job, err := c.WaitJob(context.Background(), "1", time.Millisecond)
+	if err == nil || job == nil || job.Status != JobFailed {
+		t.Fatalf("expected the job to fail, got %+v, %v", job, err)
+	}
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got %d", polls)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"build":{"version":"1.2.0"},"v1.0":{"path":"/api/v1.0","status":"stable"}}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{URL: srv.URL}
+	v, err := c.Versions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Build.Version != "1.2.0" || v.APIs["v1.0"].Status != "stable" || len(v.APIs) != 1 {
+		t.Errorf("unexpected versions %+v", v)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// ApplyOptions are the query parameters of an apply
+type ApplyOptions struct {
+	TargetManifest  string
+	SkipCharts      []string
+	SkipChartGroups []string
+	CanaryGroups    []string
+	Resume          bool
+	Atomic          bool
+	// ForceReconcile overwrites ArmadaCharts edited on the cluster
+	ForceReconcile bool
+}
+
+func (o ApplyOptions) query() url.Values {
+	q := url.Values{}
+	if o.TargetManifest != "" {
+		q.Set("target_manifest", o.TargetManifest)
+	}
+	for _, name := range o.SkipCharts {
+		q.Add("skip_chart", name)
+	}
+	for _, name := range o.SkipChartGroups {
+		q.Add("skip_chart_group", name)
+	}
+	for _, name := range o.CanaryGroups {
+		q.Add("canary_group", name)
+	}
+	if o.Resume {
+		q.Set("resume", "true")
+	}
+	if o.Atomic {
+		q.Set("atomic", "true")
+	}
+	if o.ForceReconcile {
+		q.Set("force_reconcile", "true")
+	}
+	return q
+}
+
+// ApplyResult is the response of a finished apply
+type ApplyResult struct {
+	Message struct {
+		Install []string `json:"install"`
+		Upgrade []string `json:"upgrade"`
+	} `json:"message"`
+	RequestID string        `json:"request_id"`
+	Results   []ChartResult `json:"results"`
+	Log       string        `json:"log"`
+}
+
+// ChartResult describes how the install of an ArmadaChart went
+type ChartResult struct {
+	Chart     string    `json:"chart"`
+	Namespace string    `json:"namespace"`
+	State     string    `json:"state"`
+	Started   time.Time `json:"started"`
+	// Cluster is the kubeconfig context of the cluster the chart was
+	// applied to, empty for the cluster of the apply
+	Cluster string `json:"cluster,omitempty"`
+	// ReadyAfter is the time from the start of the install until the
+	// ArmadaChart was seen ready
+	ReadyAfter time.Duration `json:"ready_after,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	// Reason is why the chart was last seen not ready or failed
+	Reason     string       `json:"reason,omitempty"`
+	RolledBack bool         `json:"rolled_back,omitempty"`
+	Tests      []TestResult `json:"tests,omitempty"`
+}
+
+// TestResult is the outcome of a Helm test of a chart
+type TestResult struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// JobStatus is the state of an apply job
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is an apply the server runs in background
+type Job struct {
+	ID             string            `json:"id"`
+	Status         JobStatus         `json:"status"`
+	Href           string            `json:"href"`
+	TargetManifest string            `json:"target_manifest"`
+	Started        time.Time         `json:"started"`
+	Finished       *time.Time        `json:"finished"`
+	Error          string            `json:"error"`
+	Charts         map[string]string `json:"charts"`
+	Install        []string          `json:"install"`
+	Upgrade        []string          `json:"upgrade"`
+	Results        []ChartResult     `json:"results"`
+}
+
+// ValidateResult is the status envelope answered by a validation
+type ValidateResult struct {
+	Kind    string `json:"kind"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Details struct {
+		ErrorCount  int `json:"errorCount"`
+		MessageList []struct {
+			Message string `json:"message"`
+			Error   bool   `json:"error"`
+		} `json:"messageList"`
+	} `json:"details"`
+}
+
+// RollbackOptions are the query parameters of a rollback
+type RollbackOptions struct {
+	Namespace string
+	// Version to roll back to, the previous revision if zero
+	Version int
+	// NoWait returns without waiting for the release to become ready
+	NoWait  bool
+	Timeout time.Duration
+}
+
+// DeleteOptions are the query parameters of a delete
+type DeleteOptions struct {
+	TargetManifest  string
+	DryRun          bool
+	PurgeNamespaces bool
+	PurgeCRD        bool
+	Timeout         time.Duration
+}
+
+func (o DeleteOptions) query() url.Values {
+	q := url.Values{}
+	if o.TargetManifest != "" {
+		q.Set("target_manifest", o.TargetManifest)
+	}
+	if o.DryRun {
+		q.Set("dry_run", "true")
+	}
+	if o.PurgeNamespaces {
+		q.Set("purge_namespaces", "true")
+	}
+	if o.PurgeCRD {
+		q.Set("purge_crd", "true")
+	}
+	if o.Timeout != 0 {
+		q.Set("timeout", o.Timeout.String())
+	}
+	return q
+}
+
+// DeleteResult is the response of a delete
+type DeleteResult struct {
+	Message struct {
+		Delete []Action `json:"delete"`
+		DryRun bool     `json:"dry_run"`
+	} `json:"message"`
+	RequestID string `json:"request_id"`
+	Log       string `json:"log"`
+}
+
+// Action is an object a delete removed or would remove
+type Action struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// Versions are the API versions and the build of the server
+type Versions struct {
+	Build BuildInfo
+	// APIs are the served API versions by name, e.g. v1.0
+	APIs map[string]APIVersion
+}
+
+// BuildInfo describes the build of armada-go
+type BuildInfo struct {
+	Version            string   `json:"version"`
+	GitCommit          string   `json:"git_commit,omitempty"`
+	BuildDate          string   `json:"build_date,omitempty"`
+	GoVersion          string   `json:"go_version"`
+	Platform           string   `json:"platform"`
+	APIVersions        []string `json:"api_versions"`
+	ArmadaChartVersion string   `json:"armadachart_version"`
+}
+
+// APIVersion is a version of the API
+type APIVersion struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// UnmarshalJSON reads the build and the versions keyed by name
+func (v *Versions) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	v.APIs = map[string]APIVersion{}
+	for k, msg := range raw {
+		if k == "build" {
+			if err := json.Unmarshal(msg, &v.Build); err != nil {
+				return err
+			}
+			continue
+		}
+		var api APIVersion
+		if err := json.Unmarshal(msg, &api); err != nil {
+			return err
+		}
+		v.APIs[k] = api
+	}
+	return nil
+}
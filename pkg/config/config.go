@@ -13,35 +13,812 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/util"
 )
 
+// DefaultPort is the port the API listens on unless [api] port is set
+const DefaultPort = 8000
+
+// DefaultMaxBodySize limits request bodies unless [api] max_body_size is set
+const DefaultMaxBodySize = 10 << 20
+
+// DefaultMaxManifestSize limits manifests sent in request bodies unless [api]
+// max_manifest_size is set
+const DefaultMaxManifestSize = 64 << 20
+
 // Config holds the information required by armada-go commands
-type Config struct{}
+type Config struct {
+	API        APIConfig
+	Auth       AuthConfig
+	Keystone   KeystoneConfig
+	Kubernetes KubernetesConfig
+	Apply      ApplyConfig
+	Sources    SourcesConfig
+	Proxy      ProxyConfig
+	Wait       WaitConfig
+	Logging    LoggingConfig
+	Pipeline   PipelineConfig
+	CORS       CORSConfig
+	Syslog     SyslogConfig
+	Policy     PolicyConfig
+	Audit      AuditConfig
+	// LeaderElection elects the replica of `armada server` running applies
+	LeaderElection LeaderElectionConfig
+	RateLimit      RateLimitConfig
+
+	// v holds the settings the config was loaded from, profiles are read
+	// from it on demand
+	v *viper.Viper
+}
+
+// APIConfig is the [api] section
+type APIConfig struct {
+	ListenAddress string
+	Port          int
+	// ShutdownTimeout limits draining of in-flight applies, zero means no limit
+	ShutdownTimeout time.Duration
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	// UnauthenticatedEndpoints replace the server defaults if not nil
+	UnauthenticatedEndpoints []string
+	// TrustedProxies are the addresses or CIDRs of proxies whose
+	// X-Forwarded-For header names the client, none are trusted by default
+	TrustedProxies []string
+
+	// MaxBodySize limits request bodies in bytes, zero means no limit
+	MaxBodySize int64
+	// MaxManifestSize replaces MaxBodySize for manifest documents sent to
+	// the apply endpoint
+	MaxManifestSize int64
+	// RequestTimeout limits every handler, zero means no limit
+	RequestTimeout time.Duration
+	// HandlerTimeouts replace RequestTimeout by endpoint path below
+	// /api/v1.0, e.g. apply=2h or jobs/:id/logs=0
+	HandlerTimeouts map[string]time.Duration
+}
+
+// AuthConfig is the [auth] section
+type AuthConfig struct {
+	Strategy  string
+	Token     string
+	TokenFile string
+	Roles     []string
+}
+
+// KeystoneConfig is the [keystone_authtoken] section
+type KeystoneConfig struct {
+	AuthURL                     string
+	AuthType                    string
+	Username                    string
+	UserID                      string
+	Password                    string
+	UserDomainName              string
+	ProjectName                 string
+	ProjectDomainName           string
+	TrustID                     string
+	ApplicationCredentialID     string
+	ApplicationCredentialName   string
+	ApplicationCredentialSecret string
+	// TokenCacheTime is how long validated tokens are cached, zero keeps the
+	// library default
+	TokenCacheTime time.Duration
+}
+
+// KubernetesConfig is the [kubernetes] section, it selects the target
+// cluster and tunes the client:
+//
+//	[kubernetes]
+//	kubeconfig = /etc/armada/kubeconfig
+//	context = site
+//	qps = 50
+//	burst = 100
+type KubernetesConfig struct {
+	Kubeconfig string
+	Context    string
+	// QPS and Burst override the client-go rate limits if not zero
+	QPS   float32
+	Burst int
+}
+
+// RestConfig returns the client configuration of the target cluster. The
+// in-cluster configuration is used unless a kubeconfig or context is given,
+// otherwise the kubeconfig is loaded the way kubectl does.
+func (k KubernetesConfig) RestConfig() (*rest.Config, error) {
+	var restConfig *rest.Config
+	if k.Kubeconfig == "" && k.Context == "" {
+		var err error
+		if restConfig, err = rest.InClusterConfig(); err != nil {
+			log.Printf("Unable to load in-cluster kubeconfig, reason: %v", err)
+		}
+	}
+	if restConfig == nil {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = k.Kubeconfig
+		var err error
+		restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			rules, &clientcmd.ConfigOverrides{CurrentContext: k.Context}).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k.QPS > 0 {
+		restConfig.QPS = k.QPS
+	}
+	if k.Burst > 0 {
+		restConfig.Burst = k.Burst
+	}
+	return restConfig, nil
+}
+
+// ApplyConfig is the [apply] section
+type ApplyConfig struct {
+	ReleaseLabelKey      string
+	ReleaseLabelTemplate string
+	ExtraLabels          map[string]string
+	// MaxParallel limits charts installed at once in parallel chart groups
+	MaxParallel int
+	// WaitTimeout is used for charts without data.wait.timeout
+	WaitTimeout time.Duration
+	// ChartTimeouts replace the wait timeout of charts by chart or release name
+	ChartTimeouts map[string]time.Duration
+	// Timeout limits the whole apply, zero means no limit
+	Timeout time.Duration
+	// CRDPath overrides the ArmadaChart CRD embedded in armada-go
+	CRDPath string
+	// WaitForOperator checks that the armada-operator deployment is
+	// available before charts are created
+	WaitForOperator     bool
+	OperatorNamespace   string
+	OperatorDeployment  string
+	OperatorWaitTimeout time.Duration
+	// SiteStatusNamespace holds the ConfigMap summarizing the last apply
+	SiteStatusNamespace string
+	// Backend installs the charts, operator or helm
+	Backend string
+	// ManifestKeyFile is the PEM public key manifests have to be signed
+	// with, unsigned manifests are accepted if empty
+	ManifestKeyFile string
+	// NoCreateNamespaces is set by create_namespaces = false, missing
+	// namespaces of charts fail the apply
+	NoCreateNamespaces bool
+	// Preflight checks the cluster before every apply
+	Preflight bool
+	// Clusters maps chart groups to kubeconfig contexts of the clusters
+	// their charts are applied to
+	Clusters map[string]string
+	// NoLock is set by lock = false, applies of a manifest aren't
+	// serialized
+	NoLock bool
+	// LockWait is how long an apply waits for the lock of its manifest
+	LockWait time.Duration
+}
+
+// SourcesConfig is the [sources] section
+type SourcesConfig struct {
+	// CacheDir keeps fetched charts across applies
+	CacheDir string
+	// PublicURL is where armada-operator downloads the charts of CacheDir
+	// from, the charts endpoint of `armada server`
+	PublicURL string
+	// PlainHTTP talks to OCI registries without TLS
+	PlainHTTP bool
+	// Username, Password and the token of TokenFile authenticate to the
+	// servers of sources without a secret_ref, like the key of SSHKeyFile
+	// does for git over SSH and the auths of DockerConfigFile for registries
+	Username         string
+	Password         string
+	TokenFile        string
+	SSHKeyFile       string
+	KnownHostsFile   string
+	DockerConfigFile string
+	// Verify requires the Helm provenance of tarballs or the cosign
+	// signature of OCI charts of every source, checked with Keyring and
+	// the PEM public key of PublicKeyFile
+	Verify        bool
+	Keyring       string
+	PublicKeyFile string
+}
+
+// WaitConfig is the [wait] section
+type WaitConfig struct {
+	// Timeout is used by `armada wait` without --timeout
+	Timeout time.Duration
+	// OperatorTimeout is how long charts may stay unobserved by the operator,
+	// the wait default if zero, disabled if negative
+	OperatorTimeout time.Duration
+	// ProgressInterval is how often waits log which resources aren't ready,
+	// the wait default if zero, disabled if negative
+	ProgressInterval time.Duration
+}
+
+// LoggingConfig is the [logging] section
+type LoggingConfig struct {
+	Format string
+	Output string
+	// Verbosity is nil if not configured
+	Verbosity *int
+}
+
+// PipelineConfig is the [pipeline] section
+type PipelineConfig struct {
+	// Filters replace the server defaults if not nil
+	Filters []string
+}
+
+// CORSConfig is the [cors] section
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowMethods     string
+	AllowHeaders     string
+	ExposeHeaders    string
+	MaxAge           int
+	AllowCredentials bool
+}
+
+// SyslogConfig is the [syslog] section
+type SyslogConfig struct {
+	Enabled  bool
+	Address  string
+	AppName  string
+	Facility string
+}
+
+// PolicyConfig is the [oslo_policy] section
+type PolicyConfig struct {
+	PolicyFile string
+}
+
+// AuditConfig is the [audit] section
+type AuditConfig struct {
+	File   string
+	Format string
+	Syslog bool
+}
+
+// LeaderElectionConfig is the [leader_election] section, replicas of
+// `armada server` elect the one running applies through a Lease:
+//
+//	[leader_election]
+//	enabled = true
+//	lease_name = armada-go
+//	advertise_url = https://armada-0.armada.ucp:8000
+type LeaderElectionConfig struct {
+	Enabled bool
+	// Namespace and LeaseName locate the Lease, the namespace of the pod
+	// is used if Namespace is empty
+	Namespace string
+	LeaseName string
+	// AdvertiseURL is where the other replicas forward applies to while
+	// this one leads, they answer 409 Conflict if it is empty
+	AdvertiseURL  string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// RateLimitConfig is the [rate_limit] section, every client gets a token
+// bucket refilled with Rate requests per second up to Burst requests:
+//
+//	[rate_limit]
+//	enabled = true
+//	rate = 2
+//	burst = 10
+//	key = project
+type RateLimitConfig struct {
+	Enabled bool
+	Rate    float64
+	Burst   int
+	// Key tells which requests share a bucket: project, user or ip,
+	// requests without the project or user fall back to the client IP,
+	// which is only taken from X-Forwarded-For of API.TrustedProxies
+	Key string
+}
+
+// Clone returns a deep copy of the config, so a request can't change the
+// settings seen by others
+func (c *Config) Clone() *Config {
+	cp := *c
+	cp.API.UnauthenticatedEndpoints = slices.Clone(c.API.UnauthenticatedEndpoints)
+	cp.API.HandlerTimeouts = maps.Clone(c.API.HandlerTimeouts)
+	cp.API.TrustedProxies = slices.Clone(c.API.TrustedProxies)
+	cp.Auth.Roles = slices.Clone(c.Auth.Roles)
+	cp.Apply.ExtraLabels = maps.Clone(c.Apply.ExtraLabels)
+	cp.Apply.ChartTimeouts = maps.Clone(c.Apply.ChartTimeouts)
+	cp.Apply.Clusters = maps.Clone(c.Apply.Clusters)
+	cp.Pipeline.Filters = slices.Clone(c.Pipeline.Filters)
+	cp.CORS.AllowedOrigins = slices.Clone(c.CORS.AllowedOrigins)
+	if c.Logging.Verbosity != nil {
+		v := *c.Logging.Verbosity
+		cp.Logging.Verbosity = &v
+	}
+	return &cp
+}
+
+type ctxKey struct{}
+
+// IntoContext returns a context carrying the config
+func IntoContext(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// FromContext returns the config of the context, nil if there is none
+func FromContext(ctx context.Context) *Config {
+	c, _ := ctx.Value(ctxKey{}).(*Config)
+	return c
+}
+
+// DefaultPath is the config file read unless another one is given
+const DefaultPath = "/etc/armada/armada.conf"
+
+// EnvPrefix prefixes environment variables overriding config settings, a
+// setting is overridden by ARMADA_<SECTION>_<KEY> in upper case, e.g.
+// ARMADA_API_PORT or ARMADA_KEYSTONE_AUTHTOKEN_AUTH_URL
+const EnvPrefix = "ARMADA"
+
+// EnvConfigPath selects the config file if --armadaconf isn't given
+const EnvConfigPath = EnvPrefix + "_CONFIG"
 
 // Factory is a function which returns ready to use config object and error (if any)
 type Factory func() (*Config, error)
 
-// CreateFactory returns function which creates ready to use Config object
-func CreateFactory(armadaConfigPath *string) Factory {
+// Resolve returns the config of the factory, or defaults and environment
+// settings if the factory is nil
+func Resolve(f Factory) (*Config, error) {
+	if f == nil {
+		return Load()
+	}
+	return f()
+}
+
+// CreateFactory returns function which creates ready to use Config object.
+// Settings are taken in this order of precedence: command line flags,
+// ARMADA_* environment variables, the config file, defaults. The config file
+// is armadaConfigPath, $ARMADA_CONFIG or DefaultPath. INI is expected unless
+// the file name ends in .yaml, .yml or .json. A missing DefaultPath is not an
+// error, so the environment alone can configure armada-go.
+// Non empty fields of kube, usually bound to command line flags, take
+// precedence over the [kubernetes] section.
+func CreateFactory(armadaConfigPath *string, kube *KubernetesConfig) Factory {
 	return func() (*Config, error) {
-		err := initConfig()
+		var path string
+		if armadaConfigPath != nil {
+			path = *armadaConfigPath
+		}
+		cfg, err := initConfig(path)
 		if err != nil {
 			log.Print("Failed to load or initialize config: ", err)
 			return nil, err
 		}
-		return &Config{}, nil
+		if kube != nil {
+			if kube.Kubeconfig != "" {
+				cfg.Kubernetes.Kubeconfig = kube.Kubeconfig
+			}
+			if kube.Context != "" {
+				cfg.Kubernetes.Context = kube.Context
+			}
+		}
+		return cfg, nil
+	}
+}
+
+// InitConfig reads an armada config from the cfg file
+func initConfig(path string) (*Config, error) {
+	explicit := true
+	if path == "" {
+		path = os.Getenv(EnvConfigPath)
+	}
+	if path == "" {
+		path, explicit = DefaultPath, false
+	}
+	v := newViper()
+	v.SetConfigFile(path)
+	v.SetConfigType(configType(path))
+	if err := v.ReadInConfig(); err != nil {
+		if explicit || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		log.Debugf("config file %s not found, using defaults and environment", path)
+	}
+	cfg, err := load(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := log.Configure(cfg.Logging.Format, cfg.Logging.Output, cfg.Logging.Verbosity); err != nil {
+		return nil, err
+	}
+	cfg.Proxy.Install()
+	return cfg, nil
+}
+
+// configType returns the viper config type of the file
+func configType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	default:
+		return "ini"
+	}
+}
+
+// newViper returns settings overridden by ARMADA_* environment variables.
+// Every load uses its own instance, so configs loaded concurrently don't
+// share state.
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	return v
+}
+
+// Load returns defaults and settings of the environment, commands which
+// don't require a config file use it
+func Load() (*Config, error) {
+	return load(newViper())
+}
+
+func load(v *viper.Viper) (*Config, error) {
+	cfg := &Config{
+		API: APIConfig{
+			ListenAddress:   v.GetString("api.listen_address"),
+			TLSCertFile:     v.GetString("api.tls_cert_file"),
+			TLSKeyFile:      v.GetString("api.tls_key_file"),
+			TLSClientCAFile: v.GetString("api.tls_client_ca_file"),
+		},
+		Auth: AuthConfig{
+			Strategy:  v.GetString("auth.strategy"),
+			Token:     v.GetString("auth.token"),
+			TokenFile: v.GetString("auth.token_file"),
+			Roles:     []string{"admin"},
+		},
+		Keystone: KeystoneConfig{
+			AuthURL:                     v.GetString("keystone_authtoken.auth_url"),
+			AuthType:                    v.GetString("keystone_authtoken.auth_type"),
+			Username:                    v.GetString("keystone_authtoken.username"),
+			UserID:                      v.GetString("keystone_authtoken.user_id"),
+			Password:                    v.GetString("keystone_authtoken.password"),
+			UserDomainName:              v.GetString("keystone_authtoken.user_domain_name"),
+			ProjectName:                 v.GetString("keystone_authtoken.project_name"),
+			ProjectDomainName:           v.GetString("keystone_authtoken.project_domain_name"),
+			TrustID:                     v.GetString("keystone_authtoken.trust_id"),
+			ApplicationCredentialID:     v.GetString("keystone_authtoken.application_credential_id"),
+			ApplicationCredentialName:   v.GetString("keystone_authtoken.application_credential_name"),
+			ApplicationCredentialSecret: v.GetString("keystone_authtoken.application_credential_secret"),
+		},
+		Kubernetes: KubernetesConfig{
+			Kubeconfig: v.GetString("kubernetes.kubeconfig"),
+			Context:    v.GetString("kubernetes.context"),
+		},
+		Apply: ApplyConfig{
+			ReleaseLabelKey:      v.GetString("apply.release_label_key"),
+			ReleaseLabelTemplate: v.GetString("apply.release_label_template"),
+			CRDPath:              v.GetString("apply.crd_path"),
+			WaitForOperator:      v.GetBool("apply.wait_for_operator"),
+			OperatorNamespace:    v.GetString("apply.operator_namespace"),
+			OperatorDeployment:   v.GetString("apply.operator_deployment"),
+			SiteStatusNamespace:  v.GetString("apply.site_status_namespace"),
+			Backend:              v.GetString("apply.backend"),
+			ManifestKeyFile:      v.GetString("apply.manifest_key_file"),
+			NoCreateNamespaces:   v.IsSet("apply.create_namespaces") && !v.GetBool("apply.create_namespaces"),
+			Preflight:            v.GetBool("apply.preflight"),
+			NoLock:               v.IsSet("apply.lock") && !v.GetBool("apply.lock"),
+		},
+		Sources: SourcesConfig{
+			CacheDir:         v.GetString("sources.cache_dir"),
+			PublicURL:        v.GetString("sources.public_url"),
+			PlainHTTP:        v.GetBool("sources.plain_http"),
+			Username:         v.GetString("sources.username"),
+			Password:         v.GetString("sources.password"),
+			TokenFile:        v.GetString("sources.token_file"),
+			SSHKeyFile:       v.GetString("sources.ssh_key_file"),
+			KnownHostsFile:   v.GetString("sources.known_hosts_file"),
+			DockerConfigFile: v.GetString("sources.docker_config_file"),
+			Verify:           v.GetBool("sources.verify"),
+			Keyring:          v.GetString("sources.keyring"),
+			PublicKeyFile:    v.GetString("sources.public_key_file"),
+		},
+		Logging: LoggingConfig{
+			Format: v.GetString("logging.format"),
+			Output: v.GetString("logging.output"),
+		},
+		CORS: CORSConfig{
+			AllowMethods:     v.GetString("cors.allow_methods"),
+			AllowHeaders:     v.GetString("cors.allow_headers"),
+			ExposeHeaders:    v.GetString("cors.expose_headers"),
+			AllowCredentials: v.GetBool("cors.allow_credentials"),
+		},
+		Proxy: ProxyConfig{
+			HTTPProxy:  v.GetString("proxy.http_proxy"),
+			HTTPSProxy: v.GetString("proxy.https_proxy"),
+			NoProxy:    v.GetString("proxy.no_proxy"),
+		},
+		Syslog: SyslogConfig{
+			Enabled:  v.GetBool("syslog.enabled"),
+			Address:  v.GetString("syslog.address"),
+			AppName:  v.GetString("syslog.app_name"),
+			Facility: v.GetString("syslog.facility"),
+		},
+		Policy: PolicyConfig{
+			PolicyFile: v.GetString("oslo_policy.policy_file"),
+		},
+		Audit: AuditConfig{
+			File:   v.GetString("audit.file"),
+			Format: v.GetString("audit.format"),
+			Syslog: v.GetBool("audit.syslog"),
+		},
+		LeaderElection: LeaderElectionConfig{
+			Enabled:      v.GetBool("leader_election.enabled"),
+			Namespace:    v.GetString("leader_election.namespace"),
+			LeaseName:    v.GetString("leader_election.lease_name"),
+			AdvertiseURL: v.GetString("leader_election.advertise_url"),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: v.GetBool("rate_limit.enabled"),
+			Key:     v.GetString("rate_limit.key"),
+		},
+		v: v,
+	}
+
+	var err error
+	if cfg.API.Port, err = getInt(v, "api.port", DefaultPort); err != nil {
+		return nil, err
+	}
+	if cfg.API.ShutdownTimeout, err = getDuration(v, "api.shutdown_timeout"); err != nil {
+		return nil, err
+	}
+	if cfg.API.MaxBodySize, err = getSize(v, "api.max_body_size", DefaultMaxBodySize); err != nil {
+		return nil, err
+	}
+	if cfg.API.MaxManifestSize, err = getSize(v, "api.max_manifest_size", DefaultMaxManifestSize); err != nil {
+		return nil, err
+	}
+	if cfg.API.RequestTimeout, err = getDuration(v, "api.request_timeout"); err != nil {
+		return nil, err
+	}
+	if timeouts := getList(v, "api.handler_timeouts"); len(timeouts) > 0 {
+		if cfg.API.HandlerTimeouts, err = util.ParseDurations(timeouts); err != nil {
+			return nil, fmt.Errorf("api.handler_timeouts: %w", err)
+		}
+	}
+	cfg.API.TrustedProxies = getList(v, "api.trusted_proxies")
+	if v.IsSet("api.unauthenticated_endpoints") {
+		cfg.API.UnauthenticatedEndpoints = append([]string{}, getList(v, "api.unauthenticated_endpoints")...)
+	}
+	if v.IsSet("pipeline.filters") {
+		cfg.Pipeline.Filters = append([]string{}, getList(v, "pipeline.filters")...)
+	}
+	cfg.CORS.AllowedOrigins = getList(v, "cors.allowed_origin")
+	if cfg.CORS.MaxAge, err = getInt(v, "cors.max_age", 3600); err != nil {
+		return nil, err
+	}
+	if roles := getList(v, "auth.roles"); len(roles) > 0 {
+		cfg.Auth.Roles = roles
+	}
+	// token_cache_time has always been given in seconds
+	if cacheTime := v.GetString("keystone_authtoken.token_cache_time"); cacheTime != "" {
+		seconds, err := strconv.Atoi(cacheTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keystone_authtoken.token_cache_time %q: %w", cacheTime, err)
+		}
+		cfg.Keystone.TokenCacheTime = time.Duration(seconds) * time.Second
+	}
+	if extra := v.GetString("apply.extra_labels"); extra != "" {
+		lbls, err := labels.ConvertSelectorToLabelsMap(extra)
+		if err != nil {
+			return nil, fmt.Errorf("invalid apply.extra_labels %q: %w", extra, err)
+		}
+		cfg.Apply.ExtraLabels = lbls
+	}
+	if qpsValue := v.GetString("kubernetes.qps"); qpsValue != "" {
+		qps, err := strconv.ParseFloat(qpsValue, 32)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes.qps: invalid value %q", qpsValue)
+		}
+		cfg.Kubernetes.QPS = float32(qps)
+	}
+	if cfg.Kubernetes.Burst, err = getInt(v, "kubernetes.burst", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Apply.MaxParallel, err = getInt(v, "apply.max_parallel", 0); err != nil {
+		return nil, err
+	}
+	if cfg.Apply.WaitTimeout, err = getDuration(v, "apply.wait_timeout"); err != nil {
+		return nil, err
+	}
+	if cfg.Apply.OperatorWaitTimeout, err = getDuration(v, "apply.operator_wait_timeout"); err != nil {
+		return nil, err
+	}
+	if cfg.Apply.Timeout, err = getDuration(v, "apply.timeout"); err != nil {
+		return nil, err
+	}
+	if cfg.Apply.LockWait, err = getDuration(v, "apply.lock_wait"); err != nil {
+		return nil, err
+	}
+	if rate := v.GetString("rate_limit.rate"); rate != "" {
+		if cfg.RateLimit.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return nil, fmt.Errorf("rate_limit.rate: invalid value %q", rate)
+		}
+	} else {
+		cfg.RateLimit.Rate = 5
+	}
+	if cfg.RateLimit.Burst, err = getInt(v, "rate_limit.burst", 20); err != nil {
+		return nil, err
+	}
+	if cfg.LeaderElection.LeaseDuration, err = getDuration(v, "leader_election.lease_duration"); err != nil {
+		return nil, err
+	}
+	if cfg.LeaderElection.RenewDeadline, err = getDuration(v, "leader_election.renew_deadline"); err != nil {
+		return nil, err
+	}
+	if cfg.LeaderElection.RetryPeriod, err = getDuration(v, "leader_election.retry_period"); err != nil {
+		return nil, err
+	}
+	if timeouts := getList(v, "apply.chart_timeouts"); len(timeouts) > 0 {
+		if cfg.Apply.ChartTimeouts, err = util.ParseDurations(timeouts); err != nil {
+			return nil, fmt.Errorf("apply.chart_timeouts: %w", err)
+		}
+	}
+	if clusters := getList(v, "apply.clusters"); len(clusters) > 0 {
+		if cfg.Apply.Clusters, err = util.ParsePairs(clusters); err != nil {
+			return nil, fmt.Errorf("apply.clusters: %w", err)
+		}
+	}
+	if cfg.Wait.Timeout, err = getDuration(v, "wait.timeout"); err != nil {
+		return nil, err
+	}
+	if cfg.Wait.OperatorTimeout, err = getDuration(v, "wait.operator_timeout"); err != nil {
+		return nil, err
+	}
+	if cfg.Wait.ProgressInterval, err = getDuration(v, "wait.progress_interval"); err != nil {
+		return nil, err
+	}
+	if v.IsSet("logging.verbosity") {
+		verbosity, err := getInt(v, "logging.verbosity", 0)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Logging.Verbosity = &verbosity
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return cfg, nil
 }
 
-// InitConfig reads an armada config from the default cfg file
-func initConfig() error {
-	viper.SetConfigFile("/etc/armada/armada.conf")
-	viper.SetConfigType("ini")
-	if err := viper.ReadInConfig(); err != nil {
-		return err
+// Validate checks settings which can be verified without contacting any service
+func (c *Config) Validate() error {
+	if c.API.Port < 1 || c.API.Port > 65535 {
+		return fmt.Errorf("api.port: %d is out of range", c.API.Port)
+	}
+	if c.API.ShutdownTimeout < 0 {
+		return fmt.Errorf("api.shutdown_timeout must not be negative")
+	}
+	if c.API.MaxBodySize < 0 || c.API.MaxManifestSize < 0 {
+		return fmt.Errorf("api.max_body_size and api.max_manifest_size must not be negative")
+	}
+	if c.API.RequestTimeout < 0 {
+		return fmt.Errorf("api.request_timeout must not be negative")
+	}
+	for path, d := range c.API.HandlerTimeouts {
+		if d < 0 {
+			return fmt.Errorf("api.handler_timeouts: %s must not be negative", path)
+		}
+	}
+	if (c.API.TLSCertFile == "") != (c.API.TLSKeyFile == "") {
+		return fmt.Errorf("api.tls_cert_file and api.tls_key_file must be set together")
+	}
+	if c.API.TLSClientCAFile != "" && c.API.TLSCertFile == "" {
+		return fmt.Errorf("api.tls_client_ca_file requires api.tls_cert_file and api.tls_key_file")
+	}
+	switch c.Keystone.AuthType {
+	case "", "password", "v3password", "v3applicationcredential", "application_credential":
+	default:
+		return fmt.Errorf("unsupported keystone_authtoken.auth_type %q", c.Keystone.AuthType)
+	}
+	if c.Kubernetes.QPS < 0 || c.Kubernetes.Burst < 0 {
+		return fmt.Errorf("kubernetes.qps and kubernetes.burst must not be negative")
+	}
+	if c.Apply.MaxParallel < 0 {
+		return fmt.Errorf("apply.max_parallel must not be negative")
+	}
+	if c.Apply.WaitTimeout < 0 || c.Apply.OperatorWaitTimeout < 0 || c.Wait.Timeout < 0 || c.Apply.Timeout < 0 {
+		return fmt.Errorf("wait timeouts must not be negative")
+	}
+	if f := c.Logging.Format; f != "" && f != log.FormatText && f != log.FormatJSON {
+		return fmt.Errorf("logging.format: unknown format %q, expected %s or %s", f, log.FormatText, log.FormatJSON)
+	}
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("cors.max_age must not be negative")
+	}
+	if c.Logging.Verbosity != nil && *c.Logging.Verbosity < 0 {
+		return fmt.Errorf("logging.verbosity must not be negative")
+	}
+	if rl := c.RateLimit; rl.Enabled && (rl.Rate <= 0 || rl.Burst < 1) {
+		return fmt.Errorf("rate_limit.rate must be positive and rate_limit.burst at least 1")
+	}
+	switch c.RateLimit.Key {
+	case "", "project", "user", "ip":
+	default:
+		return fmt.Errorf("rate_limit.key: unknown key %q, expected project, user or ip", c.RateLimit.Key)
+	}
+	if le := c.LeaderElection; le.LeaseDuration < 0 || le.RenewDeadline < 0 || le.RetryPeriod < 0 {
+		return fmt.Errorf("leader_election durations must not be negative")
 	}
 	return nil
 }
+
+func getInt(v *viper.Viper, key string, def int) (int, error) {
+	val := v.GetString(key)
+	if val == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", key, val)
+	}
+	return n, nil
+}
+
+// getSize reads a size in bytes, suffixes like Mi or M are allowed
+func getSize(v *viper.Viper, key string, def int64) (int64, error) {
+	val := v.GetString(key)
+	if val == "" {
+		return def, nil
+	}
+	q, err := resource.ParseQuantity(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", key, val)
+	}
+	return q.Value(), nil
+}
+
+func getDuration(v *viper.Viper, key string) (time.Duration, error) {
+	val := v.GetString(key)
+	if val == "" {
+		return 0, nil
+	}
+	d, err := util.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+// getList returns a comma separated INI value or a YAML list
+func getList(v *viper.Viper, key string) []string {
+	raw := v.Get(key)
+	if list, ok := raw.([]any); ok {
+		return cast.ToStringSlice(list)
+	}
+	var items []string
+	for _, item := range strings.Split(cast.ToString(raw), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
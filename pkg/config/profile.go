@@ -0,0 +1,95 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"opendev.org/airship/armada-go/pkg/util"
+)
+
+// Profile bundles apply defaults for an environment, it is read from a
+// [profile.<name>] section of armada.conf:
+//
+//	[profile.prod]
+//	target_manifest = full-site
+//	max_parallel = 4
+//	wait_timeout = 30m
+//	kubeconfig = /etc/armada/prod.kubeconfig
+//	context = prod
+//	prune = true
+type Profile struct {
+	Name                string
+	TargetManifest      string
+	Transcript          string
+	DistributeNamespace string
+	// MaxParallel limits charts installed at once in parallel chart groups
+	MaxParallel int
+	// WaitTimeout is used for charts without data.wait.timeout
+	WaitTimeout time.Duration
+	// Kubeconfig and Context select the target cluster
+	Kubeconfig string
+	Context    string
+	// ReleasePrefix replaces release_prefix of the manifest
+	ReleasePrefix string
+	// Prune deletes ArmadaCharts of previous applies which are not in the
+	// manifest
+	Prune bool
+}
+
+// Profile reads the named profile from the settings the config was loaded from
+func (c *Config) Profile(name string) (*Profile, error) {
+	section := "profile." + name
+	v := c.v
+	if v == nil {
+		v = newViper()
+	}
+	if !v.IsSet(section) {
+		return nil, fmt.Errorf("profile %q is not defined in the config", name)
+	}
+	p := &Profile{
+		Name:                name,
+		TargetManifest:      v.GetString(section + ".target_manifest"),
+		Transcript:          v.GetString(section + ".transcript"),
+		DistributeNamespace: v.GetString(section + ".distribute_namespace"),
+		Kubeconfig:          v.GetString(section + ".kubeconfig"),
+		Context:             v.GetString(section + ".context"),
+		ReleasePrefix:       v.GetString(section + ".release_prefix"),
+	}
+	if val := v.GetString(section + ".max_parallel"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s.max_parallel: invalid value %q", section, val)
+		}
+		p.MaxParallel = n
+	}
+	if val := v.GetString(section + ".wait_timeout"); val != "" {
+		d, err := util.ParseDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s.wait_timeout: %w", section, err)
+		}
+		p.WaitTimeout = d
+	}
+	if val := v.GetString(section + ".prune"); val != "" {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s.prune: invalid value %q", section, val)
+		}
+		p.Prune = b
+	}
+	return p, nil
+}
@@ -0,0 +1,94 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig is the [proxy] section, its settings take precedence over the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables for requests
+// to Deckhand, Keystone, chart sources and registries:
+//
+//	[proxy]
+//	https_proxy = http://proxy.example.com:3128
+//	no_proxy = .svc,.cluster.local,10.0.0.0/8
+type ProxyConfig struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+}
+
+var (
+	proxyFunc    atomic.Pointer[func(*url.URL) (*url.URL, error)]
+	proxyInstall sync.Once
+)
+
+// config merges the settings with the environment
+func (p ProxyConfig) config() *httpproxy.Config {
+	cfg := httpproxy.FromEnvironment()
+	if p.HTTPProxy != "" {
+		cfg.HTTPProxy = p.HTTPProxy
+	}
+	if p.HTTPSProxy != "" {
+		cfg.HTTPSProxy = p.HTTPSProxy
+	}
+	if p.NoProxy != "" {
+		cfg.NoProxy = p.NoProxy
+	}
+	return cfg
+}
+
+// Install routes requests of http.DefaultTransport and the clients derived
+// from it through the proxies. Kubernetes clients have their own transport,
+// they only follow the environment.
+func (p ProxyConfig) Install() {
+	if p == (ProxyConfig{}) && proxyFunc.Load() == nil {
+		return
+	}
+	f := p.config().ProxyFunc()
+	proxyFunc.Store(&f)
+	proxyInstall.Do(func() {
+		http.DefaultTransport.(*http.Transport).Proxy = func(req *http.Request) (*url.URL, error) {
+			return (*proxyFunc.Load())(req.URL)
+		}
+	})
+}
+
+// Env returns the environment passing the proxies to commands like git
+func (p ProxyConfig) Env() []string {
+	if p == (ProxyConfig{}) {
+		// commands follow the environment themselves
+		return nil
+	}
+	cfg := p.config()
+	var env []string
+	for _, v := range []struct{ name, value string }{
+		{"http_proxy", cfg.HTTPProxy},
+		{"https_proxy", cfg.HTTPSProxy},
+		{"no_proxy", cfg.NoProxy},
+	} {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value, strings.ToUpper(v.name)+"="+v.value)
+		}
+	}
+	return env
+}
@@ -0,0 +1,362 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package convert migrates armada/Chart/v1 documents written for the Python
+// Armada to the subset of fields armada-go and armada-operator understand
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/render"
+	armadaschema "opendev.org/airship/armada-go/pkg/schema"
+)
+
+// Output formats
+const (
+	FormatManifest    = "manifest"
+	FormatArmadaChart = "armadachart"
+)
+
+// ErrUnsupported is returned in strict mode if fields had to be dropped
+var ErrUnsupported = errors.New("manifest uses fields armada-go doesn't support")
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory config.Factory
+	// Manifests is a file with the legacy documents, - reads stdin
+	Manifests string
+	// Format is manifest, to keep the Armada documents, or armadachart to
+	// render the converted charts like the render command does
+	Format         string
+	TargetManifest string
+	// Strict fails if any field can't be converted
+	Strict bool
+	In     io.Reader
+	Out    io.Writer
+}
+
+// Warning is a field of a chart document which was changed or dropped
+type Warning struct {
+	Chart   string
+	Field   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("chart %s: %s %s", w.Chart, w.Field, w.Message)
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	if c.Format == "" {
+		c.Format = FormatManifest
+	}
+	if c.Format != FormatManifest && c.Format != FormatArmadaChart {
+		return fmt.Errorf("unknown output format %q, expected %s or %s", c.Format, FormatManifest, FormatArmadaChart)
+	}
+	in := c.In
+	if c.Manifests != "-" {
+		f, err := os.Open(c.Manifests)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var out bytes.Buffer
+	warnings, err := Convert(in, &out)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		log.Printf("WARNING: %s", w)
+	}
+	if c.Strict && len(warnings) > 0 {
+		return fmt.Errorf("%w, %d fields were dropped or changed", ErrUnsupported, len(warnings))
+	}
+
+	if c.Format == FormatManifest {
+		_, err = c.Out.Write(out.Bytes())
+		return err
+	}
+	dir, err := os.MkdirTemp("", "armada-convert")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manifest.yaml")
+	if err = os.WriteFile(path, out.Bytes(), 0o600); err != nil {
+		return err
+	}
+	r := &render.RunCommand{Factory: c.Factory, Manifests: path, TargetManifest: c.TargetManifest, Out: c.Out}
+	return r.RunE()
+}
+
+// Convert copies the YAML documents of in to out, converting the data of
+// armada/Chart/v1 documents, and returns what had to be changed or dropped.
+// Other documents are copied unchanged.
+func Convert(in io.Reader, out io.Writer) ([]Warning, error) {
+	var warnings []Warning
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(in))
+	for {
+		buf, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(buf)) == 0 {
+			continue
+		}
+		sch, name, ok, err := armadaschema.Detect(buf)
+		if err == nil && ok && sch.Kind == armadaschema.KindChart {
+			if sch.Version != armadaschema.V1 {
+				warnings = append(warnings, Warning{Chart: name, Field: "schema",
+					Message: fmt.Sprintf("%s is not converted, only %s is", sch, armadaschema.ChartV1)})
+			} else {
+				var w []Warning
+				if buf, w, err = convertChart(name, buf); err != nil {
+					return nil, fmt.Errorf("chart %s: %w", name, err)
+				}
+				warnings = append(warnings, w...)
+			}
+		}
+		if !bytes.HasSuffix(buf, []byte("\n")) {
+			buf = append(buf, '\n')
+		}
+		if _, err = fmt.Fprintf(out, "---\n%s", bytes.TrimPrefix(buf, []byte("---\n"))); err != nil {
+			return nil, err
+		}
+	}
+	return warnings, nil
+}
+
+// field describes a supported chart field, nil children accept any value
+type field map[string]field
+
+// anyValue describes fields whose content is not checked
+var anyValue field
+
+// supported are the data fields of ArmadaChartSpec and the armada-go
+// extensions, list entries are described by their element
+var supported = field{
+	"chart_name":   anyValue,
+	"namespace":    anyValue,
+	"release":      anyValue,
+	"values":       anyValue,
+	"namespaces":   anyValue,
+	"dependencies": anyValue,
+	"atomic":       anyValue,
+	"hooks":        anyValue,
+	"source": {
+		"checksum":   anyValue,
+		"location":   anyValue,
+		"reference":  anyValue,
+		"secret_ref": anyValue,
+		"subpath":    anyValue,
+		"type":       anyValue,
+		"verify":     anyValue,
+	},
+	"test": {
+		"enabled": anyValue,
+		"timeout": anyValue,
+		"options": {
+			"cleanup": anyValue,
+		},
+	},
+	"upgrade": {
+		"pre": {
+			"cleanup":    anyValue,
+			"update_crd": anyValue,
+			"delete": {
+				"type":   anyValue,
+				"labels": anyValue,
+			},
+		},
+	},
+	"wait": {
+		"labels":  anyValue,
+		"timeout": anyValue,
+		"native": {
+			"enabled": anyValue,
+		},
+		"resources": {
+			"condition": anyValue,
+			"delay":     anyValue,
+			"labels":    anyValue,
+			"min_ready": anyValue,
+			"namespace": anyValue,
+			"type":      anyValue,
+			"timeout":   anyValue,
+		},
+	},
+}
+
+// hints explain how to replace well known legacy fields
+var hints = map[string]string{
+	"install":             "is dropped, install options like no_hooks are not supported",
+	"upgrade.no_hooks":    "is dropped, hooks always run",
+	"upgrade.options":     "is dropped, armada-operator doesn't force upgrades or recreate pods",
+	"upgrade.post":        "is dropped, declare post upgrade actions as data.hooks.post",
+	"upgrade.pre.create":  "is dropped, run jobs before upgrades as data.hooks.pre of type job",
+	"upgrade.pre.update":  "is dropped, declare pre upgrade actions as data.hooks.pre",
+	"source.auth_method":  "is dropped, refer to the credentials with source.secret_ref or configure them in [sources]",
+	"source.proxy_server": "is dropped, configure [proxy] of armada-go and the proxy of armada-operator instead",
+	"protected":           "is dropped, failed releases are not protected from upgrades",
+	"delete":              "is dropped, releases are deleted with the default timeout",
+}
+
+// Check returns the fields of an armada/Chart/v1 document convert would
+// change or drop, without converting it
+func Check(name string, buf []byte) ([]Warning, error) {
+	_, warnings, err := convertChart(name, buf)
+	return warnings, err
+}
+
+// convertChart rewrites legacy fields of the chart data and drops the ones
+// which are not supported
+func convertChart(name string, buf []byte) ([]byte, []Warning, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, nil, err
+	}
+	data, ok := doc["data"].(map[string]interface{})
+	if !ok {
+		return buf, nil, nil
+	}
+	var warnings []Warning
+	warn := func(field, format string, v ...interface{}) {
+		warnings = append(warnings, Warning{Chart: name, Field: field, Message: fmt.Sprintf(format, v...)})
+	}
+
+	// test: true was the short form of test.enabled
+	if enabled, ok := data["test"].(bool); ok {
+		data["test"] = map[string]interface{}{"enabled": enabled}
+		warn("test", "converted to test.enabled")
+	}
+	// the top level timeout was replaced by wait.timeout
+	if timeout, ok := data["timeout"]; ok {
+		wait, _ := data["wait"].(map[string]interface{})
+		if wait == nil {
+			wait = map[string]interface{}{}
+			data["wait"] = wait
+		}
+		if _, ok := wait["timeout"]; ok {
+			warn("timeout", "is dropped, wait.timeout is set")
+		} else {
+			wait["timeout"] = timeout
+			warn("timeout", "moved to wait.timeout")
+		}
+		delete(data, "timeout")
+	}
+	if wait, ok := data["wait"].(map[string]interface{}); ok {
+		resources, _ := wait["resources"].([]interface{})
+		for i, res := range resources {
+			rm, ok := res.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// min_ready is a string to allow percentages
+			if n, ok := rm["min_ready"].(float64); ok {
+				rm["min_ready"] = fmt.Sprint(n)
+				warn(fmt.Sprintf("wait.resources[%d].min_ready", i), "converted to a string")
+			}
+		}
+	}
+	if source, ok := data["source"].(map[string]interface{}); ok {
+		if typ, _ := source["type"].(string); typ != "" && typ != "tar" {
+			warn("source.type", "%s is kept, armada-go fetches the chart and serves it to armada-operator "+
+				"from sources.public_url", typ)
+		}
+	}
+
+	for _, path := range prune(data, supported, "") {
+		hint, ok := hints[stripIndexes(path)]
+		if !ok {
+			hint = "is dropped, it is not supported"
+		}
+		warn(path, "%s", hint)
+	}
+	out, err := yaml.Marshal(doc)
+	return out, warnings, err
+}
+
+// prune deletes fields of m which spec doesn't describe and returns their
+// paths, the elements of lists are checked against the same spec
+func prune(m map[string]interface{}, spec field, prefix string) []string {
+	var dropped []string
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		child, ok := spec[k]
+		if !ok {
+			delete(m, k)
+			dropped = append(dropped, path)
+			continue
+		}
+		if child == nil {
+			continue
+		}
+		switch v := m[k].(type) {
+		case map[string]interface{}:
+			dropped = append(dropped, prune(v, child, path)...)
+		case []interface{}:
+			for i, e := range v {
+				if em, ok := e.(map[string]interface{}); ok {
+					dropped = append(dropped, prune(em, child, fmt.Sprintf("%s[%d]", path, i))...)
+				}
+			}
+		}
+	}
+	return dropped
+}
+
+// stripIndexes turns a.b[0].c into a.b.c
+func stripIndexes(path string) string {
+	var b strings.Builder
+	skip := false
+	for _, r := range path {
+		switch {
+		case r == '[':
+			skip = true
+		case r == ']':
+			skip = false
+		case !skip:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
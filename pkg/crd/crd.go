@@ -0,0 +1,175 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package crd provides the ArmadaChart CustomResourceDefinition shipped with
+// armada-go and decides when the one in the cluster has to be upgraded
+package crd
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+// Name of the ArmadaChart CRD
+const Name = "armadacharts.armada.airshipit.org"
+
+// RevisionAnnotation is increased whenever the embedded CRD changes, the CRD
+// in the cluster is upgraded if its revision is lower
+const RevisionAnnotation = "armada.airshipit.org/crd-revision"
+
+//go:embed crd.yaml
+var embedded []byte
+
+// Load returns the CRD from path, or the embedded one if path is empty
+func Load(path string) (*apiextv1.CustomResourceDefinition, error) {
+	data := embedded
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return Decode(data)
+}
+
+// Decode parses a CRD manifest
+func Decode(data []byte) (*apiextv1.CustomResourceDefinition, error) {
+	sch := runtime.NewScheme()
+	_ = apiextv1.AddToScheme(sch)
+	obj, _, err := serializer.NewCodecFactory(sch).UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	crd, ok := obj.(*apiextv1.CustomResourceDefinition)
+	if !ok {
+		return nil, fmt.Errorf("expected a CustomResourceDefinition, got %T", obj)
+	}
+	return crd, nil
+}
+
+// Revision returns the revision annotation of the CRD, 0 if there is none
+func Revision(crd *apiextv1.CustomResourceDefinition) int {
+	rev, err := strconv.Atoi(crd.Annotations[RevisionAnnotation])
+	if err != nil {
+		return 0
+	}
+	return rev
+}
+
+// hasRevision returns whether the CRD carries a revision annotation, CRDs
+// installed by other means, like armada-operator, don't
+func hasRevision(crd *apiextv1.CustomResourceDefinition) bool {
+	_, err := strconv.Atoi(crd.Annotations[RevisionAnnotation])
+	return err == nil
+}
+
+// NeedsUpgrade returns why the live CRD is older than want, or an empty
+// string if it is up to date. A live CRD of a higher revision is never
+// downgraded, one without revision only lacks served versions.
+func NeedsUpgrade(live, want *apiextv1.CustomResourceDefinition) string {
+	liveRev, wantRev := Revision(live), Revision(want)
+	if liveRev > wantRev {
+		return ""
+	}
+	if liveRev < wantRev && hasRevision(live) {
+		return fmt.Sprintf("revision %d is older than %d", liveRev, wantRev)
+	}
+	served := map[string]bool{}
+	for _, v := range live.Spec.Versions {
+		served[v.Name] = v.Served
+	}
+	for _, v := range want.Spec.Versions {
+		if v.Served && !served[v.Name] {
+			return fmt.Sprintf("version %s is not served", v.Name)
+		}
+	}
+	return ""
+}
+
+// Upgrade returns the CRD to write over live when NeedsUpgrade reported a
+// reason: want, or for a live CRD without revision, live with the served
+// versions of want it lacks, its schema and metadata are kept
+func Upgrade(live, want *apiextv1.CustomResourceDefinition) *apiextv1.CustomResourceDefinition {
+	if hasRevision(live) {
+		up := want.DeepCopy()
+		up.ResourceVersion = live.ResourceVersion
+		return up
+	}
+	up := live.DeepCopy()
+	for _, v := range want.Spec.Versions {
+		if !v.Served {
+			continue
+		}
+		i := slices.IndexFunc(up.Spec.Versions, func(l apiextv1.CustomResourceDefinitionVersion) bool {
+			return l.Name == v.Name
+		})
+		if i >= 0 {
+			up.Spec.Versions[i].Served = true
+			continue
+		}
+		added := *v.DeepCopy()
+		added.Storage = false
+		up.Spec.Versions = append(up.Spec.Versions, added)
+	}
+	return up
+}
+
+// Established returns whether the API server serves the CRD, and why not
+func Established(crd *apiextv1.CustomResourceDefinition) (bool, string) {
+	for _, cond := range crd.Status.Conditions {
+		switch {
+		case cond.Type == apiextv1.NamesAccepted && cond.Status == apiextv1.ConditionFalse:
+			return false, fmt.Sprintf("names not accepted: %s", cond.Message)
+		case cond.Type == apiextv1.Established && cond.Status == apiextv1.ConditionTrue:
+			return true, ""
+		}
+	}
+	return false, "not established yet"
+}
+
+// CheckVersion returns an error if the CRD can't be used to store objects of
+// version, either because it isn't served or because objects would be
+// stored as another version without a conversion webhook
+func CheckVersion(crd *apiextv1.CustomResourceDefinition, version string) error {
+	var served []string
+	storage := ""
+	found := false
+	for _, v := range crd.Spec.Versions {
+		if v.Served {
+			served = append(served, v.Name)
+		}
+		if v.Storage {
+			storage = v.Name
+		}
+		if v.Name == version && v.Served {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("installed CRD %s serves versions %v but armada-go requires %s, "+
+			"upgrade the CRD or use a matching armada-go release", crd.Name, served, version)
+	}
+	if storage != version && (crd.Spec.Conversion == nil || crd.Spec.Conversion.Strategy != apiextv1.WebhookConverter) {
+		return fmt.Errorf("installed CRD %s stores version %s without a conversion webhook, "+
+			"objects of version %s can't be converted", crd.Name, storage, version)
+	}
+	return nil
+}
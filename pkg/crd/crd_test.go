@@ -0,0 +1,95 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package crd
+
+import (
+	"testing"
+
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// liveCRD returns a CRD of the cluster with the revision, none if empty,
+// serving the versions
+func liveCRD(revision string, versions ...string) *apiextv1.CustomResourceDefinition {
+	crd := &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: Name, ResourceVersion: "42"}}
+	if revision != "" {
+		crd.Annotations = map[string]string{RevisionAnnotation: revision}
+	}
+	for i, v := range versions {
+		crd.Spec.Versions = append(crd.Spec.Versions,
+			apiextv1.CustomResourceDefinitionVersion{Name: v, Served: true, Storage: i == 0})
+	}
+	return crd
+}
+
+func TestNeedsUpgrade(t *testing.T) {
+	want, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		live *apiextv1.CustomResourceDefinition
+		want string
+	}{
+		"same revision":            {liveCRD("1", "v1"), ""},
+		"older revision":           {liveCRD("0", "v1"), "revision 0 is older than 1"},
+		"newer revision":           {liveCRD("2"), ""},
+		"no revision, served":      {liveCRD("", "v1"), ""},
+		"no revision, not served":  {liveCRD("", "v1alpha1"), "version v1 is not served"},
+		"invalid revision, served": {liveCRD("x", "v1"), ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := NeedsUpgrade(tc.live, want); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	want, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a CRD of armada-go is replaced
+	up := Upgrade(liveCRD("0", "v1"), want)
+	if up.ResourceVersion != "42" || Revision(up) != Revision(want) || len(up.Spec.Versions) != len(want.Spec.Versions) {
+		t.Errorf("got revision %d, resource version %q, %d versions, want the embedded CRD at resource version 42",
+			Revision(up), up.ResourceVersion, len(up.Spec.Versions))
+	}
+
+	// a CRD installed by other means only gets the missing version, which
+	// doesn't take over the storage
+	live := liveCRD("", "v1alpha1")
+	up = Upgrade(live, want)
+	if hasRevision(up) || len(up.Spec.Versions) != 2 {
+		t.Fatalf("got annotations %v and versions %v, want v1alpha1 and v1 without revision",
+			up.Annotations, up.Spec.Versions)
+	}
+	if v := up.Spec.Versions[0]; v.Name != "v1alpha1" || !v.Storage {
+		t.Errorf("got first version %s, storage %v, want the stored v1alpha1", v.Name, v.Storage)
+	}
+	if v := up.Spec.Versions[1]; v.Name != "v1" || !v.Served || v.Storage || v.Schema == nil {
+		t.Errorf("got added version %s, served %v, storage %v, want v1 served with its schema", v.Name, v.Served, v.Storage)
+	}
+	if len(live.Spec.Versions) != 1 {
+		t.Error("the live CRD was modified")
+	}
+	if NeedsUpgrade(up, want) != "" {
+		t.Errorf("upgraded CRD still needs an upgrade: %s", NeedsUpgrade(up, want))
+	}
+}
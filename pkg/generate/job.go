@@ -0,0 +1,147 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package generate
+
+import (
+	"fmt"
+	"io"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DefaultImage   = "quay.io/airshipit/armada-go:latest-ubuntu_noble"
+	DefaultName    = "armada-apply"
+	configVolume   = "armada-etc"
+	configMountDir = "/etc/armada"
+)
+
+// JobCommand generates a Job, or a CronJob if Schedule is set, running
+// `armada apply` in the cluster
+type JobCommand struct {
+	Manifests      string
+	TargetManifest string
+	Profile        string
+	Schedule       string
+	Name           string
+	Namespace      string
+	Image          string
+	PullPolicy     string
+	ServiceAccount string
+	// ConfigMap holding armada.conf, mounted at /etc/armada if set
+	ConfigMap string
+	// BackoffLimit is the number of retries of a failed apply
+	BackoffLimit int32
+	Out          io.Writer
+}
+
+// RunE runs the phase
+func (c *JobCommand) RunE() error {
+	if c.Manifests == "" {
+		return fmt.Errorf("manifest href is required")
+	}
+	obj, err := c.object()
+	if err != nil {
+		return err
+	}
+	buf, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, err = c.Out.Write(buf)
+	return err
+}
+
+func (c *JobCommand) object() (runtime.Object, error) {
+	meta := metav1.ObjectMeta{
+		Name:      c.Name,
+		Namespace: c.Namespace,
+		Labels:    map[string]string{"app.kubernetes.io/name": "armada-go", "app.kubernetes.io/component": "apply"},
+	}
+	if meta.Name == "" {
+		meta.Name = DefaultName
+	}
+	spec := c.jobSpec(meta.Labels)
+
+	if c.Schedule == "" {
+		return &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: meta,
+			Spec:       spec,
+		}, nil
+	}
+	return &batchv1.CronJob{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: meta,
+		Spec: batchv1.CronJobSpec{
+			Schedule: c.Schedule,
+			// Applies of the same site must not overlap
+			ConcurrencyPolicy: batchv1.ForbidConcurrent,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: meta.Labels},
+				Spec:       spec,
+			},
+		},
+	}, nil
+}
+
+func (c *JobCommand) jobSpec(labels map[string]string) batchv1.JobSpec {
+	args := []string{"apply", c.Manifests}
+	if c.TargetManifest != "" {
+		args = append(args, "--target-manifest", c.TargetManifest)
+	}
+	if c.Profile != "" {
+		args = append(args, "--profile", c.Profile)
+	}
+
+	image := c.Image
+	if image == "" {
+		image = DefaultImage
+	}
+	container := corev1.Container{
+		Name:            "armada",
+		Image:           image,
+		ImagePullPolicy: corev1.PullPolicy(c.PullPolicy),
+		Args:            args,
+	}
+
+	podSpec := corev1.PodSpec{
+		ServiceAccountName: c.ServiceAccount,
+		RestartPolicy:      corev1.RestartPolicyNever,
+	}
+	if c.ConfigMap != "" {
+		container.VolumeMounts = []corev1.VolumeMount{{Name: configVolume, MountPath: configMountDir, ReadOnly: true}}
+		podSpec.Volumes = []corev1.Volume{{
+			Name: configVolume,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: c.ConfigMap}},
+			},
+		}}
+	}
+	podSpec.Containers = []corev1.Container{container}
+
+	backoff := c.BackoffLimit
+	return batchv1.JobSpec{
+		BackoffLimit: &backoff,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec:       podSpec,
+		},
+	}
+}
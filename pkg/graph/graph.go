@@ -0,0 +1,181 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+)
+
+// Graph formats
+const (
+	FormatDot     = "dot"
+	FormatMermaid = "mermaid"
+)
+
+// RunCommand phase run command
+type RunCommand struct {
+	Manifests      string
+	TargetManifest string
+	// ReleasePrefix and NoReleasePrefix name the ArmadaCharts like the
+	// options of apply
+	ReleasePrefix   string
+	NoReleasePrefix bool
+	Format          string
+	Out             io.Writer
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	if c.Format != FormatDot && c.Format != FormatMermaid {
+		return fmt.Errorf("unknown graph format %q, expected %s or %s", c.Format, FormatDot, FormatMermaid)
+	}
+	parser := &apply.RunCommand{Manifests: c.Manifests, TargetManifest: c.TargetManifest,
+		ReleasePrefix: c.ReleasePrefix, NoReleasePrefix: c.NoReleasePrefix, Out: io.Discard}
+	if err := parser.ParseManifests(); err != nil {
+		return err
+	}
+	g := build(parser)
+	if c.Format == FormatMermaid {
+		return g.mermaid(c.Out)
+	}
+	return g.dot(c.Out)
+}
+
+type group struct {
+	name        string
+	description string
+	sequenced   bool
+	charts      []*chart
+}
+
+type chart struct {
+	name         string
+	release      string
+	namespaces   []string
+	dependencies []string
+}
+
+type graph struct {
+	manifest string
+	groups   []*group
+}
+
+// build collects chart groups and charts of the parsed manifest in apply order
+func build(parser *apply.RunCommand) *graph {
+	m := parser.Manifest()
+	g := &graph{manifest: m.Metadata.Name}
+	for _, cgName := range m.ChartGroups {
+		cg := parser.ChartGroup(cgName)
+		grp := &group{name: cgName, description: cg.Description, sequenced: cg.IsSequenced(m.ChartGroupDefaults)}
+		for _, cName := range cg.ChartGroup {
+			ch := parser.Chart(cName)
+			grp.charts = append(grp.charts, &chart{name: cName, release: parser.ConvertChart(ch).Name,
+				namespaces: ch.TargetNamespaces(), dependencies: ch.Extensions.Dependencies})
+		}
+		g.groups = append(g.groups, grp)
+	}
+	return g
+}
+
+// id returns a node identifier safe for both dot and mermaid, characters
+// other than letters and digits are escaped as _<hex> so names stay distinct
+func id(kind, name string) string {
+	var b strings.Builder
+	b.WriteString(kind + "_")
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, "_%x_", r)
+		}
+	}
+	return b.String()
+}
+
+func (g *graph) dot(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", g.manifest)
+	b.WriteString("  rankdir=LR;\n  compound=true;\n  node [shape=box];\n")
+	for i, grp := range g.groups {
+		fmt.Fprintf(&b, "  subgraph %s {\n", id("cluster", grp.name))
+		fmt.Fprintf(&b, "    label=%q;\n", fmt.Sprintf("%s\nsequenced: %v", grp.name, grp.sequenced))
+		fmt.Fprintf(&b, "    sequenced=%q;\n", fmt.Sprint(grp.sequenced))
+		if grp.description != "" {
+			fmt.Fprintf(&b, "    tooltip=%q;\n", grp.description)
+		}
+		for _, ch := range grp.charts {
+			fmt.Fprintf(&b, "    %s [label=%q, release=%q, namespace=%q];\n", id("chart", ch.name),
+				fmt.Sprintf("%s\nrelease: %s\nnamespace: %s", ch.name, ch.release, strings.Join(ch.namespaces, ",")),
+				ch.release, strings.Join(ch.namespaces, ","))
+		}
+		if grp.sequenced {
+			for j := 1; j < len(grp.charts); j++ {
+				fmt.Fprintf(&b, "    %s -> %s [style=dashed, label=\"sequenced\"];\n",
+					id("chart", grp.charts[j-1].name), id("chart", grp.charts[j].name))
+			}
+		}
+		b.WriteString("  }\n")
+		if i > 0 && len(grp.charts) > 0 && len(g.groups[i-1].charts) > 0 {
+			prev := g.groups[i-1]
+			fmt.Fprintf(&b, "  %s -> %s [ltail=%s, lhead=%s, style=bold];\n",
+				id("chart", prev.charts[len(prev.charts)-1].name), id("chart", grp.charts[0].name),
+				id("cluster", prev.name), id("cluster", grp.name))
+		}
+	}
+	for _, grp := range g.groups {
+		for _, ch := range grp.charts {
+			for _, dep := range ch.dependencies {
+				fmt.Fprintf(&b, "  %s -> %s [label=\"depends on\"];\n", id("chart", ch.name), id("chart", dep))
+			}
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *graph) mermaid(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, grp := range g.groups {
+		fmt.Fprintf(&b, "  subgraph %s[\"%s (sequenced: %v)\"]\n", id("group", grp.name), grp.name, grp.sequenced)
+		for _, ch := range grp.charts {
+			fmt.Fprintf(&b, "    %s[\"%s<br/>release: %s<br/>namespace: %s\"]\n", id("chart", ch.name),
+				ch.name, ch.release, strings.Join(ch.namespaces, ","))
+		}
+		if grp.sequenced {
+			for j := 1; j < len(grp.charts); j++ {
+				fmt.Fprintf(&b, "    %s -.->|sequenced| %s\n", id("chart", grp.charts[j-1].name), id("chart", grp.charts[j].name))
+			}
+		}
+		b.WriteString("  end\n")
+		if i > 0 {
+			fmt.Fprintf(&b, "  %s ==> %s\n", id("group", g.groups[i-1].name), id("group", grp.name))
+		}
+	}
+	for _, grp := range g.groups {
+		for _, ch := range grp.charts {
+			for _, dep := range ch.dependencies {
+				fmt.Fprintf(&b, "  %s -->|depends on| %s\n", id("chart", ch.name), id("chart", dep))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
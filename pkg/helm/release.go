@@ -0,0 +1,163 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// ChartMetadata is the subset of Helm chart metadata stored with a release
+type ChartMetadata struct {
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	AppVersion string `json:"appVersion,omitempty"`
+}
+
+// Info describes the state of a release revision
+type Info struct {
+	FirstDeployed time.Time `json:"first_deployed,omitempty"`
+	LastDeployed  time.Time `json:"last_deployed,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Description   string    `json:"description,omitempty"`
+}
+
+// Release is a single revision of a Helm release as recorded by the Helm
+// secrets storage driver
+type Release struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	Info      *Info  `json:"info,omitempty"`
+	Chart     *struct {
+		Metadata *ChartMetadata `json:"metadata,omitempty"`
+	} `json:"chart,omitempty"`
+	Config map[string]interface{} `json:"config,omitempty"`
+	Hooks  []*Hook                `json:"hooks,omitempty"`
+}
+
+// Hook is a resource of the release Helm creates on events instead of
+// installing it with the release, like test pods
+type Hook struct {
+	Name           string   `json:"name,omitempty"`
+	Kind           string   `json:"kind,omitempty"`
+	Path           string   `json:"path,omitempty"`
+	Manifest       string   `json:"manifest,omitempty"`
+	Events         []string `json:"events,omitempty"`
+	Weight         int      `json:"weight,omitempty"`
+	DeletePolicies []string `json:"delete_policies,omitempty"`
+}
+
+// ChartMetadata returns metadata of the chart deployed by the revision
+func (r *Release) ChartMetadata() ChartMetadata {
+	if r.Chart == nil || r.Chart.Metadata == nil {
+		return ChartMetadata{}
+	}
+	return *r.Chart.Metadata
+}
+
+// ListReleases returns all stored revisions of the named Helm release,
+// ordered from the oldest to the newest
+func ListReleases(ctx context.Context, cs kubernetes.Interface, namespace, name string) ([]*Release, error) {
+	selector := labels.SelectorFromSet(map[string]string{"owner": "helm", "name": name}).String()
+	secrets, err := cs.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]*Release, 0, len(secrets.Items))
+	for _, s := range secrets.Items {
+		rel, err := decodeRelease(s.Data["release"])
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode helm release secret %s/%s: %w", s.Namespace, s.Name, err)
+		}
+		releases = append(releases, rel)
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Version < releases[j].Version })
+	return releases, nil
+}
+
+// LatestReleases returns the newest revision of every Helm release of the
+// namespace keyed by namespace/name, all namespaces are searched if it is
+// empty
+func LatestReleases(ctx context.Context, cs kubernetes.Interface, namespace string) (map[string]*Release, error) {
+	selector := labels.SelectorFromSet(map[string]string{"owner": "helm"}).String()
+	secrets, err := cs.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	// revisions are told apart by the labels, only the newest is decoded
+	newest := map[string]int{}
+	for i, s := range secrets.Items {
+		key := s.Namespace + "/" + s.Labels["name"]
+		j, ok := newest[key]
+		if !ok || revision(s.Labels["version"]) > revision(secrets.Items[j].Labels["version"]) {
+			newest[key] = i
+		}
+	}
+	releases := make(map[string]*Release, len(newest))
+	for key, i := range newest {
+		s := secrets.Items[i]
+		rel, err := decodeRelease(s.Data["release"])
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode helm release secret %s/%s: %w", s.Namespace, s.Name, err)
+		}
+		releases[key] = rel
+	}
+	return releases, nil
+}
+
+func revision(s string) int {
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+func decodeRelease(data []byte) (*Release, error) {
+	b, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(b, gzipMagic) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if b, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	var rel Release
+	if err := json.Unmarshal(b, &rel); err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
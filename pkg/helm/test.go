@@ -0,0 +1,146 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// DefaultTestTimeout is the helm test default timeout
+const DefaultTestTimeout = 300 * time.Second
+
+// ErrTestFailed is returned if a test pod or job of the release failed
+var ErrTestFailed = errors.New("helm test failed")
+
+// testLogLines is how many lines of the log of a failed test pod are shown
+const testLogLines = 20
+
+// TestOptions control how RunTests runs the tests of a release
+type TestOptions struct {
+	// Timeout limits every test, DefaultTestTimeout if zero
+	Timeout time.Duration
+	// Cleanup deletes the test resources once the tests finished, they are
+	// kept otherwise unless their hook delete policy says so
+	Cleanup bool
+	Log     *log.Logger
+}
+
+// TestResult is the outcome of one test hook
+type TestResult struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// RunTests runs the test hooks of the release with the Helm SDK the way
+// helm test does, it stops at the first failing test. The Helm SDK doesn't
+// take a context, the tests are only limited by the timeout.
+func RunTests(ctx context.Context, restConfig *rest.Config, namespace, name string,
+	opts TestOptions) ([]TestResult, error) {
+	if opts.Log == nil {
+		opts.Log = log.Default()
+	}
+	cfg, err := Configuration(restConfig, namespace, opts.Log.Debugf)
+	if err != nil {
+		return nil, err
+	}
+	tester := action.NewReleaseTesting(cfg)
+	tester.Namespace, tester.Timeout = namespace, opts.Timeout
+	if tester.Timeout == 0 {
+		tester.Timeout = DefaultTestTimeout
+	}
+
+	start := time.Now()
+	rel, runErr := tester.Run(name)
+	if rel == nil {
+		return nil, fmt.Errorf("tests of release %s: %w", name, runErr)
+	}
+	var results []TestResult
+	var failed *release.Hook
+	for _, h := range rel.Hooks {
+		// hooks after a failing test keep the result of an earlier run
+		if !slices.Contains(h.Events, release.HookTest) || h.LastRun.StartedAt.Time.Before(start) {
+			continue
+		}
+		res := TestResult{Name: h.Name, Kind: h.Kind, Passed: h.LastRun.Phase == release.HookPhaseSucceeded}
+		if !res.Passed {
+			res.Message = fmt.Sprintf("%s %s", strings.ToLower(h.Kind), strings.ToLower(h.LastRun.Phase.String()))
+			failed = h
+		}
+		results = append(results, res)
+	}
+	if opts.Cleanup {
+		cleanupTests(cfg, rel, opts.Log)
+	}
+	switch {
+	case failed != nil:
+		if failed.Kind == "Pod" {
+			logTail(ctx, tester, rel, failed, opts.Log)
+		}
+		return results, fmt.Errorf("%w: %s %s of release %s: %w", ErrTestFailed, failed.Kind, failed.Name, name,
+			runErr)
+	case runErr != nil:
+		return results, fmt.Errorf("tests of release %s: %w", name, runErr)
+	case len(results) == 0:
+		opts.Log.Printf("release %s has no tests", name)
+	default:
+		opts.Log.Printf("%d tests of release %s passed", len(results), name)
+	}
+	return results, nil
+}
+
+// cleanupTests deletes the resources of the test hooks of the release
+func cleanupTests(cfg *action.Configuration, rel *release.Release, logger *log.Logger) {
+	for _, h := range rel.Hooks {
+		if !slices.Contains(h.Events, release.HookTest) {
+			continue
+		}
+		resources, err := cfg.KubeClient.Build(strings.NewReader(h.Manifest), false)
+		if err == nil {
+			_, errs := cfg.KubeClient.Delete(resources)
+			err = errors.Join(errs...)
+		}
+		if err != nil {
+			logger.Printf("WARNING: unable to clean up test %s %s: %s", h.Kind, h.Name, err.Error())
+		}
+	}
+}
+
+// logTail logs the last lines of the log of the failed test pod
+func logTail(ctx context.Context, tester *action.ReleaseTesting, rel *release.Release, h *release.Hook,
+	logger *log.Logger) {
+	tester.Filters[action.IncludeNameFilter] = []string{h.Name}
+	var buf bytes.Buffer
+	if err := tester.GetPodLogs(&buf, rel); err != nil || ctx.Err() != nil {
+		logger.Printf("unable to get logs of test pod %s: %v", h.Name, errors.Join(err, ctx.Err()))
+		return
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	logger.Printf("last lines of test pod %s:\n%s", h.Name,
+		strings.Join(lines[max(0, len(lines)-testLogLines):], "\n"))
+}
@@ -0,0 +1,167 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package history
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/helm"
+	"opendev.org/airship/armada-go/pkg/releases"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Output formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// Revision is a revision of the Helm release of an ArmadaChart
+type Revision struct {
+	Revision     int       `json:"revision"`
+	Chart        string    `json:"chart,omitempty"`
+	Version      string    `json:"version,omitempty"`
+	AppVersion   string    `json:"app_version,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	LastDeployed time.Time `json:"last_deployed,omitempty"`
+	// ValuesHash is a digest of the user supplied values, revisions with the
+	// same hash were deployed with the same values
+	ValuesHash string `json:"values_hash"`
+}
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory config.Factory
+	// Release is the name of the ArmadaChart managing the Helm release
+	Release   string
+	Namespace string
+	// Max limits the output to the newest revisions, 0 shows all
+	Max int
+	// Format is table or json
+	Format string
+	Out    io.Writer
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	if c.Format == "" {
+		c.Format = FormatTable
+	}
+	if c.Format != FormatTable && c.Format != FormatJSON {
+		return fmt.Errorf("unknown output format %q, expected %s or %s", c.Format, FormatTable, FormatJSON)
+	}
+	revisions, err := c.History(context.Background())
+	if err != nil {
+		return err
+	}
+	if c.Format == FormatJSON {
+		enc := json.NewEncoder(c.Out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(revisions)
+	}
+	return printRevisions(c.Out, revisions)
+}
+
+// History returns the revisions of the release, oldest first
+func (c *RunCommand) History(ctx context.Context) ([]Revision, error) {
+	cfg, err := config.Resolve(c.Factory)
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := cfg.Kubernetes.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+	resClient := dynamic.NewForConfigOrDie(restConfig).Resource(schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	})
+	chart, err := releases.Find(ctx, resClient, c.Release, c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	helmRelease, _, _ := unstructured.NestedString(chart.Object, "data", "release")
+	helmReleases, err := helm.ListReleases(ctx, kubernetes.NewForConfigOrDie(restConfig),
+		chart.GetNamespace(), helmRelease)
+	if err != nil {
+		return nil, err
+	}
+	if len(helmReleases) == 0 {
+		return nil, fmt.Errorf("release %s of armadachart %s/%s has no revisions", helmRelease,
+			chart.GetNamespace(), chart.GetName())
+	}
+	if c.Max > 0 && len(helmReleases) > c.Max {
+		helmReleases = helmReleases[len(helmReleases)-c.Max:]
+	}
+
+	revisions := make([]Revision, 0, len(helmReleases))
+	for _, rel := range helmReleases {
+		md := rel.ChartMetadata()
+		r := Revision{Revision: rel.Version, Chart: md.Name, Version: md.Version, AppVersion: md.AppVersion}
+		if rel.Info != nil {
+			r.Status, r.Description, r.LastDeployed = rel.Info.Status, rel.Info.Description, rel.Info.LastDeployed
+		}
+		if r.ValuesHash, err = valuesHash(rel.Config); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, nil
+}
+
+// valuesHash returns a short digest of the values, map keys are sorted by
+// the JSON encoder so equal values hash equally
+func valuesHash(values map[string]interface{}) (string, error) {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	buf, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(buf))[:12], nil
+}
+
+func printRevisions(out io.Writer, revisions []Revision) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "REVISION\tUPDATED\tSTATUS\tCHART\tAPP VERSION\tVALUES\tDESCRIPTION")
+	for _, r := range revisions {
+		updated := "-"
+		if !r.LastDeployed.IsZero() {
+			updated = r.LastDeployed.Local().Format(time.RFC3339)
+		}
+		chart := r.Chart
+		if r.Version != "" {
+			chart += "-" + r.Version
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Revision, updated, r.Status, chart,
+			r.AppVersion, r.ValuesHash, r.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,318 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package hooks runs the actions declared in data.hooks of chart and chart
+// group documents before and after they are installed
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// Hook types
+const (
+	TypeJob      = "job"
+	TypeAnnotate = "annotate"
+	TypeWebhook  = "webhook"
+)
+
+// Phases hooks run in
+const (
+	Pre  = "pre"
+	Post = "post"
+)
+
+// DefaultTimeout limits hooks without a timeout
+const DefaultTimeout = 300 * time.Second
+
+// jobTTL removes finished hook jobs which don't set ttlSecondsAfterFinished
+const jobTTL int32 = 24 * 3600
+
+// Hooks are the data.hooks field of chart and chart group documents, every
+// hook has to succeed before the next one runs and the install continues:
+//
+//	data:
+//	  hooks:
+//	    pre:
+//	      - type: job
+//	        job:
+//	          metadata: {name: keystone-db-sync}
+//	          spec: {template: ...}
+//	    post:
+//	      - type: webhook
+//	        url: https://cache.example.com/warmup
+type Hooks struct {
+	Pre  []Hook `json:"pre,omitempty"`
+	Post []Hook `json:"post,omitempty"`
+}
+
+// Hook is a single action
+type Hook struct {
+	// Name identifies the hook in messages, derived from the action if empty
+	Name string `json:"name,omitempty"`
+	// Type is one of job, annotate or webhook
+	Type string `json:"type"`
+	// Timeout in seconds, DefaultTimeout if zero
+	Timeout int64 `json:"timeout,omitempty"`
+	// Namespace of the job or annotated resources, the namespace of the
+	// chart by default
+	Namespace string `json:"namespace,omitempty"`
+
+	// Job is the batch/v1 Job to run, a new one is created for every run
+	// with metadata.name as name prefix
+	Job *batchv1.Job `json:"job,omitempty"`
+
+	// APIVersion and Resource select the resources to annotate, like apps/v1
+	// and deployments, Labels narrows them down
+	APIVersion  string            `json:"api_version,omitempty"`
+	Resource    string            `json:"resource,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// URL receives a request with the Event as JSON body, it has to answer
+	// with a 2xx status. Method is POST by default.
+	URL    string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"`
+}
+
+// Event describes what a hook runs for
+type Event struct {
+	Phase      string `json:"phase"`
+	Manifest   string `json:"manifest"`
+	ChartGroup string `json:"chart_group,omitempty"`
+	Chart      string `json:"chart,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// Validate checks that the hook has the fields its type needs
+func (h *Hook) Validate() error {
+	switch h.Type {
+	case TypeJob:
+		if h.Job == nil {
+			return fmt.Errorf("job hook has no job")
+		}
+	case TypeAnnotate:
+		if h.APIVersion == "" || h.Resource == "" || len(h.Annotations) == 0 {
+			return fmt.Errorf("annotate hook needs api_version, resource and annotations")
+		}
+	case TypeWebhook:
+		if !strings.HasPrefix(h.URL, "http://") && !strings.HasPrefix(h.URL, "https://") {
+			return fmt.Errorf("webhook hook needs an http or https url")
+		}
+	default:
+		return fmt.Errorf("unknown hook type %q, expected %s, %s or %s", h.Type, TypeJob, TypeAnnotate, TypeWebhook)
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("negative hook timeout")
+	}
+	return nil
+}
+
+// Validate checks all hooks
+func (h *Hooks) Validate() error {
+	for i := range h.Pre {
+		if err := h.Pre[i].Validate(); err != nil {
+			return fmt.Errorf("%s hook %d: %w", Pre, i+1, err)
+		}
+	}
+	for i := range h.Post {
+		if err := h.Post[i].Validate(); err != nil {
+			return fmt.Errorf("%s hook %d: %w", Post, i+1, err)
+		}
+	}
+	return nil
+}
+
+// webhookClient calls webhooks of Runners without Client, the hook timeout
+// usually ends the call earlier
+var webhookClient = &http.Client{Timeout: DefaultTimeout}
+
+// Runner runs hooks against a cluster
+type Runner struct {
+	RestConfig *rest.Config
+	Client     *http.Client
+	Log        *log.Logger
+}
+
+// Run runs the hooks of the phase one after another, it stops at the first
+// failing one
+func (r *Runner) Run(ctx context.Context, hooks *Hooks, ev Event) error {
+	if hooks == nil {
+		return nil
+	}
+	list := hooks.Pre
+	if ev.Phase == Post {
+		list = hooks.Post
+	}
+	for i := range list {
+		h := list[i]
+		if h.Name == "" {
+			h.Name = fmt.Sprintf("%s-%s-%d", ev.Phase, h.Type, i+1)
+		}
+		if h.Namespace == "" {
+			h.Namespace = ev.Namespace
+		}
+		timeout := DefaultTimeout
+		if h.Timeout > 0 {
+			timeout = time.Duration(h.Timeout) * time.Second
+		}
+		r.Log.Printf("running %s hook %s", h.Type, h.Name)
+		start := time.Now()
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := r.run(hookCtx, &h, ev)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s hook %s failed: %w", ev.Phase, h.Name, err)
+		}
+		r.Log.Printf("%s hook %s succeeded after %s", h.Type, h.Name, time.Since(start).Round(time.Second))
+	}
+	return nil
+}
+
+func (r *Runner) run(ctx context.Context, h *Hook, ev Event) error {
+	if h.Type != TypeWebhook && h.Namespace == "" && (h.Type != TypeJob || h.Job.Namespace == "") {
+		return fmt.Errorf("no namespace given")
+	}
+	switch h.Type {
+	case TypeJob:
+		return r.runJob(ctx, h)
+	case TypeAnnotate:
+		return r.annotate(ctx, h)
+	case TypeWebhook:
+		return r.callWebhook(ctx, h, ev)
+	}
+	return h.Validate()
+}
+
+// runJob creates the job and waits for it to complete
+func (r *Runner) runJob(ctx context.Context, h *Hook) error {
+	job := h.Job.DeepCopy()
+	if job.Namespace == "" {
+		job.Namespace = h.Namespace
+	}
+	prefix := job.Name
+	if prefix == "" {
+		prefix = h.Name
+	}
+	job.Name, job.GenerateName = "", prefix+"-"
+	if job.Spec.Template.Spec.RestartPolicy == "" {
+		job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+	}
+	if job.Spec.TTLSecondsAfterFinished == nil {
+		ttl := jobTTL
+		job.Spec.TTLSecondsAfterFinished = &ttl
+	}
+	jobs := kubernetes.NewForConfigOrDie(r.RestConfig).BatchV1().Jobs(job.Namespace)
+	created, err := jobs.Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	r.Log.Printf("created job %s/%s", created.Namespace, created.Name)
+	return k8swait.PollUntilContextCancel(ctx, 2*time.Second, false, func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, created.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range current.Status.Conditions {
+			if cond.Status != v1.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				return false, fmt.Errorf("job %s/%s failed: %s", created.Namespace, created.Name, cond.Message)
+			}
+		}
+		return false, nil
+	})
+}
+
+// annotate merges the annotations into the selected resources
+func (r *Runner) annotate(ctx context.Context, h *Hook) error {
+	gv, err := schema.ParseGroupVersion(h.APIVersion)
+	if err != nil {
+		return err
+	}
+	res := dynamic.NewForConfigOrDie(r.RestConfig).Resource(gv.WithResource(h.Resource)).Namespace(h.Namespace)
+	list, err := res.List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(h.Labels).String()})
+	if err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return fmt.Errorf("no %s found in namespace %s", h.Resource, h.Namespace)
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": h.Annotations}})
+	if err != nil {
+		return err
+	}
+	for _, obj := range list.Items {
+		if _, err := res.Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
+	r.Log.Printf("annotated %d %s in namespace %s", len(list.Items), h.Resource, h.Namespace)
+	return nil
+}
+
+// callWebhook sends the event to the hook URL
+func (r *Runner) callWebhook(ctx context.Context, h *Hook, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := r.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %s: %s", h.URL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package lint checks Armada manifests for mistakes schema validation
+// doesn't catch
+package lint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/convert"
+	armadaschema "opendev.org/airship/armada-go/pkg/schema"
+)
+
+// Severities of findings
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Rules
+const (
+	RuleDuplicateDocument = "duplicate-document"
+	RuleMissingReference  = "missing-reference"
+	RuleDuplicateRelease  = "duplicate-release"
+	RuleNameCollision     = "name-collision"
+	RuleInvalidName       = "invalid-name"
+	RuleUnassignedChart   = "unassigned-chart"
+	RuleUnreferencedGroup = "unreferenced-group"
+	RuleMissingTimeout    = "missing-wait-timeout"
+	RuleDeprecatedField   = "deprecated-field"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// maxReleaseName is the longest Helm release name
+const maxReleaseName = 53
+
+// Finding is a problem of a document
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	// Document is the schema kind and name, e.g. Chart/keystone
+	Document string `json:"document"`
+	Message  string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", f.Severity, f.Document, f.Message, f.Rule)
+}
+
+// RunCommand phase run command
+type RunCommand struct {
+	// Manifests is a file with the documents, - reads stdin
+	Manifests string
+	Format    string
+	// Strict fails on warnings too
+	Strict bool
+	In     io.Reader
+	Out    io.Writer
+}
+
+// RunE runs the phase, it fails if errors were found
+func (c *RunCommand) RunE() error {
+	if c.Format == "" {
+		c.Format = FormatText
+	}
+	if c.Format != FormatText && c.Format != FormatJSON {
+		return fmt.Errorf("unknown output format %q, expected %s or %s", c.Format, FormatText, FormatJSON)
+	}
+	in := c.In
+	if c.Manifests != "-" {
+		f, err := os.Open(c.Manifests)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	findings, err := Lint(in)
+	if err != nil {
+		return err
+	}
+
+	errs, warnings := 0, 0
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	if c.Format == FormatJSON {
+		enc := json.NewEncoder(c.Out)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(map[string]interface{}{"findings": findings, "errors": errs, "warnings": warnings}); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			if _, err = fmt.Fprintln(c.Out, f); err != nil {
+				return err
+			}
+		}
+		if _, err = fmt.Fprintf(c.Out, "%d errors, %d warnings\n", errs, warnings); err != nil {
+			return err
+		}
+	}
+	if errs > 0 || (c.Strict && warnings > 0) {
+		return fmt.Errorf("lint found %d errors and %d warnings", errs, warnings)
+	}
+	return nil
+}
+
+type chart struct {
+	doc     *apply.AirshipChart
+	data    map[string]interface{}
+	buf     []byte
+	version string
+}
+
+// documents of a manifest file in the order they were read
+type documents struct {
+	manifests []*apply.AirshipManifest
+	groups    map[string]*apply.AirshipChartGroup
+	charts    map[string]*chart
+	findings  []Finding
+}
+
+// Lint reads the documents of r and returns the findings sorted by
+// severity, document and rule
+func Lint(r io.Reader) ([]Finding, error) {
+	d := &documents{groups: map[string]*apply.AirshipChartGroup{}, charts: map[string]*chart{}}
+	if err := d.read(r); err != nil {
+		return nil, err
+	}
+	d.references()
+	d.names()
+	d.fields()
+	sort.SliceStable(d.findings, func(i, j int) bool {
+		a, b := d.findings[i], d.findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity == SeverityError
+		}
+		if a.Document != b.Document {
+			return a.Document < b.Document
+		}
+		return a.Rule < b.Rule
+	})
+	return d.findings, nil
+}
+
+func (d *documents) add(rule, severity string, kind armadaschema.Kind, name, format string, v ...interface{}) {
+	d.findings = append(d.findings, Finding{Rule: rule, Severity: severity, Document: string(kind) + "/" + name,
+		Message: fmt.Sprintf(format, v...)})
+}
+
+func (d *documents) read(r io.Reader) error {
+	seen := map[string]bool{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		buf, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		sch, name, ok, err := armadaschema.Detect(buf)
+		if err != nil || !ok {
+			continue
+		}
+		key := string(sch.Kind) + "/" + name
+		if seen[key] {
+			d.add(RuleDuplicateDocument, SeverityError, sch.Kind, name, "defined more than once, the last one is used")
+		}
+		seen[key] = true
+		switch sch.Kind {
+		case armadaschema.KindManifest:
+			var m apply.AirshipManifest
+			if err := yaml.Unmarshal(buf, &m); err != nil {
+				return fmt.Errorf("manifest %s: %w", name, err)
+			}
+			m.Metadata.Name = name
+			d.manifests = append(d.manifests, &m)
+		case armadaschema.KindChartGroup:
+			var g apply.AirshipChartGroup
+			if err := yaml.Unmarshal(buf, &g); err != nil {
+				return fmt.Errorf("chart group %s: %w", name, err)
+			}
+			d.groups[name] = &g
+		case armadaschema.KindChart:
+			var doc struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := yaml.Unmarshal(buf, &doc); err != nil {
+				return fmt.Errorf("chart %s: %w", name, err)
+			}
+			var c apply.AirshipChart
+			// wait timeouts may be durations, which ArmadaChartSpec can't decode
+			_ = yaml.Unmarshal(buf, &c)
+			var ext struct {
+				Data apply.AirshipChartExtensions `json:"data,omitempty"`
+			}
+			_ = yaml.Unmarshal(buf, &ext)
+			c.Extensions = ext.Data
+			d.charts[name] = &chart{doc: &c, data: doc.Data, buf: buf, version: sch.Version}
+		}
+	}
+}
+
+// references checks that referenced documents exist and all documents are
+// referenced
+func (d *documents) references() {
+	usedGroups := map[string]bool{}
+	for _, m := range d.manifests {
+		for _, g := range m.ChartGroups {
+			usedGroups[g] = true
+			if _, ok := d.groups[g]; !ok {
+				d.add(RuleMissingReference, SeverityError, armadaschema.KindManifest, m.Metadata.Name,
+					"chart group %s doesn't exist", g)
+			}
+		}
+	}
+	usedCharts := map[string]bool{}
+	for _, name := range sortedKeys(d.groups) {
+		if !usedGroups[name] {
+			d.add(RuleUnreferencedGroup, SeverityWarning, armadaschema.KindChartGroup, name,
+				"not referenced by any manifest")
+		}
+		for _, c := range d.groups[name].ChartGroup {
+			usedCharts[c] = true
+			if _, ok := d.charts[c]; !ok {
+				d.add(RuleMissingReference, SeverityError, armadaschema.KindChartGroup, name, "chart %s doesn't exist", c)
+			}
+		}
+	}
+	for _, name := range sortedKeys(d.charts) {
+		if !usedCharts[name] {
+			d.add(RuleUnassignedChart, SeverityWarning, armadaschema.KindChart, name, "not part of any chart group")
+		}
+	}
+}
+
+// names checks the ArmadaChart names every manifest produces
+func (d *documents) names() {
+	// ArmadaCharts of all manifests by namespace/name, manifests may share charts
+	owners := map[string]string{}
+	for _, m := range d.manifests {
+		releases := map[string]string{}
+		for _, g := range m.ChartGroups {
+			group, ok := d.groups[g]
+			if !ok {
+				continue
+			}
+			for _, name := range group.ChartGroup {
+				c, ok := d.charts[name]
+				if !ok || c.doc.Release == "" {
+					continue
+				}
+				for _, ns := range c.doc.TargetNamespaces() {
+					key := ns + "/" + c.doc.Release
+					if other, ok := releases[key]; ok && other != name {
+						d.add(RuleDuplicateRelease, SeverityError, armadaschema.KindChart, name,
+							"release %s in namespace %s is also deployed by chart %s of manifest %s",
+							c.doc.Release, ns, other, m.Metadata.Name)
+						// the ArmadaChart names collide as well
+						continue
+					}
+					releases[key] = name
+
+					object := fmt.Sprintf("%s-%s", m.ReleasePrefix, c.doc.Release)
+					objectKey := ns + "/" + object
+					if other, ok := owners[objectKey]; ok && other != name {
+						d.add(RuleNameCollision, SeverityError, armadaschema.KindChart, name,
+							"ArmadaChart %s in namespace %s of manifest %s is also produced by chart %s",
+							object, ns, m.Metadata.Name, other)
+					}
+					owners[objectKey] = name
+					for _, msg := range validation.IsDNS1123Subdomain(object) {
+						d.add(RuleInvalidName, SeverityError, armadaschema.KindChart, name,
+							"ArmadaChart name %s of manifest %s is invalid: %s", object, m.Metadata.Name, msg)
+					}
+				}
+			}
+		}
+	}
+	for _, name := range sortedKeys(d.charts) {
+		if release := d.charts[name].doc.Release; len(release) > maxReleaseName {
+			d.add(RuleInvalidName, SeverityError, armadaschema.KindChart, name,
+				"release %s is longer than the %d characters Helm allows", release, maxReleaseName)
+		}
+	}
+}
+
+// fields checks fields of the chart documents
+func (d *documents) fields() {
+	for _, name := range sortedKeys(d.charts) {
+		c := d.charts[name]
+		if wait, _ := c.data["wait"].(map[string]interface{}); wait["timeout"] == nil && c.data["timeout"] == nil {
+			d.add(RuleMissingTimeout, SeverityWarning, armadaschema.KindChart, name,
+				"no data.wait.timeout, the apply wait timeout is used")
+		}
+		if c.version != armadaschema.V1 {
+			continue
+		}
+		warnings, err := convert.Check(name, c.buf)
+		if err != nil {
+			continue
+		}
+		for _, w := range warnings {
+			d.add(RuleDeprecatedField, SeverityWarning, armadaschema.KindChart, name, "armada convert: %s %s",
+				w.Field, w.Message)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
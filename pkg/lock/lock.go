@@ -0,0 +1,284 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package lock serializes applies of the same manifest. An apply holds a
+// Lease named after the manifest while it runs and renews it, a concurrent
+// apply either waits for the Lease to be released or fails with the holder.
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+const (
+	// LockLabel marks the Leases of apply locks
+	LockLabel = "armada.airshipit.org/apply-lock"
+	// KeyAnnotation holds the key of the apply lock on its Lease
+	KeyAnnotation = "armada.airshipit.org/apply-lock-key"
+
+	namePrefix = "armada-apply-"
+
+	defaultLeaseDuration = 60 * time.Second
+	defaultPollInterval  = 5 * time.Second
+)
+
+var invalidName = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// HeldError is returned if another apply holds the lock
+type HeldError struct {
+	Key    string
+	Holder string
+	Since  time.Time
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("apply of %s already in progress by %s since %s", e.Key, e.Holder,
+		e.Since.Format(time.RFC3339))
+}
+
+// LostError is the cause of the context of a lock which couldn't be renewed
+// and was taken over by another apply or expired
+type LostError struct {
+	Key    string
+	Holder string
+}
+
+func (e *LostError) Error() string {
+	if e.Holder == "" {
+		return fmt.Sprintf("apply lock of %s expired", e.Key)
+	}
+	return fmt.Sprintf("apply lock of %s was taken over by %s", e.Key, e.Holder)
+}
+
+// Locker takes apply locks in Namespace
+type Locker struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Holder identifies the apply to the ones waiting for the lock,
+	// DefaultHolder if empty
+	Holder string
+	// Wait is how long to wait for the lock held by another apply, zero
+	// fails right away
+	Wait time.Duration
+	// LeaseDuration after which the lock of an apply which stopped
+	// renewing it is taken over
+	LeaseDuration time.Duration
+	PollInterval  time.Duration
+}
+
+// DefaultHolder returns user@host and the process id
+func DefaultHolder() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s@%s pid %d", name, host, os.Getpid())
+}
+
+// LeaseName returns the name of the Lease of the lock key
+func LeaseName(key string) string {
+	name := strings.Trim(invalidName.ReplaceAllString(strings.ToLower(key), "-"), "-")
+	if len(namePrefix+name) <= 63 && name == key {
+		return namePrefix + name
+	}
+	sum := sha256.Sum256([]byte(key))
+	if name = strings.Trim(name[:min(len(name), 40)], "-"); name != "" {
+		name += "-"
+	}
+	return namePrefix + name + hex.EncodeToString(sum[:])[:8]
+}
+
+// Acquire takes the lock of key, release gives it back. The lock is
+// renewed until it is released, held is derived from ctx and cancelled
+// with a LostError as cause if the lock is lost before.
+func (l *Locker) Acquire(ctx context.Context, key string) (held context.Context, release func(), err error) {
+	l.defaults()
+	deadline := time.Now().Add(l.Wait)
+	waiting := false
+	for {
+		lease, err := l.take(ctx, key)
+		if err == nil {
+			held, release := l.hold(ctx, key, lease)
+			return held, release, nil
+		}
+		held, ok := err.(*HeldError)
+		if !ok || !time.Now().Before(deadline) {
+			return nil, nil, err
+		}
+		if !waiting {
+			log.Printf("waiting up to %s for the %s", time.Until(deadline).Round(time.Second), held.Error())
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("%w: %w", held, ctx.Err())
+		case <-time.After(min(l.PollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+func (l *Locker) defaults() {
+	if l.Holder == "" {
+		l.Holder = DefaultHolder()
+	}
+	if l.LeaseDuration == 0 {
+		l.LeaseDuration = defaultLeaseDuration
+	}
+	if l.PollInterval == 0 {
+		l.PollInterval = defaultPollInterval
+	}
+}
+
+// take creates the Lease of key or takes it over if it was released or
+// expired, a Lease held by another apply is returned as HeldError
+func (l *Locker) take(ctx context.Context, key string) (*coordinationv1.Lease, error) {
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(l.LeaseDuration / time.Second)
+	lease, err := leases.Get(ctx, LeaseName(key), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        LeaseName(key),
+				Namespace:   l.Namespace,
+				Labels:      map[string]string{LockLabel: "true"},
+				Annotations: map[string]string{KeyAnnotation: key},
+			},
+			Spec: coordinationv1.LeaseSpec{HolderIdentity: &l.Holder, LeaseDurationSeconds: &seconds,
+				AcquireTime: &now, RenewTime: &now},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return nil, &HeldError{Key: key, Holder: "another apply", Since: now.Time}
+		}
+		return lease, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("apply lock %s: %w", LeaseName(key), err)
+	}
+	if holder := holder(lease); holder != "" && !expired(lease) {
+		since := lease.CreationTimestamp.Time
+		if lease.Spec.AcquireTime != nil {
+			since = lease.Spec.AcquireTime.Time
+		}
+		return nil, &HeldError{Key: key, Holder: holder, Since: since}
+	}
+	if holder := holder(lease); holder != "" {
+		log.Printf("apply %s stopped renewing the lock of %s, taking it over", holder, key)
+	}
+	lease.Spec.HolderIdentity = &l.Holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	lease, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return nil, &HeldError{Key: key, Holder: "another apply", Since: now.Time}
+	}
+	return lease, err
+}
+
+// hold renews the Lease until the returned function is called, which
+// releases it. The returned context is cancelled with a LostError once the
+// Lease is held by another apply or renewing it failed for LeaseDuration.
+func (l *Locker) hold(parent context.Context, key string, lease *coordinationv1.Lease) (context.Context, func()) {
+	leases := l.Client.CoordinationV1().Leases(l.Namespace)
+	held, lose := context.WithCancelCause(parent)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lost := false
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.LeaseDuration / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				now := metav1.NewMicroTime(time.Now())
+				lease.Spec.RenewTime = &now
+				updated, err := leases.Update(ctx, lease, metav1.UpdateOptions{})
+				if err == nil {
+					lease, renewed = updated, now.Time
+					continue
+				}
+				if ctx.Err() != nil {
+					continue
+				}
+				log.Printf("unable to renew apply lock %s: %s", lease.Name, err.Error())
+				latest, err := leases.Get(ctx, lease.Name, metav1.GetOptions{})
+				switch {
+				case err == nil && holder(latest) != l.Holder:
+					lost = true
+					lose(&LostError{Key: key, Holder: holder(latest)})
+					return
+				case err == nil:
+					lease = latest
+				}
+				if time.Since(renewed) > l.LeaseDuration {
+					lost = true
+					lose(&LostError{Key: key})
+					return
+				}
+			}
+		}
+	}()
+	return held, func() {
+		cancel()
+		<-done
+		lose(context.Canceled)
+		if lost {
+			// the Lease belongs to the apply which took it over
+			return
+		}
+		lease.Spec.HolderIdentity = nil
+		lease.Spec.RenewTime = nil
+		if _, err := leases.Update(context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+			log.Printf("unable to release apply lock %s: %s", lease.Name, err.Error())
+		}
+	}
+}
+
+func expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	return time.Since(lease.Spec.RenewTime.Time) > time.Duration(*lease.Spec.LeaseDurationSeconds)*time.Second
+}
+
+func holder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
@@ -0,0 +1,135 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAcquire(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewClientset()
+	first := &Locker{Client: cs, Namespace: "ucp", Holder: "cli"}
+	second := &Locker{Client: cs, Namespace: "ucp", Holder: "api", Wait: 50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond}
+
+	_, release, err := first.Acquire(ctx, "armada-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var held *HeldError
+	if _, _, err := second.Acquire(ctx, "armada-manifest"); !errors.As(err, &held) || held.Holder != "cli" {
+		t.Fatalf("got error %v, want the lock held by cli", err)
+	}
+	if _, _, err := second.Acquire(ctx, "other-manifest"); err != nil {
+		t.Fatalf("lock of another manifest: %v", err)
+	}
+
+	release()
+	_, releaseSecond, err := second.Acquire(ctx, "armada-manifest")
+	if err != nil {
+		t.Fatalf("released lock: %v", err)
+	}
+	releaseSecond()
+}
+
+func TestAcquireExpired(t *testing.T) {
+	ctx := context.Background()
+	holder, seconds := "crashed", int32(60)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Hour))
+	cs := fake.NewClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: LeaseName("site"), Namespace: "ucp"},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &seconds,
+			AcquireTime: &renewed, RenewTime: &renewed},
+	})
+	_, release, err := (&Locker{Client: cs, Namespace: "ucp", Holder: "cli"}).Acquire(ctx, "site")
+	if err != nil {
+		t.Fatalf("expired lock wasn't taken over: %v", err)
+	}
+	defer release()
+	lease, err := cs.CoordinationV1().Leases("ucp").Get(ctx, LeaseName("site"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *lease.Spec.HolderIdentity != "cli" {
+		t.Errorf("lock is held by %s, want cli", *lease.Spec.HolderIdentity)
+	}
+}
+
+func TestAcquireLost(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewClientset()
+	// renewing the lock conflicts once another apply took it over
+	var taken atomic.Bool
+	cs.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !taken.Load() {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewConflict(coordinationv1.Resource("leases"), LeaseName("site"),
+			errors.New("modified"))
+	})
+	locker := &Locker{Client: cs, Namespace: "ucp", Holder: "cli", LeaseDuration: 300 * time.Millisecond}
+	held, release, err := locker.Acquire(ctx, "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	lease, err := cs.CoordinationV1().Leases("ucp").Get(ctx, LeaseName("site"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := "api"
+	lease.Spec.HolderIdentity = &other
+	taken.Store(true)
+	if err := cs.Tracker().Update(coordinationv1.SchemeGroupVersion.WithResource("leases"), lease, "ucp"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-held.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context of the lost lock wasn't cancelled")
+	}
+	var lost *LostError
+	if !errors.As(context.Cause(held), &lost) || lost.Holder != "api" {
+		t.Errorf("got cause %v, want the lock taken over by api", context.Cause(held))
+	}
+}
+
+func TestLeaseName(t *testing.T) {
+	if got := LeaseName("armada-manifest"); got != "armada-apply-armada-manifest" {
+		t.Errorf("got %q, want armada-apply-armada-manifest", got)
+	}
+	// names which had to be changed get a digest of the key, so they don't clash
+	if got := LeaseName("Site_Manifest"); !strings.HasPrefix(got, "armada-apply-site-manifest-") || got == LeaseName("site-manifest") {
+		t.Errorf("got %q for Site_Manifest", got)
+	}
+	if got := LeaseName(strings.Repeat("x", 100)); len(got) > 63 {
+		t.Errorf("got %q longer than 63 characters", got)
+	}
+}
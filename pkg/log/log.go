@@ -15,78 +15,373 @@
 package log
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
+const prefix = "[armada-go] "
+
 var (
-	debug     = false
-	armadaLog = log.New(os.Stderr, "[armada-go] ", log.LstdFlags)
+	mu        sync.RWMutex
+	debug               = false
+	verbosity           = 0
+	format              = FormatText
+	output    io.Writer = os.Stderr
+	level               = new(slog.LevelVar)
+	explicit            = map[string]bool{}
 )
 
+// debugVerbosity is the verbosity enabled by --debug
+const debugVerbosity = 4
+
 // Init initializes settings related to logging
 func Init(debugFlag bool, out io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
 	debug = debugFlag
-	if debug {
-		armadaLog.SetFlags(log.LstdFlags | log.Llongfile)
+	if debug && verbosity < debugVerbosity {
+		setVerbosity(debugVerbosity)
+	}
+	output = out
+	redirectKlog()
+}
+
+// SetVerbosity enables messages up to the verbosity level, 0 logs only
+// informational messages, higher levels add debug messages of armada-go and
+// the kubernetes client libraries. It takes precedence over Configure.
+func SetVerbosity(v int) {
+	mu.Lock()
+	defer mu.Unlock()
+	explicit["verbosity"] = true
+	setVerbosity(v)
+	redirectKlog()
+}
+
+// Verbosity returns the verbosity level
+func Verbosity() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return verbosity
+}
+
+// setVerbosity must be called with mu held, logr V(n) maps to slog level -n
+func setVerbosity(v int) {
+	verbosity = v
+	level.Set(slog.Level(-v))
+}
+
+// redirectKlog sends messages of the kubernetes client libraries to the
+// armada-go log, must be called with mu held. The klog flags are kept in
+// a private flag set so the global flag state of the program is untouched.
+func redirectKlog() {
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	_ = fs.Set("v", strconv.Itoa(verbosity))
+	var h slog.Handler
+	if format == FormatJSON {
+		h = slog.NewJSONHandler(output, &slog.HandlerOptions{Level: level})
+	} else {
+		h = &textHandler{out: output, mu: &sync.Mutex{}}
+	}
+	klog.SetLogger(logr.FromSlogHandler(h))
+}
+
+// SetFormat selects the text or JSON encoder, it takes precedence over the
+// format set by Configure
+func SetFormat(f string) error {
+	if f != FormatText && f != FormatJSON {
+		return fmt.Errorf("unknown log format %q, expected %s or %s", f, FormatText, FormatJSON)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	format = f
+	explicit["format"] = true
+	redirectKlog()
+	return nil
+}
+
+// Configure applies the [logging] section of armada.conf, settings given on
+// the command line are kept:
+//
+//	[logging]
+//	format = json
+//	output = /var/log/armada/armada.log
+//	verbosity = 2
+func Configure(f, out string, v *int) error {
+	if v != nil && !isExplicit("verbosity") {
+		mu.Lock()
+		setVerbosity(*v)
+		mu.Unlock()
 	}
-	armadaLog.SetOutput(out)
+	if f != "" && !isExplicit("format") {
+		if err := SetFormat(f); err != nil {
+			return err
+		}
+	}
+	if out != "" {
+		var w io.Writer
+		switch out {
+		case "stderr":
+			w = os.Stderr
+		case "stdout":
+			w = os.Stdout
+		default:
+			file, err := os.OpenFile(out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			w = file
+		}
+		mu.Lock()
+		output = w
+		mu.Unlock()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	redirectKlog()
+	return nil
+}
+
+func isExplicit(setting string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return explicit[setting]
 }
 
 // DebugEnabled returns whether the debug level is set
 func DebugEnabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
 	return debug
 }
 
 // Debug is a wrapper for log.Debug
 func Debug(v ...interface{}) {
-	if debug {
-		writeLog(v...)
-	}
+	Default().output(slog.LevelDebug, fmt.Sprint(v...))
 }
 
 // Debugf is a wrapper for log.Debugf
 func Debugf(format string, v ...interface{}) {
-	if debug {
-		writeLog(fmt.Sprintf(format, v...))
-	}
+	Default().output(slog.LevelDebug, fmt.Sprintf(format, v...))
 }
 
 // Print is a wrapper for log.Print
 func Print(v ...interface{}) {
-	writeLog(v...)
+	Default().output(slog.LevelInfo, fmt.Sprint(v...))
 }
 
 // Printf is a wrapper for log.Printf
 func Printf(format string, v ...interface{}) {
-	writeLog(fmt.Sprintf(format, v...))
+	Default().output(slog.LevelInfo, fmt.Sprintf(format, v...))
 }
 
 // Fatal is a wrapper for log.Fatal
 func Fatal(v ...interface{}) {
-	armadaLog.Fatal(v...)
+	Default().output(slog.LevelError, fmt.Sprint(v...))
+	os.Exit(1)
 }
 
 // Fatalf is a wrapper for log.Fatalf
 func Fatalf(format string, v ...interface{}) {
-	armadaLog.Fatalf(format, v...)
+	Default().output(slog.LevelError, fmt.Sprintf(format, v...))
+	os.Exit(1)
 }
 
 // Writer returns log output writer object
 func Writer() io.Writer {
-	return armadaLog.Writer()
+	mu.RLock()
+	defer mu.RUnlock()
+	return output
+}
+
+// With returns a logger writing to the global output which attaches the
+// given key value pairs to every message
+func With(args ...any) *Logger {
+	return Default().With(args...)
+}
+
+// Logger writes messages to its own output, independently of the global
+// logger, attaching its fields to every message
+type Logger struct {
+	l   *slog.Logger
+	out io.Writer
+}
+
+// New returns a Logger writing to out using the global log format
+func New(out io.Writer) *Logger {
+	return &Logger{l: slog.New(newHandler(out)), out: out}
+}
+
+// Default returns a Logger writing to the global output
+func Default() *Logger {
+	return New(Writer())
+}
+
+// With returns a copy of the logger attaching the key value pairs
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l: l.l.With(args...), out: l.out}
+}
+
+// Printf is a wrapper for log.Printf
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.output(slog.LevelInfo, fmt.Sprintf(format, v...))
 }
 
-func writeLog(v ...interface{}) {
-	if debug {
-		err := armadaLog.Output(3, fmt.Sprint(v...))
-		if err != nil {
-			log.Print(v...)
-			log.Print(err)
+// Debugf is a wrapper for log.Debugf
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.output(slog.LevelDebug, fmt.Sprintf(format, v...))
+}
+
+// Writer returns log output writer object
+func (l *Logger) Writer() io.Writer {
+	return l.out
+}
+
+// Logr returns the logger for libraries logging with logr
+func (l *Logger) Logr() logr.Logger {
+	return logr.FromSlogHandler(l.l.Handler())
+}
+
+// output logs msg with the caller of the exported logging function as source
+func (l *Logger) output(lvl slog.Level, msg string) {
+	ctx := context.Background()
+	if !l.l.Enabled(ctx, lvl) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), lvl, msg, pcs[0])
+	_ = l.l.Handler().Handle(ctx, r)
+}
+
+type ctxKey struct{}
+
+// IntoContext returns a context carrying the logger
+func IntoContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger of the context or fallback if there is none
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+func newHandler(out io.Writer) slog.Handler {
+	mu.RLock()
+	defer mu.RUnlock()
+	if format == FormatJSON {
+		return slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level, AddSource: debug})
+	}
+	return &textHandler{out: out, mu: &sync.Mutex{}, source: debug}
+}
+
+// textHandler writes messages in the classic armada-go format followed by
+// the attached fields as key=value pairs
+type textHandler struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	source bool
+	attrs  []slog.Attr
+	group  string
+}
+
+func (h *textHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return lvl >= level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	if h.source && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		fmt.Fprintf(&b, "%s:%d: ", frame.File, frame.Line)
+	}
+	switch {
+	case r.Level == slog.LevelInfo:
+	case r.Level < slog.LevelInfo && r.Level != slog.LevelDebug:
+		// logr V(n) messages
+		fmt.Fprintf(&b, "V%d ", -r.Level)
+	default:
+		b.WriteString(r.Level.String())
+		b.WriteString(" ")
+	}
+	b.WriteString(r.Message)
+	for _, a := range h.attrs {
+		writeAttr(&b, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.group, a)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+func writeAttr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, key, ga)
 		}
-	} else {
-		armadaLog.Print(v...)
+		return
+	}
+	val := a.Value.String()
+	if strings.ContainsAny(val, " \t\"=") {
+		val = fmt.Sprintf("%q", val)
+	}
+	fmt.Fprintf(b, " %s=%s", key, val)
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	if h.group != "" {
+		name = h.group + "." + name
 	}
+	h2.group = name
+	return &h2
 }
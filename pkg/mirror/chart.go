@@ -0,0 +1,265 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mirror
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Source types of chart documents
+const (
+	SourceTar   = "tar"
+	SourceLocal = "local"
+	SourceGit   = "git"
+	SourceOCI   = "oci"
+)
+
+// Chart is a chart packaged the way `helm package` does
+type Chart struct {
+	Name    string
+	Version string
+	// Metadata is the content of Chart.yaml
+	Metadata map[string]any
+	// Archive is the gzipped tarball of the chart
+	Archive []byte
+}
+
+type file struct {
+	mode int64
+	data []byte
+}
+
+// Fetch downloads the chart source and packages the chart found there
+func Fetch(ctx context.Context, client *http.Client, src armadav1.ArmadaChartSource) (*Chart, error) {
+	var files map[string]file
+	var err error
+	switch src.Type {
+	case SourceTar:
+		files, err = fetchTar(ctx, client, src.Location)
+	case SourceLocal:
+		files, err = readDir(src.Location)
+	case SourceGit:
+		return nil, fmt.Errorf("git sources are not supported, mirror %s manually", src.Location)
+	default:
+		return nil, fmt.Errorf("unsupported source type %q", src.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return packRoot(files, src.Location, src.Subpath)
+}
+
+func fetchTar(ctx context.Context, client *http.Client, location string) (map[string]file, error) {
+	var r io.Reader
+	if u, err := url.Parse(location); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("downloading %s failed: %s", location, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(strings.TrimPrefix(location, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return untar(r, location)
+}
+
+// untar returns the regular files of a gzipped tarball
+func untar(r io.Reader, location string) (map[string]file, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	files := map[string]file{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = file{mode: hdr.Mode, data: data}
+	}
+	return files, nil
+}
+
+// PackArchive packages the chart below subpath of a gzipped tarball,
+// location names the tarball in errors
+func PackArchive(archive []byte, location, subpath string) (*Chart, error) {
+	files, err := untar(bytes.NewReader(archive), location)
+	if err != nil {
+		return nil, err
+	}
+	return packRoot(files, location, subpath)
+}
+
+// PackDir packages the chart below subpath of a directory
+func PackDir(dir, subpath string) (*Chart, error) {
+	files, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return packRoot(files, dir, subpath)
+}
+
+func packRoot(files map[string]file, location, subpath string) (*Chart, error) {
+	files, err := chartRoot(files, subpath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return pack(files)
+}
+
+func readDir(dir string) (map[string]file, error) {
+	files := map[string]file{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = file{mode: int64(info.Mode().Perm()), data: data}
+		return nil
+	})
+	return files, err
+}
+
+// chartRoot returns files below subpath relative to it, a chart packaged in a
+// single top level directory, like helm package creates, is found too
+func chartRoot(files map[string]file, subpath string) (map[string]file, error) {
+	root := path.Clean(strings.Trim(subpath, "/"))
+	if root == "." {
+		root = ""
+	}
+	sub := func(root string) map[string]file {
+		if root == "" {
+			return files
+		}
+		out := map[string]file{}
+		for name, f := range files {
+			if rel, ok := strings.CutPrefix(name, root+"/"); ok {
+				out[rel] = f
+			}
+		}
+		return out
+	}
+	chart := sub(root)
+	if _, ok := chart["Chart.yaml"]; ok {
+		return chart, nil
+	}
+	if root == "" {
+		for name := range files {
+			if dir, base := path.Split(name); base == "Chart.yaml" && strings.Count(dir, "/") == 1 {
+				return sub(strings.TrimSuffix(dir, "/")), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no Chart.yaml found in %q", subpath)
+}
+
+// pack creates the chart archive with files below a directory named after
+// the chart, entries are sorted and timestamps fixed so the digest is stable
+func pack(files map[string]file) (*Chart, error) {
+	var metadata map[string]any
+	if err := yaml.Unmarshal(files["Chart.yaml"].data, &metadata); err != nil {
+		return nil, fmt.Errorf("Chart.yaml: %w", err)
+	}
+	name, _ := metadata["name"].(string)
+	version, _ := metadata["version"].(string)
+	if name == "" || version == "" {
+		return nil, fmt.Errorf("Chart.yaml must set name and version")
+	}
+
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, n := range names {
+		f := files[n]
+		mode := f.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		hdr := &tar.Header{Name: name + "/" + n, Mode: mode, Size: int64(len(f.data)),
+			ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return &Chart{Name: name, Version: version, Metadata: metadata, Archive: buf.Bytes()}, nil
+}
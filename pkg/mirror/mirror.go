@@ -0,0 +1,202 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"opendev.org/airship/armada-go/pkg/log"
+	armadaschema "opendev.org/airship/armada-go/pkg/schema"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// RunCommand phase run command
+type RunCommand struct {
+	Manifests string
+	// To is the registry location charts are pushed to, oci://host/path
+	To string
+	// Output receives the manifests pointing at the mirror
+	Output    io.Writer
+	Username  string
+	Password  string
+	PlainHTTP bool
+	Insecure  bool
+	// Fetch returns the chart of the source, tar and local sources are
+	// fetched without it
+	Fetch func(ctx context.Context, src Source) (*Chart, error)
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	u, err := url.Parse(c.To)
+	if err != nil || u.Scheme != "oci" || u.Host == "" {
+		return fmt.Errorf("invalid mirror %q, expected oci://registry/path", c.To)
+	}
+	registry, err := NewRegistry(u.Host, RegistryOptions{PlainHTTP: c.PlainHTTP, Insecure: c.Insecure,
+		Username: c.Username, Password: c.Password})
+	if err != nil {
+		return err
+	}
+	base := strings.Trim(u.Path, "/")
+
+	docs, err := c.readDocuments()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	fetch := c.Fetch
+	if fetch == nil {
+		client := &http.Client{Timeout: 10 * time.Minute}
+		fetch = func(ctx context.Context, src Source) (*Chart, error) {
+			return Fetch(ctx, client, armadav1.ArmadaChartSource{
+				Type: src.Type, Location: src.Location, Subpath: src.Subpath})
+		}
+	}
+	mirrored := map[Source]string{}
+	for _, doc := range docs {
+		buf, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		sch, name, ok, err := armadaschema.Detect(buf)
+		if err != nil || !ok || sch.Kind != armadaschema.KindChart {
+			continue
+		}
+		var chart struct {
+			Data struct {
+				Source Source `yaml:"source"`
+			} `yaml:"data"`
+		}
+		if err := doc.Decode(&chart); err != nil {
+			return fmt.Errorf("chart %s: %w", name, err)
+		}
+		src := chart.Data.Source
+		if src.Type == SourceOCI {
+			log.Printf("chart %s is already sourced from %s, skipping", name, src.Location)
+			continue
+		}
+
+		ref, ok := mirrored[src]
+		if !ok {
+			log.Printf("mirroring chart %s from %s %s", name, src.Type, src.Location)
+			chart, err := fetch(ctx, src)
+			if err != nil {
+				return fmt.Errorf("chart %s: %w", name, err)
+			}
+			repo := strings.TrimPrefix(base+"/"+chart.Name, "/")
+			if ref, err = registry.PushChart(repo, chart.Version, chart.Archive); err != nil {
+				return fmt.Errorf("chart %s: %w", name, err)
+			}
+			log.Printf("chart %s has been pushed to %s", name, ref)
+			mirrored[src] = ref
+		}
+		setSource(doc, ref)
+	}
+
+	enc := yaml.NewEncoder(c.Output)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// Source identifies the source of a chart document, charts sharing it are
+// pushed once
+type Source struct {
+	Type     string `yaml:"type"`
+	Location string `yaml:"location"`
+	Subpath  string `yaml:"subpath"`
+	// Reference is the branch, tag or commit of git sources
+	Reference string `yaml:"reference"`
+}
+
+// readDocuments returns the documents of a local or http(s) manifest file
+func (c *RunCommand) readDocuments() ([]*yaml.Node, error) {
+	var r io.Reader
+	if u, err := url.Parse(c.Manifests); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		resp, err := http.Get(c.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("downloading %s failed: %s", c.Manifests, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(c.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(r)
+	for {
+		doc := &yaml.Node{}
+		if err := dec.Decode(doc); err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// setSource points data.source of the chart document at the mirrored chart
+func setSource(doc *yaml.Node, ref string) {
+	source := lookup(lookup(doc.Content[0], "data"), "source")
+	if source == nil {
+		return
+	}
+	var content []*yaml.Node
+	for i := 0; i+1 < len(source.Content); i += 2 {
+		switch source.Content[i].Value {
+		case "type", "location", "subpath", "reference", "checksum":
+			continue
+		}
+		content = append(content, source.Content[i], source.Content[i+1])
+	}
+	scalar := func(v string) *yaml.Node { return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v} }
+	source.Content = append([]*yaml.Node{scalar("type"), scalar(SourceOCI), scalar("location"), scalar(ref)}, content...)
+}
+
+// lookup returns the value of key in a mapping node
+func lookup(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package mirror
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"helm.sh/helm/v3/pkg/registry"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// Media types of Helm charts stored in OCI registries
+const (
+	MediaTypeHelmConfig = registry.ConfigMediaType
+	MediaTypeHelmChart  = registry.ChartLayerMediaType
+)
+
+// RegistryOptions configure how a Registry talks to the registry
+type RegistryOptions struct {
+	// PlainHTTP talks to the registry without TLS
+	PlainHTTP bool
+	// Insecure skips verification of the registry certificate
+	Insecure bool
+	// Username and Password authenticate to the registry or its token service
+	Username string
+	Password string
+	// Token is a bearer token of the registry
+	Token string
+}
+
+// Registry pushes and pulls Helm charts with the Helm registry client, other
+// artifacts, like cosign signatures, are read with ORAS the client is built on
+type Registry struct {
+	// Host is the registry host with an optional port
+	Host string
+
+	client    *registry.Client
+	auth      *auth.Client
+	plainHTTP bool
+}
+
+// NewRegistry returns a client of the registry host
+func NewRegistry(host string, opts RegistryOptions) (*Registry, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	authClient := &auth.Client{
+		Client: &http.Client{Transport: transport, Timeout: 10 * time.Minute},
+		Cache:  auth.NewCache(),
+		Credential: auth.StaticCredential(host, auth.Credential{Username: opts.Username, Password: opts.Password,
+			AccessToken: opts.Token}),
+	}
+	clientOpts := []registry.ClientOption{registry.ClientOptAuthorizer(*authClient)}
+	if opts.PlainHTTP {
+		clientOpts = append(clientOpts, registry.ClientOptPlainHTTP())
+	}
+	client, err := registry.NewClient(clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{Host: host, client: client, auth: authClient, plainHTTP: opts.PlainHTTP}, nil
+}
+
+// PushChart uploads the chart archive to repository:version like `helm push`
+// does and returns the reference of the chart, a + of the version becomes _
+func (r *Registry) PushChart(repo, version string, archive []byte) (string, error) {
+	res, err := r.client.Push(archive, fmt.Sprintf("%s/%s:%s", r.Host, repo, version))
+	if err != nil {
+		return "", fmt.Errorf("pushing chart to %s/%s: %w", r.Host, repo, err)
+	}
+	return registry.OCIScheme + "://" + res.Ref, nil
+}
+
+// PullChart downloads the archive of the chart with the manifest digest like
+// `helm pull` does
+func (r *Registry) PullChart(repo, digest string) ([]byte, error) {
+	ref := fmt.Sprintf("%s/%s@%s", r.Host, repo, digest)
+	res, err := r.client.Pull(ref)
+	if err != nil {
+		return nil, fmt.Errorf("pulling chart %s: %w", ref, err)
+	}
+	return res.Chart.Data, nil
+}
+
+// Resolve returns the digest of the manifest the reference points at
+func (r *Registry) Resolve(ctx context.Context, repo, reference string) (string, error) {
+	repository, err := r.repository(repo)
+	if err != nil {
+		return "", err
+	}
+	desc, err := repository.Resolve(ctx, reference)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s/%s:%s: %w", r.Host, repo, reference, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+// PullManifest returns the OCI manifest the reference points at
+func (r *Registry) PullManifest(ctx context.Context, repo, reference string) (*ocispec.Manifest, error) {
+	repository, err := r.repository(repo)
+	if err != nil {
+		return nil, err
+	}
+	desc, rc, err := repository.FetchReference(ctx, reference)
+	if err != nil {
+		return nil, fmt.Errorf("pulling manifest %s/%s:%s: %w", r.Host, repo, reference, err)
+	}
+	defer rc.Close()
+	buf, err := content.ReadAll(rc, desc)
+	if err != nil {
+		return nil, err
+	}
+	var m ocispec.Manifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, fmt.Errorf("manifest %s/%s:%s: %w", r.Host, repo, reference, err)
+	}
+	return &m, nil
+}
+
+// PullBlob downloads the blob and verifies its digest
+func (r *Registry) PullBlob(ctx context.Context, repo string, desc ocispec.Descriptor) ([]byte, error) {
+	repository, err := r.repository(repo)
+	if err != nil {
+		return nil, err
+	}
+	return content.FetchAll(ctx, repository.Blobs(), desc)
+}
+
+func (r *Registry) repository(repo string) (*remote.Repository, error) {
+	repository, err := remote.NewRepository(r.Host + "/" + repo)
+	if err != nil {
+		return nil, err
+	}
+	repository.Client = r.auth
+	repository.PlainHTTP = r.plainHTTP
+	return repository, nil
+}
@@ -0,0 +1,245 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package partition spreads independent chart groups across multiple worker
+// processes. The coordinator publishes every chart group as a work item made
+// of a ConfigMap holding the group and a Lease used by workers to claim it;
+// the coordinator waits until all items of the batch are finished.
+package partition
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+const (
+	workLabel       = "armada.airshipit.org/work"
+	stateAnnotation = "armada.airshipit.org/work-state"
+	errorAnnotation = "armada.airshipit.org/work-error"
+	groupKey        = "group.json"
+
+	defaultLeaseDuration = 60 * time.Second
+	defaultPollInterval  = 5 * time.Second
+	defaultClaimTimeout  = 2 * time.Minute
+)
+
+// WorkState is the state of a single work item
+type WorkState string
+
+const (
+	WorkPending   WorkState = "pending"
+	WorkRunning   WorkState = "running"
+	WorkSucceeded WorkState = "succeeded"
+	WorkFailed    WorkState = "failed"
+)
+
+// Group is a chart group handed over to a worker
+type Group struct {
+	Name string `json:"name"`
+	// Charts are the charts of the group to install, skipped charts and
+	// charts applied by an interrupted apply are left out
+	Charts []string `json:"charts"`
+	// Canary are the charts installed before the others
+	Canary []string `json:"canary,omitempty"`
+}
+
+// Coordinator publishes chart groups as work items and waits for workers to
+// finish them
+type Coordinator struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// LeaseDuration after which a work item of a silent worker is handed to another one
+	LeaseDuration time.Duration
+	PollInterval  time.Duration
+	// ClaimTimeout is how long work items may stay pending while no worker
+	// runs any of them before the batch fails, as no worker is left
+	ClaimTimeout time.Duration
+
+	runID string
+	batch int
+	// idleSince is the time since which no work item of the batch is running
+	idleSince time.Time
+}
+
+// RunGroups implements apply.GroupRunner
+func (c *Coordinator) RunGroups(ctx context.Context, groups []Group) error {
+	c.defaults()
+	if c.runID == "" {
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		c.runID = hex.EncodeToString(b)
+	}
+	c.batch++
+	batch := fmt.Sprintf("%s-%d", c.runID, c.batch)
+	defer c.cleanup(batch)
+
+	for i, group := range groups {
+		if err := c.publish(ctx, batch, fmt.Sprintf("armada-work-%s-%d", batch, i), group); err != nil {
+			return err
+		}
+	}
+	log.Printf("published %d work items of batch %s in namespace %s", len(groups), batch, c.Namespace)
+
+	c.idleSince = time.Now()
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+	for {
+		done, err := c.check(ctx, batch, len(groups))
+		if done {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Coordinator) defaults() {
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = defaultLeaseDuration
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.ClaimTimeout == 0 {
+		c.ClaimTimeout = defaultClaimTimeout
+	}
+}
+
+func (c *Coordinator) publish(ctx context.Context, batch, name string, group Group) error {
+	buf, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	meta := metav1.ObjectMeta{
+		Name:        name,
+		Namespace:   c.Namespace,
+		Labels:      map[string]string{workLabel: batch},
+		Annotations: map[string]string{stateAnnotation: string(WorkPending)},
+	}
+	if _, err = c.Client.CoreV1().ConfigMaps(c.Namespace).Create(ctx, &v1.ConfigMap{
+		ObjectMeta: *meta.DeepCopy(),
+		Data:       map[string]string{groupKey: string(buf)},
+	}, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	seconds := int32(c.LeaseDuration / time.Second)
+	_, err = c.Client.CoordinationV1().Leases(c.Namespace).Create(ctx, &coordinationv1.Lease{
+		ObjectMeta: meta,
+		Spec:       coordinationv1.LeaseSpec{LeaseDurationSeconds: &seconds},
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// check returns true once all work items are finished along with their errors,
+// work items held by workers which stopped renewing the lease are released.
+// It fails once items were pending without any running for ClaimTimeout.
+func (c *Coordinator) check(ctx context.Context, batch string, total int) (bool, error) {
+	leases, err := c.Client.CoordinationV1().Leases(c.Namespace).List(ctx,
+		metav1.ListOptions{LabelSelector: workLabel + "=" + batch})
+	if err != nil {
+		log.Printf("unable to list work items: %s", err.Error())
+		return false, nil
+	}
+	if len(leases.Items) != total {
+		return true, fmt.Errorf("%d of %d work items of batch %s are missing", total-len(leases.Items), total, batch)
+	}
+
+	var errs []error
+	var unclaimed []string
+	finished, running := 0, 0
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		switch WorkState(lease.Annotations[stateAnnotation]) {
+		case WorkSucceeded:
+			finished++
+		case WorkFailed:
+			finished++
+			errs = append(errs, fmt.Errorf("%s: %s", lease.Name, lease.Annotations[errorAnnotation]))
+		case WorkPending:
+			unclaimed = append(unclaimed, lease.Name)
+		case WorkRunning:
+			running++
+			if expired(lease, c.LeaseDuration) {
+				log.Printf("worker %s stopped renewing %s, releasing it", holder(lease), lease.Name)
+				lease.Annotations[stateAnnotation] = string(WorkPending)
+				lease.Spec.HolderIdentity = nil
+				if _, err := c.Client.CoordinationV1().Leases(c.Namespace).Update(
+					ctx, lease, metav1.UpdateOptions{}); err != nil && !apierrors.IsConflict(err) {
+					log.Printf("unable to release %s: %s", lease.Name, err.Error())
+				}
+			}
+		}
+	}
+	if running > 0 {
+		c.idleSince = time.Now()
+	}
+	if finished < total {
+		if running == 0 && time.Since(c.idleSince) > c.ClaimTimeout {
+			sort.Strings(unclaimed)
+			return true, fmt.Errorf("no worker claimed %d work items of batch %s within %s, "+
+				"check that `armada worker --namespace %s` pods are running: %v",
+				len(unclaimed), batch, c.ClaimTimeout, c.Namespace, unclaimed)
+		}
+		return false, nil
+	}
+	return true, errors.Join(errs...)
+}
+
+func (c *Coordinator) cleanup(batch string) {
+	opts := metav1.ListOptions{LabelSelector: workLabel + "=" + batch}
+	if err := c.Client.CoordinationV1().Leases(c.Namespace).DeleteCollection(
+		context.Background(), metav1.DeleteOptions{}, opts); err != nil {
+		log.Printf("unable to delete leases of batch %s: %s", batch, err.Error())
+	}
+	if err := c.Client.CoreV1().ConfigMaps(c.Namespace).DeleteCollection(
+		context.Background(), metav1.DeleteOptions{}, opts); err != nil {
+		log.Printf("unable to delete configmaps of batch %s: %s", batch, err.Error())
+	}
+}
+
+func expired(lease *coordinationv1.Lease, duration time.Duration) bool {
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	if lease.Spec.RenewTime == nil {
+		return false
+	}
+	return time.Since(lease.Spec.RenewTime.Time) > duration
+}
+
+func holder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
@@ -0,0 +1,80 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package partition
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRunGroupsNoWorker(t *testing.T) {
+	c := &Coordinator{
+		Client:       fake.NewSimpleClientset(),
+		Namespace:    "armada",
+		PollInterval: 10 * time.Millisecond,
+		ClaimTimeout: 50 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := c.RunGroups(ctx, []Group{{Name: "openstack-keystone", Charts: []string{"keystone"}}})
+	if err == nil || !strings.Contains(err.Error(), "no worker claimed 1 work items") {
+		t.Errorf("got %v, want no worker claimed error", err)
+	}
+}
+
+func TestRunGroups(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var installed []string
+	w := &Worker{
+		Client:       client,
+		Namespace:    "armada",
+		Identity:     "worker-0",
+		PollInterval: 10 * time.Millisecond,
+		Install: func(_ context.Context, group Group) error {
+			mu.Lock()
+			defer mu.Unlock()
+			installed = append(installed, group.Name+":"+strings.Join(group.Charts, ","))
+			return nil
+		},
+	}
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	go func() { _ = w.Run(workerCtx) }()
+
+	c := &Coordinator{Client: client, Namespace: "armada", PollInterval: 10 * time.Millisecond}
+	if err := c.RunGroups(ctx, []Group{
+		{Name: "ceph", Charts: []string{"ceph-mon", "ceph-osd"}},
+		{Name: "mariadb", Charts: []string{"mariadb"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(installed)
+	if want := []string{"ceph:ceph-mon,ceph-osd", "mariadb:mariadb"}; !slices.Equal(installed, want) {
+		t.Errorf("got %v, want %v", installed, want)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package partition
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// Worker claims work items published by a Coordinator and installs their
+// chart groups
+type Worker struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Identity is recorded as the lease holder, usually the pod name
+	Identity     string
+	Install      func(ctx context.Context, group Group) error
+	PollInterval time.Duration
+}
+
+// Run processes work items until ctx is done
+func (w *Worker) Run(ctx context.Context) error {
+	if w.PollInterval == 0 {
+		w.PollInterval = defaultPollInterval
+	}
+	log.Printf("worker %s is waiting for work in namespace %s", w.Identity, w.Namespace)
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		leases, err := w.Client.CoordinationV1().Leases(w.Namespace).List(ctx, metav1.ListOptions{LabelSelector: workLabel})
+		if err != nil {
+			log.Printf("unable to list work items: %s", err.Error())
+		} else {
+			for i := range leases.Items {
+				if ctx.Err() != nil {
+					break
+				}
+				if leases.Items[i].Annotations[stateAnnotation] == string(WorkPending) {
+					w.process(ctx, &leases.Items[i])
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) process(ctx context.Context, lease *coordinationv1.Lease) {
+	if h := holder(lease); h != "" && h != w.Identity && !expired(lease, defaultLeaseDuration) {
+		return
+	}
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.HolderIdentity = &w.Identity
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	lease.Annotations[stateAnnotation] = string(WorkRunning)
+	lease, err := w.Client.CoordinationV1().Leases(w.Namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		if !apierrors.IsConflict(err) {
+			log.Printf("unable to claim work item: %s", err.Error())
+		}
+		return
+	}
+	log.Printf("worker %s claimed %s", w.Identity, lease.Name)
+
+	// the install is cancelled if the work item is handed to another worker
+	installCtx, stopInstall := context.WithCancel(ctx)
+	renewCtx, stopRenew := context.WithCancel(ctx)
+	renewed := make(chan *coordinationv1.Lease)
+	go w.renew(renewCtx, lease, stopInstall, renewed)
+
+	installErr := w.install(installCtx, lease.Name)
+	stopInstall()
+	stopRenew()
+	lease = <-renewed
+	if h := holder(lease); h != w.Identity {
+		log.Printf("worker %s lost %s to %s, not reporting its result", w.Identity, lease.Name, h)
+		return
+	}
+
+	lease.Annotations[stateAnnotation] = string(WorkSucceeded)
+	if installErr != nil {
+		log.Printf("work item %s failed: %s", lease.Name, installErr.Error())
+		lease.Annotations[stateAnnotation] = string(WorkFailed)
+		lease.Annotations[errorAnnotation] = installErr.Error()
+	}
+	if _, err = w.Client.CoordinationV1().Leases(w.Namespace).Update(
+		context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+		log.Printf("unable to report result of %s: %s", lease.Name, err.Error())
+	}
+}
+
+func (w *Worker) install(ctx context.Context, name string) error {
+	cm, err := w.Client.CoreV1().ConfigMaps(w.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	var group Group
+	if err = json.Unmarshal([]byte(cm.Data[groupKey]), &group); err != nil {
+		return err
+	}
+	return w.Install(ctx, group)
+}
+
+// renew keeps the lease alive until ctx is done and then sends its latest
+// version, lost is called once the lease is held by another worker
+func (w *Worker) renew(ctx context.Context, lease *coordinationv1.Lease, lost func(),
+	renewed chan<- *coordinationv1.Lease) {
+	interval := defaultLeaseDuration / 3
+	if lease.Spec.LeaseDurationSeconds != nil {
+		interval = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			renewed <- lease
+			return
+		case <-ticker.C:
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+			updated, err := w.Client.CoordinationV1().Leases(w.Namespace).Update(
+				context.Background(), lease, metav1.UpdateOptions{})
+			if err != nil {
+				log.Printf("unable to renew %s: %s", lease.Name, err.Error())
+				if latest, err := w.Client.CoordinationV1().Leases(w.Namespace).Get(
+					context.Background(), lease.Name, metav1.GetOptions{}); err == nil {
+					lease = latest
+				}
+				if holder(lease) != w.Identity {
+					lost()
+					<-ctx.Done()
+					renewed <- lease
+					return
+				}
+				continue
+			}
+			lease = updated
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Prefix is the name prefix of plugin executables, armada-foo-bar is
+// invoked as `armada foo bar`
+const Prefix = "armada-"
+
+// Plugin is an executable found on PATH
+type Plugin struct {
+	// Name is the subcommand the plugin provides, e.g. "foo bar"
+	Name string
+	Path string
+}
+
+// Lookup finds the plugin for the longest prefix of args naming one, the
+// remaining args are returned to be passed to the plugin
+func Lookup(args []string) (*Plugin, []string, bool) {
+	var parts []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		parts = append(parts, strings.ReplaceAll(arg, "-", "_"))
+	}
+	for n := len(parts); n > 0; n-- {
+		path, err := exec.LookPath(Prefix + strings.Join(parts[:n], "-"))
+		if err != nil {
+			continue
+		}
+		return &Plugin{Name: strings.Join(args[:n], " "), Path: path}, args[n:], true
+	}
+	return nil, nil, false
+}
+
+// List returns the plugins found on PATH, executables shadowed by an
+// earlier PATH entry are skipped
+func List() []Plugin {
+	seen := map[string]bool{}
+	var plugins []Plugin
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasPrefix(e.Name(), Prefix) || seen[e.Name()] {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if info, err := os.Stat(path); err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			seen[e.Name()] = true
+			name := strings.ReplaceAll(strings.TrimPrefix(e.Name(), Prefix), "-", " ")
+			plugins = append(plugins, Plugin{Name: strings.ReplaceAll(name, "_", "-"), Path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// Exec replaces the current process with the plugin, it only returns on error
+func (p *Plugin) Exec(args []string) error {
+	if p.Path == "" {
+		return errors.New("plugin path is empty")
+	}
+	return syscall.Exec(p.Path, append([]string{p.Path}, args...), os.Environ())
+}
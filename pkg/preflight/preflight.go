@@ -0,0 +1,280 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package preflight checks that a cluster can take an apply before
+// anything is changed
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	authv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/crd"
+)
+
+// MinKubernetesVersion is the oldest Kubernetes release armada-go supports
+const MinKubernetesVersion = "1.27.0"
+
+// Results of a check
+const (
+	Pass = "pass"
+	Warn = "warn"
+	Fail = "fail"
+)
+
+// Check is the result of a single check
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Report holds the results of all checks
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Failed returns the checks which failed
+func (r *Report) Failed() []Check {
+	var failed []Check
+	for _, c := range r.Checks {
+		if c.Status == Fail {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+func (r *Report) add(name, status, format string, v ...any) {
+	r.Checks = append(r.Checks, Check{Name: name, Status: status, Message: fmt.Sprintf(format, v...)})
+}
+
+// Print writes the checks and a summary
+func (r *Report) Print(out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CHECK\tSTATUS\tMESSAGE")
+	counts := map[string]int{}
+	for _, c := range r.Checks {
+		counts[c.Status]++
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Message)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "%d passed, %d warnings, %d failed\n", counts[Pass], counts[Warn], counts[Fail])
+	return err
+}
+
+// Permission is an action the identity applying the manifest needs
+type Permission struct {
+	Verb      string
+	Group     string
+	Resource  string
+	Namespace string
+	// Optional permissions only warn if denied, Why says what doesn't work
+	// without them
+	Optional bool
+	Why      string
+}
+
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	if p.Namespace != "" {
+		return fmt.Sprintf("%s %s in %s", p.Verb, resource, p.Namespace)
+	}
+	return p.Verb + " " + resource
+}
+
+// Checker checks the cluster, nothing is changed
+type Checker struct {
+	Client kubernetes.Interface
+	// CRDs and CRD check the armadacharts CRD apply installs, the Helm
+	// backend doesn't need it
+	CRDs    apiextv1client.CustomResourceDefinitionInterface
+	CRD     *apiextv1.CustomResourceDefinition
+	Version string
+	// Namespaces are the namespaces of the charts, CreateNamespaces says
+	// whether missing ones are created
+	Namespaces       []string
+	CreateNamespaces bool
+	// Permissions are checked with SelfSubjectAccessReviews
+	Permissions []Permission
+}
+
+// Run runs all checks
+func (c *Checker) Run(ctx context.Context) *Report {
+	r := &Report{}
+	c.checkVersion(r)
+	if c.CRD != nil {
+		c.checkCRD(ctx, r)
+	}
+	c.checkPermissions(ctx, r)
+	c.checkNamespaces(ctx, r)
+	c.checkNodes(ctx, r)
+	return r
+}
+
+func (c *Checker) checkVersion(r *Report) {
+	const name = "kubernetes version"
+	info, err := c.Client.Discovery().ServerVersion()
+	if err != nil {
+		r.add(name, Fail, "unable to reach the API server: %s", err.Error())
+		return
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		r.add(name, Warn, "unknown version %s", info.GitVersion)
+		return
+	}
+	if v.LessThan(version.MustParseGeneric(MinKubernetesVersion)) {
+		r.add(name, Fail, "%s is older than %s", info.GitVersion, MinKubernetesVersion)
+		return
+	}
+	r.add(name, Pass, "%s", info.GitVersion)
+}
+
+func (c *Checker) checkCRD(ctx context.Context, r *Report) {
+	const name = "armadacharts CRD"
+	live, err := c.CRDs.Get(ctx, crd.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		r.add(name, Warn, "not installed, apply creates revision %d", crd.Revision(c.CRD))
+	case err != nil:
+		r.add(name, Fail, "%s", err.Error())
+	default:
+		if reason := crd.NeedsUpgrade(live, c.CRD); reason != "" {
+			r.add(name, Warn, "outdated, %s, apply upgrades it", reason)
+		} else if err := crd.CheckVersion(live, c.Version); err != nil {
+			r.add(name, Fail, "%s", err.Error())
+		} else if ok, reason := crd.Established(live); !ok {
+			r.add(name, Fail, "%s", reason)
+		} else {
+			r.add(name, Pass, "revision %d serves %s", crd.Revision(live), c.Version)
+		}
+	}
+}
+
+func (c *Checker) checkPermissions(ctx context.Context, r *Report) {
+	const name = "permissions"
+	var denied, missing []string
+	for _, p := range c.Permissions {
+		review, err := c.Client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx,
+			&authv1.SelfSubjectAccessReview{Spec: authv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authv1.ResourceAttributes{
+					Verb: p.Verb, Group: p.Group, Resource: p.Resource, Namespace: p.Namespace,
+				},
+			}}, metav1.CreateOptions{})
+		if err != nil {
+			r.add(name, Fail, "unable to review permissions: %s", err.Error())
+			return
+		}
+		if review.Status.Allowed {
+			continue
+		}
+		if p.Optional {
+			missing = append(missing, fmt.Sprintf("%s (%s)", p, p.Why))
+		} else {
+			denied = append(denied, p.String())
+		}
+	}
+	if len(missing) > 0 {
+		r.add(name, Warn, "not allowed to %s", strings.Join(missing, ", "))
+	}
+	if len(denied) > 0 {
+		r.add(name, Fail, "not allowed to %s", strings.Join(denied, ", "))
+	}
+	if len(missing) == 0 && len(denied) == 0 {
+		r.add(name, Pass, "%d permissions granted", len(c.Permissions))
+	}
+}
+
+func (c *Checker) checkNamespaces(ctx context.Context, r *Report) {
+	const name = "namespaces"
+	var absent []string
+	for _, ns := range c.Namespaces {
+		_, err := c.Client.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			absent = append(absent, ns)
+		case err != nil:
+			r.add(name, Fail, "%s", err.Error())
+			return
+		}
+	}
+	switch {
+	case len(absent) == 0:
+		r.add(name, Pass, "%d namespaces exist", len(c.Namespaces))
+	case c.CreateNamespaces:
+		r.add(name, Pass, "apply creates %s", strings.Join(absent, ", "))
+	default:
+		r.add(name, Fail, "%s don't exist and creating namespaces is disabled", strings.Join(absent, ", "))
+	}
+}
+
+// checkNodes warns about nodes which aren't ready or report pressure
+func (c *Checker) checkNodes(ctx context.Context, r *Report) {
+	const name = "nodes"
+	nodes, err := c.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		r.add(name, Warn, "unable to list nodes: %s", err.Error())
+		return
+	}
+	ready := 0
+	var problems []string
+	for _, node := range nodes.Items {
+		var issues []string
+		for _, cond := range node.Status.Conditions {
+			switch {
+			case cond.Type == v1.NodeReady && cond.Status == v1.ConditionTrue:
+				ready++
+			case cond.Type == v1.NodeReady:
+				issues = append(issues, "not ready")
+			case cond.Status == v1.ConditionTrue && (cond.Type == v1.NodeMemoryPressure ||
+				cond.Type == v1.NodeDiskPressure || cond.Type == v1.NodePIDPressure):
+				issues = append(issues, string(cond.Type))
+			}
+		}
+		if node.Spec.Unschedulable {
+			issues = append(issues, "unschedulable")
+		}
+		if len(issues) > 0 {
+			slices.Sort(issues)
+			problems = append(problems, fmt.Sprintf("%s: %s", node.Name, strings.Join(issues, ", ")))
+		}
+	}
+	switch {
+	case ready == 0:
+		r.add(name, Fail, "none of %d nodes is ready", len(nodes.Items))
+	case len(problems) > 0:
+		r.add(name, Warn, "%d of %d nodes ready, %s", ready, len(nodes.Items), strings.Join(problems, "; "))
+	default:
+		r.add(name, Pass, "%d nodes ready", ready)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package preflight
+
+import (
+	"context"
+	"testing"
+
+	authv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func node(name string, conds ...v1.NodeCondition) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: v1.NodeStatus{Conditions: conds}}
+}
+
+func TestChecker(t *testing.T) {
+	cs := fake.NewClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "openstack"}},
+		node("a", v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue}),
+		node("b", v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue},
+			v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue}),
+	)
+	cs.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.30.2"}
+	// only namespaces may be created
+	cs.PrependReactor("create", "selfsubjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authv1.SelfSubjectAccessReview)
+			review.Status.Allowed = review.Spec.ResourceAttributes.Resource == "namespaces"
+			return true, review, nil
+		})
+
+	c := &Checker{
+		Client:     cs,
+		Namespaces: []string{"openstack", "tenant"},
+		Permissions: []Permission{
+			{Verb: "create", Resource: "namespaces"},
+			{Verb: "create", Group: "armada.airshipit.org", Resource: "armadacharts", Namespace: "tenant"},
+			{Verb: "update", Resource: "configmaps", Namespace: "armada", Optional: true, Why: "no site status"},
+		},
+	}
+	want := []Check{
+		{"kubernetes version", Pass, "v1.30.2"},
+		{"permissions", Warn, "not allowed to update configmaps in armada (no site status)"},
+		{"permissions", Fail, "not allowed to create armadacharts.armada.airshipit.org in tenant"},
+		{"namespaces", Fail, "tenant don't exist and creating namespaces is disabled"},
+		{"nodes", Warn, "2 of 2 nodes ready, b: DiskPressure"},
+	}
+	got := c.Run(context.Background()).Checks
+	if len(got) != len(want) {
+		t.Fatalf("got checks %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("check %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCheckerOldKubernetes(t *testing.T) {
+	cs := fake.NewClientset()
+	cs.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.24.0"}
+	r := (&Checker{Client: cs}).Run(context.Background())
+	if failed := r.Failed(); len(failed) != 2 || failed[0].Name != "kubernetes version" || failed[1].Name != "nodes" {
+		t.Fatalf("got failed checks %v, want kubernetes version and nodes", failed)
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package prune
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apiextv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/crd"
+	"opendev.org/airship/armada-go/pkg/helm"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Kinds of affected objects
+const (
+	KindArmadaChart = "ArmadaChart"
+	KindHelmRelease = "HelmRelease"
+	KindNamespace   = "Namespace"
+	KindCRD         = "CustomResourceDefinition"
+)
+
+var chartGVR = schema.GroupVersionResource{
+	Group:    armadav1.ArmadaChartGroup,
+	Version:  armadav1.ArmadaChartVersion,
+	Resource: armadav1.ArmadaChartPlural,
+}
+
+// Action is an object removed by a prune or delete and why
+type Action struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+// Planner finds what a prune or delete removes. Only ArmadaCharts and
+// namespaces are deleted, Helm releases are uninstalled by the operator
+// when their ArmadaChart goes away and are listed for information.
+type Planner struct {
+	Dynamic   dynamic.Interface
+	Clientset kubernetes.Interface
+	// PurgeNamespaces removes namespaces left without ArmadaCharts
+	PurgeNamespaces bool
+	// PurgeCRD removes the ArmadaChart CRD if no ArmadaCharts are left,
+	// APIExtensions has to be set for it
+	PurgeCRD      bool
+	APIExtensions apiextv1client.ApiextensionsV1Interface
+}
+
+// Prune returns actions removing ArmadaCharts matching the selector and
+// name prefix which are not kept, keep is keyed by namespace/name
+func (p *Planner) Prune(ctx context.Context, selector, namePrefix string, keep map[string]bool, reason string) ([]Action, error) {
+	list, err := p.Dynamic.Resource(chartGVR).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var remove []unstructured.Unstructured
+	for _, item := range list.Items {
+		if strings.HasPrefix(item.GetName(), namePrefix) && !keep[item.GetNamespace()+"/"+item.GetName()] {
+			remove = append(remove, item)
+		}
+	}
+	return p.plan(ctx, remove, reason)
+}
+
+// Delete returns actions removing the given ArmadaCharts, charts which
+// don't exist are skipped
+func (p *Planner) Delete(ctx context.Context, charts []*armadav1.ArmadaChart, reason string) ([]Action, error) {
+	var remove []unstructured.Unstructured
+	for _, chart := range charts {
+		obj, err := p.Dynamic.Resource(chartGVR).Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		remove = append(remove, *obj)
+	}
+	return p.plan(ctx, remove, reason)
+}
+
+func (p *Planner) plan(ctx context.Context, remove []unstructured.Unstructured, reason string) ([]Action, error) {
+	var actions []Action
+	removed := map[string]int{}
+	for _, obj := range remove {
+		actions = append(actions, Action{Kind: KindArmadaChart, Namespace: obj.GetNamespace(), Name: obj.GetName(), Reason: reason})
+		removed[obj.GetNamespace()]++
+
+		release, _, _ := unstructured.NestedString(obj.Object, "data", "release")
+		namespace, _, _ := unstructured.NestedString(obj.Object, "data", "namespace")
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+		if release == "" {
+			continue
+		}
+		revisions, err := helm.ListReleases(ctx, p.Clientset, namespace, release)
+		if err != nil {
+			return nil, err
+		}
+		if len(revisions) > 0 {
+			last := revisions[len(revisions)-1]
+			actions = append(actions, Action{Kind: KindHelmRelease, Namespace: namespace, Name: release,
+				Reason: fmt.Sprintf("revision %d of chart %s, uninstalled with ArmadaChart %s/%s",
+					last.Version, last.ChartMetadata().Name, obj.GetNamespace(), obj.GetName())})
+		}
+	}
+
+	if p.PurgeNamespaces {
+		for ns, n := range removed {
+			list, err := p.Dynamic.Resource(chartGVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			if len(list.Items) > n {
+				continue
+			}
+			actions = append(actions, Action{Kind: KindNamespace, Name: ns, Reason: "no ArmadaCharts left"})
+		}
+	}
+
+	if p.PurgeCRD {
+		list, err := p.Dynamic.Resource(chartGVR).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if len(list.Items) <= len(remove) {
+			actions = append(actions, Action{Kind: KindCRD, Name: crd.Name, Reason: "no ArmadaCharts left"})
+		}
+	}
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].Namespace != actions[j].Namespace {
+			return actions[i].Namespace < actions[j].Namespace
+		}
+		return actions[i].Name < actions[j].Name
+	})
+	return actions, nil
+}
+
+// Execute deletes the ArmadaCharts and namespaces of the actions
+func (p *Planner) Execute(ctx context.Context, actions []Action) error {
+	for _, a := range actions {
+		var err error
+		switch a.Kind {
+		case KindArmadaChart:
+			err = p.Dynamic.Resource(chartGVR).Namespace(a.Namespace).Delete(ctx, a.Name, metav1.DeleteOptions{})
+		case KindNamespace:
+			err = p.Clientset.CoreV1().Namespaces().Delete(ctx, a.Name, metav1.DeleteOptions{})
+		case KindCRD:
+			err = p.APIExtensions.CustomResourceDefinitions().Delete(ctx, a.Name, metav1.DeleteOptions{})
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete %s %s: %w", a.Kind, a.Name, err)
+		}
+	}
+	return nil
+}
+
+// WaitDeleted polls until the ArmadaCharts of the actions are gone, that is
+// their finalizers have uninstalled the Helm releases
+func (p *Planner) WaitDeleted(ctx context.Context, actions []Action, timeout time.Duration) error {
+	var pending []string
+	err := k8swait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		pending = pending[:0]
+		for _, a := range actions {
+			if a.Kind != KindArmadaChart {
+				continue
+			}
+			obj, err := p.Dynamic.Resource(chartGVR).Namespace(a.Namespace).Get(ctx, a.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			pending = append(pending, fmt.Sprintf("%s/%s (finalizers %s)", a.Namespace, a.Name,
+				strings.Join(obj.GetFinalizers(), ",")))
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil && len(pending) > 0 {
+		return fmt.Errorf("ArmadaCharts still present after %s: %s: %w", timeout, strings.Join(pending, ", "), err)
+	}
+	return err
+}
+
+// Print writes the actions as a table, dryRun marks them as not performed
+func Print(w io.Writer, actions []Action, dryRun bool) error {
+	verb := "deleted"
+	if dryRun {
+		verb = "would be deleted"
+	}
+	if len(actions) == 0 {
+		_, err := fmt.Fprintf(w, "nothing %s\n", verb)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tREASON")
+	for _, a := range actions {
+		ns := a.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", a.Kind, ns, a.Name, a.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d objects %s\n", len(actions), verb)
+	return err
+}
@@ -0,0 +1,67 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package prune
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// chart returns an ArmadaChart of the release with the labels
+func chart(namespace, name, release string, lbls map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": chartGVR.GroupVersion().String(),
+		"kind":       "ArmadaChart",
+		"data":       map[string]interface{}{"release": release, "namespace": namespace},
+	}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(lbls)
+	return obj
+}
+
+func TestPrune(t *testing.T) {
+	owned := map[string]string{"app.kubernetes.io/managed-by": "armada-go", "armada.airshipit.org/manifest": "site"}
+	other := map[string]string{"app.kubernetes.io/managed-by": "armada-go", "armada.airshipit.org/manifest": "other"}
+	p := &Planner{
+		Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{chartGVR: "ArmadaChartList"},
+			chart("openstack", "airship-keystone", "keystone", owned),
+			chart("openstack", "airship-glance", "glance", owned),
+			chart("openstack", "glance", "glance", owned),
+			chart("openstack", "airship-horizon", "horizon", other),
+			chart("openstack", "airship-heat", "heat", nil),
+		),
+		Clientset: fake.NewClientset(),
+	}
+	keep := map[string]bool{"openstack/airship-keystone": true}
+	actions, err := p.Prune(context.Background(), "app.kubernetes.io/managed-by=armada-go,"+
+		"armada.airshipit.org/manifest=site", "airship-", keep, "not in manifest site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Action{{Kind: KindArmadaChart, Namespace: "openstack", Name: "airship-glance",
+		Reason: "not in manifest site"}}
+	if !slices.Equal(actions, want) {
+		t.Errorf("got actions %v, want only the chart of the manifest and prefix it no longer has %v", actions, want)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package regroup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/transcript"
+)
+
+// RunCommand phase run command
+type RunCommand struct {
+	Manifests      string
+	TargetManifest string
+	// Transcripts are apply transcripts the chart timings are taken from,
+	// the timings of several transcripts are averaged
+	Transcripts []string
+	Out         io.Writer
+}
+
+// Suggestion is the proposed layout of a single chart group
+type Suggestion struct {
+	Group     string
+	Sequenced bool
+	// Current is the estimated duration of the group as it is now
+	Current time.Duration
+	// Stages are charts which may be installed in parallel, stages are
+	// installed one after another
+	Stages    [][]string
+	Suggested time.Duration
+	// Unknown lists charts without timings, they count as zero
+	Unknown []string
+	// Notes explain the suggestion or problems of the group
+	Notes []string
+}
+
+// Saving is the estimated time saved by the suggestion
+func (s *Suggestion) Saving() time.Duration {
+	return s.Current - s.Suggested
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	parser := &apply.RunCommand{Manifests: c.Manifests, TargetManifest: c.TargetManifest, Out: io.Discard}
+	if err := parser.ParseManifests(); err != nil {
+		return err
+	}
+	timings, err := readTimings(c.Transcripts)
+	if err != nil {
+		return err
+	}
+	return Print(c.Out, Suggest(parser, timings))
+}
+
+// readTimings averages the chart durations recorded in the transcripts
+func readTimings(paths []string) (map[string]time.Duration, error) {
+	sums := map[string]time.Duration{}
+	counts := map[string]int{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		durations, err := transcript.ChartDurations(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("transcript %s: %w", path, err)
+		}
+		for chart, d := range durations {
+			sums[chart] += d
+			counts[chart]++
+		}
+	}
+	timings := make(map[string]time.Duration, len(sums))
+	for chart, sum := range sums {
+		timings[chart] = sum / time.Duration(counts[chart])
+	}
+	return timings, nil
+}
+
+// Suggest proposes a layout for every chart group of the parsed manifest.
+// Charts of a group only have to wait for the charts of the same group they
+// declare as dependencies, earlier groups are complete by the time a group
+// starts. Timings are keyed by ArmadaChart name, as recorded in transcripts.
+func Suggest(parser *apply.RunCommand, timings map[string]time.Duration) []*Suggestion {
+	m := parser.Manifest()
+	var res []*Suggestion
+	for _, cgName := range m.ChartGroups {
+		cg := parser.ChartGroup(cgName)
+		s := &Suggestion{Group: cgName, Sequenced: cg.IsSequenced(m.ChartGroupDefaults)}
+
+		durations := map[string]time.Duration{}
+		for _, cName := range cg.ChartGroup {
+			d, known := chartDuration(parser, cName, timings)
+			if !known {
+				s.Unknown = append(s.Unknown, cName)
+			}
+			durations[cName] = d
+		}
+
+		s.Current = estimate(currentStages(cg.ChartGroup, s.Sequenced), durations)
+		stages, err := parser.DependencyWaves(cg.ChartGroup)
+		if err != nil {
+			s.Stages = currentStages(cg.ChartGroup, s.Sequenced)
+			s.Suggested = s.Current
+			s.Notes = append(s.Notes, err.Error()+", keeping the group as it is")
+			res = append(res, s)
+			continue
+		}
+		s.Stages = stages
+		s.Suggested = estimate(stages, durations)
+
+		switch {
+		case !s.Sequenced && len(stages) > 1:
+			// apply already starts charts of parallel groups once their dependencies are ready
+			s.Current = s.Suggested
+		case s.Sequenced && len(stages) == 1 && len(cg.ChartGroup) > 1:
+			s.Notes = append(s.Notes, "no chart depends on another chart of the group, set sequenced: false")
+		case s.Sequenced && len(stages) < len(cg.ChartGroup):
+			s.Notes = append(s.Notes, fmt.Sprintf("set sequenced: false, charts start once their dependencies "+
+				"are ready, in %d waves at most", len(stages)))
+		default:
+			s.Stages = currentStages(cg.ChartGroup, s.Sequenced)
+			s.Suggested = s.Current
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// chartDuration is the time all ArmadaCharts of the chart took, fanned out
+// charts are installed one after another
+func chartDuration(parser *apply.RunCommand, cName string, timings map[string]time.Duration) (time.Duration, bool) {
+	var total time.Duration
+	known := true
+	for _, chart := range parser.ConvertCharts(parser.Chart(cName)) {
+		d, ok := timings[chart.Name]
+		known = known && ok
+		total += d
+	}
+	return total, known
+}
+
+func currentStages(charts []string, sequenced bool) [][]string {
+	if !sequenced {
+		return [][]string{append([]string{}, charts...)}
+	}
+	stages := make([][]string, 0, len(charts))
+	for _, cName := range charts {
+		stages = append(stages, []string{cName})
+	}
+	return stages
+}
+
+// estimate is the duration of stages installed one after another, charts of
+// a stage in parallel
+func estimate(stages [][]string, durations map[string]time.Duration) time.Duration {
+	var total time.Duration
+	for _, stage := range stages {
+		var longest time.Duration
+		for _, cName := range stage {
+			longest = max(longest, durations[cName])
+		}
+		total += longest
+	}
+	return total
+}
+
+// Print writes the suggestions as a table followed by the proposed stages of
+// every group which can be improved
+func Print(out io.Writer, suggestions []*Suggestion) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "GROUP\tSEQUENCED\tCURRENT\tSUGGESTED\tSAVING")
+	var current, suggested time.Duration
+	for _, s := range suggestions {
+		current += s.Current
+		suggested += s.Suggested
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\n", s.Group, s.Sequenced, s.Current.Round(time.Second),
+			s.Suggested.Round(time.Second), s.Saving().Round(time.Second))
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%s\t%s\t%s\n", current.Round(time.Second), suggested.Round(time.Second),
+		(current - suggested).Round(time.Second))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, s := range suggestions {
+		if len(s.Notes) == 0 && len(s.Unknown) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\n%s:\n", s.Group)
+		for _, note := range s.Notes {
+			fmt.Fprintf(out, "  %s\n", note)
+		}
+		if len(s.Notes) > 0 && len(s.Stages) > 1 {
+			for i, stage := range s.Stages {
+				fmt.Fprintf(out, "  %d. %s\n", i+1, strings.Join(stage, ", "))
+			}
+		}
+		if len(s.Unknown) > 0 {
+			fmt.Fprintf(out, "  no timings for %s\n", strings.Join(s.Unknown, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/helm"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Output formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// Release is an ArmadaChart together with the newest revision of its Helm
+// release, the Helm fields are empty if the release wasn't installed yet
+type Release struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Release      string            `json:"release"`
+	Chart        string            `json:"chart,omitempty"`
+	Version      string            `json:"version,omitempty"`
+	AppVersion   string            `json:"app_version,omitempty"`
+	Revision     int               `json:"revision,omitempty"`
+	Status       string            `json:"status,omitempty"`
+	LastDeployed *time.Time        `json:"last_deployed,omitempty"`
+	Ready        bool              `json:"ready"`
+	Reason       string            `json:"reason,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// List returns the ArmadaCharts of the namespace, or of all namespaces if it
+// is empty, matching the label selector, sorted by namespace and name
+func List(ctx context.Context, restConfig *rest.Config, namespace, selector string) ([]Release, error) {
+	resClient := dynamic.NewForConfigOrDie(restConfig).Resource(schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	})
+	charts, err := resClient.Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	helmReleases, err := helm.LatestReleases(ctx, kubernetes.NewForConfigOrDie(restConfig), namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Release, 0, len(charts.Items))
+	for i := range charts.Items {
+		chart := &charts.Items[i]
+		r := Release{Name: chart.GetName(), Namespace: chart.GetNamespace(), Labels: chart.GetLabels()}
+		r.Release, _, _ = unstructured.NestedString(chart.Object, "data", "release")
+		r.Chart, _, _ = unstructured.NestedString(chart.Object, "data", "chart_name")
+		r.Ready, r.Reason = armadawait.IsReady(chart)
+		if hr, ok := helmReleases[r.Namespace+"/"+r.Release]; ok {
+			md := hr.ChartMetadata()
+			if md.Name != "" {
+				r.Chart = md.Name
+			}
+			r.Version, r.AppVersion, r.Revision = md.Version, md.AppVersion, hr.Version
+			if hr.Info != nil {
+				r.Status = hr.Info.Status
+				if !hr.Info.LastDeployed.IsZero() {
+					r.LastDeployed = &hr.Info.LastDeployed
+				}
+			}
+		}
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Namespace != res[j].Namespace {
+			return res[i].Namespace < res[j].Namespace
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+// Find returns the ArmadaChart of the namespace, or the only one with the
+// name in any namespace if namespace is empty
+func Find(ctx context.Context, resClient dynamic.NamespaceableResourceInterface,
+	name, namespace string) (*unstructured.Unstructured, error) {
+	if namespace != "" {
+		return resClient.Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+
+	list, err := resClient.List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch len(list.Items) {
+	case 0:
+		return nil, fmt.Errorf("armadachart %s not found", name)
+	case 1:
+		return &list.Items[0], nil
+	default:
+		return nil, fmt.Errorf("armadachart %s found in multiple namespaces, namespace must be specified", name)
+	}
+}
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory       config.Factory
+	Namespace     string
+	LabelSelector string
+	// Format is table or json
+	Format     string
+	ShowLabels bool
+	Out        io.Writer
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	if c.Format == "" {
+		c.Format = FormatTable
+	}
+	if c.Format != FormatTable && c.Format != FormatJSON {
+		return fmt.Errorf("unknown output format %q, expected %s or %s", c.Format, FormatTable, FormatJSON)
+	}
+	cfg, err := config.Resolve(c.Factory)
+	if err != nil {
+		return err
+	}
+	restConfig, err := cfg.Kubernetes.RestConfig()
+	if err != nil {
+		return err
+	}
+	releases, err := List(context.Background(), restConfig, c.Namespace, c.LabelSelector)
+	if err != nil {
+		return err
+	}
+	if c.Format == FormatJSON {
+		enc := json.NewEncoder(c.Out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(releases)
+	}
+	return c.print(releases)
+}
+
+func (c *RunCommand) print(releases []Release) error {
+	tw := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	header := "NAMESPACE\tNAME\tRELEASE\tCHART\tVERSION\tREVISION\tSTATUS\tREADY\tLAST DEPLOYED"
+	if c.ShowLabels {
+		header += "\tLABELS"
+	}
+	_, _ = fmt.Fprintln(tw, header)
+	for _, r := range releases {
+		deployed := "-"
+		if r.LastDeployed != nil {
+			deployed = r.LastDeployed.Local().Format(time.RFC3339)
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%d\t%s\t%v\t%s", r.Namespace, r.Name, r.Release,
+			orDash(r.Chart), orDash(r.Version), r.Revision, orDash(r.Status), r.Ready, deployed)
+		if c.ShowLabels {
+			pairs := make([]string, 0, len(r.Labels))
+			for k, v := range r.Labels {
+				pairs = append(pairs, k+"="+v)
+			}
+			sort.Strings(pairs)
+			line += "\t" + strings.Join(pairs, ",")
+		}
+		_, _ = fmt.Fprintln(tw, line)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory        config.Factory
+	Manifests      string
+	TargetManifest string
+	// OutputDir receives one file per ArmadaChart, <namespace>/<name>.yaml,
+	// the charts are written to Out as a multi document stream if empty
+	OutputDir string
+	// IncludeCRD adds the ArmadaChart CRD apply would create
+	IncludeCRD bool
+	CRDPath    string
+	Out        io.Writer
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	parser := &apply.RunCommand{Factory: c.Factory, Manifests: c.Manifests, TargetManifest: c.TargetManifest,
+		CRDPath: c.CRDPath, Out: io.Discard}
+	if err := parser.LoadConfig(); err != nil {
+		return err
+	}
+	if err := parser.ParseManifests(); err != nil {
+		return err
+	}
+
+	var objs []*unstructured.Unstructured
+	if c.IncludeCRD {
+		crd, err := parser.ReadCRD()
+		if err != nil {
+			return err
+		}
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, &unstructured.Unstructured{Object: obj})
+	}
+	for _, chart := range parser.Charts() {
+		obj, err := apply.Render(chart)
+		if err != nil {
+			return fmt.Errorf("unable to render chart %s: %w", chart.Name, err)
+		}
+		objs = append(objs, obj)
+	}
+
+	for _, obj := range objs {
+		// fields of the API server, not of the desired state
+		unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(obj.Object, "status")
+	}
+	if c.OutputDir != "" {
+		return c.writeDir(objs)
+	}
+	for _, obj := range objs {
+		if err := write(c.Out, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDir writes every object to its own file, cluster scoped objects are
+// kept at the top of OutputDir
+func (c *RunCommand) writeDir(objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
+		dir := filepath.Join(c.OutputDir, obj.GetNamespace())
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, obj.GetName()+".yaml")
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = write(f, obj)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("wrote %s %s", obj.GetKind(), path)
+	}
+	return nil
+}
+
+func write(w io.Writer, obj *unstructured.Unstructured) error {
+	buf, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "---\n%s", buf)
+	return err
+}
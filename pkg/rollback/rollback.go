@@ -0,0 +1,171 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package rollback
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/helm"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/releases"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory config.Factory
+	// Release is the name of the ArmadaChart managing the Helm release
+	Release   string
+	Namespace string
+	// Version is the Helm revision to roll back to, 0 means the previous one
+	Version int
+	Wait    bool
+	// Timeout overrides the wait timeout of the chart
+	Timeout time.Duration
+	Out     io.Writer
+	// Log receives messages instead of the global logger, if set
+	Log *log.Logger
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	return c.RunContext(context.Background())
+}
+
+// RunContext runs the phase with the config and logger carried by ctx, the
+// Factory takes precedence over the config of ctx
+func (c *RunCommand) RunContext(ctx context.Context) error {
+	logger := c.Log
+	if logger == nil {
+		logger = log.FromContext(ctx, log.Default())
+	}
+	logger.Printf("armada-go rollback, release %s, version %d", c.Release, c.Version)
+
+	cfg := config.FromContext(ctx)
+	if c.Factory != nil || cfg == nil {
+		var err error
+		if cfg, err = config.Resolve(c.Factory); err != nil {
+			return err
+		}
+	}
+	k8sConfig, err := cfg.Kubernetes.RestConfig()
+	if err != nil {
+		return err
+	}
+
+	resClient := dynamic.NewForConfigOrDie(k8sConfig).Resource(schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	})
+
+	chart, err := releases.Find(ctx, resClient, c.Release, c.Namespace)
+	if err != nil {
+		return err
+	}
+
+	helmRelease, _, _ := unstructured.NestedString(chart.Object, "data", "release")
+	releases, err := helm.ListReleases(ctx, kubernetes.NewForConfigOrDie(k8sConfig),
+		chart.GetNamespace(), helmRelease)
+	if err != nil {
+		return err
+	}
+	target, err := c.targetRevision(releases)
+	if err != nil {
+		return fmt.Errorf("release %s: %w", helmRelease, err)
+	}
+
+	// the source of the chart isn't recorded in the release, it can't be
+	// restored along with the values
+	current := releases[len(releases)-1].ChartMetadata()
+	if md := target.ChartMetadata(); md.Name != current.Name || md.Version != current.Version {
+		return fmt.Errorf("release %s: revision %d was deployed with chart %s-%s while chart %s-%s is currently "+
+			"referenced, roll back data.source in the manifest and apply it instead", helmRelease,
+			target.Version, md.Name, md.Version, current.Name, current.Version)
+	}
+
+	if len(target.Config) == 0 {
+		unstructured.RemoveNestedField(chart.Object, "data", "values")
+	} else if err = unstructured.SetNestedField(chart.Object, target.Config, "data", "values"); err != nil {
+		return err
+	}
+
+	if err = apply.RecordApplied(chart); err != nil {
+		return err
+	}
+
+	logger.Printf("rolling back chart %s/%s to revision %d", chart.GetNamespace(), chart.GetName(), target.Version)
+	if _, err = resClient.Namespace(chart.GetNamespace()).Update(
+		ctx, chart, metav1.UpdateOptions{FieldManager: apply.FieldManager}); err != nil {
+		return err
+	}
+
+	if !c.Wait {
+		return nil
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		seconds, _, _ := unstructured.NestedInt64(chart.Object, "data", "wait", "timeout")
+		timeout = time.Second * time.Duration(seconds)
+	}
+	wOpts := armadawait.WaitOptions{
+		RestConfig:       k8sConfig,
+		Namespace:        chart.GetNamespace(),
+		LabelSelector:    labels.SelectorFromSet(chart.GetLabels()).String(),
+		ResourceType:     armadawait.ArmadaCharts,
+		Timeout:          timeout,
+		OperatorTimeout:  cfg.Wait.OperatorTimeout,
+		ProgressInterval: cfg.Wait.ProgressInterval,
+		Logger:           log.New(c.Out).With("release", c.Release).Logr(),
+	}
+	if _, err = wOpts.Wait(ctx); err != nil {
+		return err
+	}
+	logger.Printf("rollback of %s complete", c.Release)
+	return nil
+}
+
+func (c *RunCommand) targetRevision(releases []*helm.Release) (*helm.Release, error) {
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no revisions found")
+	}
+	version := c.Version
+	if version == 0 {
+		if len(releases) < 2 {
+			return nil, fmt.Errorf("no previous revision to roll back to")
+		}
+		version = releases[len(releases)-2].Version
+	}
+	for _, rel := range releases {
+		if rel.Version == version {
+			return rel, nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d not found", version)
+}
@@ -0,0 +1,151 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package schema describes the Armada document schemas, e.g.
+// armada/Chart/v1, and detects the schema of YAML documents
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Namespace is the schema namespace of Armada documents
+const Namespace = "armada"
+
+// Kind is the type of an Armada document
+type Kind string
+
+const (
+	KindChart      Kind = "Chart"
+	KindChartGroup Kind = "ChartGroup"
+	KindManifest   Kind = "Manifest"
+)
+
+// Schema versions
+const (
+	V1 = "v1"
+	V2 = "v2"
+)
+
+// Schemas of Armada documents
+const (
+	ChartV1      = "armada/Chart/v1"
+	ChartV2      = "armada/Chart/v2"
+	ChartGroupV1 = "armada/ChartGroup/v1"
+	ChartGroupV2 = "armada/ChartGroup/v2"
+	ManifestV1   = "armada/Manifest/v1"
+	ManifestV2   = "armada/Manifest/v2"
+)
+
+// Versions lists the known versions of every kind, oldest first
+var Versions = map[Kind][]string{
+	KindChart:      {V1, V2},
+	KindChartGroup: {V1, V2},
+	KindManifest:   {V1, V2},
+}
+
+// Schema is a parsed document schema like armada/Chart/v1
+type Schema struct {
+	Namespace string
+	Kind      Kind
+	Version   string
+}
+
+// Parse splits a schema string, it fails for schemas of other namespaces
+// and unknown kinds or versions
+func Parse(s string) (Schema, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return Schema{}, fmt.Errorf("invalid schema %q, expected namespace/kind/version", s)
+	}
+	sch := Schema{Namespace: parts[0], Kind: Kind(parts[1]), Version: parts[2]}
+	if sch.Namespace != Namespace {
+		return Schema{}, fmt.Errorf("schema %q is not an armada schema", s)
+	}
+	versions, ok := Versions[sch.Kind]
+	if !ok {
+		return Schema{}, fmt.Errorf("unknown armada document kind %q", parts[1])
+	}
+	for _, v := range versions {
+		if v == sch.Version {
+			return sch, nil
+		}
+	}
+	return Schema{}, fmt.Errorf("unknown version %q of armada/%s", sch.Version, sch.Kind)
+}
+
+// String returns the schema in namespace/kind/version form
+func (s Schema) String() string {
+	return s.Namespace + "/" + string(s.Kind) + "/" + s.Version
+}
+
+// IsArmada returns whether the schema string belongs to an Armada document
+func IsArmada(s string) bool {
+	return strings.HasPrefix(s, Namespace+"/")
+}
+
+// Header is the part common to all documents
+type Header struct {
+	Schema   string `json:"schema,omitempty"`
+	Metadata struct {
+		Name   string `json:"name,omitempty"`
+		Schema string `json:"schema,omitempty"`
+	} `json:"metadata,omitempty"`
+}
+
+// Detect returns the schema and name of a YAML document. Documents which
+// are not Armada documents, like Deckhand control documents, are reported
+// with ok set to false.
+func Detect(buf []byte) (sch Schema, name string, ok bool, err error) {
+	var h Header
+	if err = yaml.Unmarshal(buf, &h); err != nil {
+		return Schema{}, "", false, err
+	}
+	if !IsArmada(h.Schema) {
+		return Schema{}, h.Metadata.Name, false, nil
+	}
+	sch, err = Parse(h.Schema)
+	if err != nil {
+		return Schema{}, h.Metadata.Name, false, err
+	}
+	return sch, h.Metadata.Name, true, nil
+}
+
+// Negotiate picks the version used to read a document of the schema from
+// the versions supported by the reader: the document version if supported,
+// otherwise an error telling which versions are accepted
+func Negotiate(sch Schema, supported ...string) (string, error) {
+	for _, v := range supported {
+		if v == sch.Version {
+			return v, nil
+		}
+	}
+	accepted := make([]string, 0, len(supported))
+	for _, v := range supported {
+		accepted = append(accepted, Schema{Namespace: sch.Namespace, Kind: sch.Kind, Version: v}.String())
+	}
+	return "", fmt.Errorf("%s is not supported, expected %s", sch, strings.Join(accepted, " or "))
+}
+
+// Latest returns the newest known version of the kind
+func Latest(kind Kind) string {
+	versions := Versions[kind]
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
@@ -0,0 +1,243 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// Audit record formats
+const (
+	AuditFormatJSON = "json"
+	AuditFormatCADF = "cadf"
+)
+
+// maxAuditBody is how much of a request body is read to find the manifest href
+const maxAuditBody = 1 << 20
+
+// AuditRecord describes who invoked which endpoint and the outcome
+type AuditRecord struct {
+	Time           time.Time         `json:"time"`
+	RequestID      string            `json:"request_id,omitempty"`
+	User           string            `json:"user,omitempty"`
+	UserID         string            `json:"user_id,omitempty"`
+	Project        string            `json:"project,omitempty"`
+	ProjectID      string            `json:"project_id,omitempty"`
+	Roles          string            `json:"roles,omitempty"`
+	IdentityStatus string            `json:"identity_status,omitempty"`
+	ClientIP       string            `json:"client_ip,omitempty"`
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Endpoint       string            `json:"endpoint,omitempty"`
+	Params         map[string]string `json:"params,omitempty"`
+	Href           string            `json:"href,omitempty"`
+	TargetManifest string            `json:"target_manifest,omitempty"`
+	Status         int               `json:"status"`
+	Outcome        string            `json:"outcome"`
+	Duration       string            `json:"duration"`
+}
+
+// cadf returns the record as a CADF event
+func (r *AuditRecord) cadf() gin.H {
+	action := map[string]string{
+		http.MethodGet: "read", http.MethodHead: "read", http.MethodPost: "create",
+		http.MethodPut: "update", http.MethodPatch: "update", http.MethodDelete: "delete",
+	}[r.Method]
+	if action == "" {
+		action = "unknown"
+	}
+	event := gin.H{
+		"typeURI":   "http://schemas.dmtf.org/cloud/audit/1.0/event",
+		"id":        newID(),
+		"eventType": "activity",
+		"eventTime": r.Time.UTC().Format(time.RFC3339Nano),
+		"action":    action,
+		"outcome":   r.Outcome,
+		"initiator": gin.H{
+			"typeURI":    "service/security/account/user",
+			"id":         r.UserID,
+			"name":       r.User,
+			"project_id": r.ProjectID,
+			"host":       gin.H{"address": r.ClientIP},
+			"credential": gin.H{"identity_status": r.IdentityStatus, "roles": r.Roles},
+		},
+		"target": gin.H{
+			"typeURI": "service/armada" + r.Endpoint,
+			"id":      r.Path,
+		},
+		"observer":    gin.H{"typeURI": "service/armada", "id": "target"},
+		"reason":      gin.H{"reasonType": "HTTP", "reasonCode": fmt.Sprint(r.Status)},
+		"requestPath": r.Path,
+	}
+	var attachments []gin.H
+	if r.RequestID != "" {
+		attachments = append(attachments, gin.H{"name": "request_id", "typeURI": "mime:text/plain", "content": r.RequestID})
+	}
+	if r.Href != "" {
+		attachments = append(attachments, gin.H{"name": "manifest_href", "typeURI": "mime:text/plain", "content": r.Href})
+	}
+	if r.TargetManifest != "" {
+		attachments = append(attachments, gin.H{"name": "target_manifest", "typeURI": "mime:text/plain", "content": r.TargetManifest})
+	}
+	if len(attachments) > 0 {
+		event["attachments"] = attachments
+	}
+	return event
+}
+
+// auditLog writes audit records to a file and syslog
+type auditLog struct {
+	format string
+	syslog *SyslogWriter
+
+	mu   sync.Mutex
+	file io.WriteCloser
+}
+
+// newAuditFromConfig creates the audit log from the [audit] section of
+// armada.conf, it returns nil if no destination is configured:
+//
+//	[audit]
+//	file = /var/log/armada/audit.log
+//	format = cadf
+//	syslog = true
+func newAuditFromConfig(cfg config.AuditConfig, syslogWriter *SyslogWriter) (*auditLog, error) {
+	a := &auditLog{format: cfg.Format}
+	switch a.format {
+	case "":
+		a.format = AuditFormatJSON
+	case AuditFormatJSON, AuditFormatCADF:
+	default:
+		return nil, fmt.Errorf("unknown audit.format %q, expected %s or %s", a.format, AuditFormatJSON, AuditFormatCADF)
+	}
+	if path := cfg.File; path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		a.file = f
+	}
+	if cfg.Syslog {
+		if syslogWriter == nil {
+			return nil, fmt.Errorf("audit.syslog requires syslog.enabled")
+		}
+		a.syslog = syslogWriter
+	}
+	if a.file == nil && a.syslog == nil {
+		return nil, nil
+	}
+	return a, nil
+}
+
+func (a *auditLog) write(r *AuditRecord) {
+	var v any = r
+	if a.format == AuditFormatCADF {
+		v = r.cadf()
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("unable to encode audit record: %s", err.Error())
+		return
+	}
+	if a.file != nil {
+		a.mu.Lock()
+		_, err = a.file.Write(append(buf, '\n'))
+		a.mu.Unlock()
+		if err != nil {
+			log.Printf("unable to write audit record: %s", err.Error())
+		}
+	}
+	if a.syslog != nil {
+		if err = a.syslog.Send(severityInfo, "audit", string(buf)); err != nil {
+			log.Printf("unable to send audit record to syslog: %s", err.Error())
+		}
+	}
+}
+
+// Handler records every request once it has been served. It has to run
+// before the authtoken and policy filters to see rejected requests too.
+func (a *auditLog) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		href := peekHref(c)
+		c.Next()
+
+		r := &AuditRecord{
+			Time:           start,
+			RequestID:      c.GetString(requestIDKey),
+			User:           c.Request.Header.Get("X-User-Name"),
+			UserID:         c.Request.Header.Get("X-User-Id"),
+			Project:        c.Request.Header.Get("X-Project-Name"),
+			ProjectID:      c.Request.Header.Get("X-Project-Id"),
+			Roles:          c.Request.Header.Get("X-Roles"),
+			IdentityStatus: c.Request.Header.Get("X-Identity-Status"),
+			ClientIP:       c.ClientIP(),
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.Path,
+			Endpoint:       c.FullPath(),
+			Href:           href,
+			TargetManifest: c.Query("target_manifest"),
+			Status:         c.Writer.Status(),
+			Duration:       time.Since(start).String(),
+		}
+		if len(c.Params) > 0 {
+			r.Params = map[string]string{}
+			for _, p := range c.Params {
+				r.Params[p.Key] = p.Value
+			}
+		}
+		switch {
+		case r.Status == http.StatusAccepted:
+			r.Outcome = "pending"
+		case r.Status < 400:
+			r.Outcome = "success"
+		default:
+			r.Outcome = "failure"
+		}
+		a.write(r)
+	}
+}
+
+// peekHref returns the manifest href of JSON request bodies, the body is
+// restored for the handler
+func peekHref(c *gin.Context) string {
+	if c.Request.Body == nil || c.ContentType() != "application/json" {
+		return ""
+	}
+	buf, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(buf), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+	var req struct {
+		Href string `json:"hrefs"`
+	}
+	if json.Unmarshal(buf, &req) != nil {
+		return ""
+	}
+	return req.Href
+}
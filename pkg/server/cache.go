@@ -0,0 +1,157 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriter compresses the body, the gzip stream is only started once
+// something is written so empty responses stay empty
+type gzipWriter struct {
+	gin.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.gz == nil {
+		h := w.ResponseWriter.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Compress gzips responses for clients sending Accept-Encoding: gzip
+func Compress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+		w := &gzipWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		// errors are rendered by ErrorHandler after the stream is closed
+		c.Writer = w.ResponseWriter
+		if w.gz != nil {
+			_ = w.gz.Close()
+		}
+	}
+}
+
+func acceptsGzip(header string) bool {
+	for _, enc := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferWriter keeps the response in memory until the handler is done
+type bufferWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferWriter) WriteHeaderNow() {}
+
+func (w *bufferWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// ETag tags successful GET responses with a hash of the body and answers
+// 304 Not Modified when the client already has the current version. The tag
+// is weak as the gzip and identity encodings of the body share it.
+func ETag() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		orig := c.Writer
+		w := &bufferWriter{ResponseWriter: orig, status: http.StatusOK}
+		c.Writer = w
+		c.Next()
+		c.Writer = orig
+
+		if len(c.Errors) > 0 {
+			// Left to ErrorHandler
+			return
+		}
+		if w.status != http.StatusOK {
+			orig.WriteHeader(w.status)
+			_, _ = orig.Write(w.body.Bytes())
+			return
+		}
+		sum := sha256.Sum256(w.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		orig.Header().Set("ETag", "W/"+etag)
+		if etagMatch(c.GetHeader("If-None-Match"), etag) {
+			orig.WriteHeader(http.StatusNotModified)
+			orig.WriteHeaderNow()
+			return
+		}
+		orig.WriteHeader(http.StatusOK)
+		_, _ = orig.Write(w.body.Bytes())
+	}
+}
+
+// etagMatch compares the tags of If-None-Match weakly with the opaque tag
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
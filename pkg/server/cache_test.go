@@ -0,0 +1,54 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1.0/releases", Compress(), ETag(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"releases": gin.H{"openstack": []string{"keystone"}}})
+	})
+	get := func(encoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1.0/releases", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	identity, gzipped := get("identity", ""), get("gzip", "")
+	etag := identity.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("got ETag %q, want a weak one", etag)
+	}
+	if got := gzipped.Header().Get("ETag"); got != etag || gzipped.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("got gzip ETag %q, want %q", got, etag)
+	}
+	for _, encoding := range []string{"identity", "gzip"} {
+		if w := get(encoding, etag); w.Code != http.StatusNotModified {
+			t.Errorf("%s: got status %d for the current ETag, want %d", encoding, w.Code, http.StatusNotModified)
+		}
+	}
+}
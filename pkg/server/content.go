@@ -0,0 +1,97 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeYAML = "application/x-yaml"
+)
+
+// mediaTypeAliases are media types used for YAML besides application/x-yaml
+var mediaTypeAliases = map[string]string{
+	"application/yaml": mediaTypeYAML,
+	"text/yaml":        mediaTypeYAML,
+	"text/x-yaml":      mediaTypeYAML,
+}
+
+// bodyMediaType returns the media type of the request body if it is one of
+// accepted, parameters like charset=utf-8 are allowed as long as the body is
+// UTF-8. Other requests are answered with 415.
+func bodyMediaType(c *gin.Context, accepted ...string) (string, bool) {
+	header := c.GetHeader("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err == nil {
+		if alias, ok := mediaTypeAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") &&
+			!strings.EqualFold(charset, "utf8") {
+			abortWithError(c, http.StatusUnsupportedMediaType, "unsupported charset %q, request bodies have to be UTF-8",
+				charset)
+			return "", false
+		}
+		for _, t := range accepted {
+			if mediaType == t {
+				return mediaType, true
+			}
+		}
+	}
+	if header == "" {
+		abortWithError(c, http.StatusUnsupportedMediaType, "missing content type, expected %s",
+			strings.Join(accepted, " or "))
+		return "", false
+	}
+	abortWithError(c, http.StatusUnsupportedMediaType, "unsupported content type %q, expected %s", header,
+		strings.Join(accepted, " or "))
+	return "", false
+}
+
+// isManifestBody returns true if the request body carries manifest documents
+// to apply, other endpoints keep the smaller limit of api.max_body_size
+func isManifestBody(c *gin.Context) bool {
+	if c.Request.Method != http.MethodPost || c.FullPath() != "/api/v1.0/apply" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if alias, ok := mediaTypeAliases[mediaType]; ok {
+		mediaType = alias
+	}
+	return err == nil && mediaType == mediaTypeYAML
+}
+
+// checkHref answers 400 if the server can't read manifests from href
+func checkHref(c *gin.Context, href string) bool {
+	src, err := apply.NewDocumentSource(href, config.KeystoneConfig{})
+	if _, ok := src.(*apply.ReaderSource); ok {
+		err = errors.New("manifests can't be read from stdin of the server, send them in the request body")
+	}
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid request: %s", err.Error())
+		return false
+	}
+	return true
+}
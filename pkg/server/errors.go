@@ -0,0 +1,111 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// APIError is an error answered with the Airship error envelope
+type APIError struct {
+	Status  int
+	Message string
+	// Retry tells the client the request may succeed when sent again
+	Retry bool
+	// Extra fields added to the response, e.g. the apply log
+	Extra gin.H
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// envelope returns the error body in the format of the python Armada API
+func (e *APIError) envelope(requestID string) gin.H {
+	body := gin.H{
+		"kind":       "Status",
+		"apiVersion": "v1.0",
+		"metadata":   gin.H{},
+		"status":     "Failure",
+		"message":    e.Message,
+		"reason":     http.StatusText(e.Status),
+		"details": gin.H{
+			"errorType":   http.StatusText(e.Status),
+			"errorCount":  1,
+			"messageList": []gin.H{{"message": e.Message, "error": true}},
+		},
+		"code":  fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		"retry": e.Retry,
+	}
+	if requestID != "" {
+		body["request_id"] = requestID
+	}
+	for k, v := range e.Extra {
+		body[k] = v
+	}
+	return body
+}
+
+// abortWithError stops the request, the response is rendered by ErrorHandler
+func abortWithError(c *gin.Context, status int, format string, a ...any) {
+	_ = c.Error(&APIError{Status: status, Message: fmt.Sprintf(format, a...)})
+	c.Abort()
+}
+
+// ErrorHandler renders errors added by handlers with c.Error as the error
+// envelope, errors other than APIError are answered with 500
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = &APIError{Status: http.StatusInternalServerError, Message: err.Error()}
+		}
+		c.JSON(apiErr.Status, apiErr.envelope(c.GetString(requestIDKey)))
+	}
+}
+
+// Recovery answers requests whose handler panicked with a 500 error envelope
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, err any) {
+		log.Printf("panic serving %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		apiErr := &APIError{Status: http.StatusInternalServerError, Message: "internal server error"}
+		c.AbortWithStatusJSON(apiErr.Status, apiErr.envelope(c.GetString(requestIDKey)))
+	})
+}
+
+// NotFound answers requests for unknown endpoints
+func NotFound(c *gin.Context) {
+	abortWithError(c, http.StatusNotFound, "endpoint %s not found", c.Request.URL.Path)
+}
+
+// writeError writes the error envelope from plain http handlers
+func writeError(w http.ResponseWriter, status int, message string) {
+	buf, _ := json.Marshal((&APIError{Status: status, Message: message}).envelope(w.Header().Get(requestIDHeader)))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf)
+}
@@ -0,0 +1,233 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// maxFinishedJobs is the number of finished jobs kept in memory
+const maxFinishedJobs = 100
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is an apply running in background
+type Job struct {
+	ID             string
+	Status         JobStatus
+	Href           string
+	TargetManifest string
+	Started        time.Time
+	Finished       *time.Time
+	Error          string
+	Charts         map[string]apply.ChartState
+	Installed      []string
+	Updated        []string
+	Results        []apply.ChartResult
+
+	mu   sync.Mutex
+	logs bytes.Buffer
+}
+
+// Write appends p to the job logs
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.logs.Write(p)
+}
+
+// Logs returns logs captured so far
+func (j *Job) Logs() []byte {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return bytes.Clone(j.logs.Bytes())
+}
+
+func (j *Job) snapshot() gin.H {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	charts := make(map[string]apply.ChartState, len(j.Charts))
+	for k, v := range j.Charts {
+		charts[k] = v
+	}
+	return gin.H{
+		"id":              j.ID,
+		"status":          j.Status,
+		"href":            j.Href,
+		"target_manifest": j.TargetManifest,
+		"started":         j.Started,
+		"finished":        j.Finished,
+		"error":           j.Error,
+		"charts":          charts,
+		"install":         append([]string{}, j.Installed...),
+		"upgrade":         append([]string{}, j.Updated...),
+		"results":         append([]apply.ChartResult{}, j.Results...),
+	}
+}
+
+func (j *Job) run(ctx context.Context, runOpts *apply.RunCommand) {
+	installed := make([]string, 0)
+	updated := make([]string, 0)
+	runOpts.Out = j
+	runOpts.Log = log.New(j).With("job_id", j.ID)
+	runOpts.Installed = &installed
+	runOpts.Updated = &updated
+	runOpts.Progress = func(chart string, state apply.ChartState) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.Charts[chart] = state
+	}
+
+	err := runOpts.RunContext(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.Finished = &now
+	j.Installed = installed
+	j.Updated = updated
+	j.Results = runOpts.Results()
+	if err != nil {
+		log.Printf("apply job %s failed: %s", j.ID, err.Error())
+		j.Status = JobFailed
+		j.Error = err.Error()
+	} else {
+		log.Printf("apply job %s succeeded", j.ID)
+		j.Status = JobSucceeded
+	}
+}
+
+// jobStore holds the apply jobs started by a server
+type jobStore struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running sync.WaitGroup
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{jobs: map[string]*Job{}}
+}
+
+// start registers a new job and runs the apply in background with the config
+// carried by ctx
+func (s *jobStore) start(ctx context.Context, runOpts *apply.RunCommand) *Job {
+	job := &Job{
+		ID:             newID(),
+		Status:         JobRunning,
+		Href:           runOpts.Manifests,
+		TargetManifest: runOpts.TargetManifest,
+		Started:        time.Now(),
+		Charts:         map[string]apply.ChartState{},
+	}
+
+	s.mu.Lock()
+	s.prune()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	log.Printf("starting apply job %s for %s", job.ID, job.Href)
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		job.run(ctx, runOpts)
+	}()
+	return job
+}
+
+// wait blocks until all running jobs finish or ctx is done
+func (s *jobStore) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("apply jobs are still running: %w", ctx.Err())
+	}
+}
+
+func (s *jobStore) get(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// prune drops the oldest finished jobs above maxFinishedJobs, must be called with s.mu held
+func (s *jobStore) prune() {
+	var finished []*Job
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		if job.Finished != nil {
+			finished = append(finished, job)
+		}
+		job.mu.Unlock()
+	}
+	if len(finished) < maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Finished.Before(*finished[j].Finished) })
+	for _, job := range finished[:len(finished)-maxFinishedJobs+1] {
+		delete(s.jobs, job.ID)
+	}
+}
+
+// GetJob returns the status of an apply job
+func (s *jobStore) GetJob(c *gin.Context) {
+	if c.GetHeader("X-Identity-Status") == "Confirmed" {
+		job, ok := s.get(c.Param("id"))
+		if !ok {
+			abortWithError(c, http.StatusNotFound, "job %s not found", c.Param("id"))
+			return
+		}
+		c.JSON(200, job.snapshot())
+	} else {
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+	}
+}
+
+// GetJobLogs returns the logs of an apply job captured so far
+func (s *jobStore) GetJobLogs(c *gin.Context) {
+	if c.GetHeader("X-Identity-Status") == "Confirmed" {
+		job, ok := s.get(c.Param("id"))
+		if !ok {
+			abortWithError(c, http.StatusNotFound, "job %s not found", c.Param("id"))
+			return
+		}
+		c.Data(200, "text/plain; charset=utf-8", job.Logs())
+	} else {
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+	}
+}
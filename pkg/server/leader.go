@@ -0,0 +1,193 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// DefaultLeaseName is the Lease the server replicas are elected through
+const DefaultLeaseName = "armada-go-server"
+
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// forwardedHeader marks requests forwarded to the leader, so replicas
+// disagreeing about the leader don't forward them in circles
+const forwardedHeader = "X-Armada-Forwarded-By"
+
+// elector takes part in the leader election of the server replicas, only
+// the leader runs applies
+type elector struct {
+	cfg      config.LeaderElectionConfig
+	client   kubernetes.Interface
+	identity string
+
+	mu      sync.RWMutex
+	leader  string
+	leading bool
+}
+
+// newElector returns an elector identified by the advertise URL or the
+// hostname
+func newElector(cfg config.LeaderElectionConfig, client kubernetes.Interface) (*elector, error) {
+	identity := cfg.AdvertiseURL
+	if identity == "" {
+		var err error
+		if identity, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("leader election identity: %w", err)
+		}
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = apply.DefaultSiteStatusNamespace()
+	}
+	if cfg.LeaseName == "" {
+		cfg.LeaseName = DefaultLeaseName
+	}
+	if cfg.LeaseDuration == 0 {
+		cfg.LeaseDuration = defaultLeaseDuration
+	}
+	if cfg.RenewDeadline == 0 {
+		cfg.RenewDeadline = defaultRenewDeadline
+	}
+	if cfg.RetryPeriod == 0 {
+		cfg.RetryPeriod = defaultRetryPeriod
+	}
+	return &elector{cfg: cfg, client: client, identity: identity}, nil
+}
+
+// start runs the election until the returned stop function is called,
+// which releases the Lease if this replica leads
+func (e *elector) start() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := e.run(ctx); err != nil {
+				log.Printf("leader election failed: %s", err.Error())
+				select {
+				case <-ctx.Done():
+				case <-time.After(e.cfg.RetryPeriod):
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// run campaigns for the Lease and returns once this replica stopped leading
+func (e *elector) run(ctx context.Context) error {
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: e.cfg.LeaseName, Namespace: e.cfg.Namespace},
+			Client:     e.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: e.identity},
+		},
+		LeaseDuration:   e.cfg.LeaseDuration,
+		RenewDeadline:   e.cfg.RenewDeadline,
+		RetryPeriod:     e.cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            e.cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				log.Printf("leading the armada-go server replicas as %s", e.identity)
+				e.setLeading(true)
+			},
+			OnStoppedLeading: func() {
+				log.Printf("stopped leading the armada-go server replicas")
+				e.setLeading(false)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != e.identity {
+					log.Printf("armada-go server replica %s is the leader", identity)
+				}
+				e.mu.Lock()
+				defer e.mu.Unlock()
+				e.leader = identity
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	le.Run(ctx)
+	return nil
+}
+
+func (e *elector) setLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading = leading
+}
+
+// state returns whether this replica leads and the identity of the leader
+func (e *elector) state() (bool, string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading, e.leader
+}
+
+// handler lets requests through on the leader. The other replicas forward
+// them to the leader if it advertises a URL, and answer 409 otherwise.
+// Without leader election every request is let through.
+func (e *elector) handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if e == nil {
+			return
+		}
+		leading, leader := e.state()
+		if leading {
+			return
+		}
+		target, err := url.Parse(leader)
+		if leader == "" || err != nil || (target.Scheme != "http" && target.Scheme != "https") ||
+			c.GetHeader(forwardedHeader) != "" {
+			if leader == "" {
+				leader = "not elected yet"
+			}
+			_ = c.Error(&APIError{Status: http.StatusConflict, Retry: true,
+				Message: fmt.Sprintf("this replica is not the leader running applies, the leader is %s", leader)})
+			c.Abort()
+			return
+		}
+		c.Request.Header.Set(forwardedHeader, e.identity)
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
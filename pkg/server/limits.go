@@ -0,0 +1,197 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+// limiterIdle is how long the bucket of a client is kept without requests
+const limiterIdle = 10 * time.Minute
+
+// Limits limits request bodies to api.max_body_size, or manifest documents
+// sent to the apply endpoint to api.max_manifest_size, answering 413 if a
+// body is larger, and handlers to api.request_timeout or the timeout of
+// their endpoint in api.handler_timeouts, answering 504 if a handler failed
+// because its timeout expired:
+//
+//	[api]
+//	max_body_size = 10Mi
+//	max_manifest_size = 64Mi
+//	request_timeout = 5m
+//	handler_timeouts = apply=2h,jobs/:id/logs=0
+func Limits(cfg config.APIConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body *limitedBody
+		limit := cfg.MaxBodySize
+		if isManifestBody(c) {
+			limit = cfg.MaxManifestSize
+		}
+		if limit > 0 && c.Request.Body != nil {
+			if c.Request.ContentLength > limit {
+				_ = c.Error(&APIError{Status: http.StatusRequestEntityTooLarge,
+					Message: "request body exceeds " + strconv.FormatInt(limit, 10) + " bytes"})
+				c.Abort()
+				return
+			}
+			body = &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit)}
+			c.Request.Body = body
+		}
+
+		timeout := cfg.RequestTimeout
+		if d, ok := cfg.HandlerTimeouts[strings.TrimPrefix(c.FullPath(), "/api/v1.0/")]; ok {
+			timeout = d
+		}
+		var ctx context.Context
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(c.Request.Context(), timeout)
+			defer cancel()
+			c.Request = c.Request.WithContext(ctx)
+		}
+
+		c.Next()
+
+		switch {
+		case body != nil && body.exceeded:
+			replaceErrors(c, http.StatusRequestEntityTooLarge,
+				"request body exceeds "+strconv.FormatInt(limit, 10)+" bytes")
+		case ctx != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+			replaceErrors(c, http.StatusGatewayTimeout, "request timed out after "+timeout.String())
+		}
+	}
+}
+
+// limitedBody remembers if the body was larger than allowed, handlers
+// report it as an invalid request
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// replaceErrors replaces the status of the errors of the handler, which are
+// rendered by ErrorHandler, the original message is kept as detail
+func replaceErrors(c *gin.Context, status int, message string) {
+	for _, e := range c.Errors {
+		var apiErr *APIError
+		if errors.As(e.Err, &apiErr) {
+			apiErr.Status = status
+			apiErr.Message = message + ": " + apiErr.Message
+		}
+	}
+}
+
+// rateLimiter keeps a token bucket per client, see config.RateLimitConfig
+type rateLimiter struct {
+	cfg     config.RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	return &rateLimiter{cfg: cfg, buckets: map[string]*bucket{}, swept: time.Now()}
+}
+
+// key returns the client a request is accounted to
+func (l *rateLimiter) key(c *gin.Context) string {
+	switch l.cfg.Key {
+	case "", "project":
+		if project := c.GetHeader("X-Project-Id"); project != "" {
+			return "project:" + project
+		}
+		fallthrough
+	case "user":
+		if user := c.GetHeader("X-User-Id"); user != "" {
+			return "user:" + user
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// reserve takes a token from the bucket of key, the returned delay is how
+// long the client has to wait for the next token if the bucket is empty
+func (l *rateLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > limiterIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.seen) > limiterIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.cfg.Rate), l.cfg.Burst)}
+		l.buckets[key] = b
+	}
+	b.seen = now
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// rateLimit answers 429 with Retry-After to clients which exhausted their
+// bucket, endpoints served without authentication like health checks
+// aren't limited
+func (r *routes) rateLimit(cfg config.RateLimitConfig) gin.HandlerFunc {
+	limiter := newRateLimiter(cfg)
+	return func(c *gin.Context) {
+		if r.bypassed(c) {
+			return
+		}
+		delay := limiter.reserve(limiter.key(c), time.Now())
+		if delay == 0 {
+			return
+		}
+		retryAfter := int(math.Ceil(delay.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		_ = c.Error(&APIError{Status: http.StatusTooManyRequests, Retry: true,
+			Message: "rate limit exceeded, retry in " + strconv.Itoa(retryAfter) + "s"})
+		c.Abort()
+	}
+}
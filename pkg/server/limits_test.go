@@ -0,0 +1,92 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+func TestLimitsManifestSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandler(), Limits(config.APIConfig{MaxBodySize: 16, MaxManifestSize: 1024}))
+	read := func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid request: %s", err.Error())
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	r.POST("/api/v1.0/apply", read)
+	r.POST("/api/v1.0/validatedesign", read)
+
+	manifest := strings.Repeat("# armada/Chart/v1\n", 8)
+	for _, tc := range []struct {
+		path, contentType string
+		want              int
+	}{
+		{"/api/v1.0/apply", "application/x-yaml", http.StatusOK},
+		// JSON bodies only reference manifests
+		{"/api/v1.0/apply", "application/json", http.StatusRequestEntityTooLarge},
+		// only the apply endpoint takes large manifests
+		{"/api/v1.0/validatedesign", "application/x-yaml", http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(manifest))
+		req.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("POST %s as %s: got status %d, want %d", tc.path, tc.contentType, w.Code, tc.want)
+		}
+	}
+}
+
+func TestRateLimitKeyTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{name: "none trusted", want: "ip:10.0.0.1"},
+		{name: "trusted proxy", proxies: []string{"10.0.0.0/8"}, want: "ip:192.0.2.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if err := r.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			l := newRateLimiter(config.RateLimitConfig{Key: "ip"})
+			var got string
+			r.GET("/api/v1.0/releases", func(c *gin.Context) { got = l.key(c) })
+			req := httptest.NewRequest(http.MethodGet, "/api/v1.0/releases", nil)
+			req.RemoteAddr = "10.0.0.1:41234"
+			req.Header.Set("X-Forwarded-For", "192.0.2.7")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("got key %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
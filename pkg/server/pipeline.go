@@ -0,0 +1,130 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// defaultPipeline is the filter chain used when [pipeline] isn't configured
+var defaultPipeline = []string{"request_id", "limits", "accesslog", "logger", "audit", "authtoken", "ratelimit",
+	"policy"}
+
+// filterFactory creates a pipeline filter, a nil filter is skipped
+type filterFactory func() (gin.HandlerFunc, error)
+
+// pipeline builds the middleware chain from the [pipeline] section of
+// armada.conf, similar to the paste pipelines of the python Armada API:
+//
+//	[pipeline]
+//	filters = request_id,cors,limits,accesslog,logger,audit,authtoken,ratelimit,policy
+//
+// Filters are applied in the given order, leaving a filter out disables it.
+// authtoken and policy are required, in this order: the handlers trust the
+// identity headers authtoken sets, which clients could send themselves
+// otherwise. The noauth auth strategy disables authentication instead.
+func pipeline(cfg config.PipelineConfig, filters map[string]filterFactory) ([]gin.HandlerFunc, error) {
+	names := defaultPipeline
+	if cfg.Filters != nil {
+		names = cfg.Filters
+	}
+
+	if i, j := slices.Index(names, "authtoken"), slices.Index(names, "policy"); i < 0 || j < 0 || j < i {
+		return nil, fmt.Errorf("pipeline filters %s lack authtoken followed by policy, "+
+			"use auth strategy noauth to disable authentication", strings.Join(names, ","))
+	}
+
+	var chain []gin.HandlerFunc
+	seen := map[string]bool{}
+	for _, name := range names {
+		factory, ok := filters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline filter %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("pipeline filter %q is listed twice", name)
+		}
+		seen[name] = true
+		filter, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("pipeline filter %q: %w", name, err)
+		}
+		if filter != nil {
+			chain = append(chain, filter)
+		}
+	}
+	log.Printf("request pipeline: %s", strings.Join(names, " "))
+	return chain, nil
+}
+
+// CORS answers preflight requests and sets CORS headers for allowed origins,
+// configured by the [cors] section of armada.conf like oslo.middleware does:
+//
+//	[cors]
+//	allowed_origin = https://shipyard.example.com
+//	allow_credentials = true
+//	max_age = 3600
+func CORS(cfg config.CORSConfig) (gin.HandlerFunc, error) {
+	origins := map[string]bool{}
+	for _, o := range cfg.AllowedOrigins {
+		origins[o] = true
+	}
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("cors.allowed_origin is not set")
+	}
+	methods := cfg.AllowMethods
+	if methods == "" {
+		methods = "GET,POST,PUT,DELETE,OPTIONS"
+	}
+	headers := cfg.AllowHeaders
+	if headers == "" {
+		headers = "Content-Type,X-Auth-Token,X-Request-Id"
+	}
+	maxAge := strconv.Itoa(cfg.MaxAge)
+	credentials := cfg.AllowCredentials
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || !(origins[origin] || origins["*"]) {
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Vary", "Origin")
+		if credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if expose := cfg.ExposeHeaders; expose != "" {
+			c.Header("Access-Control-Expose-Headers", expose)
+		}
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}, nil
+}
@@ -0,0 +1,66 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/config"
+)
+
+func TestPipeline(t *testing.T) {
+	filters := map[string]filterFactory{}
+	for _, name := range append(defaultPipeline, "cors") {
+		filters[name] = func() (gin.HandlerFunc, error) { return func(*gin.Context) {}, nil }
+	}
+	// disabled filters are left out of the chain
+	filters["ratelimit"] = func() (gin.HandlerFunc, error) { return nil, nil }
+
+	chain, err := pipeline(config.PipelineConfig{}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != len(defaultPipeline)-1 {
+		t.Errorf("got %d filters, want the %d enabled filters of the default pipeline", len(chain),
+			len(defaultPipeline)-1)
+	}
+
+	for name, tc := range map[string]struct {
+		filters []string
+		want    string
+	}{
+		"cors":                  {[]string{"cors", "authtoken", "policy"}, ""},
+		"no filters":            {[]string{}, "lack authtoken followed by policy"},
+		"without authtoken":     {[]string{"request_id", "policy"}, "lack authtoken followed by policy"},
+		"without policy":        {[]string{"request_id", "authtoken"}, "lack authtoken followed by policy"},
+		"policy before auth":    {[]string{"policy", "authtoken"}, "lack authtoken followed by policy"},
+		"unknown filter":        {[]string{"authtoken", "policy", "keystone"}, `unknown pipeline filter "keystone"`},
+		"filter listed twice":   {[]string{"logger", "authtoken", "logger", "policy"}, `"logger" is listed twice`},
+		"auth after the policy": {[]string{"authtoken", "policy", "authtoken"}, "listed twice"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := pipeline(config.PipelineConfig{Filters: tc.filters}, filters)
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	policy "github.com/databus23/goslo.policy"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+const defaultPolicyFile = "/etc/armada/policy.yaml"
+
+// defaultPolicy holds rules used when the policy file doesn't define them
+var defaultPolicy = map[string]string{
+	"armada:get_policy":      "role:admin",
+	"armada:delete_manifest": "role:admin",
+	// jobs were read with the rule of apply before they had their own
+	"armada:get_job": "rule:armada:create_endpoints",
+}
+
+// policyStore holds the enforcer built from the policy file, the file is
+// read from oslo_policy.policy_file and reloaded when it changes:
+//
+//	[oslo_policy]
+//	policy_file = /etc/armada/policy.yaml
+type policyStore struct {
+	path string
+
+	mu       sync.RWMutex
+	rules    map[string]string
+	enforcer *policy.Enforcer
+	loadedAt time.Time
+}
+
+// newPolicyStore loads the policy file, failing if it can't be parsed
+func newPolicyStore(path string) (*policyStore, error) {
+	if path == "" {
+		path = defaultPolicyFile
+	}
+	s := &policyStore{path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the policy file and replaces the enforcer, the previous one is
+// kept if the file is invalid
+func (s *policyStore) load() error {
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var pol map[string]string
+	if err = yaml.Unmarshal(buf, &pol); err != nil {
+		return fmt.Errorf("in file %q: %w", s.path, err)
+	}
+	rules := map[string]string{}
+	for k, v := range defaultPolicy {
+		rules[k] = v
+	}
+	for k, v := range pol {
+		rules[k] = v
+	}
+
+	enf, err := policy.NewEnforcer(rules)
+	if err != nil {
+		return fmt.Errorf("in file %q: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+	s.enforcer = enf
+	s.loadedAt = time.Now()
+	return nil
+}
+
+// current returns the enforcer of the last successfully loaded policy
+func (s *policyStore) current() *policy.Enforcer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.enforcer
+}
+
+// watch reloads the policy whenever the file changes until stop is called.
+// The directory is watched, so files replaced by renames or by ConfigMap
+// symlink swaps are picked up as well.
+func (s *policyStore) watch() (stop func(), err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err = watcher.Add(filepath.Dir(s.path)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Has(fsnotify.Chmod) {
+					continue
+				}
+				if err := s.load(); err != nil {
+					log.Printf("policy %s not reloaded: %s", s.path, err.Error())
+					continue
+				}
+				log.Printf("policy %s reloaded", s.path)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("watching policy %s: %s", s.path, err.Error())
+			}
+		}
+	}()
+	return func() { _ = watcher.Close() }, nil
+}
+
+// GetPolicy returns the currently loaded policy rules
+func (s *policyStore) GetPolicy(c *gin.Context) {
+	if c.GetHeader("X-Identity-Status") != "Confirmed" {
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c.JSON(200, gin.H{
+		"path":      s.path,
+		"loaded_at": s.loadedAt.UTC().Format(time.RFC3339),
+		"rules":     s.rules,
+	})
+}
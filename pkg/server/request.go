@@ -0,0 +1,147 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+const (
+	requestIDHeader = "X-Request-Id"
+	requestIDKey    = "request_id"
+)
+
+// maxRequestIDLength limits request IDs provided by clients
+const maxRequestIDLength = 128
+
+// RequestID assigns an ID to every request, reusing the one provided by the
+// client in the X-Request-Id header if it is valid, and returns it in the
+// response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = newID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		ctx := c.Request.Context()
+		c.Request = c.Request.WithContext(log.IntoContext(ctx, log.FromContext(ctx, log.Default()).With("request_id", id)))
+		c.Next()
+	}
+}
+
+// RequestContext gives every request its own copy of the config and a
+// logger, handlers pass them on to applies and rollbacks via the context
+func RequestContext(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := config.IntoContext(c.Request.Context(), cfg.Clone())
+		c.Request = c.Request.WithContext(log.IntoContext(ctx, log.Default()))
+		c.Next()
+	}
+}
+
+// requestContext returns the context handlers run applies with, it carries
+// the config and logger of the request but isn't canceled when the client
+// goes away so an apply isn't interrupted halfway, the handler timeout set
+// by Limits still applies
+func requestContext(c *gin.Context) context.Context {
+	ctx := jobContext(c)
+	if deadline, ok := c.Request.Context().Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		// nothing else cancels it, the timer is released at the deadline
+		context.AfterFunc(ctx, cancel)
+	}
+	return ctx
+}
+
+// jobContext returns the context of apply jobs, which outlive the request
+// and its timeout
+func jobContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+// validRequestID returns whether id is safe to log and echo: at most
+// maxRequestIDLength letters, digits, dots, underscores and dashes
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestWriter prefixes every line written with the request ID, keeps a
+// copy of the output and passes it to the underlying writer
+type requestWriter struct {
+	mu      sync.Mutex
+	prefix  []byte
+	out     io.Writer
+	buf     bytes.Buffer
+	pending []byte
+}
+
+func newRequestWriter(id string, out io.Writer) *requestWriter {
+	return &requestWriter{prefix: []byte("[" + id + "] "), out: out}
+}
+
+func (w *requestWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := append(append([]byte{}, w.prefix...), w.pending[:i+1]...)
+		w.pending = w.pending[i+1:]
+		w.buf.Write(line)
+		if _, err := w.out.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// String returns the output captured so far
+func (w *requestWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
@@ -0,0 +1,58 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/api/v1.0/health", Health)
+	tests := []struct {
+		name string
+		id   string
+		keep bool
+	}{
+		{name: "valid", id: "req-2026.10_16", keep: true},
+		{name: "longest", id: strings.Repeat("a", 128), keep: true},
+		{name: "missing"},
+		{name: "too long", id: strings.Repeat("a", 129)},
+		{name: "spaces", id: "forged request_id=admin"},
+		{name: "non ascii", id: "réquest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1.0/health", nil)
+			req.Header.Set(requestIDHeader, tt.id)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			got := w.Header().Get(requestIDHeader)
+			if tt.keep && got != tt.id {
+				t.Errorf("got request ID %q, want %q", got, tt.id)
+			}
+			if !tt.keep && (got == tt.id || len(got) != 32) {
+				t.Errorf("got request ID %q, want a new one", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/auth"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// defaultUnauthenticatedEndpoints are served without a token unless
+// api.unauthenticated_endpoints says otherwise
+var defaultUnauthenticatedEndpoints = []string{"/api/v1.0/health", "/api/v1.0/openapi.json", "/api/v1.0/charts/:name"}
+
+// routes keeps the policy rule of every API endpoint, authentication and
+// policy enforcement are applied by the authtoken and policy pipeline filters
+type routes struct {
+	engine   *gin.Engine
+	provider auth.Provider
+	policies *policyStore
+	bypass   map[string]bool
+	rules    map[string]string
+}
+
+// newRoutes reads the endpoints which bypass authentication from the [api]
+// section of armada.conf:
+//
+//	[api]
+//	unauthenticated_endpoints = /api/v1.0/health,/api/v1.0/versions
+func newRoutes(engine *gin.Engine, provider auth.Provider, policies *policyStore, endpoints []string) *routes {
+	if endpoints == nil {
+		endpoints = defaultUnauthenticatedEndpoints
+	}
+	bypass := map[string]bool{}
+	for _, e := range endpoints {
+		if e = strings.TrimSpace(e); e != "" {
+			log.Printf("endpoint %s is served without authentication", e)
+			bypass[e] = true
+		}
+	}
+	return &routes{engine: engine, provider: provider, policies: policies, bypass: bypass, rules: map[string]string{}}
+}
+
+// handle registers the handlers, requests have to be authenticated and allowed
+// by the policy rule, an empty rule only requires authentication
+func (r *routes) handle(method, path, rule string, h ...gin.HandlerFunc) {
+	r.rules[method+" "+path] = rule
+	r.engine.Handle(method, path, h...)
+}
+
+// bypassed returns true for requests which are not subject to authentication
+// and policy, unknown paths are left to routing to answer 404
+func (r *routes) bypassed(c *gin.Context) bool {
+	return c.FullPath() == "" || r.bypass[c.FullPath()]
+}
+
+// authToken authenticates requests using the configured provider
+func (r *routes) authToken() gin.HandlerFunc {
+	authenticate := Authenticator(r.provider.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	unauthenticated := Unauthenticated()
+	return func(c *gin.Context) {
+		if r.bypassed(c) {
+			unauthenticated(c)
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// policy rejects requests not allowed by the policy rule of the endpoint
+func (r *routes) policy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r.bypassed(c) {
+			return
+		}
+		Authenticator(Enforcer(r.policies.current(), r.rules[c.Request.Method+" "+c.FullPath()]))(c)
+	}
+}
+
+// logger writes access logs of authenticated endpoints to the server output
+func (r *routes) logger() gin.HandlerFunc {
+	logger := gin.Logger()
+	return func(c *gin.Context) {
+		if r.bypassed(c) {
+			return
+		}
+		logger(c)
+	}
+}
+
+// Unauthenticated marks requests to endpoints bypassing authentication as
+// confirmed, so handlers don't have to distinguish them
+func Unauthenticated() gin.HandlerFunc {
+	p := &auth.NoAuthProvider{}
+	return Authenticator(p.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+}
@@ -15,25 +15,57 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	policy "github.com/databus23/goslo.policy"
-	"github.com/databus23/keystone"
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
-	"gopkg.in/yaml.v3"
+	"io"
+	"k8s.io/client-go/kubernetes"
+	"net"
 	"net/http"
 	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/auth"
 	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/lock"
 	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/prune"
+	"opendev.org/airship/armada-go/pkg/releases"
+	"opendev.org/airship/armada-go/pkg/rollback"
+	"opendev.org/airship/armada-go/pkg/source"
+	"opendev.org/airship/armada-go/pkg/teardown"
+	"opendev.org/airship/armada-go/pkg/tracing"
+	"opendev.org/airship/armada-go/pkg/util"
+	"opendev.org/airship/armada-go/pkg/version"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // RunCommand phase run command
 type RunCommand struct {
 	Factory config.Factory
+	// ListenAddress is the address to bind to, all interfaces if empty
+	ListenAddress string
+	// Port to listen on, taken from config if zero
+	Port int
+	// ShutdownTimeout limits how long in-flight applies are drained on
+	// shutdown, zero means no limit
+	ShutdownTimeout time.Duration
+	// TLSCertFile and TLSKeyFile enable HTTPS, files are reloaded on change
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile enables verification of client certificates
+	TLSClientCAFile string
 }
 
+// inlineManifests names manifests sent in the request body
+const inlineManifests = "inline"
+
 type JsonDataRequest struct {
 	Href      string `json:"hrefs" binding:"required"`
 	Overrides []any  `json:"overrides"`
@@ -42,16 +74,15 @@ type JsonDataRequest struct {
 func Enforcer(enforcer *policy.Enforcer, rule string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("X-Identity-Status") != "Confirmed" {
-			w.WriteHeader(401)
-			_, _ = fmt.Fprint(w, "Invalid or no token provided")
+			writeError(w, http.StatusUnauthorized, "Invalid or no token provided")
 		} else {
 			ctx := policy.Context{
 				Roles:  strings.Split(r.Header.Get("X-Roles"), ","),
 				Logger: log.Printf,
 			}
-			if !enforcer.Enforce(rule, ctx) {
-				w.WriteHeader(401)
-				_, _ = fmt.Fprint(w, "Oslo policy error")
+			if rule != "" && !enforcer.Enforce(rule, ctx) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("Oslo policy denied %s", rule))
+				return
 			}
 			log.Printf("Request from authenticated user %s with roles %s", r.Header.Get("X-User-Name"), r.Header.Get("X-Roles"))
 		}
@@ -61,46 +92,122 @@ func Enforcer(enforcer *policy.Enforcer, rule string) http.HandlerFunc {
 func Authenticator(h http.Handler) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		h.ServeHTTP(c.Writer, c.Request)
-		if c.Writer.Status() == 401 {
+		if c.Writer.Status() == http.StatusUnauthorized || c.Writer.Status() == http.StatusForbidden {
 			c.Abort()
 		}
 	}
 }
 
-func Apply(c *gin.Context) {
+// Apply applies manifests, async applies are started as jobs of s
+func (s *jobStore) Apply(c *gin.Context) {
 	if c.GetHeader("X-Identity-Status") == "Confirmed" {
-		if c.ContentType() == "application/json" {
-			targetManifest := c.Query("target_manifest")
+		mediaType, ok := bodyMediaType(c, mediaTypeJSON, mediaTypeYAML)
+		if !ok {
+			return
+		}
+		targetManifest := c.Query("target_manifest")
+		skipCharts, skipChartGroups := c.QueryArray("skip_chart"), c.QueryArray("skip_chart_group")
+		resume := c.Query("resume") == "true"
+		canaryGroups := c.QueryArray("canary_group")
+		atomic := c.Query("atomic") == "true"
+		forceReconcile := c.Query("force_reconcile") == "true"
+
+		// YAML bodies carry the manifest documents like with the python
+		// Armada API, JSON bodies reference them
+		var manifests string
+		var manifestReader io.Reader
+		if mediaType == mediaTypeYAML {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, "invalid request: %s", err.Error())
+				return
+			}
+			if len(bytes.TrimSpace(body)) == 0 {
+				abortWithError(c, http.StatusBadRequest, "invalid request: no manifest documents in the body")
+				return
+			}
+			manifests, manifestReader = inlineManifests, bytes.NewReader(body)
+		} else {
 			var dataReq JsonDataRequest
-			if err := c.BindJSON(&dataReq); err != nil {
-				c.String(500, "internal error", err.Error())
+			if err := c.ShouldBindJSON(&dataReq); err != nil {
+				abortWithError(c, http.StatusBadRequest, "invalid request: %s", err.Error())
 				return
 			}
-
-			installed := make([]string, 0)
-			updated := make([]string, 0)
-			runOpts := apply.RunCommand{Manifests: dataReq.Href, TargetManifest: targetManifest, Out: os.Stdout,
-				Installed: &installed, Updated: &updated}
-			if err := runOpts.RunE(); err != nil {
-				c.String(500, "apply error", err.Error())
+			if !checkHref(c, dataReq.Href) {
 				return
 			}
+			manifests = dataReq.Href
+		}
 
-			c.JSON(200, gin.H{
+		if c.Query("async") == "true" {
+			job := s.start(jobContext(c), &apply.RunCommand{Manifests: manifests, ManifestReader: manifestReader,
+				TargetManifest: targetManifest, SkipCharts: skipCharts, SkipChartGroups: skipChartGroups, Resume: resume,
+				CanaryGroups: canaryGroups, Atomic: atomic, ForceReconcile: forceReconcile,
+				LockHolder: lockHolder(c)})
+			c.Header("Location", "/api/v1.0/jobs/"+job.ID)
+			c.JSON(202, gin.H{
 				"message": gin.H{
-					"install":   installed,
-					"upgrade":   updated,
-					"diff":      []any{},
-					"purge":     []any{},
-					"protected": []any{},
+					"job_id": job.ID,
 				},
 			})
-		} else {
-			c.Status(500)
+			return
 		}
+
+		if c.Query("stream") == "true" {
+			streamApply(c, &apply.RunCommand{Manifests: manifests, ManifestReader: manifestReader,
+				TargetManifest: targetManifest, SkipCharts: skipCharts, SkipChartGroups: skipChartGroups, Resume: resume,
+				CanaryGroups: canaryGroups, Atomic: atomic, ForceReconcile: forceReconcile,
+				LockHolder: lockHolder(c)})
+			return
+		}
+
+		requestID := c.GetString(requestIDKey)
+		out := newRequestWriter(requestID, log.Writer())
+		installed := make([]string, 0)
+		updated := make([]string, 0)
+		runOpts := apply.RunCommand{Manifests: manifests, ManifestReader: manifestReader, TargetManifest: targetManifest,
+			SkipCharts: skipCharts, SkipChartGroups: skipChartGroups, Resume: resume,
+			CanaryGroups: canaryGroups, Atomic: atomic, ForceReconcile: forceReconcile, LockHolder: lockHolder(c),
+			Out: out, Log: log.New(out).With("request_id", requestID), Installed: &installed, Updated: &updated}
+		if err := runOpts.RunContext(requestContext(c)); err != nil {
+			status, held := http.StatusInternalServerError, &lock.HeldError{}
+			if errors.As(err, &held) {
+				status = http.StatusConflict
+			}
+			_ = c.Error(&APIError{Status: status, Message: "apply error: " + err.Error(),
+				Retry: status == http.StatusConflict, Extra: gin.H{"log": out.String()}})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": gin.H{
+				"install":   installed,
+				"upgrade":   updated,
+				"diff":      []any{},
+				"purge":     []any{},
+				"protected": []any{},
+			},
+			"request_id": requestID,
+			"results":    runOpts.Results(),
+			"log":        out.String(),
+		})
 	} else {
-		c.Status(401)
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+	}
+}
+
+// lockHolder identifies applies of the API to concurrent applies of the
+// manifest
+func lockHolder(c *gin.Context) string {
+	user := c.GetHeader("X-User-Name")
+	if user == "" {
+		user = "unknown"
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
 	}
+	return fmt.Sprintf("%s via armada-go server %s", user, host)
 }
 
 func Validate(c *gin.Context) {
@@ -114,21 +221,121 @@ func Validate(c *gin.Context) {
 			"status":     "Success",
 			"message":    "Armada validations succeeded",
 		})
-		c.Status(200)
 	} else {
-		c.Status(401)
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
 	}
 }
 
 func Releases(c *gin.Context) {
 	if c.GetHeader("X-Identity-Status") == "Confirmed" {
+		ctx := requestContext(c)
+		cfg := config.FromContext(ctx)
+		if cfg == nil {
+			abortWithError(c, http.StatusInternalServerError, "no configuration loaded")
+			return
+		}
+		restConfig, err := cfg.Kubernetes.RestConfig()
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "releases error: %s", err.Error())
+			return
+		}
+		list, err := releases.List(ctx, restConfig, c.Query("namespace"), "")
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "releases error: %s", err.Error())
+			return
+		}
+		// Helm release names by namespace, like the Armada API
+		byNamespace := map[string][]string{}
+		for _, r := range list {
+			byNamespace[r.Namespace] = append(byNamespace[r.Namespace], r.Release)
+		}
+		c.JSON(200, gin.H{
+			"releases": byNamespace,
+		})
+	} else {
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+	}
+}
+
+func Rollback(c *gin.Context) {
+	if c.GetHeader("X-Identity-Status") == "Confirmed" {
+		version, err := strconv.Atoi(c.DefaultQuery("version", "0"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid version: %s", err.Error())
+			return
+		}
+		timeout, err := util.ParseDuration(c.DefaultQuery("timeout", "0"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid timeout: %s", err.Error())
+			return
+		}
+		release := c.Param("release")
+		requestID := c.GetString(requestIDKey)
+		out := newRequestWriter(requestID, log.Writer())
+		runOpts := rollback.RunCommand{Release: release, Namespace: c.Query("namespace"), Version: version,
+			Wait: c.DefaultQuery("wait", "true") == "true", Timeout: timeout,
+			Out: out, Log: log.New(out).With("request_id", requestID)}
+		if err := runOpts.RunContext(requestContext(c)); err != nil {
+			_ = c.Error(&APIError{Status: http.StatusInternalServerError, Message: "rollback error: " + err.Error(),
+				Extra: gin.H{"log": out.String()}})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message":    fmt.Sprintf("Rollback of %s complete.", release),
+			"request_id": requestID,
+			"log":        out.String(),
+		})
+	} else {
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+	}
+}
+
+func Delete(c *gin.Context) {
+	if c.GetHeader("X-Identity-Status") == "Confirmed" {
+		if _, ok := bodyMediaType(c, mediaTypeJSON); !ok {
+			return
+		}
+		var dataReq JsonDataRequest
+		if err := c.ShouldBindJSON(&dataReq); err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid request: %s", err.Error())
+			return
+		}
+		if !checkHref(c, dataReq.Href) {
+			return
+		}
+		timeout, err := util.ParseDuration(c.DefaultQuery("timeout", "0"))
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid timeout: %s", err.Error())
+			return
+		}
+
+		requestID := c.GetString(requestIDKey)
+		out := newRequestWriter(requestID, log.Writer())
+		runOpts := teardown.RunCommand{Manifests: dataReq.Href, TargetManifest: c.Query("target_manifest"),
+			DryRun: c.Query("dry_run") == "true", PurgeNamespaces: c.Query("purge_namespaces") == "true",
+			PurgeCRD: c.Query("purge_crd") == "true", Timeout: timeout, Out: out,
+			Log: log.New(out).With("request_id", requestID)}
+		if err := runOpts.RunContext(requestContext(c)); err != nil {
+			_ = c.Error(&APIError{Status: http.StatusInternalServerError, Message: "delete error: " + err.Error(),
+				Extra: gin.H{"log": out.String()}})
+			return
+		}
+
+		actions := runOpts.Actions
+		if actions == nil {
+			actions = []prune.Action{}
+		}
 		c.JSON(200, gin.H{
-			"releases": gin.H{
-				"ucp": []string{},
+			"message": gin.H{
+				"delete":  actions,
+				"dry_run": runOpts.DryRun,
 			},
+			"request_id": requestID,
+			"log":        out.String(),
 		})
 	} else {
-		c.Status(401)
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
 	}
 }
 
@@ -136,38 +343,212 @@ func Health(c *gin.Context) {
 	c.String(http.StatusNoContent, "OK")
 }
 
+// Versions lists the API versions like the Armada API does, together with
+// the build of armada-go
+func Versions(c *gin.Context) {
+	if c.GetHeader("X-Identity-Status") == "Confirmed" {
+		res := gin.H{"build": version.Get()}
+		for _, v := range version.APIVersions {
+			res[v] = gin.H{"path": "/api/" + v, "status": "stable"}
+		}
+		c.JSON(http.StatusOK, res)
+	} else {
+		abortWithError(c, http.StatusUnauthorized, "Invalid or no token provided")
+	}
+}
+
+// Charts serves the charts armada-go fetched from git, local and OCI sources
+// to armada-operator. Names are content digests, so they need no token
+func Charts(c *gin.Context) {
+	cfg := config.FromContext(requestContext(c))
+	if cfg == nil {
+		abortWithError(c, http.StatusInternalServerError, "no configuration loaded")
+		return
+	}
+	f, err := (&source.Resolver{CacheDir: cfg.Sources.CacheDir}).Open(c.Param("name"))
+	if err != nil {
+		abortWithError(c, http.StatusNotFound, "chart %s not found", c.Param("name"))
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, "chart error: %s", err.Error())
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.DataFromReader(http.StatusOK, fi.Size(), "application/gzip", f, nil)
+}
+
 // RunE runs the phase
 func (c *RunCommand) RunE() error {
-	_, err := c.Factory()
+	cfg, err := c.Factory()
 	if err != nil {
 		return err
 	}
-
 	log.Printf("armada-go server has been started")
+	shutdown, err := tracing.Init(context.Background())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdown(context.Background()); err != nil {
+			log.Printf("unable to flush traces: %s", err.Error())
+		}
+	}()
 	r := gin.New()
-	r.Use(gin.Recovery())
+	// the client address rate limits, audit records and access logs rely
+	// on can't be forged through X-Forwarded-For
+	if err := r.SetTrustedProxies(cfg.API.TrustedProxies); err != nil {
+		return fmt.Errorf("api.trusted_proxies: %w", err)
+	}
+	r.Use(Recovery(), ErrorHandler(), RequestContext(cfg))
+	r.NoRoute(NotFound)
+
+	syslogWriter, err := NewSyslogFromConfig(cfg.Syslog)
+	if err != nil {
+		return err
+	}
+	if syslogWriter != nil {
+		defer syslogWriter.Close()
+	}
 
-	auth := keystone.New(viper.Sub("keystone_authtoken").GetString("auth_url"))
+	authProvider, err := auth.NewProvider(cfg)
+	if err != nil {
+		return err
+	}
 
-	buf, err := os.ReadFile("/etc/armada/policy.yaml")
+	policies, err := newPolicyStore(cfg.Policy.PolicyFile)
+	if err != nil {
+		return err
+	}
+	stopWatch, err := policies.watch()
 	if err != nil {
 		return err
 	}
+	defer stopWatch()
 
-	var pol map[string]string
-	err = yaml.Unmarshal(buf, &pol)
+	rt := newRoutes(r, authProvider, policies, cfg.API.UnauthenticatedEndpoints)
+	chain, err := pipeline(cfg.Pipeline, map[string]filterFactory{
+		"request_id": func() (gin.HandlerFunc, error) { return RequestID(), nil },
+		"cors":       func() (gin.HandlerFunc, error) { return CORS(cfg.CORS) },
+		"accesslog": func() (gin.HandlerFunc, error) {
+			if syslogWriter == nil {
+				return nil, nil
+			}
+			return SyslogAccessLog(syslogWriter), nil
+		},
+		"logger": func() (gin.HandlerFunc, error) { return rt.logger(), nil },
+		"audit": func() (gin.HandlerFunc, error) {
+			audit, err := newAuditFromConfig(cfg.Audit, syslogWriter)
+			if audit == nil || err != nil {
+				return nil, err
+			}
+			return audit.Handler(), nil
+		},
+		"limits":    func() (gin.HandlerFunc, error) { return Limits(cfg.API), nil },
+		"authtoken": func() (gin.HandlerFunc, error) { return rt.authToken(), nil },
+		"policy":    func() (gin.HandlerFunc, error) { return rt.policy(), nil },
+		"ratelimit": func() (gin.HandlerFunc, error) {
+			if !cfg.RateLimit.Enabled {
+				return nil, nil
+			}
+			return rt.rateLimit(cfg.RateLimit), nil
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("in file %q: %w", "policy", err)
+		return err
+	}
+	// Filters have to be in place before routes are registered
+	r.Use(chain...)
+
+	var elect *elector
+	if cfg.LeaderElection.Enabled {
+		restConfig, err := cfg.Kubernetes.RestConfig()
+		if err != nil {
+			return err
+		}
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return err
+		}
+		if elect, err = newElector(cfg.LeaderElection, client); err != nil {
+			return err
+		}
+		// the Lease is released once in-flight applies are drained
+		defer elect.start()()
+	}
+	leader := elect.handler()
+
+	jobs := newJobStore()
+	rt.handle(http.MethodPost, "/api/v1.0/apply", "armada:create_endpoints", leader, jobs.Apply)
+	rt.handle(http.MethodPost, "/api/v1.0/validatedesign", "armada:validate_manifest", Validate)
+	rt.handle(http.MethodGet, "/api/v1.0/releases", "armada:get_release", Compress(), ETag(), Releases)
+	rt.handle(http.MethodPost, "/api/v1.0/rollback/:release", "armada:rollback_release", leader, Rollback)
+	rt.handle(http.MethodPost, "/api/v1.0/delete", "armada:delete_manifest", leader, Delete)
+	rt.handle(http.MethodGet, "/api/v1.0/jobs/:id", "armada:get_job", leader, Compress(), ETag(), jobs.GetJob)
+	rt.handle(http.MethodGet, "/api/v1.0/jobs/:id/logs", "armada:get_job", leader, Compress(), jobs.GetJobLogs)
+	rt.handle(http.MethodGet, "/api/v1.0/policy", "armada:get_policy", policies.GetPolicy)
+	rt.handle(http.MethodGet, "/api/v1.0/health", "", Health)
+	rt.handle(http.MethodGet, "/api/v1.0/versions", "", Versions)
+	rt.handle(http.MethodGet, "/api/v1.0/openapi.json", "", Compress(), ETag(), OpenAPI)
+	rt.handle(http.MethodGet, "/api/v1.0/charts/:name", "", Charts)
+	return c.serve(r, cfg.API, jobs)
+}
+
+// serve runs the HTTP server until SIGTERM or SIGINT is received, then stops
+// accepting connections and waits for in-flight requests and apply jobs
+func (c *RunCommand) serve(h http.Handler, api config.APIConfig, jobs *jobStore) error {
+	if c.ListenAddress == "" {
+		c.ListenAddress = api.ListenAddress
+	}
+	if c.Port == 0 {
+		c.Port = api.Port
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = api.ShutdownTimeout
 	}
 
-	enf, err := policy.NewEnforcer(pol)
+	tlsConfig, err := c.tlsConfig(api)
 	if err != nil {
 		return err
 	}
 
-	r.POST("/api/v1.0/apply", gin.Logger(), Authenticator(auth.Handler(Enforcer(enf, "armada:create_endpoints"))), Apply)
-	r.POST("/api/v1.0/validatedesign", gin.Logger(), Authenticator(auth.Handler(Enforcer(enf, "armada:validate_manifest"))), Validate)
-	r.GET("/api/v1.0/releases", gin.Logger(), Authenticator(auth.Handler(Enforcer(enf, "armada:get_release"))), Releases)
-	r.GET("/api/v1.0/health", Health)
-	return r.Run(":8000")
+	srv := &http.Server{Addr: net.JoinHostPort(c.ListenAddress, strconv.Itoa(c.Port)), Handler: h, TLSConfig: tlsConfig}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			log.Printf("listening on %s with TLS", srv.Addr)
+			errCh <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("listening on %s", srv.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("armada-go server is shutting down, draining in-flight applies")
+	drainCtx := context.Background()
+	if c.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(drainCtx, c.ShutdownTimeout)
+		defer cancel()
+	}
+
+	if err := srv.Shutdown(drainCtx); err != nil {
+		return err
+	}
+	if err := jobs.wait(drainCtx); err != nil {
+		return err
+	}
+	log.Printf("armada-go server has been stopped")
+	return nil
 }
@@ -0,0 +1,76 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// flushWriter writes to the client and flushes every write so the client
+// receives the output as soon as it is produced
+type flushWriter struct {
+	mu sync.Mutex
+	w  gin.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
+
+// streamApply runs the apply and sends its output to the client using chunked
+// transfer encoding. The last line of the response is the JSON apply result.
+func streamApply(c *gin.Context, runOpts *apply.RunCommand) {
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+
+	out := &flushWriter{w: c.Writer}
+	installed := make([]string, 0)
+	updated := make([]string, 0)
+	runOpts.Out = out
+	runOpts.Log = log.New(out).With("request_id", c.GetString(requestIDKey))
+	runOpts.Installed = &installed
+	runOpts.Updated = &updated
+	runOpts.Progress = func(chart string, state apply.ChartState) {
+		_, _ = fmt.Fprintf(out, "chart %s: %s\n", chart, state)
+	}
+
+	err := runOpts.RunContext(requestContext(c))
+	result := gin.H{
+		"install":   installed,
+		"upgrade":   updated,
+		"diff":      []any{},
+		"purge":     []any{},
+		"protected": []any{},
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+
+	buf, _ := json.Marshal(gin.H{"message": result})
+	_, _ = fmt.Fprintf(out, "%s\n", buf)
+}
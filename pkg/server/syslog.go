@@ -0,0 +1,195 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+// syslog severities used by armada-go
+const (
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogQueueSize is the number of messages buffered while the syslog
+// server is slow or unreachable, further messages are dropped
+const syslogQueueSize = 1024
+
+// SyslogWriter sends RFC5424 messages to a syslog server. Messages are
+// queued and sent from a single goroutine, so a slow or unreachable server
+// never holds up requests.
+type SyslogWriter struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	appName  string
+	conn     net.Conn
+	queue    chan string
+	done     sync.WaitGroup
+}
+
+// NewSyslogFromConfig creates a SyslogWriter from the [syslog] section of
+// armada.conf, it returns nil if syslog output isn't enabled:
+//
+//	[syslog]
+//	enabled = true
+//	address = udp://syslog.example.com:514
+//	facility = local0
+func NewSyslogFromConfig(cfg config.SyslogConfig) (*SyslogWriter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	address := cfg.Address
+	if address == "" {
+		address = "unix:///dev/log"
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog.address %q: %w", address, err)
+	}
+	w := &SyslogWriter{network: u.Scheme, address: u.Host, appName: cfg.AppName}
+	switch u.Scheme {
+	case "unix", "unixgram":
+		// unix tries a datagram socket first, like log/syslog does
+		w.address = u.Path
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unsupported syslog.address scheme %q, use udp, tcp, unix or unixgram", u.Scheme)
+	}
+
+	facility := strings.ToLower(cfg.Facility)
+	if facility == "" {
+		facility = "local0"
+	}
+	var ok bool
+	if w.facility, ok = facilities[facility]; !ok {
+		return nil, fmt.Errorf("unknown syslog.facility %q", facility)
+	}
+	if w.appName == "" {
+		w.appName = "armada-go"
+	}
+	if w.hostname, err = os.Hostname(); err != nil {
+		w.hostname = "-"
+	}
+	w.queue = make(chan string, syslogQueueSize)
+	w.done.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Send queues a single message with the given severity and message ID, it
+// returns an error if the queue is full and the message was dropped
+func (w *SyslogWriter) Send(severity int, msgID, msg string) error {
+	line := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s", w.facility*8+severity,
+		time.Now().UTC().Format(time.RFC3339Nano), w.hostname, w.appName, os.Getpid(), msgID, msg)
+	if w.network == "tcp" {
+		// RFC6587 octet counting framing
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+	select {
+	case w.queue <- line:
+		return nil
+	default:
+		return fmt.Errorf("syslog queue is full, dropped %s message", msgID)
+	}
+}
+
+// Close sends the queued messages and closes the connection
+func (w *SyslogWriter) Close() {
+	close(w.queue)
+	w.done.Wait()
+	if w.conn != nil {
+		_ = w.conn.Close()
+	}
+}
+
+// run sends the queued messages, (re)connecting when needed
+func (w *SyslogWriter) run() {
+	defer w.done.Done()
+	for line := range w.queue {
+		if err := w.write(line); err != nil {
+			log.Printf("unable to send to syslog: %s", err.Error())
+		}
+	}
+}
+
+func (w *SyslogWriter) write(line string) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if w.conn, err = w.dial(); err != nil {
+				w.conn = nil
+				continue
+			}
+		}
+		if _, err = w.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *SyslogWriter) dial() (net.Conn, error) {
+	if w.network != "unix" {
+		return net.DialTimeout(w.network, w.address, 5*time.Second)
+	}
+	// /dev/log is a datagram socket on most systems
+	conn, err := net.DialTimeout("unixgram", w.address, 5*time.Second)
+	if err == nil {
+		return conn, nil
+	}
+	return net.DialTimeout("unix", w.address, 5*time.Second)
+}
+
+// SyslogAccessLog sends an access log record of every request to syslog
+func SyslogAccessLog(w *SyslogWriter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		severity := severityInfo
+		if c.Writer.Status() >= 500 {
+			severity = severityWarning
+		}
+		msg := fmt.Sprintf("%s %s %d %s client=%s request_id=%s user=%s", c.Request.Method, c.Request.URL.Path,
+			c.Writer.Status(), time.Since(start), c.ClientIP(), c.GetString(requestIDKey), c.GetHeader("X-User-Name"))
+		if err := w.Send(severity, "access", msg); err != nil {
+			log.Printf("unable to send access log to syslog: %s", err.Error())
+		}
+	}
+}
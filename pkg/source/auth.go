@@ -0,0 +1,195 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Keys of the Kubernetes secrets sources refer to, the keys of the
+// basic-auth, ssh-auth and dockerconfigjson secret types are understood
+const (
+	SecretUsername     = "username"
+	SecretPassword     = "password"
+	SecretToken        = "token"
+	SecretSSHKey       = "ssh-privatekey"
+	SecretKnownHosts   = "known_hosts"
+	SecretDockerConfig = ".dockerconfigjson"
+)
+
+// SecretRef refers to the Kubernetes secret with the credentials of a
+// source, the namespace defaults to the namespace of the chart
+type SecretRef struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SecretGetter returns the data of a Kubernetes secret
+type SecretGetter func(ctx context.Context, namespace, name string) (map[string][]byte, error)
+
+// Credentials authenticate to the location of a source
+type Credentials struct {
+	// Username and Password are sent as basic auth to HTTP servers, git
+	// servers and registries
+	Username string
+	Password string
+	// Token is sent as bearer token to HTTP servers and registries and as
+	// password to git servers
+	Token string
+	// SSHKey is the private key for git over SSH, KnownHosts verifies the
+	// host keys of the servers instead of the known hosts of the user
+	SSHKey     []byte
+	KnownHosts []byte
+	// DockerConfig is a docker config.json, its auths are looked up by
+	// registry host
+	DockerConfig []byte
+}
+
+// CredentialsFromSecret reads credentials from the data of a Kubernetes secret
+func CredentialsFromSecret(data map[string][]byte) *Credentials {
+	return &Credentials{
+		Username:     string(data[SecretUsername]),
+		Password:     string(data[SecretPassword]),
+		Token:        strings.TrimSpace(string(data[SecretToken])),
+		SSHKey:       data[SecretSSHKey],
+		KnownHosts:   data[SecretKnownHosts],
+		DockerConfig: data[SecretDockerConfig],
+	}
+}
+
+// credentials returns the credentials of the secret of the source, or the
+// default credentials of the resolver for sources without a secret
+func (r *Resolver) credentials(ctx context.Context, src Source) (*Credentials, error) {
+	if src.SecretRef == nil {
+		if r.Credentials == nil {
+			return &Credentials{}, nil
+		}
+		return r.Credentials, nil
+	}
+	if src.SecretRef.Namespace == "" {
+		return nil, fmt.Errorf("source.secret_ref.namespace of secret %s is required", src.SecretRef.Name)
+	}
+	if r.Secrets == nil {
+		return nil, fmt.Errorf("secret %s/%s of the source can't be read without a cluster",
+			src.SecretRef.Namespace, src.SecretRef.Name)
+	}
+	data, err := r.Secrets(ctx, src.SecretRef.Namespace, src.SecretRef.Name)
+	if err != nil {
+		return nil, fmt.Errorf("reading secret %s/%s of the source: %w", src.SecretRef.Namespace, src.SecretRef.Name, err)
+	}
+	return CredentialsFromSecret(data), nil
+}
+
+// authorize sets the Authorization header of HTTP requests
+func (c *Credentials) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// registry returns the username and password or token of the registry
+// host, from the docker config first
+func (c *Credentials) registry(host string) (username, password, token string, err error) {
+	if len(c.DockerConfig) > 0 {
+		var cfg struct {
+			Auths map[string]struct {
+				Auth          string `json:"auth"`
+				Username      string `json:"username"`
+				Password      string `json:"password"`
+				RegistryToken string `json:"registrytoken"`
+			} `json:"auths"`
+		}
+		if err := json.Unmarshal(c.DockerConfig, &cfg); err != nil {
+			return "", "", "", fmt.Errorf("invalid docker config: %w", err)
+		}
+		for key, auth := range cfg.Auths {
+			if registryHost(key) != host {
+				continue
+			}
+			if auth.Auth != "" {
+				buf, err := base64.StdEncoding.DecodeString(auth.Auth)
+				if err != nil {
+					return "", "", "", fmt.Errorf("invalid auth of %s in docker config: %w", key, err)
+				}
+				auth.Username, auth.Password, _ = strings.Cut(string(buf), ":")
+			}
+			return auth.Username, auth.Password, auth.RegistryToken, nil
+		}
+	}
+	return c.Username, c.Password, c.Token, nil
+}
+
+// registryHost strips the scheme and path docker config keys may have,
+// like https://index.docker.io/v1/
+func registryHost(key string) string {
+	if u, err := url.Parse(key); err == nil && u.Host != "" {
+		return u.Host
+	}
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
+
+// gitEnv returns the environment passing the credentials to git, cleanup
+// removes the key files it wrote
+func (c *Credentials) gitEnv() (env []string, cleanup func(), err error) {
+	cleanup = func() {}
+	if c.Token != "" || c.Username != "" {
+		username, password := c.Username, c.Password
+		if c.Token != "" {
+			password = c.Token
+			if username == "" {
+				// git servers take any user name with an access token
+				username = "token"
+			}
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		// passed through the environment to keep it out of the process list
+		env = append(env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth)
+	}
+	if len(c.SSHKey) > 0 {
+		dir, err := os.MkdirTemp("", "armada-ssh-")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		key := filepath.Join(dir, "id")
+		if err := os.WriteFile(key, c.SSHKey, 0o600); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		ssh := "ssh -o IdentitiesOnly=yes -o BatchMode=yes -i " + key
+		if len(c.KnownHosts) > 0 {
+			knownHosts := filepath.Join(dir, "known_hosts")
+			if err := os.WriteFile(knownHosts, c.KnownHosts, 0o600); err != nil {
+				cleanup()
+				return nil, func() {}, err
+			}
+			ssh += " -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + knownHosts
+		}
+		env = append(env, "GIT_SSH_COMMAND="+ssh)
+	}
+	return env, cleanup, nil
+}
@@ -0,0 +1,139 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"opendev.org/airship/armada-go/pkg/mirror"
+)
+
+var commitRE = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// resolveGit returns the commit the reference of the source points at
+func (r *Resolver) resolveGit(ctx context.Context, src Source, creds *Credentials) (string, error) {
+	ref := src.Reference
+	if ref == "" {
+		ref = DefaultReference
+	}
+	if commitRE.MatchString(ref) {
+		return ref, nil
+	}
+	env, cleanup, err := creds.gitEnv()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	out, err := git(ctx, "", append(slices.Clone(r.Env), env...), "ls-remote", "--", src.Location, ref)
+	if err != nil {
+		return "", err
+	}
+	var commit string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		sha, name, ok := strings.Cut(sc.Text(), "\t")
+		if !ok {
+			continue
+		}
+		switch name {
+		case ref + "^{}", "refs/tags/" + ref + "^{}":
+			// the commit an annotated tag points at
+			return sha, nil
+		case ref, "refs/heads/" + ref, "refs/tags/" + ref:
+			if commit == "" {
+				commit = sha
+			}
+		}
+	}
+	if commit == "" {
+		return "", fmt.Errorf("reference %s not found in %s", ref, src.Location)
+	}
+	return commit, nil
+}
+
+// fetchGit checks the commit out and packages the chart below the subpath
+func (r *Resolver) fetchGit(ctx context.Context, src Source, commit string, creds *Credentials) (*mirror.Chart, error) {
+	env, cleanup, err := creds.gitEnv()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	dir, err := os.MkdirTemp("", "armada-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	ref := src.Reference
+	if ref == "" {
+		ref = DefaultReference
+	}
+	if commitRE.MatchString(ref) {
+		ref = commit
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", "--", src.Location, ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		if _, err := git(ctx, dir, append(slices.Clone(r.Env), env...), args...); err != nil {
+			return nil, err
+		}
+	}
+	head, err := git(ctx, dir, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if got := strings.TrimSpace(string(head)); got != commit {
+		return nil, fmt.Errorf("%s moved from commit %s to %s while fetching it", ref, commit, got)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		return nil, err
+	}
+	return mirror.PackDir(dir, src.Subpath)
+}
+
+// gitProtocols are the transports git may use, remote helpers like ext::
+// which run commands are disabled
+var gitProtocols = []string{
+	"-c", "protocol.allow=never",
+	"-c", "protocol.https.allow=always",
+	"-c", "protocol.http.allow=always",
+	"-c", "protocol.ssh.allow=always",
+	"-c", "protocol.git.allow=always",
+}
+
+// git runs git with the additional environment without prompting for
+// credentials, only over gitProtocols
+func git(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append(slices.Clone(gitProtocols), args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
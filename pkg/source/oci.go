@@ -0,0 +1,88 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"opendev.org/airship/armada-go/pkg/mirror"
+)
+
+// parseOCI splits oci://host/repository:tag or oci://host/repository@digest
+func parseOCI(location string) (host, repo, reference string, err error) {
+	rest, ok := strings.CutPrefix(location, "oci://")
+	if !ok {
+		return "", "", "", fmt.Errorf("invalid OCI location %q, expected oci://registry/repository:tag", location)
+	}
+	host, repo, _ = strings.Cut(rest, "/")
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo, reference = repo[:i], repo[i+1:]
+	} else if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo, reference = repo[:i], repo[i+1:]
+	}
+	if host == "" || repo == "" || reference == "" {
+		return "", "", "", fmt.Errorf("invalid OCI location %q, expected oci://registry/repository:tag", location)
+	}
+	return host, repo, reference, nil
+}
+
+func (r *Resolver) registry(host string, creds *Credentials) (*mirror.Registry, error) {
+	opts := mirror.RegistryOptions{PlainHTTP: r.PlainHTTP}
+	var err error
+	if opts.Username, opts.Password, opts.Token, err = creds.registry(host); err != nil {
+		return nil, err
+	}
+	return mirror.NewRegistry(host, opts)
+}
+
+// resolveOCI returns the digest of the manifest the location points at
+func (r *Resolver) resolveOCI(ctx context.Context, src Source, creds *Credentials) (string, error) {
+	host, repo, reference, err := parseOCI(src.Location)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(reference, "sha256:") {
+		return reference, nil
+	}
+	registry, err := r.registry(host, creds)
+	if err != nil {
+		return "", err
+	}
+	return registry.Resolve(ctx, repo, reference)
+}
+
+// fetchOCI pulls the chart of the manifest digest
+func (r *Resolver) fetchOCI(ctx context.Context, src Source, digest string, creds *Credentials) (*mirror.Chart, error) {
+	host, repo, _, err := parseOCI(src.Location)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := r.registry(host, creds)
+	if err != nil {
+		return nil, err
+	}
+	if r.verify(src) {
+		if err := r.verifyCosign(ctx, registry, repo, digest); err != nil {
+			return nil, err
+		}
+	}
+	archive, err := registry.PullChart(repo, digest)
+	if err != nil {
+		return nil, err
+	}
+	return mirror.PackArchive(archive, src.Location, src.Subpath)
+}
@@ -0,0 +1,384 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package source fetches the charts of chart documents from the sources
+// classic Armada supports and caches them
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"opendev.org/airship/armada-go/pkg/mirror"
+)
+
+// Source types of chart documents
+const (
+	TypeTar   = mirror.SourceTar
+	TypeLocal = mirror.SourceLocal
+	TypeGit   = mirror.SourceGit
+	TypeOCI   = mirror.SourceOCI
+)
+
+// DefaultReference is the git reference of sources without one, like in
+// classic Armada
+const DefaultReference = "master"
+
+// Source is the data.source block of a chart document
+type Source struct {
+	Type     string `json:"type,omitempty"`
+	Location string `json:"location,omitempty"`
+	Subpath  string `json:"subpath,omitempty"`
+	// Reference is the branch, tag or commit of git sources
+	Reference string `json:"reference,omitempty"`
+	// Checksum is the sha256:<hex> digest of the tarball of tar sources
+	Checksum string `json:"checksum,omitempty"`
+	// SecretRef refers to the credentials of the location
+	SecretRef *SecretRef `json:"secret_ref,omitempty"`
+	// Verify requires the Helm provenance file of tar sources or a cosign
+	// signature of OCI sources
+	Verify bool `json:"verify,omitempty"`
+}
+
+// Fetched reports whether only armada-go can fetch the source, armada-operator
+// downloads tarballs from http(s) URLs itself
+func (s Source) Fetched() bool {
+	if s.Type != TypeTar || s.Checksum != "" || s.Verify {
+		return true
+	}
+	u, err := url.Parse(s.Location)
+	return err != nil || u.Scheme != "http" && u.Scheme != "https"
+}
+
+var (
+	checksumRE = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+	fileNameRE = regexp.MustCompile(`^[0-9a-f]{64}\.tgz$`)
+)
+
+// Validate checks the fields of the source type
+func (s Source) Validate() error {
+	if s.Location == "" {
+		return errors.New("source.location is required")
+	}
+	// the location and reference are passed to git, which would take them
+	// for options
+	if strings.HasPrefix(s.Location, "-") {
+		return fmt.Errorf("invalid source.location %q, it must not start with -", s.Location)
+	}
+	if strings.HasPrefix(s.Reference, "-") {
+		return fmt.Errorf("invalid source.reference %q, it must not start with -", s.Reference)
+	}
+	switch s.Type {
+	case TypeTar:
+	case TypeLocal, TypeGit, TypeOCI:
+		if s.Checksum != "" {
+			return fmt.Errorf("source.checksum is only supported for %s sources", TypeTar)
+		}
+	default:
+		return fmt.Errorf("unsupported source type %q, expected %s, %s, %s or %s",
+			s.Type, TypeTar, TypeLocal, TypeGit, TypeOCI)
+	}
+	if s.Verify && s.Type != TypeTar && s.Type != TypeOCI {
+		return fmt.Errorf("source.verify is only supported for %s and %s sources", TypeTar, TypeOCI)
+	}
+	if s.Reference != "" && s.Type != TypeGit {
+		return fmt.Errorf("source.reference is only supported for %s sources", TypeGit)
+	}
+	if s.SecretRef != nil {
+		if s.Type == TypeLocal {
+			return fmt.Errorf("source.secret_ref is not supported for %s sources", TypeLocal)
+		}
+		if s.SecretRef.Name == "" {
+			return errors.New("source.secret_ref.name is required")
+		}
+	}
+	if s.Checksum != "" && !checksumRE.MatchString(s.Checksum) {
+		return fmt.Errorf("invalid source.checksum %q, expected sha256:<hex digest>", s.Checksum)
+	}
+	return nil
+}
+
+// Chart is a fetched chart
+type Chart struct {
+	*mirror.Chart
+	// Digest is the sha256:<hex> digest of the chart archive
+	Digest string
+	// Cached is set if the chart was taken from the cache
+	Cached bool
+}
+
+// FileName is the name of the chart archive in the cache directory
+func (c *Chart) FileName() string {
+	return strings.TrimPrefix(c.Digest, "sha256:") + ".tgz"
+}
+
+// Resolver fetches charts, charts of immutable sources, tarballs with a
+// checksum, git commits and OCI manifests, are fetched once. The others
+// are fetched once per Resolver.
+type Resolver struct {
+	// CacheDir keeps the fetched charts across resolvers, they are only
+	// kept in memory if empty
+	CacheDir string
+	Client   *http.Client
+	// PlainHTTP talks to OCI registries without TLS
+	PlainHTTP bool
+	// Env is added to the environment of git, usually proxy settings
+	Env []string
+	// Credentials authenticate sources without a secret reference
+	Credentials *Credentials
+	// Secrets reads the secrets sources refer to
+	Secrets SecretGetter
+	// Verify requires every chart to be verified like the charts of sources
+	// with verify set
+	Verify bool
+	// Keyring verifies the Helm provenance files of tar sources
+	Keyring string
+	// PublicKey is the PEM public key verifying cosign signatures of OCI
+	// sources
+	PublicKey []byte
+
+	mu     sync.Mutex
+	charts map[string]*Chart
+}
+
+// Fetch returns the chart of the source
+func (r *Resolver) Fetch(ctx context.Context, src Source) (*Chart, error) {
+	if err := src.Validate(); err != nil {
+		return nil, err
+	}
+	creds, err := r.credentials(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	verify := r.verify(src)
+	if verify && src.Type != TypeTar && src.Type != TypeOCI {
+		return nil, fmt.Errorf("charts have to be verified, %s sources can't be", src.Type)
+	}
+	key, rev, persistent, err := r.key(ctx, src, creds)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" && verify {
+		// unverified charts don't satisfy verified fetches
+		key = "verified:" + key
+	}
+	if key != "" {
+		if chart := r.cached(key, persistent); chart != nil {
+			return chart, nil
+		}
+	}
+
+	var mc *mirror.Chart
+	switch src.Type {
+	case TypeTar:
+		mc, err = r.fetchTar(ctx, src, creds)
+	case TypeLocal:
+		mc, err = mirror.PackDir(src.Location, src.Subpath)
+	case TypeGit:
+		mc, err = r.fetchGit(ctx, src, rev, creds)
+	case TypeOCI:
+		mc, err = r.fetchOCI(ctx, src, rev, creds)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(mc.Archive)
+	chart := &Chart{Chart: mc, Digest: "sha256:" + hex.EncodeToString(sum[:])}
+	if err := r.store(key, persistent, chart); err != nil {
+		return nil, err
+	}
+	return chart, nil
+}
+
+// Open returns the archive of a chart stored in the cache directory by its
+// file name, see Chart.FileName
+func (r *Resolver) Open(name string) (*os.File, error) {
+	if r.CacheDir == "" || !fileNameRE.MatchString(name) {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(filepath.Join(r.CacheDir, name))
+}
+
+// key identifies the content of the source, persistent keys identify
+// immutable content. rev is the git commit or the OCI manifest digest the
+// source resolved to. Local sources have no key, they are always read.
+func (r *Resolver) key(ctx context.Context, src Source, creds *Credentials) (key, rev string, persistent bool, err error) {
+	switch src.Type {
+	case TypeTar:
+		if src.Checksum != "" {
+			return "tar:" + src.Checksum + "/" + src.Subpath, "", true, nil
+		}
+		return "tar:" + src.Location + "/" + src.Subpath, "", false, nil
+	case TypeGit:
+		if rev, err = r.resolveGit(ctx, src, creds); err != nil {
+			return "", "", false, err
+		}
+		return "git:" + src.Location + "@" + rev + "/" + src.Subpath, rev, true, nil
+	case TypeOCI:
+		if rev, err = r.resolveOCI(ctx, src, creds); err != nil {
+			return "", "", false, err
+		}
+		return "oci:" + src.Location + "@" + rev + "/" + src.Subpath, rev, true, nil
+	}
+	return "", "", false, nil
+}
+
+// cached returns the chart of the key from memory or, for persistent keys,
+// the cache directory
+func (r *Resolver) cached(key string, persistent bool) *Chart {
+	r.mu.Lock()
+	chart, ok := r.charts[key]
+	r.mu.Unlock()
+	if ok {
+		return &Chart{Chart: chart.Chart, Digest: chart.Digest, Cached: true}
+	}
+	if !persistent || r.CacheDir == "" {
+		return nil
+	}
+	digest, err := os.ReadFile(r.refPath(key))
+	if err != nil {
+		return nil
+	}
+	name := strings.TrimPrefix(string(digest), "sha256:") + ".tgz"
+	archive, err := os.ReadFile(filepath.Join(r.CacheDir, name))
+	if err != nil {
+		return nil
+	}
+	mc, err := mirror.PackArchive(archive, name, "")
+	if err != nil {
+		return nil
+	}
+	chart = &Chart{Chart: mc, Digest: string(digest)}
+	r.remember(key, chart)
+	return &Chart{Chart: mc, Digest: chart.Digest, Cached: true}
+}
+
+// store keeps the chart in memory and writes its archive to the cache
+// directory, so it can be served to armada-operator
+func (r *Resolver) store(key string, persistent bool, chart *Chart) error {
+	if key != "" {
+		r.remember(key, chart)
+	}
+	if r.CacheDir == "" {
+		return nil
+	}
+	if err := writeFile(filepath.Join(r.CacheDir, chart.FileName()), chart.Archive); err != nil {
+		return err
+	}
+	if persistent {
+		return writeFile(r.refPath(key), []byte(chart.Digest))
+	}
+	return nil
+}
+
+func (r *Resolver) remember(key string, chart *Chart) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.charts == nil {
+		r.charts = map[string]*Chart{}
+	}
+	r.charts[key] = chart
+}
+
+func (r *Resolver) refPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(r.CacheDir, "refs", hex.EncodeToString(sum[:]))
+}
+
+func (r *Resolver) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return http.DefaultClient
+}
+
+// fetchTar downloads the tarball, verifies its checksum and packages the
+// chart below the subpath
+func (r *Resolver) fetchTar(ctx context.Context, src Source, creds *Credentials) (*mirror.Chart, error) {
+	archive, err := r.download(ctx, src.Location, creds)
+	if err != nil {
+		return nil, err
+	}
+	if src.Checksum != "" {
+		sum := sha256.Sum256(archive)
+		if got := "sha256:" + hex.EncodeToString(sum[:]); got != src.Checksum {
+			return nil, fmt.Errorf("checksum of %s is %s, expected %s", src.Location, got, src.Checksum)
+		}
+	}
+	if r.verify(src) {
+		prov, err := r.download(ctx, src.Location+".prov", creds)
+		if err != nil {
+			return nil, fmt.Errorf("provenance of %s: %w", src.Location, err)
+		}
+		if err := r.verifyProvenance(archive, prov, src.Location); err != nil {
+			return nil, err
+		}
+	}
+	return mirror.PackArchive(archive, src.Location, src.Subpath)
+}
+
+// download reads an http(s) URL or a file
+func (r *Resolver) download(ctx context.Context, location string, creds *Credentials) ([]byte, error) {
+	if u, err := url.Parse(location); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	creds.authorize(req)
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s failed: %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// writeFile replaces the file atomically
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
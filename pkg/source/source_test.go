@@ -0,0 +1,53 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package source
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	repo, tgz := "https://git.example.com/a", "https://charts.example.com/a.tgz"
+	for name, tc := range map[string]struct {
+		src  Source
+		want string
+	}{
+		"tar":                 {Source{Type: TypeTar, Location: tgz, Checksum: digest}, ""},
+		"git":                 {Source{Type: TypeGit, Location: repo, Reference: "v1.0"}, ""},
+		"oci verified":        {Source{Type: TypeOCI, Location: "oci://registry.example.com/a:1.0", Verify: true}, ""},
+		"no location":         {Source{Type: TypeTar}, "source.location is required"},
+		"option location":     {Source{Type: TypeGit, Location: "--upload-pack=touch /tmp/x"}, "must not start with -"},
+		"option reference":    {Source{Type: TypeGit, Location: repo, Reference: "-f"}, "must not start with -"},
+		"unknown type":        {Source{Type: "svn", Location: "https://svn.example.com/a"}, "unsupported source type"},
+		"git checksum":        {Source{Type: TypeGit, Location: repo, Checksum: digest}, "only supported for tar"},
+		"git verify":          {Source{Type: TypeGit, Location: repo, Verify: true}, "source.verify is only"},
+		"tar reference":       {Source{Type: TypeTar, Location: tgz, Reference: "v1"}, "source.reference is only"},
+		"local secret":        {Source{Type: TypeLocal, Location: "/a", SecretRef: &SecretRef{Name: "a"}}, "not supported"},
+		"secret without name": {Source{Type: TypeGit, Location: repo, SecretRef: &SecretRef{}}, "name is required"},
+		"invalid checksum":    {Source{Type: TypeTar, Location: tgz, Checksum: "md5:abc"}, "invalid source.checksum"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.src.Validate()
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("got error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
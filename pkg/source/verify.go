@@ -0,0 +1,152 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package source
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/provenance"
+
+	"opendev.org/airship/armada-go/pkg/mirror"
+)
+
+// Cosign stores the signatures of an OCI artifact as layers of the
+// sha256-<hex>.sig tag of its repository
+const (
+	mediaTypeCosignPayload = "application/vnd.dev.cosign.simplesigning.v1+json"
+	annotationCosignSig    = "dev.cosignproject.cosign/signature"
+)
+
+// VerifySignature checks the base64 encoded signature of data with the PEM
+// public key, signatures written by `cosign sign-blob --key` verify
+func VerifySignature(publicKey, data, signature []byte) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return errors.New("invalid public key, expected PEM")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	var ok bool
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, sum[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if !ok {
+		return errors.New("signature doesn't match the public key")
+	}
+	return nil
+}
+
+// verify reports whether the chart of the source has to be verified
+func (r *Resolver) verify(src Source) bool {
+	return r.Verify || src.Verify
+}
+
+// verifyProvenance checks the archive with the Helm provenance file next
+// to it, like `helm verify` does
+func (r *Resolver) verifyProvenance(archive, prov []byte, location string) error {
+	if r.Keyring == "" {
+		return fmt.Errorf("verifying %s requires a keyring", location)
+	}
+	signatory, err := provenance.NewFromKeyring(r.Keyring, "")
+	if err != nil {
+		return fmt.Errorf("keyring %s: %w", r.Keyring, err)
+	}
+	dir, err := os.MkdirTemp("", "armada-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// the provenance file lists the digest of the archive by its file name
+	name := filepath.Join(dir, path.Base(location))
+	if err := os.WriteFile(name, archive, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name+".prov", prov, 0o600); err != nil {
+		return err
+	}
+	if _, err := signatory.Verify(name, name+".prov"); err != nil {
+		return fmt.Errorf("verifying provenance of %s: %w", location, err)
+	}
+	return nil
+}
+
+// verifyCosign checks that a cosign signature of the manifest digest was
+// made with the public key
+func (r *Resolver) verifyCosign(ctx context.Context, registry *mirror.Registry, repo, digest string) error {
+	if len(r.PublicKey) == 0 {
+		return fmt.Errorf("verifying %s@%s requires a public key", repo, digest)
+	}
+	tag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	m, err := registry.PullManifest(ctx, repo, tag)
+	if err != nil {
+		return fmt.Errorf("no cosign signature of %s@%s: %w", repo, digest, err)
+	}
+	for _, layer := range m.Layers {
+		sig, ok := layer.Annotations[annotationCosignSig]
+		if layer.MediaType != mediaTypeCosignPayload || !ok {
+			continue
+		}
+		payload, err := registry.PullBlob(ctx, repo, layer)
+		if err != nil {
+			return err
+		}
+		if VerifySignature(r.PublicKey, payload, []byte(sig)) != nil {
+			continue
+		}
+		var simple struct {
+			Critical struct {
+				Image struct {
+					Digest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+			} `json:"critical"`
+		}
+		if err := json.Unmarshal(payload, &simple); err != nil {
+			return fmt.Errorf("invalid cosign payload of %s@%s: %w", repo, digest, err)
+		}
+		if simple.Critical.Image.Digest == digest {
+			return nil
+		}
+	}
+	return fmt.Errorf("no cosign signature of %s@%s matches the public key", repo, digest)
+}
@@ -0,0 +1,259 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ErrNotConverged is returned with ExitCode set if the site isn't converged
+var ErrNotConverged = errors.New("site is not converged")
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory        config.Factory
+	Manifests      string
+	TargetManifest string
+	// SiteStatusNamespace holds the site status ConfigMap of the last
+	// apply, apply.site_status_namespace of the config if empty
+	SiteStatusNamespace string
+	// Format is text or json
+	Format string
+	// Diff adds the spec difference of drifted charts
+	Diff bool
+	// ExitCode fails with ErrNotConverged if the site isn't converged
+	ExitCode bool
+	Out      io.Writer
+}
+
+// ChartStatus compares a chart of the manifest with the cluster
+type ChartStatus struct {
+	Chart     string `json:"chart"`
+	Namespace string `json:"namespace"`
+	Present   bool   `json:"present"`
+	Ready     bool   `json:"ready"`
+	// Reason explains why the chart isn't ready
+	Reason string `json:"reason,omitempty"`
+	// GenerationLag is how many spec changes the operator hasn't observed
+	GenerationLag int64 `json:"generation_lag"`
+	Drifted       bool  `json:"drifted"`
+	// Owned is false if the live chart lacks the ownership labels of the
+	// manifest, Reason says which
+	Owned bool `json:"owned"`
+	// Orphaned charts carry the ownership labels of the manifest, which no
+	// longer has them, prune deletes them
+	Orphaned bool `json:"orphaned,omitempty"`
+	// ManifestHash and LiveHash are digests of the spec the manifest asks
+	// for and of the managed part of the live spec
+	ManifestHash string `json:"manifest_hash"`
+	LiveHash     string `json:"live_hash,omitempty"`
+	Diff         string `json:"diff,omitempty"`
+}
+
+// Converged returns whether the chart exists, is ready for its latest spec
+// and matches the manifest
+func (s ChartStatus) Converged() bool {
+	return s.Present && s.Ready && s.GenerationLag == 0 && !s.Drifted && s.Owned && !s.Orphaned
+}
+
+// Report is the status of all charts of the manifest
+type Report struct {
+	Time      time.Time     `json:"time"`
+	Converged bool          `json:"converged"`
+	Charts    []ChartStatus `json:"charts"`
+	// LastApply is the outcome of the last apply, nil if none was recorded
+	LastApply *apply.SiteStatus `json:"last_apply,omitempty"`
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	if c.Format == "" {
+		c.Format = FormatText
+	}
+	if c.Format != FormatText && c.Format != FormatJSON {
+		return fmt.Errorf("unknown output format %q, expected %s or %s", c.Format, FormatText, FormatJSON)
+	}
+	report, err := c.Status(context.Background())
+	if err != nil {
+		return err
+	}
+	if c.Format == FormatJSON {
+		enc := json.NewEncoder(c.Out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = c.print(report)
+	}
+	if err != nil {
+		return err
+	}
+	if c.ExitCode && !report.Converged {
+		return ErrNotConverged
+	}
+	return nil
+}
+
+// Status compares the ArmadaCharts of the cluster with the manifest
+func (c *RunCommand) Status(ctx context.Context) (*Report, error) {
+	parser := &apply.RunCommand{Factory: c.Factory, Manifests: c.Manifests, TargetManifest: c.TargetManifest,
+		Out: io.Discard}
+	if err := parser.LoadConfig(); err != nil {
+		return nil, err
+	}
+	if err := parser.ParseManifests(); err != nil {
+		return nil, err
+	}
+	restConfig, err := parser.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+	resClient := dynamic.NewForConfigOrDie(restConfig).Resource(schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	})
+
+	report := &Report{Time: time.Now(), Converged: true}
+	for _, chart := range parser.Charts() {
+		s := ChartStatus{Chart: chart.Name, Namespace: chart.Namespace}
+		live, err := resClient.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			s.Reason = "missing"
+		case err != nil:
+			return nil, err
+		default:
+			s.Present = true
+			s.Ready, s.Reason = armadawait.IsReady(live)
+			if reason := parser.NotOwned(live); reason == "" {
+				s.Owned = true
+			} else if s.Reason == "" {
+				s.Reason = reason
+			}
+			observed, _, _ := unstructured.NestedInt64(live.Object, "status", "observedGeneration")
+			s.GenerationLag = max(live.GetGeneration()-observed, 0)
+			if s.ManifestHash, s.LiveHash, err = apply.SpecHashes(chart, live); err != nil {
+				return nil, err
+			}
+			s.Drifted = s.ManifestHash != s.LiveHash
+			if s.Drifted && c.Diff {
+				if s.Diff, err = apply.Drift(chart, live); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if s.ManifestHash == "" {
+			if s.ManifestHash, _, err = apply.SpecHashes(chart, nil); err != nil {
+				return nil, err
+			}
+		}
+		report.Converged = report.Converged && s.Converged()
+		report.Charts = append(report.Charts, s)
+	}
+	orphans, err := parser.Orphans(ctx, resClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, live := range orphans {
+		s := ChartStatus{Chart: live.GetName(), Namespace: live.GetNamespace(), Present: true, Owned: true,
+			Orphaned: true, Reason: "not in manifest " + parser.Manifest().Metadata.Name}
+		s.Ready, _ = armadawait.IsReady(&live)
+		report.Converged = false
+		report.Charts = append(report.Charts, s)
+	}
+
+	namespace := c.SiteStatusNamespace
+	if namespace == "" {
+		namespace = parser.Config.Apply.SiteStatusNamespace
+	}
+	if report.LastApply, err = apply.ReadSiteStatus(ctx, restConfig, namespace); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *RunCommand) print(report *Report) error {
+	tw := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAMESPACE\tCHART\tPRESENT\tREADY\tGEN LAG\tDRIFTED\tHASH\tREASON")
+	converged := 0
+	for _, s := range report.Charts {
+		if s.Converged() {
+			converged++
+		}
+		hash := short(s.ManifestHash)
+		if s.Drifted {
+			hash += "/" + short(s.LiveHash)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%v\t%v\t%d\t%v\t%s\t%s\n", s.Namespace, s.Chart, s.Present, s.Ready,
+			s.GenerationLag, s.Drifted, hash, s.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range report.Charts {
+		if s.Diff != "" {
+			_, _ = fmt.Fprintf(c.Out, "\n%s/%s (-manifest +live):\n%s", s.Namespace, s.Chart, s.Diff)
+		}
+	}
+
+	state := "converged"
+	if !report.Converged {
+		state = "not converged"
+	}
+	if _, err := fmt.Fprintf(c.Out, "\nsite %s: %d of %d charts converged\n", state, converged, len(report.Charts)); err != nil {
+		return err
+	}
+	if la := report.LastApply; la != nil {
+		line := fmt.Sprintf("last apply %s at %s, manifest %s", la.Status, la.Time.Format(time.RFC3339), la.Manifest)
+		if la.Error != "" {
+			line += ": " + la.Error
+		}
+		_, err := fmt.Fprintln(c.Out, line)
+		return err
+	}
+	return nil
+}
+
+// short abbreviates a hash like git does
+func short(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return strings.TrimSpace(hash)
+}
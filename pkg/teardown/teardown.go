@@ -0,0 +1,230 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package teardown
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	apiextension "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/helm"
+	"opendev.org/airship/armada-go/pkg/log"
+	"opendev.org/airship/armada-go/pkg/prune"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// DefaultTimeout limits how long the ArmadaCharts of a chart group may take
+// to go away
+const DefaultTimeout = 10 * time.Minute
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory        config.Factory
+	Manifests      string
+	TargetManifest string
+	// DryRun only prints what would be deleted
+	DryRun bool
+	// PurgeNamespaces deletes namespaces left without ArmadaCharts
+	PurgeNamespaces bool
+	// PurgeCRD deletes the ArmadaChart CRD if no ArmadaCharts are left
+	PurgeCRD bool
+	// Backend is how the charts were installed, apply.BackendOperator if
+	// empty. The releases of apply.BackendHelm are uninstalled directly.
+	Backend string
+	// Timeout limits the wait for the finalizers of every chart group,
+	// DefaultTimeout if zero
+	Timeout time.Duration
+	Out     io.Writer
+	// Log receives messages instead of the global logger, if set
+	Log *log.Logger
+
+	// Actions are the deletions of the last run
+	Actions []prune.Action
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	return c.RunContext(context.Background())
+}
+
+// RunContext deletes the ArmadaCharts of the manifest chart group by chart
+// group in reverse order, the reverse of how apply installed them. Charts of
+// sequenced groups are deleted one by one. Every deletion waits until the
+// operator removed its finalizer, namespaces and the CRD are deleted last.
+func (c *RunCommand) RunContext(ctx context.Context) error {
+	if c.Log == nil {
+		c.Log = log.FromContext(ctx, log.Default())
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	switch c.Backend {
+	case "", apply.BackendOperator:
+	case apply.BackendHelm:
+		if c.PurgeNamespaces || c.PurgeCRD {
+			return fmt.Errorf("purging namespaces or the CRD is not supported by the %s backend", apply.BackendHelm)
+		}
+	default:
+		return fmt.Errorf("unknown backend %q, expected %s or %s", c.Backend, apply.BackendOperator, apply.BackendHelm)
+	}
+	parser := &apply.RunCommand{Factory: c.Factory, Manifests: c.Manifests, TargetManifest: c.TargetManifest,
+		Out: c.Out, Log: c.Log}
+	if c.Factory == nil {
+		parser.Config = config.FromContext(ctx)
+	}
+	if err := parser.LoadConfig(); err != nil {
+		return err
+	}
+	if err := parser.ParseManifests(); err != nil {
+		return err
+	}
+
+	k8sConfig, err := parser.RestConfig()
+	if err != nil {
+		return err
+	}
+	if c.Backend == apply.BackendHelm {
+		return c.uninstall(ctx, &apply.HelmBackend{RestConfig: k8sConfig}, kubernetes.NewForConfigOrDie(k8sConfig),
+			stages(parser))
+	}
+
+	planner := &prune.Planner{
+		Dynamic:         dynamic.NewForConfigOrDie(k8sConfig),
+		Clientset:       kubernetes.NewForConfigOrDie(k8sConfig),
+		PurgeNamespaces: c.PurgeNamespaces,
+		PurgeCRD:        c.PurgeCRD,
+		APIExtensions:   apiextension.NewForConfigOrDie(k8sConfig).ApiextensionsV1(),
+	}
+	actions, err := planner.Delete(ctx, parser.Charts(), fmt.Sprintf("deleting manifest %s", c.Manifests))
+	if err != nil {
+		return err
+	}
+	c.Actions = actions
+	if !c.DryRun {
+		if err := c.execute(ctx, planner, stages(parser), actions); err != nil {
+			return err
+		}
+	}
+	return prune.Print(c.Out, actions, c.DryRun)
+}
+
+// stages returns the ArmadaCharts of the manifest in deletion order, charts
+// of a stage are deleted at once
+func stages(parser *apply.RunCommand) [][]*armadav1.ArmadaChart {
+	m := parser.Manifest()
+	var res [][]*armadav1.ArmadaChart
+	for i := len(m.ChartGroups) - 1; i >= 0; i-- {
+		cg := parser.ChartGroup(m.ChartGroups[i])
+		var charts []*armadav1.ArmadaChart
+		for _, cName := range cg.ChartGroup {
+			charts = append(charts, parser.ConvertCharts(parser.Chart(cName))...)
+		}
+		if !cg.IsSequenced(m.ChartGroupDefaults) {
+			res = append(res, charts)
+			continue
+		}
+		for j := len(charts) - 1; j >= 0; j-- {
+			res = append(res, []*armadav1.ArmadaChart{charts[j]})
+		}
+	}
+	return res
+}
+
+// uninstall deletes the Helm releases installed without ArmadaCharts through
+// the backend stage by stage, releases which aren't deployed are skipped
+func (c *RunCommand) uninstall(ctx context.Context, backend apply.Backend, clientset kubernetes.Interface,
+	stages [][]*armadav1.ArmadaChart) error {
+	reason := fmt.Sprintf("deleting manifest %s", c.Manifests)
+	var actions []prune.Action
+	var deployed [][]*armadav1.ArmadaChart
+	for _, stage := range stages {
+		var charts []*armadav1.ArmadaChart
+		for _, chart := range stage {
+			revisions, err := helm.ListReleases(ctx, clientset, chart.Namespace, chart.Spec.Release)
+			if err != nil {
+				return err
+			}
+			if len(revisions) == 0 {
+				continue
+			}
+			actions = append(actions, prune.Action{Kind: prune.KindHelmRelease, Namespace: chart.Namespace,
+				Name: chart.Spec.Release, Reason: reason})
+			charts = append(charts, chart)
+		}
+		deployed = append(deployed, charts)
+	}
+	c.Actions = actions
+	if !c.DryRun {
+		for _, stage := range deployed {
+			for _, chart := range stage {
+				c.Log.Printf("uninstalling release %s/%s", chart.Namespace, chart.Spec.Release)
+				if err := backend.Delete(ctx, chart); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return prune.Print(c.Out, actions, c.DryRun)
+}
+
+// execute deletes the ArmadaCharts of the actions stage by stage, then the
+// namespaces and the CRD
+func (c *RunCommand) execute(ctx context.Context, planner *prune.Planner, stages [][]*armadav1.ArmadaChart,
+	actions []prune.Action) error {
+	byChart := map[string]prune.Action{}
+	var rest []prune.Action
+	for _, a := range actions {
+		switch a.Kind {
+		case prune.KindArmadaChart:
+			byChart[a.Namespace+"/"+a.Name] = a
+		case prune.KindNamespace, prune.KindCRD:
+			rest = append(rest, a)
+		}
+	}
+
+	for _, stage := range stages {
+		var stageActions []prune.Action
+		for _, chart := range stage {
+			if a, ok := byChart[chart.Namespace+"/"+chart.Name]; ok {
+				stageActions = append(stageActions, a)
+				c.Log.Printf("deleting chart %s/%s", chart.Namespace, chart.Name)
+			}
+		}
+		if len(stageActions) == 0 {
+			continue
+		}
+		if err := planner.Execute(ctx, stageActions); err != nil {
+			return err
+		}
+		if err := planner.WaitDeleted(ctx, stageActions, c.Timeout); err != nil {
+			return err
+		}
+	}
+
+	// namespaces go before the CRD, which would otherwise block their removal
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].Kind == prune.KindNamespace && rest[j].Kind == prune.KindCRD })
+	for _, a := range rest {
+		c.Log.Printf("deleting %s %s", a.Kind, a.Name)
+	}
+	return planner.Execute(ctx, rest)
+}
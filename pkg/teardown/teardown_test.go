@@ -0,0 +1,76 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package teardown
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"slices"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/log"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+func helmChart(name string) *armadav1.ArmadaChart {
+	return &armadav1.ArmadaChart{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openstack", Name: "airship-" + name},
+		Spec:       armadav1.ArmadaChartSpec{Release: "airship-" + name},
+	}
+}
+
+func releaseSecret(release string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openstack", Name: "sh.helm.release.v1." + release + ".v1",
+			Labels: map[string]string{"owner": "helm", "name": release}},
+		Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(
+			[]byte(`{"name":"` + release + `","version":1}`)))},
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	stages := [][]*armadav1.ArmadaChart{
+		{helmChart("keystone")},
+		{helmChart("mariadb"), helmChart("rabbitmq")},
+	}
+	for _, dryRun := range []bool{false, true} {
+		clientset := fake.NewSimpleClientset(releaseSecret("airship-keystone"), releaseSecret("airship-mariadb"))
+		rec := &apply.RecordingBackend{Backend: &apply.FakeBackend{}}
+		c := &RunCommand{Manifests: "site.yaml", DryRun: dryRun, Out: io.Discard, Log: log.New(io.Discard)}
+		if err := c.uninstall(context.Background(), rec, clientset, stages); err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Actions) != 2 || c.Actions[0].Name != "airship-keystone" || c.Actions[1].Name != "airship-mariadb" {
+			t.Errorf("dry run %t: got actions %v, want the keystone and mariadb releases", dryRun, c.Actions)
+		}
+		var got []string
+		for _, call := range rec.Calls() {
+			got = append(got, call.String())
+		}
+		want := []string{"delete openstack/airship-keystone", "delete openstack/airship-mariadb"}
+		if dryRun {
+			want = nil
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("dry run %t: got calls %v, want %v", dryRun, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in a transcript
+const (
+	ApplyStart  = "apply.start"
+	ApplyFinish = "apply.finish"
+	ChartState  = "chart.state"
+	Log         = "log"
+)
+
+// Entry is a single line of a transcript
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Chart   string    `json:"chart,omitempty"`
+	State   string    `json:"state,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Writer appends entries to a JSONL transcript file
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// Create creates or truncates the transcript file at path
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Record writes the entry, setting its time if it's not set
+func (w *Writer) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(e)
+}
+
+// Close flushes and closes the transcript file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Sync(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// each calls fn for every entry of the transcript read from r
+func each(r io.Reader, fn func(e Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// View pretty-prints the transcript read from r to out
+func View(r io.Reader, out io.Writer) error {
+	var start time.Time
+	return each(r, func(e Entry) error {
+		if start.IsZero() {
+			start = e.Time
+		}
+
+		text := e.Message
+		switch e.Action {
+		case ChartState:
+			text = fmt.Sprintf("chart %s %s", e.Chart, e.State)
+		case ApplyFinish:
+			text = "apply finished successfully"
+			if e.Error != "" {
+				text = "apply failed"
+			}
+		}
+		if e.Error != "" {
+			text += ": " + e.Error
+		}
+		_, err := fmt.Fprintf(out, "%s +%-8s %-13s %s\n", e.Time.Format(time.RFC3339),
+			e.Time.Sub(start).Truncate(time.Second), e.Action, text)
+		return err
+	})
+}
+
+// ChartDurations returns how long each chart of the transcript took from
+// installing until ready, charts which never became ready are left out
+func ChartDurations(r io.Reader) (map[string]time.Duration, error) {
+	started := map[string]time.Time{}
+	durations := map[string]time.Duration{}
+	err := each(r, func(e Entry) error {
+		if e.Action != ChartState {
+			return nil
+		}
+		switch e.State {
+		case "installing":
+			started[e.Chart] = e.Time
+		case "ready":
+			if start, ok := started[e.Chart]; ok {
+				durations[e.Chart] = e.Time.Sub(start)
+				delete(started, e.Chart)
+			}
+		}
+		return nil
+	})
+	return durations, err
+}
@@ -0,0 +1,135 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"opendev.org/airship/armada-go/pkg/log"
+)
+
+const (
+	// MinSaneTimeout is the lowest timeout which doesn't trigger a warning
+	MinSaneTimeout = 30 * time.Second
+	// MaxSaneTimeout is the highest timeout which doesn't trigger a warning
+	MaxSaneTimeout = 24 * time.Hour
+)
+
+// ParseDuration parses either a plain number of seconds ("900") or a Go
+// duration string ("15m", "1h30m")
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expected seconds or a value like 15m or 1h30m", s)
+	}
+	return d, nil
+}
+
+// ParseDurations parses NAME=DURATION pairs, durations in the formats of
+// ParseDuration
+func ParseDurations(pairs []string) (map[string]time.Duration, error) {
+	res := make(map[string]time.Duration, len(pairs))
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return nil, fmt.Errorf("invalid %q, expected NAME=DURATION", pair)
+		}
+		d, err := ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		res[name] = d
+	}
+	return res, nil
+}
+
+// WarnSuspiciousTimeout logs a warning if a non-zero timeout is unusually
+// short or long, which is usually a unit mistake
+func WarnSuspiciousTimeout(what string, d time.Duration) {
+	if d == 0 {
+		return
+	}
+	if d < MinSaneTimeout {
+		log.Printf("warning: %s timeout %s is shorter than %s", what, d, MinSaneTimeout)
+	} else if d > MaxSaneTimeout {
+		log.Printf("warning: %s timeout %s is longer than %s", what, d, MaxSaneTimeout)
+	}
+}
+
+// Duration is read from JSON as a number of seconds or as a string in the
+// formats of ParseDuration
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(buf []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s, expected seconds or a value like 15m or 1h30m", buf)
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// DurationValue is a pflag.Value accepting the formats of ParseDuration
+type DurationValue struct {
+	d *time.Duration
+}
+
+// NewDurationValue returns a flag value storing the parsed duration in d
+func NewDurationValue(d *time.Duration) *DurationValue {
+	return &DurationValue{d: d}
+}
+
+func (v *DurationValue) String() string {
+	if v.d == nil {
+		return "0s"
+	}
+	return v.d.String()
+}
+
+func (v *DurationValue) Set(s string) error {
+	d, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v.d = d
+	return nil
+}
+
+func (v *DurationValue) Type() string {
+	return "duration"
+}
@@ -0,0 +1,89 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package verify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics keeps the results of the last check in the Prometheus text
+// exposition format
+type metrics struct {
+	mu        sync.Mutex
+	report    *Report
+	lastCheck time.Time
+	errors    int
+}
+
+func (m *metrics) update(r *Report) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report = r
+	m.lastCheck = r.Time
+}
+
+func (m *metrics) failed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors++
+}
+
+func (m *metrics) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(m.render()))
+	})
+	return mux
+}
+
+func (m *metrics) render() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	metric("armada_verify_errors_total", "counter", "Checks which could not be completed.")
+	fmt.Fprintf(&b, "armada_verify_errors_total %d\n", m.errors)
+	if m.report == nil {
+		return b.String()
+	}
+
+	metric("armada_verify_last_check_timestamp_seconds", "gauge", "Time of the last completed check.")
+	fmt.Fprintf(&b, "armada_verify_last_check_timestamp_seconds %d\n", m.lastCheck.Unix())
+	metric("armada_site_health", "gauge", "1 if all ArmadaCharts of the manifest are ready and match it.")
+	fmt.Fprintf(&b, "armada_site_health %d\n", boolValue(m.report.Healthy()))
+	metric("armada_chart_ready", "gauge", "1 if the ArmadaChart is ready.")
+	for _, ch := range m.report.Charts {
+		fmt.Fprintf(&b, "armada_chart_ready{namespace=%q,chart=%q} %d\n", ch.Namespace, ch.Chart, boolValue(ch.Ready))
+	}
+	metric("armada_chart_drift", "gauge", "1 if the ArmadaChart differs from the manifest.")
+	for _, ch := range m.report.Charts {
+		fmt.Fprintf(&b, "armada_chart_drift{namespace=%q,chart=%q} %d\n", ch.Namespace, ch.Chart, boolValue(ch.Drifted))
+	}
+	return b.String()
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
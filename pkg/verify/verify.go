@@ -0,0 +1,305 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"opendev.org/airship/armada-go/pkg/apply"
+	"opendev.org/airship/armada-go/pkg/config"
+	"opendev.org/airship/armada-go/pkg/log"
+	armadawait "opendev.org/airship/armada-go/pkg/wait"
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// DefaultInterval is the time between checks unless set otherwise
+const DefaultInterval = 10 * time.Minute
+
+// RunCommand phase run command
+type RunCommand struct {
+	Factory        config.Factory
+	Manifests      string
+	TargetManifest string
+	// Interval is the time between checks
+	Interval time.Duration
+	// MetricsAddress serves Prometheus metrics on /metrics, disabled if empty
+	MetricsAddress string
+	// Webhook receives a JSON alert when the site regresses or recovers,
+	// disabled if empty
+	Webhook string
+	// Once runs a single check and fails if the site is unhealthy
+	Once bool
+	Out  io.Writer
+}
+
+// ChartResult is the state of a single ArmadaChart
+type ChartResult struct {
+	Chart     string `json:"chart"`
+	Namespace string `json:"namespace"`
+	Ready     bool   `json:"ready"`
+	Drifted   bool   `json:"drifted"`
+	// Orphaned charts carry the ownership labels of the manifest, which no
+	// longer has them
+	Orphaned bool   `json:"orphaned,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Healthy returns whether the chart is ready and matches the manifest
+func (r ChartResult) Healthy() bool {
+	return r.Ready && !r.Drifted && !r.Orphaned
+}
+
+// Report is the result of a check
+type Report struct {
+	Time   time.Time     `json:"time"`
+	Charts []ChartResult `json:"charts"`
+}
+
+// Healthy returns whether all charts are healthy
+func (r *Report) Healthy() bool {
+	for _, ch := range r.Charts {
+		if !ch.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// Alert is posted to the webhook
+type Alert struct {
+	// Event is regression or recovered
+	Event     string        `json:"event"`
+	Manifests string        `json:"manifests"`
+	Time      time.Time     `json:"time"`
+	Healthy   bool          `json:"healthy"`
+	Charts    []ChartResult `json:"charts,omitempty"`
+}
+
+// RunE runs the phase
+func (c *RunCommand) RunE() error {
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Once {
+		report, err := c.check(context.Background())
+		if err != nil {
+			return err
+		}
+		if err := c.print(report); err != nil {
+			return err
+		}
+		if !report.Healthy() {
+			return errors.New("site is not healthy")
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	m := &metrics{}
+	if c.MetricsAddress != "" {
+		srv := &http.Server{Addr: c.MetricsAddress, Handler: m.handler()}
+		go func() {
+			log.Printf("serving metrics on %s/metrics", c.MetricsAddress)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("metrics server failed: %s", err.Error())
+				stop()
+			}
+		}()
+		defer func() { _ = srv.Shutdown(context.Background()) }()
+	}
+
+	log.Printf("verifying %s every %s", c.Manifests, c.Interval)
+	var previous *Report
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := c.check(ctx)
+		if err != nil {
+			log.Printf("verification failed: %s", err.Error())
+			m.failed()
+		} else {
+			m.update(report)
+			if err := c.print(report); err != nil {
+				return err
+			}
+			c.alert(ctx, previous, report)
+			previous = report
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("verification stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check compares ArmadaCharts in the cluster with the manifest, which is
+// parsed again every time so updates of the manifest are picked up
+func (c *RunCommand) check(ctx context.Context) (*Report, error) {
+	parser := &apply.RunCommand{Factory: c.Factory, Manifests: c.Manifests, TargetManifest: c.TargetManifest,
+		Out: io.Discard}
+	if err := parser.LoadConfig(); err != nil {
+		return nil, err
+	}
+	if err := parser.ParseManifests(); err != nil {
+		return nil, err
+	}
+	restConfig, err := parser.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+	resClient := dynamic.NewForConfigOrDie(restConfig).Resource(schema.GroupVersionResource{
+		Group:    armadav1.ArmadaChartGroup,
+		Version:  armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural,
+	})
+
+	report := &Report{Time: time.Now()}
+	for _, chart := range parser.Charts() {
+		result := ChartResult{Chart: chart.Name, Namespace: chart.Namespace}
+		live, err := resClient.Namespace(chart.Namespace).Get(ctx, chart.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			result.Reason = "missing"
+			report.Charts = append(report.Charts, result)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		result.Ready, result.Reason = armadawait.IsReady(live)
+		diff, err := apply.Drift(chart, live)
+		if err != nil {
+			return nil, err
+		}
+		if diff != "" {
+			result.Drifted = true
+			log.Debugf("chart %s/%s drifted from the manifest (-manifest +live):\n%s", chart.Namespace, chart.Name, diff)
+			if result.Reason == "" {
+				result.Reason = "spec differs from the manifest"
+			}
+		}
+		if reason := parser.NotOwned(live); reason != "" {
+			result.Drifted = true
+			if result.Reason == "" {
+				result.Reason = reason
+			}
+		}
+		report.Charts = append(report.Charts, result)
+	}
+	orphans, err := parser.Orphans(ctx, resClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, live := range orphans {
+		result := ChartResult{Chart: live.GetName(), Namespace: live.GetNamespace(), Orphaned: true,
+			Reason: "not in manifest " + parser.Manifest().Metadata.Name}
+		result.Ready, _ = armadawait.IsReady(&live)
+		report.Charts = append(report.Charts, result)
+	}
+	return report, nil
+}
+
+// print writes unhealthy charts and a summary
+func (c *RunCommand) print(report *Report) error {
+	unhealthy := 0
+	tw := tabwriter.NewWriter(c.Out, 0, 4, 2, ' ', 0)
+	for _, ch := range report.Charts {
+		if ch.Healthy() {
+			continue
+		}
+		if unhealthy == 0 {
+			_, _ = fmt.Fprintln(tw, "NAMESPACE\tCHART\tREADY\tDRIFTED\tREASON")
+		}
+		unhealthy++
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%v\t%v\t%s\n", ch.Namespace, ch.Chart, ch.Ready, ch.Drifted, ch.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(c.Out, "%s: %d of %d charts healthy\n", report.Time.Format(time.RFC3339),
+		len(report.Charts)-unhealthy, len(report.Charts))
+	return err
+}
+
+// alert posts charts which became unhealthy since the previous report, or
+// the recovery of the site. The site is assumed healthy before the first
+// report so problems found on start are reported too.
+func (c *RunCommand) alert(ctx context.Context, previous, report *Report) {
+	if c.Webhook == "" {
+		return
+	}
+	wasHealthy := map[string]bool{}
+	if previous != nil {
+		for _, ch := range previous.Charts {
+			wasHealthy[ch.Namespace+"/"+ch.Chart] = ch.Healthy()
+		}
+	}
+	a := &Alert{Event: "regression", Manifests: c.Manifests, Time: report.Time, Healthy: report.Healthy()}
+	for _, ch := range report.Charts {
+		healthy, seen := wasHealthy[ch.Namespace+"/"+ch.Chart]
+		if !ch.Healthy() && (healthy || !seen) {
+			a.Charts = append(a.Charts, ch)
+		}
+	}
+	if len(a.Charts) == 0 {
+		if previous == nil || previous.Healthy() || !report.Healthy() {
+			return
+		}
+		a.Event = "recovered"
+	}
+
+	buf, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("unable to encode alert: %s", err.Error())
+		return
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, c.Webhook, bytes.NewReader(buf))
+	if err != nil {
+		log.Printf("unable to send alert: %s", err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("unable to send alert: %s", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("alert webhook answered %s", resp.Status)
+		return
+	}
+	log.Printf("%s alert sent for %d charts", a.Event, len(a.Charts))
+}
@@ -0,0 +1,95 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package version reports the build of armada-go, the variables are set at
+// build time:
+//
+//	go build -ldflags "-X opendev.org/airship/armada-go/pkg/version.version=1.2.0 \
+//	  -X opendev.org/airship/armada-go/pkg/version.gitCommit=$(git rev-parse HEAD) \
+//	  -X opendev.org/airship/armada-go/pkg/version.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+var (
+	version   = "dev"
+	gitCommit = ""
+	buildDate = ""
+)
+
+// APIVersions are the versions of the Armada API served by armada-go
+var APIVersions = []string{"v1.0"}
+
+// Info describes the build of armada-go
+type Info struct {
+	Version     string   `json:"version"`
+	GitCommit   string   `json:"git_commit,omitempty"`
+	BuildDate   string   `json:"build_date,omitempty"`
+	GoVersion   string   `json:"go_version"`
+	Platform    string   `json:"platform"`
+	APIVersions []string `json:"api_versions"`
+	// ArmadaChartVersion is the ArmadaChart API version armada-go writes
+	ArmadaChartVersion string `json:"armadachart_version"`
+}
+
+// Get returns the build information, the commit and date recorded by the Go
+// toolchain are used if they weren't set at build time
+func Get() Info {
+	info := Info{
+		Version:            version,
+		GitCommit:          gitCommit,
+		BuildDate:          buildDate,
+		GoVersion:          runtime.Version(),
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		APIVersions:        APIVersions,
+		ArmadaChartVersion: armadav1.ArmadaChartAPIVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && gitCommit == "" {
+		modified := false
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.GitCommit = s.Value
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && info.GitCommit != "" {
+			info.GitCommit += "-dirty"
+		}
+	}
+	return info
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("armada-go %s (commit %s, built %s, %s %s)", i.Version, orUnknown(i.GitCommit),
+		orUnknown(i.BuildDate), i.GoVersion, i.Platform)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ParseFor parses a readiness criterion the way kubectl wait --for does:
+//
+//	condition=Available              the condition has status True
+//	condition=Available=False        the condition has the given status
+//	jsonpath={.status.phase}=Running the expression evaluates to the value
+//	jsonpath={.status.readyReplicas} the expression evaluates to anything
+func ParseFor(s string) (Evaluator, error) {
+	switch {
+	case strings.HasPrefix(s, "condition="):
+		condType, status, found := strings.Cut(strings.TrimPrefix(s, "condition="), "=")
+		if !found {
+			status = "True"
+		}
+		if condType == "" {
+			return nil, fmt.Errorf("invalid wait criterion %q, the condition type is empty", s)
+		}
+		return conditionReady(condType, status), nil
+	case strings.HasPrefix(s, "jsonpath="):
+		expr := strings.TrimPrefix(s, "jsonpath=")
+		var value *string
+		if strings.HasPrefix(expr, "{") {
+			if i := strings.LastIndex(expr, "}="); i >= 0 {
+				v := expr[i+2:]
+				expr, value = expr[:i+1], &v
+			}
+		} else {
+			// relaxed form without braces, like kubectl accepts
+			path, v, found := strings.Cut(expr, "=")
+			expr = "{" + path + "}"
+			if found {
+				value = &v
+			}
+		}
+		jp := jsonpath.New("for").AllowMissingKeys(true)
+		if err := jp.Parse(expr); err != nil {
+			return nil, fmt.Errorf("invalid wait criterion %q: %w", s, err)
+		}
+		return jsonPathReady(jp, expr, value), nil
+	default:
+		return nil, fmt.Errorf("invalid wait criterion %q, expected condition=TYPE[=STATUS] or jsonpath={EXPR}[=VALUE]", s)
+	}
+}
+
+// conditionReady accepts objects having the status condition with the
+// status, types and statuses are compared ignoring case
+func conditionReady(condType, status string) Evaluator {
+	return func(obj *unstructured.Unstructured) (bool, string) {
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, cond := range conditions {
+			cm, ok := cond.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if t, _ := cm["type"].(string); !strings.EqualFold(t, condType) {
+				continue
+			}
+			if s, _ := cm["status"].(string); strings.EqualFold(s, status) {
+				return true, ""
+			}
+			message, _ := cm["message"].(string)
+			return false, fmt.Sprintf("condition %s is %v: %s", condType, cm["status"], message)
+		}
+		return false, fmt.Sprintf("condition %s is not reported", condType)
+	}
+}
+
+// jsonPathReady accepts objects where every result of the expression equals
+// the value, or where the expression has any result if value is nil
+func jsonPathReady(jp *jsonpath.JSONPath, expr string, value *string) Evaluator {
+	return func(obj *unstructured.Unstructured) (bool, string) {
+		results, err := jp.FindResults(obj.Object)
+		if err != nil {
+			return false, err.Error()
+		}
+		var found []string
+		for _, rs := range results {
+			for _, r := range rs {
+				if r.IsValid() && r.CanInterface() {
+					found = append(found, fmt.Sprint(r.Interface()))
+				}
+			}
+		}
+		if len(found) == 0 {
+			return false, fmt.Sprintf("%s is not set", expr)
+		}
+		if value == nil {
+			return true, ""
+		}
+		for _, f := range found {
+			if f != *value {
+				return false, fmt.Sprintf("%s is %s, waiting for %s", expr, strings.Join(found, ","), *value)
+			}
+		}
+		return true, ""
+	}
+}
+
+// discoverResource resolves a resource type without a built-in readiness
+// check, like certificates, certificates.cert-manager.io or
+// certificates.v1.cert-manager.io, using the API discovery
+func discoverResource(restConfig *rest.Config, resourceType string) (schema.GroupVersionResource, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	fullySpecified, gr := schema.ParseResourceArg(strings.ToLower(resourceType))
+	if fullySpecified != nil {
+		if gvr, err := mapper.ResourceFor(*fullySpecified); err == nil {
+			return gvr, nil
+		}
+	}
+	gvr, err := mapper.ResourceFor(gr.WithVersion(""))
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("unable to find resource type %q: %w", resourceType, err)
+	}
+	return gvr, nil
+}
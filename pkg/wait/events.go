@@ -0,0 +1,152 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Limits of the events collected when a wait times out
+const (
+	maxEventObjects   = 10
+	maxObjectEvents   = 5
+	eventQueryTimeout = 10 * time.Second
+)
+
+// Event is a warning event of a resource which isn't ready
+type Event struct {
+	// Object is the involved object as kind/name
+	Object   string    `json:"object"`
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// reportEvents logs and records the recent warning events of the resources
+// which aren't ready. For ArmadaCharts the pods selected by data.wait.labels
+// are looked at as well, they are what the chart is usually stuck on.
+func (c *WaitOptions) reportEvents(parent context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), eventQueryTimeout)
+	defer cancel()
+	client, err := kubernetes.NewForConfig(c.RestConfig)
+	if err != nil {
+		c.Logger.Info("unable to collect events", "error", err.Error())
+		return
+	}
+
+	var events []Event
+	for _, obj := range c.recorder.unready(maxEventObjects) {
+		involved := []*unstructured.Unstructured{obj}
+		if c.kind.gvr.Resource == ArmadaCharts {
+			pods, err := c.unreadyPods(ctx, client, obj)
+			if err != nil {
+				c.Logger.Info("unable to list pods of chart", "chart", obj.GetName(), "error", err.Error())
+			}
+			involved = append(involved, pods...)
+		}
+		for _, o := range involved {
+			found, err := objectEvents(ctx, client, o)
+			if err != nil {
+				c.Logger.Info("unable to list events", "object", o.GetName(), "error", err.Error())
+				continue
+			}
+			events = append(events, found...)
+		}
+	}
+
+	for _, e := range events {
+		c.Logger.Info(fmt.Sprintf("event %s %s: %s", e.Object, e.Reason, e.Message),
+			"count", e.Count, "last_seen", e.LastSeen.Format(time.RFC3339))
+	}
+	c.recorder.setEvents(events)
+}
+
+// unreadyPods returns the pods selected by the wait labels of the chart which
+// aren't ready
+func (c *WaitOptions) unreadyPods(ctx context.Context, client kubernetes.Interface,
+	chart *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	waitLabels, _, _ := unstructured.NestedStringMap(chart.Object, "data", "wait", "labels")
+	if len(waitLabels) == 0 {
+		return nil, nil
+	}
+	pods, err := client.CoreV1().Pods(chart.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(waitLabels).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []*unstructured.Unstructured
+	for i := range pods.Items {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pods.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		pod := &unstructured.Unstructured{Object: obj}
+		pod.SetKind("Pod")
+		if ready, _ := podReady(pod); !ready {
+			res = append(res, pod)
+		}
+	}
+	return res, nil
+}
+
+// objectEvents returns the latest warning events of the object, oldest first
+func objectEvents(ctx context.Context, client kubernetes.Interface, obj *unstructured.Unstructured) ([]Event, error) {
+	list, err := client.CoreV1().Events(obj.GetNamespace()).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.uid": string(obj.GetUID()), "type": corev1.EventTypeWarning}.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(list.Items))
+	for _, e := range list.Items {
+		events = append(events, Event{
+			Object:   fmt.Sprintf("%s/%s", e.InvolvedObject.Kind, e.InvolvedObject.Name),
+			Reason:   e.Reason,
+			Message:  e.Message,
+			Count:    e.Count,
+			LastSeen: lastSeen(e),
+		})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].LastSeen.Before(events[j].LastSeen) })
+	if len(events) > maxObjectEvents {
+		events = events[len(events)-maxObjectEvents:]
+	}
+	return events, nil
+}
+
+func lastSeen(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	case !e.FirstTimestamp.IsZero():
+		return e.FirstTimestamp.Time
+	}
+	return e.CreationTimestamp.Time
+}
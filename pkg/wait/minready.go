@@ -0,0 +1,68 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minReady is the parsed form of WaitOptions.MinReady, either an absolute
+// number of resources or a percentage of the matched resources
+type minReady struct {
+	value   int
+	percent bool
+}
+
+// parseMinReady accepts an absolute count like "2" or a percentage like
+// "75%", an empty value requires all resources to be ready
+func parseMinReady(s string) (*minReady, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	m := &minReady{}
+	number := s
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		m.percent = true
+		number = strings.TrimSpace(v)
+	}
+	value, err := strconv.Atoi(number)
+	if err != nil || value < 0 || (m.percent && value > 100) {
+		return nil, fmt.Errorf("invalid min ready %q, expected a count or a percentage between 0%% and 100%%", s)
+	}
+	m.value = value
+	return m, nil
+}
+
+// required returns how many of total resources have to be ready, a
+// percentage is rounded up as in classic Armada
+func (m *minReady) required(total int) int {
+	if m == nil {
+		return total
+	}
+	if m.percent {
+		return (total*m.value + 99) / 100
+	}
+	return m.value
+}
+
+func (m *minReady) String() string {
+	if m.percent {
+		return fmt.Sprintf("%d%%", m.value)
+	}
+	return strconv.Itoa(m.value)
+}
@@ -0,0 +1,56 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+// Observer is notified about the progress of a wait so callers don't have
+// to parse its log. The calls of a wait don't overlap.
+type Observer interface {
+	// OnResourceReady is called when a resource is seen ready, after being
+	// seen not ready or for the first time
+	OnResourceReady(r ResourceResult)
+	// OnResourceUnready is called when a resource is seen not ready for the
+	// first time or for another reason
+	OnResourceUnready(r ResourceResult)
+	// OnTimeout is called with the result when the wait times out
+	OnTimeout(r *WaitResult)
+}
+
+// ObserverFuncs is an Observer calling the functions which are set
+type ObserverFuncs struct {
+	Ready   func(r ResourceResult)
+	Unready func(r ResourceResult)
+	Timeout func(r *WaitResult)
+}
+
+// OnResourceReady implements Observer
+func (o ObserverFuncs) OnResourceReady(r ResourceResult) {
+	if o.Ready != nil {
+		o.Ready(r)
+	}
+}
+
+// OnResourceUnready implements Observer
+func (o ObserverFuncs) OnResourceUnready(r ResourceResult) {
+	if o.Unready != nil {
+		o.Unready(r)
+	}
+}
+
+// OnTimeout implements Observer
+func (o ObserverFuncs) OnTimeout(r *WaitResult) {
+	if o.Timeout != nil {
+		o.Timeout(r)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultOperatorTimeout is how long charts may stay unobserved by the
+// operator before a wait fails, unless OperatorTimeout is set
+const DefaultOperatorTimeout = 5 * time.Minute
+
+// ErrOperatorNotReconciling is returned if the operator doesn't pick up
+// changed charts, it's usually down or unable to reach the API server
+var ErrOperatorNotReconciling = errors.New("armada-operator is not reconciling")
+
+// operatorHint tells users where to look instead of debugging their charts
+const operatorHint = "check that the armada-operator pod is running and its logs, " +
+	"e.g. kubectl get pods -A | grep armada-operator"
+
+// stallDetector notices that the operator stopped reconciling: charts whose
+// generation isn't observed while no status of any watched chart changes.
+// Charts being installed have their generation observed, so long running
+// installs aren't mistaken for a stalled operator.
+type stallDetector struct {
+	timeout time.Duration
+
+	mu sync.Mutex
+	// lastChange is the time the status of a watched chart last changed
+	lastChange time.Time
+	status     map[string]any
+	pending    map[string]bool
+}
+
+func newStallDetector(timeout time.Duration) *stallDetector {
+	return &stallDetector{
+		timeout:    timeout,
+		lastChange: time.Now(),
+		status:     map[string]any{},
+		pending:    map[string]bool{},
+	}
+}
+
+// observe records the status of obj, seeing an object for the first time
+// isn't a change as it happens again whenever resources are listed
+func (d *stallDetector) observe(obj *unstructured.Unstructured) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := objectKey(obj)
+	status := obj.Object["status"]
+	if prev, ok := d.status[key]; ok && !reflect.DeepEqual(prev, status) {
+		d.lastChange = time.Now()
+	}
+	d.status[key] = status
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < obj.GetGeneration() {
+		d.pending[key] = true
+	} else {
+		delete(d.pending, key)
+	}
+}
+
+func (d *stallDetector) remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.status, key)
+	delete(d.pending, key)
+}
+
+// check returns ErrOperatorNotReconciling if charts are pending and nothing
+// changed for longer than idle
+func (d *stallDetector) check(idle time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	since := time.Since(d.lastChange)
+	if len(d.pending) == 0 || since < idle {
+		return nil
+	}
+	names := make([]string, 0, len(d.pending))
+	for name := range d.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("%w: %d of %d charts not observed, no status update for %s (%s); %s",
+		ErrOperatorNotReconciling, len(names), len(d.status), since.Round(time.Second),
+		strings.Join(names, ", "), operatorHint)
+}
+
+// run cancels ctx once the operator is considered stalled
+func (d *stallDetector) run(ctx context.Context, cancel context.CancelCauseFunc) {
+	interval := min(d.timeout/4, 10*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.check(d.timeout); err != nil {
+				cancel(err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	armadav1 "opendev.org/airship/armada-operator/api/v1"
+)
+
+// Evaluator returns whether an object is ready and the reason if it is not
+type Evaluator func(obj *unstructured.Unstructured) (bool, string)
+
+// resourceKind is a resource type the wait package knows how to evaluate
+type resourceKind struct {
+	gvr   schema.GroupVersionResource
+	ready Evaluator
+}
+
+// ArmadaCharts is the resource type of ArmadaCharts
+const ArmadaCharts = armadav1.ArmadaChartPlural
+
+var resourceKinds = map[string]resourceKind{
+	ArmadaCharts: {schema.GroupVersionResource{Group: armadav1.ArmadaChartGroup, Version: armadav1.ArmadaChartVersion,
+		Resource: armadav1.ArmadaChartPlural}, IsReady},
+	"pods":         {schema.GroupVersionResource{Version: "v1", Resource: "pods"}, podReady},
+	"jobs":         {schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, jobReady},
+	"deployments":  {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, deploymentReady},
+	"statefulsets": {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, statefulSetReady},
+	"daemonsets":   {schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, daemonSetReady},
+}
+
+// ResourceTypes returns the resource types with built-in readiness checks
+func ResourceTypes() []string {
+	return []string{ArmadaCharts, "pods", "jobs", "deployments", "statefulsets", "daemonsets"}
+}
+
+// lookupResource resolves a resource type, singular names like "job" are
+// accepted the way classic Armada did
+func lookupResource(resourceType string) (resourceKind, error) {
+	name := strings.ToLower(resourceType)
+	if name == "" {
+		name = ArmadaCharts
+	}
+	if kind, ok := resourceKinds[name]; ok {
+		return kind, nil
+	}
+	if kind, ok := resourceKinds[name+"s"]; ok {
+		return kind, nil
+	}
+	return resourceKind{}, fmt.Errorf("unsupported resource type %q, expected one of %s or a readiness criterion",
+		resourceType, strings.Join(ResourceTypes(), ", "))
+}
+
+func nestedInt(obj *unstructured.Unstructured, fields ...string) int64 {
+	v, _, _ := unstructured.NestedInt64(obj.Object, fields...)
+	return v
+}
+
+// generationObserved returns a reason if the controller hasn't seen the
+// latest spec yet
+func generationObserved(obj *unstructured.Unstructured) string {
+	if observed := nestedInt(obj, "status", "observedGeneration"); observed < obj.GetGeneration() {
+		return fmt.Sprintf("observed generation %d is behind %d", observed, obj.GetGeneration())
+	}
+	return ""
+}
+
+// condition returns the status and message of a status condition
+func condition(obj *unstructured.Unstructured, condType string) (string, string, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, cond := range conditions {
+		cm, ok := cond.(map[string]interface{})
+		if !ok || cm["type"] != condType {
+			continue
+		}
+		status, _ := cm["status"].(string)
+		message, _ := cm["message"].(string)
+		return status, message, true
+	}
+	return "", "", false
+}
+
+// podReady accepts running pods passing their readiness checks and pods
+// which completed successfully
+func podReady(obj *unstructured.Unstructured) (bool, string) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return true, ""
+	case "Running":
+		if status, _, _ := condition(obj, "Ready"); status == "True" {
+			return true, ""
+		}
+		return false, "containers are not ready"
+	default:
+		return false, fmt.Sprintf("phase is %s", phase)
+	}
+}
+
+func jobReady(obj *unstructured.Unstructured) (bool, string) {
+	if status, message, _ := condition(obj, "Failed"); status == "True" {
+		return false, fmt.Sprintf("failed: %s", message)
+	}
+	completions, found, _ := unstructured.NestedInt64(obj.Object, "spec", "completions")
+	if !found {
+		completions = 1
+	}
+	if succeeded := nestedInt(obj, "status", "succeeded"); succeeded < completions {
+		return false, fmt.Sprintf("%d of %d completions succeeded", succeeded, completions)
+	}
+	return true, ""
+}
+
+// deploymentReady follows `kubectl rollout status`
+func deploymentReady(obj *unstructured.Unstructured) (bool, string) {
+	if reason := generationObserved(obj); reason != "" {
+		return false, reason
+	}
+	if status, _, _ := condition(obj, "Progressing"); status == "False" {
+		return false, "rollout exceeded its progress deadline"
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated := nestedInt(obj, "status", "updatedReplicas")
+	if updated < replicas {
+		return false, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+	}
+	if total := nestedInt(obj, "status", "replicas"); total > updated {
+		return false, fmt.Sprintf("%d old replicas pending termination", total-updated)
+	}
+	if available := nestedInt(obj, "status", "availableReplicas"); available < updated {
+		return false, fmt.Sprintf("%d of %d updated replicas available", available, updated)
+	}
+	return true, ""
+}
+
+func statefulSetReady(obj *unstructured.Unstructured) (bool, string) {
+	if reason := generationObserved(obj); reason != "" {
+		return false, reason
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	if ready := nestedInt(obj, "status", "readyReplicas"); ready < replicas {
+		return false, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+	}
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return true, ""
+	}
+	if partition := nestedInt(obj, "spec", "updateStrategy", "rollingUpdate", "partition"); partition > 0 {
+		if updated := nestedInt(obj, "status", "updatedReplicas"); updated < replicas-partition {
+			return false, fmt.Sprintf("%d of %d replicas above the partition updated", updated, replicas-partition)
+		}
+		return true, ""
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if current != update {
+		return false, fmt.Sprintf("rolling update to revision %s in progress", update)
+	}
+	return true, ""
+}
+
+func daemonSetReady(obj *unstructured.Unstructured) (bool, string) {
+	if reason := generationObserved(obj); reason != "" {
+		return false, reason
+	}
+	desired := nestedInt(obj, "status", "desiredNumberScheduled")
+	if updated := nestedInt(obj, "status", "updatedNumberScheduled"); updated < desired {
+		return false, fmt.Sprintf("%d of %d pods updated", updated, desired)
+	}
+	if available := nestedInt(obj, "status", "numberAvailable"); available < desired {
+		return false, fmt.Sprintf("%d of %d pods available", available, desired)
+	}
+	return true, ""
+}
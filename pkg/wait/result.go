@@ -0,0 +1,244 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// WaitResult describes the resources a wait matched and how it ended
+type WaitResult struct {
+	ResourceType  string           `json:"resource_type"`
+	Namespace     string           `json:"namespace"`
+	LabelSelector string           `json:"label_selector"`
+	MinReady      string           `json:"min_ready,omitempty"`
+	For           string           `json:"for,omitempty"`
+	Started       time.Time        `json:"started"`
+	Duration      time.Duration    `json:"duration"`
+	Ready         bool             `json:"ready"`
+	Error         string           `json:"error,omitempty"`
+	Resources     []ResourceResult `json:"resources"`
+	// Events are recent warnings of resources which weren't ready when the
+	// wait timed out
+	Events []Event `json:"events,omitempty"`
+}
+
+// ResourceResult is the last known state of a matched resource
+type ResourceResult struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	// Reason explains why the resource isn't ready
+	Reason string `json:"reason,omitempty"`
+	// ReadyAfter is the time from the start of the wait until the resource
+	// became ready, zero if it was ready when first seen
+	ReadyAfter time.Duration `json:"ready_after,omitempty"`
+	// Deleted is set for resources deleted during the wait
+	Deleted bool `json:"deleted,omitempty"`
+
+	obj *unstructured.Unstructured
+}
+
+// NotReady returns the resources which aren't ready
+func (r *WaitResult) NotReady() []ResourceResult {
+	var res []ResourceResult
+	for _, rr := range r.Resources {
+		if !rr.Ready && !rr.Deleted {
+			res = append(res, rr)
+		}
+	}
+	return res
+}
+
+// resultRecorder keeps the state of every resource seen during a wait,
+// across relists of the watch
+type resultRecorder struct {
+	started time.Time
+
+	mu        sync.Mutex
+	resources map[string]*ResourceResult
+	events    []Event
+}
+
+func newResultRecorder() *resultRecorder {
+	return &resultRecorder{started: time.Now(), resources: map[string]*ResourceResult{}}
+}
+
+// set records the state of the object and returns it, changed is false if
+// the object was seen before in the same state for the same reason
+func (r *resultRecorder) set(obj *unstructured.Unstructured, ready bool, reason string) (ResourceResult, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := objectKey(obj)
+	rr, seen := r.resources[key]
+	if !seen {
+		rr = &ResourceResult{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		r.resources[key] = rr
+	}
+	if ready && !rr.Ready && seen {
+		rr.ReadyAfter = time.Since(r.started)
+	}
+	changed := !seen || rr.Deleted || rr.Ready != ready || rr.Reason != reason
+	rr.Ready, rr.Reason, rr.Deleted, rr.obj = ready, reason, false, obj
+	return *rr, changed
+}
+
+// unready returns up to limit objects which aren't ready, by namespace and
+// name
+func (r *resultRecorder) unready(limit int) []*unstructured.Unstructured {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for key, rr := range r.resources {
+		if !rr.Ready && !rr.Deleted {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var res []*unstructured.Unstructured
+	for _, key := range keys {
+		if len(res) == limit {
+			break
+		}
+		res = append(res, r.resources[key].obj)
+	}
+	return res
+}
+
+func (r *resultRecorder) setEvents(events []Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = events
+}
+
+func (r *resultRecorder) remove(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rr, ok := r.resources[key]; ok {
+		rr.Deleted = true
+	}
+}
+
+// maxSummaryResources is the number of unready resources named in a summary
+const maxSummaryResources = 5
+
+// summary describes how many resources are ready and why the first of the
+// others are not
+func (r *resultRecorder) summary(c *WaitOptions) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	total := 0
+	for name, rr := range r.resources {
+		if rr.Deleted {
+			continue
+		}
+		total++
+		if !rr.Ready {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	msg := fmt.Sprintf("%d of %d %s with labels %s ready after %s", total-len(names), total,
+		c.kind.gvr.Resource, c.LabelSelector, time.Since(r.started).Round(time.Second))
+	if len(names) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	for i, name := range names {
+		if i == maxSummaryResources {
+			fmt.Fprintf(&b, ", and %d more", len(names)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s (%s)", name, r.resources[name].Reason)
+	}
+	return msg + ", waiting for " + b.String()
+}
+
+func (r *resultRecorder) result(c *WaitOptions, err error) *WaitResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := &WaitResult{
+		ResourceType:  c.ResourceType,
+		Namespace:     c.Namespace,
+		LabelSelector: c.LabelSelector,
+		MinReady:      c.MinReady,
+		For:           c.For,
+		Started:       r.started,
+		Duration:      time.Since(r.started),
+		Ready:         err == nil,
+		Resources:     make([]ResourceResult, 0, len(r.resources)),
+		Events:        r.events,
+	}
+	if c.kind.gvr.Resource != "" {
+		res.ResourceType = c.kind.gvr.Resource
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	for _, rr := range r.resources {
+		res.Resources = append(res.Resources, *rr)
+	}
+	sort.Slice(res.Resources, func(i, j int) bool {
+		a, b := res.Resources[i], res.Resources[j]
+		return a.Namespace < b.Namespace || a.Namespace == b.Namespace && a.Name < b.Name
+	})
+	return res
+}
+
+// PrintResult writes a table of the resources which aren't ready
+func PrintResult(out io.Writer, r *WaitResult) error {
+	notReady := r.NotReady()
+	if _, err := fmt.Fprintf(out, "%d of %d %s ready after %s\n", len(r.Resources)-len(notReady),
+		len(r.Resources), r.ResourceType, r.Duration.Round(time.Second)); err != nil {
+		return err
+	}
+	if len(notReady) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tREASON")
+	for _, rr := range notReady {
+		name := rr.Name
+		if r.Namespace == "" && rr.Namespace != "" {
+			name = rr.Namespace + "/" + rr.Name
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", name, rr.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(r.Events) == 0 {
+		return nil
+	}
+	_, _ = fmt.Fprintln(out, "\nRecent warning events:")
+	tw = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "LAST SEEN\tOBJECT\tREASON\tMESSAGE")
+	for _, e := range r.Events {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.LastSeen.Format(time.RFC3339), e.Object, e.Reason, e.Message)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,105 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// MaxWatchRetries is how many times in a row a failed list or watch is
+// retried before the wait fails
+const MaxWatchRetries = 5
+
+// watchHealthyAfter is how long a watch has to stay open to count as
+// healthy, a healthy watch resets the retries
+const watchHealthyAfter = time.Minute
+
+// errRetriesExhausted marks errors of lists and watches which kept failing
+var errRetriesExhausted = errors.New("giving up")
+
+// retrier bounds the retries of transient list and watch failures and
+// backs off between them
+type retrier struct {
+	attempts int
+	backoff  k8swait.Backoff
+}
+
+func newRetrier() *retrier {
+	r := &retrier{}
+	r.reset()
+	return r
+}
+
+func (r *retrier) reset() {
+	r.attempts = 0
+	r.backoff = k8swait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: MaxWatchRetries, Cap: 30 * time.Second}
+}
+
+// retry sleeps before the next attempt, it returns an error if err isn't
+// transient, the retries are used up or ctx is done
+func (r *retrier) retry(ctx context.Context, err error) error {
+	if !transient(err) || errors.Is(err, errRetriesExhausted) {
+		return err
+	}
+	if r.attempts == MaxWatchRetries {
+		return fmt.Errorf("%w after %d retries: %w", errRetriesExhausted, r.attempts, err)
+	}
+	r.attempts++
+	select {
+	case <-ctx.Done():
+		return err
+	case <-time.After(r.backoff.Step()):
+		return nil
+	}
+}
+
+// transient returns whether err is likely to go away, like a closed watch,
+// a restarting API server or a network blip
+func transient(err error) bool {
+	var apiErr *APIError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, watchtools.ErrWatchClosed), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &apiErr):
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	case utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return true
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
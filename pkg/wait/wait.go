@@ -0,0 +1,394 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// WaitOptions describes a set of resources to wait for
+type WaitOptions struct {
+	RestConfig    *rest.Config
+	Namespace     string
+	LabelSelector string
+	// ResourceType is one of ResourceTypes, armadacharts if empty. Other
+	// resource types, like certificates.cert-manager.io, need For.
+	ResourceType string
+	// For is a readiness criterion replacing the built-in check of the
+	// resource type, see ParseFor
+	For     string
+	Timeout time.Duration
+	// MinReady is the number, like "2", or percentage, like "75%", of the
+	// matched resources which have to be ready, all of them if empty
+	MinReady string
+	// OperatorTimeout is how long charts may stay unobserved without any
+	// status update before the wait fails with ErrOperatorNotReconciling,
+	// DefaultOperatorTimeout if zero, disabled if negative
+	OperatorTimeout time.Duration
+	// ProgressInterval is how often a summary of the resources which are not
+	// ready yet is logged, DefaultProgressInterval if zero, disabled if negative
+	ProgressInterval time.Duration
+	// Observers are notified about resources becoming ready or not and
+	// about the timeout
+	Observers []Observer
+	Logger    logr.Logger
+
+	kind     resourceKind
+	minReady *minReady
+	stall    *stallDetector
+	recorder *resultRecorder
+}
+
+// DefaultProgressInterval is how often waits log a progress summary
+const DefaultProgressInterval = 30 * time.Second
+
+// APIError is the structured form of an ERROR event received from the watch
+type APIError struct {
+	Code    int32
+	Reason  metav1.StatusReason
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("watch error %d %s: %s", e.Code, e.Reason, e.Message)
+}
+
+// Expired returns true if the watched resource version is too old and
+// resources have to be listed again
+func (e *APIError) Expired() bool {
+	return e.Code == http.StatusGone || e.Reason == metav1.StatusReasonExpired || e.Reason == metav1.StatusReasonGone
+}
+
+// Wait blocks until all selected resources are ready or the timeout expires,
+// the result describes the matched resources also if the wait failed
+func (c *WaitOptions) Wait(parent context.Context) (*WaitResult, error) {
+	c.Logger.Info(fmt.Sprintf("armada-go wait, namespace %s labels %s type %s timeout %s",
+		c.Namespace, c.LabelSelector, c.ResourceType, c.Timeout))
+
+	c.recorder = newResultRecorder()
+	var err error
+	if c.kind, err = c.resolve(); err != nil {
+		return c.recorder.result(c, err), err
+	}
+	if c.minReady, err = parseMinReady(c.MinReady); err != nil {
+		return c.recorder.result(c, err), err
+	}
+	err = c.wait(parent)
+	return c.recorder.result(c, err), err
+}
+
+// resolve returns the resource type to watch and how its readiness is
+// evaluated
+func (c *WaitOptions) resolve() (resourceKind, error) {
+	if c.For == "" {
+		return lookupResource(c.ResourceType)
+	}
+	ready, err := ParseFor(c.For)
+	if err != nil {
+		return resourceKind{}, err
+	}
+	kind, err := lookupResource(c.ResourceType)
+	if err != nil {
+		if kind.gvr, err = discoverResource(c.RestConfig, c.ResourceType); err != nil {
+			return resourceKind{}, err
+		}
+	}
+	kind.ready = ready
+	return kind, nil
+}
+
+func (c *WaitOptions) wait(parent context.Context) error {
+	resClient := dynamic.NewForConfigOrDie(c.RestConfig).Resource(c.kind.gvr).Namespace(c.Namespace)
+
+	ctx, cancel := watchtools.ContextWithOptionalTimeout(parent, c.Timeout)
+	defer cancel()
+
+	// only ArmadaCharts are reconciled by armada-operator
+	operatorTimeout := c.OperatorTimeout
+	if operatorTimeout == 0 {
+		operatorTimeout = DefaultOperatorTimeout
+	}
+	if c.kind.gvr.Resource != ArmadaCharts {
+		operatorTimeout = -1
+	}
+	c.stall = newStallDetector(operatorTimeout)
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	if operatorTimeout > 0 {
+		go c.stall.run(ctx, stop)
+	}
+	go c.reportProgress(ctx)
+
+	retries := newRetrier()
+	for {
+		err := c.listAndWatch(ctx, resClient, retries)
+		if expired(err) {
+			c.Logger.Info("watch expired, listing resources again", "reason", err.Error())
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			if cause := context.Cause(ctx); errors.Is(cause, ErrOperatorNotReconciling) {
+				return cause
+			}
+			// charts still unobserved at the timeout point at the operator
+			if stalled := c.stall.check(0); stalled != nil && operatorTimeout > 0 && parent.Err() == nil {
+				return stalled
+			}
+			if parent.Err() == nil {
+				c.reportEvents(parent)
+			}
+			err := fmt.Errorf("timed out waiting for %s with labels %s in namespace %s",
+				c.ResourceType, c.LabelSelector, c.Namespace)
+			if len(c.Observers) > 0 {
+				res := c.recorder.result(c, err)
+				for _, o := range c.Observers {
+					o.OnTimeout(res)
+				}
+			}
+			return err
+		}
+		if err != nil {
+			c.Logger.Info("listing resources failed, retrying", "error", err.Error(), "attempt", retries.attempts+1)
+			if rErr := retries.retry(ctx, err); rErr != nil {
+				return rErr
+			}
+			continue
+		}
+		return nil
+	}
+}
+
+// reportProgress logs a summary of the wait every ProgressInterval until ctx
+// is done
+func (c *WaitOptions) reportProgress(ctx context.Context) {
+	interval := c.ProgressInterval
+	if interval == 0 {
+		interval = DefaultProgressInterval
+	}
+	if interval < 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Logger.Info(c.recorder.summary(c))
+		}
+	}
+}
+
+// listAndWatch lists the resources and watches them until they are ready. A
+// watch closed by the API server or broken by the network is opened again
+// from the last seen resource version, so the list isn't repeated.
+func (c *WaitOptions) listAndWatch(ctx context.Context, resClient dynamic.ResourceInterface, retries *retrier) error {
+	list, err := resClient.List(ctx, metav1.ListOptions{LabelSelector: c.LabelSelector})
+	if err != nil {
+		return err
+	}
+
+	store := newReadyStore(len(list.Items))
+	for i := range list.Items {
+		c.update(store, &list.Items[i])
+	}
+	if c.allReady(store) {
+		return nil
+	}
+
+	resourceVersion := list.GetResourceVersion()
+	for {
+		started := time.Now()
+		w, err := resClient.Watch(ctx, metav1.ListOptions{
+			LabelSelector:       c.LabelSelector,
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err == nil {
+			_, err = watchtools.UntilWithoutRetry(ctx, w, func(event watch.Event) (bool, error) {
+				if obj, ok := event.Object.(*unstructured.Unstructured); ok && event.Type != watch.Error {
+					resourceVersion = obj.GetResourceVersion()
+				}
+				return c.processEvent(store, event)
+			})
+			if err == nil {
+				return nil
+			}
+			if time.Since(started) > watchHealthyAfter {
+				retries.reset()
+			}
+		}
+		if ctx.Err() != nil || !transient(err) || expired(err) {
+			return err
+		}
+		c.Logger.Info("watch interrupted, watching again", "error", err.Error(),
+			"resource_version", resourceVersion, "attempt", retries.attempts+1)
+		if rErr := retries.retry(ctx, err); rErr != nil {
+			return rErr
+		}
+	}
+}
+
+// readyStore tracks readiness of the selected objects, the number of objects
+// not ready is kept up to date on every event so checking whether all of
+// them are ready doesn't have to scan the store
+type readyStore struct {
+	ready    map[string]bool
+	notReady int
+}
+
+// objectKey identifies obj in the stores of a wait, the wait may watch all
+// namespaces so names alone aren't unique
+func objectKey(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func newReadyStore(size int) *readyStore {
+	return &readyStore{ready: make(map[string]bool, size)}
+}
+
+func (s *readyStore) set(key string, ready bool) {
+	if prev, ok := s.ready[key]; ok && !prev {
+		s.notReady--
+	}
+	s.ready[key] = ready
+	if !ready {
+		s.notReady++
+	}
+}
+
+func (s *readyStore) remove(key string) {
+	if prev, ok := s.ready[key]; ok && !prev {
+		s.notReady--
+	}
+	delete(s.ready, key)
+}
+
+func (c *WaitOptions) update(store *readyStore, obj *unstructured.Unstructured) {
+	c.stall.observe(obj)
+	ready, reason := c.kind.ready(obj)
+	rr, changed := c.recorder.set(obj, ready, reason)
+	if changed {
+		for _, o := range c.Observers {
+			if ready {
+				o.OnResourceReady(rr)
+			} else {
+				o.OnResourceUnready(rr)
+			}
+		}
+	}
+	if !ready {
+		c.Logger.V(1).Info(fmt.Sprintf("waiting for %s %s: %s", c.ResourceType, obj.GetName(), reason))
+	}
+	store.set(objectKey(obj), ready)
+}
+
+func (c *WaitOptions) processEvent(store *readyStore, event watch.Event) (bool, error) {
+	if event.Type == watch.Error {
+		return false, decodeError(event.Object)
+	}
+
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	if !ok {
+		return false, fmt.Errorf("unexpected object type %T", event.Object)
+	}
+	c.Logger.V(1).Info("received event", "type", event.Type, "name", obj.GetName())
+
+	switch event.Type {
+	case watch.Bookmark:
+		return false, nil
+	case watch.Added, watch.Modified:
+		c.update(store, obj)
+	case watch.Deleted:
+		key := objectKey(obj)
+		c.stall.remove(key)
+		c.recorder.remove(key)
+		store.remove(key)
+	}
+	return c.allReady(store), nil
+}
+
+func (c *WaitOptions) allReady(store *readyStore) bool {
+	total := len(store.ready)
+	if total == 0 || store.notReady > 0 && total-store.notReady < c.minReady.required(total) {
+		return false
+	}
+	if store.notReady > 0 {
+		c.Logger.Info(fmt.Sprintf("%d of %d %s with labels %s are ready, min ready %s reached",
+			total-store.notReady, total, c.ResourceType, c.LabelSelector, c.minReady))
+		return true
+	}
+	c.Logger.Info(fmt.Sprintf("all %s with labels %s are ready", c.ResourceType, c.LabelSelector))
+	return true
+}
+
+// IsReady returns whether the ArmadaChart reports Ready for its current
+// generation and the reason if it does not
+func IsReady(obj *unstructured.Unstructured) (bool, string) {
+	if reason := generationObserved(obj); reason != "" {
+		return false, reason
+	}
+	status, message, found := condition(obj, "Ready")
+	if !found {
+		return false, "ready condition is not reported yet"
+	}
+	if status == string(metav1.ConditionTrue) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("not ready: %s", message)
+}
+
+// expired returns whether the resources have to be listed again because the
+// watched resource version is too old
+func expired(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Expired()
+	}
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+func decodeError(obj runtime.Object) error {
+	var status metav1.Status
+	switch o := obj.(type) {
+	case *metav1.Status:
+		status = *o
+	case *unstructured.Unstructured:
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.Object, &status); err != nil {
+			return fmt.Errorf("unable to decode watch error %v: %w", o.Object, err)
+		}
+	default:
+		return fmt.Errorf("unexpected watch error object %T: %v", obj, obj)
+	}
+	return &APIError{Code: status.Code, Reason: status.Reason, Message: status.Message}
+}
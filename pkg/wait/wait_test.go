@@ -0,0 +1,88 @@
+/*
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     https://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package wait
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func pod(namespace, name string, ready bool) *unstructured.Unstructured {
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]any{"namespace": namespace, "name": name},
+		"status": map[string]any{
+			"phase":      "Running",
+			"conditions": []any{map[string]any{"type": "Ready", "status": status}},
+		},
+	}}
+}
+
+func TestSameNameInNamespaces(t *testing.T) {
+	kind, err := lookupResource("pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &WaitOptions{
+		Logger:   logr.Discard(),
+		kind:     kind,
+		stall:    newStallDetector(-1),
+		recorder: newResultRecorder(),
+	}
+	store := newReadyStore(2)
+
+	steps := []struct {
+		event watch.Event
+		ready bool
+	}{
+		{watch.Event{Type: watch.Added, Object: pod("openstack", "mariadb-0", true)}, true},
+		{watch.Event{Type: watch.Added, Object: pod("osh-infra", "mariadb-0", false)}, false},
+		{watch.Event{Type: watch.Modified, Object: pod("openstack", "mariadb-0", true)}, false},
+		{watch.Event{Type: watch.Deleted, Object: pod("openstack", "mariadb-0", true)}, false},
+		{watch.Event{Type: watch.Modified, Object: pod("osh-infra", "mariadb-0", true)}, true},
+	}
+	for i, step := range steps {
+		ready, err := c.processEvent(store, step.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ready != step.ready {
+			t.Errorf("step %d: got ready %t, want %t", i, ready, step.ready)
+		}
+	}
+
+	res := c.recorder.result(c, nil)
+	if len(res.Resources) != 2 {
+		t.Fatalf("got %d resources, want 2", len(res.Resources))
+	}
+	for i, want := range []ResourceResult{
+		{Namespace: "openstack", Name: "mariadb-0", Ready: true, Deleted: true},
+		{Namespace: "osh-infra", Name: "mariadb-0", Ready: true},
+	} {
+		got := res.Resources[i]
+		if got.Namespace != want.Namespace || got.Name != want.Name || got.Ready != want.Ready ||
+			got.Deleted != want.Deleted {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+}